@@ -7,6 +7,13 @@ import (
 	"github.com/adamveld12/tai/internal/cli"
 )
 
+// Set at build time with -ldflags "-X main.version=... -X main.commit=... -X main.date=..."
+var (
+	version = cli.DefaultVersion
+	commit  = cli.DefaultCommit
+	date    = cli.DefaultDate
+)
+
 func main() {
 	// Parse command line arguments
 	config, err := cli.ParseArgs()
@@ -21,6 +28,26 @@ func main() {
 		os.Exit(0)
 	}
 
+	if config.Version {
+		fmt.Println(cli.FormatVersion(version, commit, date))
+		os.Exit(0)
+	}
+
+	if config.Completion != "" {
+		script, err := cli.CompletionScript(config.Completion)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(script)
+		os.Exit(0)
+	}
+
+	if config.PrintConfig {
+		fmt.Print(cli.FormatSettings(config.Effective()))
+		os.Exit(0)
+	}
+
 	var handler cli.Executor
 
 	// Execute based on mode
@@ -36,6 +63,6 @@ func main() {
 
 	if err := handler.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error running %v: %v\n", config.Mode, err)
-		os.Exit(1)
+		os.Exit(cli.ExitCode(err))
 	}
 }
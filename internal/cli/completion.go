@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/adamveld12/tai/internal/llm"
+	"github.com/adamveld12/tai/internal/ui"
+)
+
+// CompletionShells are the shells -completion writes scripts for
+var CompletionShells = []string{"bash", "zsh", "fish"}
+
+// completionFlag is a flag as the completion scripts describe it
+type completionFlag struct {
+	name, usage string
+	takesValue  bool
+	// values are the flag's possible values, if it has a fixed set of them
+	values []string
+	// files and dirs complete the flag's value with file or directory names
+	files, dirs bool
+}
+
+// fileFlags and dirFlags take paths, which are completed from the file system
+var (
+	fileFlags = []string{"f", "file", "system-file", "tools", "config"}
+	dirFlags  = []string{"dir"}
+)
+
+// completionValues are the values offered for the flags that have a fixed set of them
+func completionValues() map[string][]string {
+	registered := llm.RegisteredProviders()
+	providers := make([]string, len(registered))
+	for i, p := range registered {
+		providers[i] = string(p)
+	}
+
+	return map[string][]string{
+		"provider":   providers,
+		"theme":      slices.Sorted(slices.Values(ui.ThemeManagerInstance.ListThemes())),
+		"output":     {string(OutputText), string(OutputJSON)},
+		"completion": CompletionShells,
+	}
+}
+
+// completionFlags describes every flag tai accepts, sorted by name
+func completionFlags() []completionFlag {
+	values := completionValues()
+
+	var flags []completionFlag
+	newFlagSet(&Config{}, new(bool), "").VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			name:       f.Name,
+			usage:      f.Usage,
+			takesValue: !ok || !b.IsBoolFlag(),
+			values:     values[f.Name],
+			files:      slices.Contains(fileFlags, f.Name),
+			dirs:       slices.Contains(dirFlags, f.Name),
+		})
+	})
+	return flags
+}
+
+// CompletionScript returns the script that completes tai's flags and their values in
+// shell, one of CompletionShells
+func CompletionScript(shell string) (string, error) {
+	flags := completionFlags()
+	switch shell {
+	case "bash":
+		return bashCompletion(flags), nil
+	case "zsh":
+		return zshCompletion(flags), nil
+	case "fish":
+		return fishCompletion(flags), nil
+	default:
+		return "", fmt.Errorf("no completion for %q, must be one of %s", shell, strings.Join(CompletionShells, ", "))
+	}
+}
+
+func bashCompletion(flags []completionFlag) string {
+	var b strings.Builder
+	b.WriteString(`# bash completion for tai, load it with: source <(tai -completion bash)
+_tai() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    case "$prev" in
+`)
+	for _, f := range flags {
+		if !f.takesValue {
+			continue
+		}
+		fmt.Fprintf(&b, "        -%s|--%s)\n", f.name, f.name)
+		switch {
+		case f.values != nil:
+			fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(f.values, " "))
+		case f.files:
+			b.WriteString("            COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+		case f.dirs:
+			b.WriteString("            COMPREPLY=($(compgen -d -- \"$cur\"))\n")
+		default:
+			b.WriteString("            COMPREPLY=()\n")
+		}
+		b.WriteString("            return ;;\n")
+	}
+
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "-" + f.name
+	}
+	fmt.Fprintf(&b, `    esac
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W %q -- "$cur"))
+    fi
+}
+complete -o default -F _tai tai
+`, strings.Join(names, " "))
+	return b.String()
+}
+
+func zshCompletion(flags []completionFlag) string {
+	var b strings.Builder
+	b.WriteString(`#compdef tai
+# zsh completion for tai, load it with: source <(tai -completion zsh)
+_tai() {
+    _arguments \
+`)
+	for _, f := range flags {
+		spec := fmt.Sprintf("-%s[%s]", f.name, zshEscape(f.usage))
+		if f.takesValue {
+			switch {
+			case f.values != nil:
+				spec += fmt.Sprintf(":%s:(%s)", f.name, strings.Join(f.values, " "))
+			case f.files:
+				spec += fmt.Sprintf(":%s:_files", f.name)
+			case f.dirs:
+				spec += fmt.Sprintf(":%s:_directories", f.name)
+			default:
+				spec += fmt.Sprintf(":%s: ", f.name)
+			}
+		}
+		fmt.Fprintf(&b, "        '%s' \\\n", spec)
+	}
+	b.WriteString(`        '*:prompt:'
+}
+compdef _tai tai
+`)
+	return b.String()
+}
+
+// zshEscape escapes a flag's usage for a single quoted _arguments description
+func zshEscape(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func fishCompletion(flags []completionFlag) string {
+	var b strings.Builder
+	b.WriteString("# fish completion for tai, load it with: tai -completion fish | source\n")
+	b.WriteString("complete -c tai -f\n")
+	for _, f := range flags {
+		line := fmt.Sprintf("complete -c tai -o %s -d '%s'", f.name, strings.ReplaceAll(f.usage, "'", `\'`))
+		if f.takesValue {
+			switch {
+			case f.values != nil:
+				line += fmt.Sprintf(" -x -a '%s'", strings.Join(f.values, " "))
+			case f.files:
+				line += " -r -F"
+			case f.dirs:
+				line += " -x -a '(__fish_complete_directories)'"
+			default:
+				line += " -x"
+			}
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
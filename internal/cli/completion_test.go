@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/llm"
+	"github.com/adamveld12/tai/internal/ui"
+)
+
+func TestCompletionScript(t *testing.T) {
+	flags := []string{"provider", "model", "oneshot", "theme", "output", "dir", "f", "file", "completion", "version"}
+	var values []string
+	for _, p := range llm.SupportedProviders {
+		values = append(values, string(p))
+	}
+	values = append(values, ui.ThemeManagerInstance.ListThemes()...)
+
+	for _, shell := range CompletionShells {
+		t.Run(shell, func(t *testing.T) {
+			script, err := CompletionScript(shell)
+			if err != nil {
+				t.Fatalf("CompletionScript() error = %v", err)
+			}
+
+			for _, name := range flags {
+				// fish names single dash options with -o
+				want := "-" + name
+				if shell == "fish" {
+					want = "-o " + name
+				}
+				if !strings.Contains(script, want+" ") && !strings.Contains(script, want+"|") && !strings.Contains(script, want+"[") {
+					t.Errorf("Expected the %s script to complete %s", shell, want)
+				}
+			}
+			for _, value := range values {
+				if !strings.Contains(script, value) {
+					t.Errorf("Expected the %s script to offer %q", shell, value)
+				}
+			}
+
+			// the script has to at least parse in the shell it's for, when that's installed
+			path, err := exec.LookPath(shell)
+			if err != nil {
+				return
+			}
+			file := filepath.Join(t.TempDir(), "tai."+shell)
+			if err := os.WriteFile(file, []byte(script), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := exec.Command(path, "-n", file).CombinedOutput(); err != nil {
+				t.Errorf("%s -n failed: %v\n%s", shell, err, out)
+			}
+		})
+	}
+
+	if _, err := CompletionScript("tcsh"); err == nil {
+		t.Error("Expected an unsupported shell to be rejected")
+	}
+}
+
+func TestParseArgs_Completion(t *testing.T) {
+	config, err := parseArgs([]string{"-completion", "zsh"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if config.Completion != "zsh" {
+		t.Errorf("Completion = %q, want zsh", config.Completion)
+	}
+
+	if _, err := parseArgs([]string{"-completion", "tcsh"}); err == nil {
+		t.Error("Expected an unsupported shell to be rejected")
+	}
+}
+
+func TestParseArgs_Theme(t *testing.T) {
+	config, err := parseArgs([]string{"-theme", "dark"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if config.Theme != "dark" || config.Source("theme") != SourceFlag {
+		t.Errorf("Theme = %q from %s, want dark from the flag", config.Theme, config.Source("theme"))
+	}
+}
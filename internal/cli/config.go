@@ -1,9 +1,20 @@
 package cli
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adamveld12/tai/internal/llm"
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/adamveld12/tai/internal/ui"
 )
 
 // Mode represents the execution mode of the application
@@ -16,17 +27,385 @@ const (
 
 // Config holds the configuration for the CLI application
 type Config struct {
-	WorkingDirectory string
-	Mode             Mode
-	Prompt           string
-	SystemPrompt     string
-	Verbose          bool
-	Help             bool
-	Provider         string
+	WorkingDirectory  string
+	Mode              Mode
+	Prompt            string
+	PromptFile        string
+	SystemPrompt      string
+	SystemFile        string
+	Verbose           bool
+	Help              bool
+	Version           bool
+	Provider          string
+	Model             string
+	APIKey            string
+	BaseURL           string
+	AutosaveInterval  time.Duration
+	StallWarning      time.Duration
+	Timeout           time.Duration
+	NoAltScreen       bool
+	ConfirmTokens     int
+	Yes               bool
+	MaxSessions       int
+	PrintConfig       bool
+	Session           string
+	EmitToolCalls     bool
+	MaxToolIterations int
+	ReviewPlan        bool
+	UserMarkdown      bool
+	NoColor           bool
+	ToolsFile         string
+	Temperature       *float64
+	TopP              *float64
+	MaxTokens         int
+	PresencePenalty   *float64
+	FrequencyPenalty  *float64
+	Stop              []string
+	Seed              *int
+	JSON              bool
+	Output            OutputFormat
+	ConfigFile        string
+	Theme             string
+	Completion        string
+	Stream            bool
+	ContextBudget     int
+
+	// ProviderParams holds per-provider parameter profiles layered over llm.DefaultParams
+	ProviderParams map[string]state.ModelParams
+
+	// sources records where each setting that didn't come from its default was set, keyed by flag name
+	sources map[string]Source
+}
+
+// OutputFormat is how one-shot mode prints the response
+type OutputFormat string
+
+const (
+	// OutputText prints only the response's content
+	OutputText OutputFormat = "text"
+	// OutputJSON prints the content along with the model, token usage and duration as a JSON object
+	OutputJSON OutputFormat = "json"
+)
+
+// Source is where a configuration value came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFlag    Source = "flag"
+	SourceEnv     Source = "env"
+	SourceFile    Source = "file"
+)
+
+// Setting is a resolved configuration value and where it came from
+type Setting struct {
+	Name   string
+	Value  string
+	Source Source
+}
+
+// Source returns where the setting called name was resolved from
+func (c *Config) Source(name string) Source {
+	if source, ok := c.sources[name]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// setSource records that the setting called name was resolved from source
+func (c *Config) setSource(name string, source Source) {
+	if c.sources == nil {
+		c.sources = make(map[string]Source)
+	}
+	c.sources[name] = source
+}
+
+// Effective returns the fully resolved configuration, including the provider settings
+// that are only filled in when the provider is built. API keys are redacted.
+func (c *Config) Effective() []Setting {
+	provider := c.Provider
+	if provider == "" {
+		provider = string(llm.ProviderLMStudio)
+	}
+	p := llm.SupportedProvider(provider)
+
+	apiKey := Setting{Name: "api-key", Value: "(not required)", Source: SourceDefault}
+	if c.APIKey != "" {
+		apiKey.Value, apiKey.Source = redact(c.APIKey), c.Source("api-key")
+	} else if env, ok := llm.APIKeyEnvs[p]; ok {
+		apiKey.Value = redact(os.Getenv(env))
+		if apiKey.Value != "" {
+			apiKey.Source = SourceEnv
+		} else {
+			apiKey.Value = "(unset)"
+		}
+	}
+
+	baseURL := Setting{Name: "base-url", Value: llm.DefaultBaseURLs[p], Source: SourceDefault}
+	if c.BaseURL != "" {
+		baseURL.Value, baseURL.Source = c.BaseURL, c.Source("base-url")
+	} else if env, ok := llm.BaseURLEnvs[p]; ok && os.Getenv(env) != "" {
+		baseURL.Value, baseURL.Source = os.Getenv(env), SourceEnv
+	}
+
+	model := Setting{Name: "model", Value: c.Model, Source: c.Source("model")}
+	if c.Model == "" {
+		model.Value = llm.DefaultModels[p]
+	}
+
+	theme := c.Theme
+	if theme == "" {
+		theme = ui.DefaultTheme
+	}
+
+	systemPrompt := strconv.Quote(c.SystemPrompt)
+	if c.SystemPrompt == "" {
+		systemPrompt = "(built-in)"
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = llm.DefaultTimeout
+	}
+
+	params := c.ParamsFor(provider)
+	profile := c.ProviderParams[provider]
+	paramSource := func(flag string, set bool) Source {
+		if c.Source(flag) == SourceFlag {
+			return SourceFlag
+		}
+		if set {
+			return SourceFile
+		}
+		return SourceDefault
+	}
+
+	return []Setting{
+		{"provider", provider, c.Source("provider")},
+		model,
+		baseURL,
+		apiKey,
+		{"temperature", formatParam(params.Temperature), paramSource("temperature", profile.Temperature != nil)},
+		{"top-p", formatParam(params.TopP), paramSource("top-p", profile.TopP != nil)},
+		{"presence-penalty", formatParam(params.PresencePenalty), paramSource("presence-penalty", profile.PresencePenalty != nil)},
+		{"frequency-penalty", formatParam(params.FrequencyPenalty), paramSource("frequency-penalty", profile.FrequencyPenalty != nil)},
+		{"stop", strings.Join(stopQuoted(c.Stop), ", "), c.Source("stop")},
+		{"seed", optionalInt{&c.Seed}.String(), c.Source("seed")},
+		{"max-tokens", strconv.Itoa(params.MaxTokens), paramSource("max-tokens", profile.MaxTokens != 0)},
+		{"timeout", timeout.String(), c.Source("timeout")},
+		{"system", systemPrompt, c.Source("system")},
+		{"dir", c.WorkingDirectory, c.Source("dir")},
+		{"autosave-interval", c.AutosaveInterval.String(), c.Source("autosave-interval")},
+		{"stall-warning", c.StallWarning.String(), c.Source("stall-warning")},
+		{"context-budget", strconv.Itoa(c.ContextBudget), c.Source("context-budget")},
+		{"confirm-tokens", strconv.Itoa(c.ConfirmTokens), c.Source("confirm-tokens")},
+		{"session", c.Session, c.Source("session")},
+		{"max-sessions", strconv.Itoa(c.MaxSessions), c.Source("max-sessions")},
+		{"no-altscreen", strconv.FormatBool(c.NoAltScreen), c.Source("no-altscreen")},
+		{"user-markdown", strconv.FormatBool(c.UserMarkdown), c.Source("user-markdown")},
+		{"no-color", strconv.FormatBool(c.NoColor), c.Source("no-color")},
+		{"yes", strconv.FormatBool(c.Yes), c.Source("yes")},
+		{"config", c.ConfigFile, c.Source("config")},
+		{"theme", theme, c.Source("theme")},
+		{"tools", c.ToolsFile, c.Source("tools")},
+		{"stream", strconv.FormatBool(c.Stream), c.Source("stream")},
+		{"json", strconv.FormatBool(c.JSON), c.Source("json")},
+		{"output", string(c.Output), c.Source("output")},
+		{"emit-tool-calls", strconv.FormatBool(c.EmitToolCalls), c.Source("emit-tool-calls")},
+		{"max-tool-iterations", strconv.Itoa(c.MaxToolIterations), c.Source("max-tool-iterations")},
+		{"review-plan", strconv.FormatBool(c.ReviewPlan), c.Source("review-plan")},
+		{"verbose", strconv.FormatBool(c.Verbose), c.Source("verbose")},
+	}
+}
+
+// FormatSettings renders settings as an aligned name, value and source table
+func FormatSettings(settings []Setting) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, s := range settings {
+		fmt.Fprintf(w, "%s\t%s\t(%s)\n", s.Name, s.Value, s.Source)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// stopQuoted quotes stop sequences so whitespace and newlines stay visible
+func stopQuoted(stop []string) []string {
+	quoted := make([]string, len(stop))
+	for i, s := range stop {
+		quoted[i] = strconv.Quote(s)
+	}
+	return quoted
+}
+
+// formatParam renders a sampling parameter, empty when it is left to the provider
+func formatParam(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'g', -1, 64)
+}
+
+// redact hides a secret, keeping only whether it's set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// flagParams are the sampling parameters given on the command line
+func (c *Config) flagParams() state.ModelParams {
+	return state.ModelParams{
+		Temperature:      c.Temperature,
+		TopP:             c.TopP,
+		MaxTokens:        c.MaxTokens,
+		PresencePenalty:  c.PresencePenalty,
+		FrequencyPenalty: c.FrequencyPenalty,
+	}
+}
+
+// ParamsFor returns the default parameters for provider: the built-in defaults
+// with the provider's configured profile and then the command line flags applied on top
+func (c *Config) ParamsFor(provider string) state.ModelParams {
+	if provider == "" {
+		provider = string(llm.ProviderLMStudio)
+	}
+	return llm.DefaultParams[llm.SupportedProvider(provider)].Merge(c.ProviderParams[provider]).Merge(c.flagParams())
+}
+
+// ProviderConfig returns the configuration the selected provider is built with
+func (c *Config) ProviderConfig() llm.ProviderConfig {
+	config := llm.DefaultProviderConfig()
+	config.DefaultModel = c.Model
+	config.APIKey = c.APIKey
+	config.BaseURL = c.BaseURL
+	config.ContextBudget = c.ContextBudget
+	config.Timeout = c.Timeout
+	if c.Verbose {
+		// the standard logger, so the REPL can move it off the terminal it draws on
+		config.Logger = log.Default()
+	}
+	return config
+}
+
+// DefaultConfirmTokens is the estimated prompt size above which tai asks before sending
+const DefaultConfirmTokens = 32000
+
+// SystemPromptEnv is the environment variable consulted for the system prompt
+// when one isn't given on the command line
+const SystemPromptEnv = "TAI_SYSTEM_PROMPT"
+
+// stringList is a flag that collects every value it's given
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// optionalInt is an int flag that stays nil until it's given, for values where 0 is meaningful
+type optionalInt struct {
+	dst **int
+}
+
+func (o optionalInt) String() string {
+	if o.dst == nil || *o.dst == nil {
+		return ""
+	}
+	return strconv.Itoa(**o.dst)
+}
+
+func (o optionalInt) Set(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*o.dst = &n
+	return nil
+}
+
+// optionalFloat is a float flag that stays nil until it's given, so an explicit 0 is kept
+type optionalFloat struct {
+	dst **float64
+}
+
+func (o optionalFloat) String() string {
+	if o.dst == nil {
+		return ""
+	}
+	return formatParam(*o.dst)
+}
+
+func (o optionalFloat) Set(value string) error {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	*o.dst = &f
+	return nil
+}
+
+// newFlagSet defines every command line flag, parsing into config and oneshot. wd is the
+// default of -dir.
+func newFlagSet(config *Config, oneshot *bool, wd string) *flag.FlagSet {
+	flags := flag.NewFlagSet("tai", flag.ContinueOnError)
+	flags.BoolVar(oneshot, "oneshot", false, "Run in one-shot mode (single prompt and exit)")
+	flags.BoolVar(&config.Verbose, "verbose", false, "Log the requests sent to the provider and its responses, with API keys redacted")
+	flags.BoolVar(&config.Help, "help", false, "Show help message")
+	flags.BoolVar(&config.Version, "version", false, "Print the version and exit")
+	flags.StringVar(&config.Provider, "provider", "lmstudio", "Specify the LLM provider to use (e.g., lmstudio, ollama, claude, openai, gemini)")
+	flags.StringVar(&config.Model, "model", "", "Specify the model to use (default: the provider's default model)")
+	flags.StringVar(&config.APIKey, "api-key", "", "API key for the provider (default: $OPENAI_API_KEY, $ANTHROPIC_API_KEY or $GEMINI_API_KEY)")
+	flags.StringVar(&config.BaseURL, "base-url", "", "Base URL of the provider's API (default: $OPENAI_BASE_URL or $LMSTUDIO_BASE_URL)")
+	flags.StringVar(&config.PromptFile, "f", "", "Read the one-shot prompt from this file, - reads it from stdin even from a terminal")
+	flags.StringVar(&config.PromptFile, "file", "", "Same as -f")
+	flags.StringVar(&config.SystemPrompt, "system", "", "Specify the system prompt to use")
+	flags.StringVar(&config.SystemFile, "system-file", "", "Read the system prompt from this file")
+	flags.Var(optionalFloat{&config.Temperature}, "temperature", "Sampling temperature between 0 and 2 (default: the provider's)")
+	flags.Var(optionalFloat{&config.TopP}, "top-p", "Nucleus sampling probability mass between 0 and 1 (default: the provider's)")
+	flags.Var(optionalFloat{&config.PresencePenalty}, "presence-penalty", "Penalize tokens that already appeared, between -2 and 2 (default: the provider's)")
+	flags.Var(optionalFloat{&config.FrequencyPenalty}, "frequency-penalty", "Penalize tokens by how often they already appeared, between -2 and 2 (default: the provider's)")
+	flags.IntVar(&config.MaxTokens, "max-tokens", 0, "Maximum tokens to generate (default: the provider's)")
+	flags.Var(optionalInt{&config.Seed}, "seed", "Sampling seed so one-shot responses can be reproduced (default: random)")
+	flags.Var((*stringList)(&config.Stop), "stop", "Stop generating at this sequence in one-shot mode (repeatable)")
+	flags.StringVar(&config.WorkingDirectory, "dir", wd, "Set the working directory (default: current directory)")
+	flags.DurationVar(&config.AutosaveInterval, "autosave-interval", state.DefaultAutosaveInterval, "Minimum time between session saves to disk")
+	flags.BoolVar(&config.NoAltScreen, "no-altscreen", false, "Render the REPL inline so the conversation stays in the terminal scrollback")
+	flags.BoolVar(&config.UserMarkdown, "user-markdown", false, "In the REPL, render your messages as markdown too so code you paste is highlighted")
+	flags.BoolVar(&config.NoColor, "no-color", false, "Turn off colors and text styling (default: on when "+ui.NoColorEnv+" is set)")
+	flags.IntVar(&config.ContextBudget, "context-budget", 0, "Drop the oldest messages so each request is estimated at no more than this many tokens (0 sends everything)")
+	flags.IntVar(&config.ConfirmTokens, "confirm-tokens", DefaultConfirmTokens, "Ask before sending prompts estimated above this many tokens (0 disables)")
+	flags.StringVar(&config.Session, "session", "", "Resume the saved session with this ID")
+	flags.IntVar(&config.MaxSessions, "max-sessions", state.DefaultMaxSessions, "Keep at most this many saved sessions, pruning the oldest (0 keeps all)")
+	flags.BoolVar(&config.Yes, "yes", false, "Send large prompts in one-shot mode without asking")
+	flags.DurationVar(&config.Timeout, "timeout", llm.DefaultTimeout, "Maximum time a request to the provider may take, streaming the reply included")
+	flags.DurationVar(&config.StallWarning, "stall-warning", ui.DefaultStallWarning, "Show a hint when the model streams nothing for this long (0 disables)")
+	flags.BoolVar(&config.EmitToolCalls, "emit-tool-calls", false, "In one-shot mode, print the model's tool calls as JSON and exit instead of running them")
+	flags.IntVar(&config.MaxToolIterations, "max-tool-iterations", ui.DefaultMaxToolIterations, "Maximum rounds of tool calls the agent makes for a single message")
+	flags.BoolVar(&config.ReviewPlan, "review-plan", false, "In the REPL, show each round of tool calls that needs approval as one plan to approve or reject")
+	flags.StringVar(&config.ToolsFile, "tools", "", "JSON file of tool definitions offered to the model in one-shot mode")
+	flags.BoolVar(&config.JSON, "json", false, "In one-shot mode, constrain the response to JSON and fail if it doesn't parse")
+	flags.StringVar((*string)(&config.Output), "output", string(OutputText), "In one-shot mode, print the response as text, or as json with the model, token usage and duration")
+	flags.BoolVar(&config.Stream, "stream", isTerminal(os.Stdout), "In one-shot mode, print the response as it's generated (default: on when stdout is a terminal)")
+	flags.StringVar(&config.Theme, "theme", "", "Color theme of the REPL (default: "+ui.DefaultTheme+")")
+	flags.StringVar(&config.Completion, "completion", "", "Print the shell completion script for bash, zsh or fish, then exit")
+	flags.StringVar(&config.ConfigFile, "config", "", "Read settings from this YAML file (default: ~/.tai/config.yaml)")
+	flags.BoolVar(&config.PrintConfig, "print-config", false, "Print the effective configuration and where each value came from, then exit")
+
+	return flags
 }
 
 // ParseArgs parses command line arguments and returns a Config
 func ParseArgs() (*Config, error) {
+	return parseArgs(os.Args[1:])
+}
+
+func parseArgs(args []string) (*Config, error) {
 	config := &Config{}
 	var oneshot bool
 
@@ -35,29 +414,109 @@ func ParseArgs() (*Config, error) {
 		return nil, fmt.Errorf("failed to get current working directory: %w", err)
 	}
 
-	flag.BoolVar(&oneshot, "oneshot", false, "Run in one-shot mode (single prompt and exit)")
-	flag.BoolVar(&config.Verbose, "verbose", false, "Enable verbose logging")
-	flag.BoolVar(&config.Help, "help", false, "Show help message")
-	flag.StringVar(&config.Provider, "provider", "lmstudio", "Specify the LLM provider to use (e.g., lmstudio)")
-	flag.StringVar(&config.SystemPrompt, "system", "", "Specify the system prompt to use")
-	flag.StringVar(&config.WorkingDirectory, "dir", wd, "Set the working directory (default: current directory)")
+	flags := newFlagSet(config, &oneshot, wd)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		config.setSource(f.Name, SourceFlag)
+	})
+
+	if config.Completion != "" && !slices.Contains(CompletionShells, config.Completion) {
+		return nil, fmt.Errorf("invalid -completion %q: must be one of %s", config.Completion, strings.Join(CompletionShells, ", "))
+	}
+
+	if config.Output != OutputText && config.Output != OutputJSON {
+		return nil, fmt.Errorf("invalid -output %q: must be text or json", config.Output)
+	}
+
+	if config.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid -timeout %s: must be positive", config.Timeout)
+	}
+
+	if err := config.flagParams().Validate(); err != nil {
+		return nil, fmt.Errorf("invalid sampling flags: %w", err)
+	}
+
+	if config.SystemFile != "" {
+		if config.Source("system") == SourceFlag {
+			return nil, errors.New("-system and -system-file can't both be given")
+		}
+		data, err := os.ReadFile(config.SystemFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read system prompt file: %w", err)
+		}
+		if config.SystemPrompt = strings.TrimSpace(string(data)); config.SystemPrompt == "" {
+			return nil, fmt.Errorf("system prompt file %s is empty", config.SystemFile)
+		}
+		config.setSource("system", SourceFlag)
+	}
 
-	flag.Parse()
+	// an explicit -system or -system-file flag wins over the environment, and both over the config file
+	if config.SystemPrompt == "" {
+		if config.SystemPrompt = os.Getenv(SystemPromptEnv); config.SystemPrompt != "" {
+			config.setSource("system", SourceEnv)
+		}
+	}
+
+	// NO_COLOR only has to be set, whatever its value, and -no-color=false overrides it
+	if config.Source("no-color") == SourceDefault && os.Getenv(ui.NoColorEnv) != "" {
+		config.NoColor = true
+		config.setSource("no-color", SourceEnv)
+	}
+
+	// a missing file is only fine at the default location, an explicit -config has to exist
+	path := config.ConfigFile
+	if path == "" {
+		if path, err = DefaultConfigPath(); err != nil {
+			path = ""
+		}
+	} else if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if path != "" {
+		file, err := LoadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		config.ConfigFile = path
+		config.applyFile(file)
+	}
 
 	if oneshot {
 		config.Mode = ModeOneShot
-		// Get input from remaining args or stdin
-		args := flag.Args()
-		if len(args) > 0 {
-			config.Prompt = args[0]
+		// the words of an unquoted prompt arrive as separate arguments
+		config.Prompt = strings.Join(flags.Args(), " ")
+		if config.Prompt, err = expandMentions(config.Prompt, config.WorkingDirectory); err != nil {
+			return nil, err
+		}
+
+		// a prompt argument comes before the file, and stdin is added after both when it's run
+		if config.PromptFile != "" && config.PromptFile != "-" {
+			data, err := os.ReadFile(config.PromptFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read prompt file: %w", err)
+			}
+			config.Prompt = combinePrompt(config.Prompt, string(data))
 		}
 	} else {
 		config.Mode = ModeREPL
+		if args := flags.Args(); len(args) == 1 && args[0] == "version" {
+			config.Version = true
+		}
 	}
 
 	return config, nil
 }
 
+// promptFromStdin reports whether -f - asked for the prompt to be read from stdin, which
+// is then read even when it's a terminal
+func (c *Config) promptFromStdin() bool {
+	return c != nil && c.PromptFile == "-"
+}
+
 // ShowHelp displays the help message
 func ShowHelp() {
 	fmt.Fprintf(os.Stderr, `TAI - Terminal AI Assistant
@@ -68,19 +527,62 @@ Usage:
 
 Options:
   -oneshot         Run in one-shot mode
-  -verbose         Enable verbose logging
+  -verbose         Log provider requests and responses, API keys redacted (REPL: ~/.tai/debug.log)
   -help            Show this help message
-  -provider        LLM provider to use (default: lmstudio)
-  -system          System prompt to use
+  -version         Print the version and exit (also: tai version)
+  -provider        LLM provider to use: lmstudio, ollama, claude, openai, gemini (default: lmstudio)
+  -model           Model to use (default: the provider's default model)
+  -api-key         API key for the provider (default: $OPENAI_API_KEY, $ANTHROPIC_API_KEY, $GEMINI_API_KEY)
+  -base-url        Base URL of the provider's API (default: $OPENAI_BASE_URL, $LMSTUDIO_BASE_URL)
+  -f, -file        Read the one-shot prompt from a file, - reads it from stdin
+  -system          System prompt to use (default: $TAI_SYSTEM_PROMPT)
+  -system-file     Read the system prompt from a file instead
+  -temperature     Sampling temperature, 0 to 2 (default: the provider's)
+  -top-p           Nucleus sampling probability mass, 0 to 1 (default: the provider's)
+  -presence-penalty   Penalize tokens that already appeared, -2 to 2 (default: the provider's)
+  -frequency-penalty  Penalize tokens by how often they appeared, -2 to 2 (default: the provider's)
+  -max-tokens      Maximum tokens to generate (default: the provider's)
+  -seed            Sampling seed to reproduce a one-shot response (default: random)
+  -stop            Stop generating at this sequence (one-shot, repeatable)
   -dir             Working directory (default: current directory)
+  -autosave-interval  Minimum time between session saves (default: 2s)
+  -no-altscreen    Render inline and keep the conversation in the scrollback on exit
+  -user-markdown   Render your messages as markdown too, highlighting pasted code
+  -no-color        Turn off colors and text styling, also on when NO_COLOR is set
+  -timeout         Maximum time a request may take, streaming included (default: 5m)
+  -stall-warning   Hint when the model streams nothing for this long (default: 20s, 0 disables)
+  -context-budget  Drop the oldest messages to keep each request under this many tokens (default: 0, off)
+  -confirm-tokens  Ask before sending prompts estimated above this many tokens (default: 32000, 0 disables)
+  -session         Resume the saved session with this ID (see ~/.tai/sessions)
+  -max-sessions    Keep at most this many saved sessions, pruning the oldest (default: 100, 0 keeps all)
+  -yes             Skip the large prompt confirmation in one-shot mode
+  -emit-tool-calls Print the model's tool calls as JSON and exit instead of running them (one-shot)
+  -max-tool-iterations  Maximum rounds of tool calls the agent makes per message (default: 10)
+  -tools           JSON file of tool definitions offered to the model (one-shot)
+  -json            Constrain the one-shot response to JSON and fail if it doesn't parse
+  -output          Print the one-shot response as text or json with usage (default: text)
+  -stream          Print the one-shot response as it's generated (default: on when stdout is a terminal)
+  -theme           Color theme of the REPL (default: retro)
+  -completion      Print the completion script for bash, zsh or fish
+  -config          YAML file to read settings from (default: ~/.tai/config.yaml)
+  -print-config    Print the effective configuration and where each value came from
 
 Examples:
   tai                                                    # Start REPL mode
   tai -oneshot "Hello, world!"                           # One-shot with prompt
+  tai -oneshot what is a goroutine                       # One-shot with an unquoted prompt
   echo "Hello" | tai -oneshot                            # One-shot from stdin
   echo "Hello" | tai -oneshot 'what comes after Hello?' # One-shot from stdin with additional prompt
+  tai -oneshot -f prompt.md                              # One-shot with the prompt in a file
+  tai -oneshot "explain @main.go"                        # One-shot with a file inlined, @@ is a literal @
   tai -provider ollama -system "You are a poet"          # REPL with custom provider and system prompt
+  tai -provider ollama -model qwen2.5-coder              # REPL with a specific model
   tai -dir /path/to/project -oneshot "analyze this"     # One-shot with custom working directory
+  cat big.log | tai -oneshot -yes "summarize this"       # One-shot without the large prompt confirmation
+  tai -oneshot -tools tools.json -emit-tool-calls "plan" # Hand the model's tool calls to another program
+  tai -oneshot -json "name 3 colors" | jq .              # Script against JSON output
+  tai -oneshot -output json "hi" | jq .usage             # Token usage of a one-shot prompt
+  source <(tai -completion bash)                         # Tab completion in bash
 
 `)
 }
@@ -0,0 +1,765 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamveld12/tai/internal/llm"
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/adamveld12/tai/internal/ui"
+)
+
+func TestParseArgs_SystemPromptFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		args     []string
+		file     string
+		expected string
+	}{
+		{
+			name:     "env var used when no flag is given",
+			env:      "You are a container bot",
+			args:     []string{},
+			expected: "You are a container bot",
+		},
+		{
+			name:     "explicit flag overrides env var",
+			env:      "You are a container bot",
+			args:     []string{"-system", "You are a poet"},
+			expected: "You are a poet",
+		},
+		{
+			name:     "system file overrides env var",
+			env:      "You are a container bot",
+			file:     "You are a file bot\n",
+			expected: "You are a file bot",
+		},
+		{
+			name:     "built-in default when neither is set",
+			env:      "",
+			args:     []string{},
+			expected: "You are an AI assistant that autonomously writes code and helps the user with programming tasks.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(SystemPromptEnv, tt.env)
+
+			args := tt.args
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "system.md")
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				args = append(args, "-system-file", path)
+			}
+
+			config, err := parseArgs(args)
+			if err != nil {
+				t.Fatalf("parseArgs() error = %v", err)
+			}
+
+			s := state.NewMemoryState(config.SystemPrompt, config.WorkingDirectory, "test").GetState()
+			if s.Context.SystemPrompt != tt.expected {
+				t.Errorf("Context.SystemPrompt = %q, want %q", s.Context.SystemPrompt, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseArgs_NoColor(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		args   []string
+		want   bool
+		source Source
+	}{
+		{"off by default", "", nil, false, SourceDefault},
+		{"flag", "", []string{"-no-color"}, true, SourceFlag},
+		{"NO_COLOR set to anything", "0", nil, true, SourceEnv},
+		{"flag overrides NO_COLOR", "1", []string{"-no-color=false"}, false, SourceFlag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ui.NoColorEnv, tt.env)
+
+			config, err := parseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("parseArgs() error = %v", err)
+			}
+			if config.NoColor != tt.want || config.Source("no-color") != tt.source {
+				t.Errorf("NoColor = %v from %s, want %v from %s", config.NoColor, config.Source("no-color"), tt.want, tt.source)
+			}
+		})
+	}
+}
+
+func TestConfig_ParamsFor(t *testing.T) {
+	config := &Config{
+		ProviderParams: map[string]state.ModelParams{
+			"ollama": {Temperature: state.Float(0.6), MaxTokens: 2048},
+			"claude": {TopP: state.Float(0.9)},
+		},
+	}
+
+	tests := []struct {
+		provider string
+		want     state.ModelParams
+	}{
+		{"", state.ModelParams{Temperature: state.Float(0.8)}},
+		{"lmstudio", state.ModelParams{Temperature: state.Float(0.8)}},
+		{"ollama", state.ModelParams{Temperature: state.Float(0.6), MaxTokens: 2048}},
+		{"claude", state.ModelParams{Temperature: state.Float(0.2), TopP: state.Float(0.9)}},
+		{"unknown", state.ModelParams{}},
+	}
+
+	for _, tt := range tests {
+		if got := config.ParamsFor(tt.provider); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParamsFor(%q) = %+v, want %+v", tt.provider, got, tt.want)
+		}
+	}
+}
+
+func TestConfig_EffectiveSources(t *testing.T) {
+	t.Setenv(SystemPromptEnv, "You are a container bot")
+	t.Setenv(llm.AnthropicAPIKeyEnv, "sk-ant-secret")
+
+	config, err := parseArgs([]string{"-provider", "claude", "-max-sessions", "5"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+
+	settings := map[string]Setting{}
+	for _, s := range config.Effective() {
+		settings[s.Name] = s
+	}
+
+	tests := []struct {
+		name   string
+		value  string
+		source Source
+	}{
+		{"provider", "claude", SourceFlag},
+		{"max-sessions", "5", SourceFlag},
+		{"system", `"You are a container bot"`, SourceEnv},
+		{"api-key", "[redacted]", SourceEnv},
+		{"base-url", llm.DefaultBaseURLs[llm.ProviderClaude], SourceDefault},
+		{"confirm-tokens", "32000", SourceDefault},
+		{"temperature", "0.2", SourceDefault},
+	}
+
+	for _, tt := range tests {
+		got, ok := settings[tt.name]
+		if !ok {
+			t.Errorf("missing setting %q", tt.name)
+			continue
+		}
+		if got.Value != tt.value || got.Source != tt.source {
+			t.Errorf("%s = %q (%s), want %q (%s)", tt.name, got.Value, got.Source, tt.value, tt.source)
+		}
+	}
+
+	if out := FormatSettings(config.Effective()); strings.Contains(out, "sk-ant-secret") {
+		t.Error("Expected the API key to be redacted from the printed configuration")
+	}
+}
+
+func TestConfig_EffectiveProfileSource(t *testing.T) {
+	config := &Config{
+		Provider:       "ollama",
+		ProviderParams: map[string]state.ModelParams{"ollama": {Temperature: state.Float(0.6)}},
+	}
+
+	for _, s := range config.Effective() {
+		switch s.Name {
+		case "temperature":
+			if s.Value != "0.6" || s.Source != SourceFile {
+				t.Errorf("temperature = %q (%s), want %q (%s)", s.Value, s.Source, "0.6", SourceFile)
+			}
+		case "max-tokens":
+			if s.Source != SourceDefault {
+				t.Errorf("max-tokens source = %s, want %s", s.Source, SourceDefault)
+			}
+		}
+	}
+}
+
+func TestParseArgs_Model(t *testing.T) {
+	config, err := parseArgs([]string{"-provider", "ollama", "-model", "qwen2.5-coder"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+
+	if config.Model != "qwen2.5-coder" {
+		t.Errorf("Model = %q, want %q", config.Model, "qwen2.5-coder")
+	}
+	if got := config.ProviderConfig().DefaultModel; got != "qwen2.5-coder" {
+		t.Errorf("ProviderConfig().DefaultModel = %q, want the -model override", got)
+	}
+
+	for _, s := range config.Effective() {
+		if s.Name == "model" && (s.Value != "qwen2.5-coder" || s.Source != SourceFlag) {
+			t.Errorf("model = %q (%s), want %q (%s)", s.Value, s.Source, "qwen2.5-coder", SourceFlag)
+		}
+	}
+
+	// without -model the provider picks its own default
+	config, err = parseArgs([]string{"-provider", "ollama"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if config.Model != "" || config.ProviderConfig().DefaultModel != "" {
+		t.Errorf("Model = %q, want it left to the provider", config.Model)
+	}
+}
+
+func TestParseArgs_SystemFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	prompt := filepath.Join(dir, "system.md")
+	empty := filepath.Join(dir, "empty.md")
+	if err := os.WriteFile(prompt, []byte("You are a file bot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, []byte("\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-system", "You are a poet", "-system-file", prompt}, "can't both be given"},
+		{[]string{"-system-file", filepath.Join(dir, "missing.md")}, "failed to read system prompt file"},
+		{[]string{"-system-file", empty}, "is empty"},
+	}
+	for _, tt := range tests {
+		if _, err := parseArgs(tt.args); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseArgs(%q) error = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestParseArgs_ConfigFilePrecedence(t *testing.T) {
+	t.Setenv(SystemPromptEnv, "")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(`
+provider: ollama
+model: llama3.2
+system_prompt: You are a file bot
+theme: light
+temperature: 0.4
+working_directory: /srv/project
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// file values win over the built-in defaults
+	config, err := parseArgs([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if config.Provider != "ollama" || config.Model != "llama3.2" || config.Theme != "light" || config.WorkingDirectory != "/srv/project" {
+		t.Errorf("config = %+v, want the file's values", config)
+	}
+	if config.SystemPrompt != "You are a file bot" || config.Source("system") != SourceFile {
+		t.Errorf("system = %q (%s), want the file's prompt", config.SystemPrompt, config.Source("system"))
+	}
+	if got := config.ParamsFor("ollama").Temperature; got == nil || *got != 0.4 {
+		t.Errorf("temperature = %v, want the file's 0.4", formatParam(got))
+	}
+
+	// flags win over the file
+	config, err = parseArgs([]string{"-config", path, "-provider", "claude", "-model", "claude-3-5-haiku-latest", "-system", "You are a flag bot"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if config.Provider != "claude" || config.Model != "claude-3-5-haiku-latest" || config.SystemPrompt != "You are a flag bot" {
+		t.Errorf("config = %+v, want the flags to override the file", config)
+	}
+	if config.Source("provider") != SourceFlag || config.Source("theme") != SourceFile {
+		t.Errorf("sources = provider %s, theme %s, want flag and file", config.Source("provider"), config.Source("theme"))
+	}
+
+	// the environment wins over the file too
+	t.Setenv(SystemPromptEnv, "You are an env bot")
+	config, err = parseArgs([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if config.SystemPrompt != "You are an env bot" || config.Source("system") != SourceEnv {
+		t.Errorf("system = %q (%s), want the environment's prompt", config.SystemPrompt, config.Source("system"))
+	}
+
+	// and -system-file over both
+	system := filepath.Join(t.TempDir(), "system.md")
+	if err := os.WriteFile(system, []byte("You are a flag file bot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err = parseArgs([]string{"-config", path, "-system-file", system})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if config.SystemPrompt != "You are a flag file bot" || config.Source("system") != SourceFlag {
+		t.Errorf("system = %q (%s), want the -system-file prompt", config.SystemPrompt, config.Source("system"))
+	}
+}
+
+func TestParseArgs_ConfigFileDefaultModels(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	defaults := write("defaults.yaml", `
+defaults:
+  lmstudio: qwen2.5-coder-7b
+  ollama: llama3.2
+`)
+	withModel := write("model.yaml", `
+model: mistral
+defaults:
+  ollama: llama3.2
+`)
+
+	effectiveModel := func(c *Config) Setting {
+		for _, s := range c.Effective() {
+			if s.Name == "model" {
+				return s
+			}
+		}
+		t.Fatal("no model in Effective()")
+		return Setting{}
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		want   string
+		source Source
+	}{
+		{"the provider's configured default", []string{"-config", defaults, "-provider", "ollama"}, "llama3.2", SourceFile},
+		{"lmstudio when no provider is given", []string{"-config", defaults}, "qwen2.5-coder-7b", SourceFile},
+		{"built-in default without a configured one", []string{"-config", defaults, "-provider", "claude"}, llm.DefaultModels[llm.ProviderClaude], SourceDefault},
+		{"-model wins", []string{"-config", defaults, "-provider", "ollama", "-model", "phi4"}, "phi4", SourceFlag},
+		{"the file's model wins", []string{"-config", withModel, "-provider", "ollama"}, "mistral", SourceFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("parseArgs() error = %v", err)
+			}
+			if got := effectiveModel(config); got.Value != tt.want || got.Source != tt.source {
+				t.Errorf("model = %q (%s), want %q (%s)", got.Value, got.Source, tt.want, tt.source)
+			}
+			if tt.source != SourceDefault && config.ProviderConfig().DefaultModel != tt.want {
+				t.Errorf("ProviderConfig().DefaultModel = %q, want %q", config.ProviderConfig().DefaultModel, tt.want)
+			}
+		})
+	}
+
+	unknown := write("unknown.yaml", "defaults:\n  lmstuido: qwen\n")
+	if _, err := parseArgs([]string{"-config", unknown}); err == nil || !strings.Contains(err.Error(), "lmstuido") {
+		t.Errorf("parseArgs() error = %v, want the unknown provider named", err)
+	}
+}
+
+func TestParseArgs_ConfigFileProviderProfiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	path := write("profiles.yaml", `
+temperature: 0.4
+providers:
+  lmstudio:
+    top_p: 0.8
+  ollama:
+    temperature: 0.2
+    max_tokens: 4096
+`)
+
+	config, err := parseArgs([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	lmstudio := config.ParamsFor("lmstudio")
+	if !reflect.DeepEqual(lmstudio, state.ModelParams{Temperature: state.Float(0.4), TopP: state.Float(0.8)}) {
+		t.Errorf("lmstudio params = %+v, want the file's temperature and its top_p", lmstudio)
+	}
+	ollama := config.ParamsFor("ollama")
+	if !reflect.DeepEqual(ollama, state.ModelParams{Temperature: state.Float(0.2), MaxTokens: 4096}) {
+		t.Errorf("ollama params = %+v, want its own profile", ollama)
+	}
+
+	// a provider's profile wins over the file's temperature, the flags over both
+	config, err = parseArgs([]string{"-config", path, "-provider", "ollama", "-max-tokens", "100"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if got := config.ParamsFor("ollama"); !reflect.DeepEqual(got, state.ModelParams{Temperature: state.Float(0.2), MaxTokens: 100}) {
+		t.Errorf("ollama params = %+v, want the profile's temperature and the flag's max tokens", got)
+	}
+
+	// a profile's 0 is a value, it replaces the provider's non-zero default
+	zero := write("zero.yaml", "providers:\n  claude:\n    temperature: 0\n")
+	config, err = parseArgs([]string{"-config", zero})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if got := config.ParamsFor("claude").Temperature; got == nil || *got != 0 {
+		t.Errorf("claude temperature = %q, want the profile's 0", formatParam(got))
+	}
+
+	for name, content := range map[string]string{
+		"temperature":       "temperature: 3\n",
+		"top_p":             "providers:\n  claude:\n    top_p: 1.5\n",
+		"max_tokens":        "providers:\n  gemini:\n    max_tokens: -1\n",
+		"unknown provider":  "providers:\n  lmstuido:\n    temperature: 0.2\n",
+		"presence_penalty":  "providers:\n  ollama:\n    presence_penalty: 5\n",
+		"frequency_penalty": "providers:\n  ollama:\n    frequency_penalty: -5\n",
+	} {
+		bad := write("bad.yaml", content)
+		if _, err := parseArgs([]string{"-config", bad}); err == nil {
+			t.Errorf("%s: expected the out of range config to be rejected", name)
+		}
+	}
+}
+
+func TestParseArgs_ConfigFileMissingOrMalformed(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// no ~/.tai/config.yaml is just the defaults
+	config, err := parseArgs(nil)
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v, want a missing default config to be ignored", err)
+	}
+	if config.Provider != "lmstudio" || config.Source("provider") != SourceDefault {
+		t.Errorf("provider = %q (%s), want the default", config.Provider, config.Source("provider"))
+	}
+
+	// an explicit -config has to exist
+	if _, err := parseArgs([]string{"-config", filepath.Join(home, "nope.yaml")}); err == nil {
+		t.Error("Expected an error for a -config file that doesn't exist")
+	}
+
+	path := filepath.Join(home, ".tai", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("provider: [ollama\ntemperature: warm\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = parseArgs(nil)
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("parseArgs() error = %v, want a parse error naming %s", err, path)
+	}
+}
+
+func TestConfig_EffectiveProviderEnvironment(t *testing.T) {
+	t.Setenv(llm.OpenAIAPIKeyEnv, "sk-env-secret")
+	t.Setenv(llm.OpenAIBaseURLEnv, "https://proxy.example.com/v1")
+
+	config, err := parseArgs([]string{"-provider", "openai"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+
+	settings := map[string]Setting{}
+	for _, s := range config.Effective() {
+		settings[s.Name] = s
+	}
+	if got := settings["api-key"]; got.Value != "[redacted]" || got.Source != SourceEnv {
+		t.Errorf("api-key = %q (%s), want it redacted from the environment", got.Value, got.Source)
+	}
+	if got := settings["base-url"]; got.Value != "https://proxy.example.com/v1" || got.Source != SourceEnv {
+		t.Errorf("base-url = %q (%s), want the environment's", got.Value, got.Source)
+	}
+
+	// flags override the environment
+	config, err = parseArgs([]string{"-provider", "openai", "-api-key", "sk-flag-secret", "-base-url", "https://api.openai.com/v1"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	pc := config.ProviderConfig()
+	if pc.APIKey != "sk-flag-secret" || pc.BaseURL != "https://api.openai.com/v1" {
+		t.Errorf("ProviderConfig() = %+v, want the flag values", pc)
+	}
+	if out := FormatSettings(config.Effective()); strings.Contains(out, "sk-flag-secret") || !strings.Contains(out, "(flag)") {
+		t.Errorf("Expected the flag key to be redacted and marked as a flag, got:\n%s", out)
+	}
+}
+
+func TestParseArgs_ContextBudget(t *testing.T) {
+	config, err := parseArgs([]string{})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if got := config.ProviderConfig().ContextBudget; got != 0 {
+		t.Errorf("ContextBudget = %d by default, want 0 so nothing is truncated", got)
+	}
+
+	config, err = parseArgs([]string{"-context-budget", "6000"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if got := config.ProviderConfig().ContextBudget; got != 6000 {
+		t.Errorf("ContextBudget = %d, want the -context-budget flag", got)
+	}
+}
+
+func TestParseArgs_Timeout(t *testing.T) {
+	config, err := parseArgs([]string{})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if got := config.ProviderConfig().Timeout; got != llm.DefaultTimeout {
+		t.Errorf("Timeout = %s by default, want %s", got, llm.DefaultTimeout)
+	}
+
+	for _, mode := range [][]string{{"-timeout", "45s"}, {"-oneshot", "-timeout", "45s", "prompt"}} {
+		config, err := parseArgs(mode)
+		if err != nil {
+			t.Fatalf("parseArgs(%q) error = %v", mode, err)
+		}
+		if got := config.ProviderConfig().Timeout; got != 45*time.Second {
+			t.Errorf("parseArgs(%q) Timeout = %s, want the -timeout flag", mode, got)
+		}
+		if src := config.Source("timeout"); src != SourceFlag {
+			t.Errorf("parseArgs(%q) timeout source = %s, want %s", mode, src, SourceFlag)
+		}
+	}
+
+	for _, value := range []string{"0s", "-5s"} {
+		if _, err := parseArgs([]string{"-timeout", value}); err == nil {
+			t.Errorf("Expected -timeout %s to be rejected", value)
+		}
+	}
+}
+
+func TestParseArgs_SamplingFlags(t *testing.T) {
+	config, err := parseArgs([]string{"-provider", "ollama", "-temperature", "1.5", "-top-p", "0.9", "-max-tokens", "512"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+
+	want := state.ModelParams{Temperature: state.Float(1.5), TopP: state.Float(0.9), MaxTokens: 512}
+	if got := config.ParamsFor("ollama"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParamsFor() = %+v, want %+v", got, want)
+	}
+	for _, s := range config.Effective() {
+		if (s.Name == "temperature" || s.Name == "top-p" || s.Name == "max-tokens") && s.Source != SourceFlag {
+			t.Errorf("%s source = %s, want %s", s.Name, s.Source, SourceFlag)
+		}
+	}
+
+	// an explicit 0 asks for deterministic decoding, it doesn't fall back to the provider's default
+	config, err = parseArgs([]string{"-provider", "claude", "-temperature", "0"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if got := config.ParamsFor("claude").Temperature; got == nil || *got != 0 {
+		t.Errorf("ParamsFor().Temperature = %q, want 0", formatParam(got))
+	}
+	for _, s := range config.Effective() {
+		if s.Name == "temperature" && (s.Value != "0" || s.Source != SourceFlag) {
+			t.Errorf("temperature setting = %s (%s), want 0 (%s)", s.Value, s.Source, SourceFlag)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-temperature", "2.5"}, "temperature must be between 0 and 2"},
+		{[]string{"-temperature", "-1"}, "temperature must be between 0 and 2"},
+		{[]string{"-top-p", "1.1"}, "top_p must be between 0 and 1"},
+		{[]string{"-max-tokens", "-5"}, "max_tokens cannot be negative"},
+		{[]string{"-presence-penalty", "2.5"}, "presence_penalty must be between -2 and 2"},
+		{[]string{"-frequency-penalty", "-2.1"}, "frequency_penalty must be between -2 and 2"},
+	}
+	for _, tt := range tests {
+		if _, err := parseArgs(tt.args); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseArgs(%q) error = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestParseArgs_PenaltyFlags(t *testing.T) {
+	config, err := parseArgs([]string{"-presence-penalty", "0.6", "-frequency-penalty", "-2"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+
+	params := config.ParamsFor("lmstudio")
+	if !reflect.DeepEqual(params.PresencePenalty, state.Float(0.6)) || !reflect.DeepEqual(params.FrequencyPenalty, state.Float(-2)) {
+		t.Errorf("ParamsFor() penalties = (%s, %s), want (0.6, -2)", formatParam(params.PresencePenalty), formatParam(params.FrequencyPenalty))
+	}
+}
+
+func TestParseArgs_Seed(t *testing.T) {
+	config, err := parseArgs([]string{"-oneshot", "prompt"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if config.Seed != nil {
+		t.Errorf("Seed = %d, want nil when -seed isn't given", *config.Seed)
+	}
+
+	config, err = parseArgs([]string{"-oneshot", "-seed", "0", "prompt"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if config.Seed == nil || *config.Seed != 0 {
+		t.Errorf("Seed = %v, want a seed of 0", config.Seed)
+	}
+
+	if _, err := parseArgs([]string{"-seed", "abc"}); err == nil {
+		t.Error("Expected a non-numeric seed to be rejected")
+	}
+}
+
+func TestParseArgs_Version(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"-version"}, true},
+		{[]string{"version"}, true},
+		{[]string{}, false},
+		// a one-shot prompt that happens to be the word
+		{[]string{"-oneshot", "version"}, false},
+	}
+
+	for _, tt := range tests {
+		config, err := parseArgs(tt.args)
+		if err != nil {
+			t.Fatalf("parseArgs(%q) error = %v", tt.args, err)
+		}
+		if config.Version != tt.want {
+			t.Errorf("parseArgs(%q) Version = %v, want %v", tt.args, config.Version, tt.want)
+		}
+	}
+}
+
+func TestParseArgs_PromptArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"quoted", []string{"-oneshot", "what is the weather today"}, "what is the weather today"},
+		{"unquoted", []string{"-oneshot", "what", "is", "the", "weather", "today"}, "what is the weather today"},
+		{"flags first", []string{"-oneshot", "-model", "qwen", "explain", "this"}, "explain this"},
+		{"none", []string{"-oneshot"}, ""},
+	}
+
+	for _, tt := range tests {
+		config, err := parseArgs(tt.args)
+		if err != nil {
+			t.Fatalf("%s: parseArgs() error = %v", tt.name, err)
+		}
+		if config.Prompt != tt.want {
+			t.Errorf("%s: Prompt = %q, want %q", tt.name, config.Prompt, tt.want)
+		}
+	}
+}
+
+func TestParseArgs_PromptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompt.md")
+	if err := os.WriteFile(path, []byte("  explain this code\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"file only", []string{"-oneshot", "-f", path}, "explain this code"},
+		{"long flag", []string{"-oneshot", "--file", path}, "explain this code"},
+		{"prompt argument first", []string{"-oneshot", "-f", path, "briefly"}, "briefly\nexplain this code"},
+		{"stdin", []string{"-oneshot", "-f", "-"}, ""},
+	}
+
+	for _, tt := range tests {
+		config, err := parseArgs(tt.args)
+		if err != nil {
+			t.Fatalf("%s: parseArgs() error = %v", tt.name, err)
+		}
+		if config.Prompt != tt.want {
+			t.Errorf("%s: Prompt = %q, want %q", tt.name, config.Prompt, tt.want)
+		}
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.md")
+	_, err := parseArgs([]string{"-oneshot", "-f", missing})
+	if !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), missing) {
+		t.Errorf("parseArgs() error = %v, want the missing file named", err)
+	}
+}
+
+func TestParseArgs_Output(t *testing.T) {
+	config, err := parseArgs([]string{"-oneshot", "prompt"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if config.Output != OutputText {
+		t.Errorf("Output = %q, want text by default", config.Output)
+	}
+
+	config, err = parseArgs([]string{"-oneshot", "-output", "json", "prompt"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if config.Output != OutputJSON {
+		t.Errorf("Output = %q, want json", config.Output)
+	}
+
+	if _, err := parseArgs([]string{"-output", "yaml"}); err == nil {
+		t.Error("Expected an unknown output format to be rejected")
+	}
+}
+
+func TestProviderConfig_VerboseLogsRequests(t *testing.T) {
+	if logger := (&Config{}).ProviderConfig().Logger; logger != nil {
+		t.Error("Expected no request logging without -verbose")
+	}
+	if logger := (&Config{Verbose: true}).ProviderConfig().Logger; logger == nil {
+		t.Error("Expected -verbose to log provider requests")
+	}
+}
+
+func TestParseArgs_StopIsRepeatable(t *testing.T) {
+	config, err := parseArgs([]string{"-oneshot", "-stop", "END", "-stop", "\n\n", "prompt"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+
+	if want := []string{"END", "\n\n"}; !slices.Equal(config.Stop, want) {
+		t.Errorf("Stop = %q, want %q", config.Stop, want)
+	}
+	if config.Prompt != "prompt" {
+		t.Errorf("Prompt = %q, want the positional argument after the flags", config.Prompt)
+	}
+}
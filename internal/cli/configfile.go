@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/adamveld12/tai/internal/llm"
+	"github.com/adamveld12/tai/internal/state"
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig is the subset of the configuration that can be set in the config file
+type FileConfig struct {
+	Provider     string `yaml:"provider"`
+	Model        string `yaml:"model"`
+	SystemPrompt string `yaml:"system_prompt"`
+	Theme        string `yaml:"theme"`
+	// Temperature applies to whichever provider ends up selected
+	Temperature      *float64 `yaml:"temperature"`
+	WorkingDirectory string   `yaml:"working_directory"`
+	// Defaults replaces a provider's built-in default model, it's used when neither -model
+	// nor model above is set, e.g. defaults: {lmstudio: qwen2.5-coder}
+	Defaults map[string]string `yaml:"defaults"`
+	// Providers holds each provider's parameter profile, layered over its built-in
+	// defaults and temperature above, e.g. providers: {ollama: {temperature: 0.2}}
+	Providers map[string]FileParams `yaml:"providers"`
+}
+
+// FileParams is a provider's parameter profile in the config file, unset values keep
+// the provider's defaults
+type FileParams struct {
+	Temperature      *float64 `yaml:"temperature"`
+	TopP             *float64 `yaml:"top_p"`
+	MaxTokens        int      `yaml:"max_tokens"`
+	PresencePenalty  *float64 `yaml:"presence_penalty"`
+	FrequencyPenalty *float64 `yaml:"frequency_penalty"`
+}
+
+// params converts the profile to the parameters it overrides
+func (p FileParams) params() state.ModelParams {
+	return state.ModelParams{
+		Temperature:      p.Temperature,
+		TopP:             p.TopP,
+		MaxTokens:        p.MaxTokens,
+		PresencePenalty:  p.PresencePenalty,
+		FrequencyPenalty: p.FrequencyPenalty,
+	}
+}
+
+// DefaultConfigPath returns where the config file is read from when -config isn't given (~/.tai/config.yaml)
+func DefaultConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+
+	return filepath.Join(home, ".tai", "config.yaml"), nil
+}
+
+// LoadConfigFile reads the config file at path. A missing file is an empty configuration.
+func LoadConfigFile(path string) (FileConfig, error) {
+	var file FileConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return file, nil
+		}
+		return file, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	known := func(provider string) bool {
+		return slices.Contains(llm.RegisteredProviders(), llm.SupportedProvider(provider))
+	}
+	for provider := range file.Defaults {
+		if !known(provider) {
+			return file, fmt.Errorf("invalid config %s: unknown provider %q in defaults", path, provider)
+		}
+	}
+
+	if err := (state.ModelParams{Temperature: file.Temperature}).Validate(); err != nil {
+		return file, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	for provider, params := range file.Providers {
+		if !known(provider) {
+			return file, fmt.Errorf("invalid config %s: unknown provider %q in providers", path, provider)
+		}
+		if err := params.params().Validate(); err != nil {
+			return file, fmt.Errorf("invalid config %s: providers.%s: %w", path, provider, err)
+		}
+	}
+
+	return file, nil
+}
+
+// applyFile fills in the settings still at their defaults from the config file,
+// flags and the environment take precedence over it
+func (c *Config) applyFile(file FileConfig) {
+	set := func(name string, dst *string, value string) {
+		if value == "" || c.Source(name) != SourceDefault {
+			return
+		}
+		*dst = value
+		c.setSource(name, SourceFile)
+	}
+
+	set("provider", &c.Provider, file.Provider)
+	set("model", &c.Model, file.Model)
+	provider := c.Provider
+	if provider == "" {
+		provider = string(llm.ProviderLMStudio)
+	}
+	set("model", &c.Model, file.Defaults[provider])
+	set("system", &c.SystemPrompt, file.SystemPrompt)
+	set("theme", &c.Theme, file.Theme)
+	set("dir", &c.WorkingDirectory, expandHome(file.WorkingDirectory))
+
+	if file.Temperature == nil && len(file.Providers) == 0 {
+		return
+	}
+	if c.ProviderParams == nil {
+		c.ProviderParams = make(map[string]state.ModelParams)
+	}
+	if file.Temperature != nil {
+		params := c.ProviderParams[provider]
+		params.Temperature = file.Temperature
+		c.ProviderParams[provider] = params
+	}
+	// a provider's own profile is more specific than the temperature for all of them
+	for name, params := range file.Providers {
+		c.ProviderParams[name] = c.ProviderParams[name].Merge(params.params())
+	}
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
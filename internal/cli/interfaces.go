@@ -1,5 +1,26 @@
 package cli
 
+import "errors"
+
+const (
+	// ExitError is the exit code for any failure without a more specific code
+	ExitError = 1
+	// ExitContentFiltered is the exit code when the provider blocked the response
+	ExitContentFiltered = 3
+)
+
 type Executor interface {
 	Execute() error
 }
+
+// ExitCode maps an error returned by an Executor to the process exit code
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrContentFiltered):
+		return ExitContentFiltered
+	default:
+		return ExitError
+	}
+}
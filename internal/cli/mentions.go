@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamveld12/tai/internal/tools"
+)
+
+// maxMentionSize is the largest file an @path mention may inline
+const maxMentionSize = 256 << 10
+
+// ErrMentionTooLarge is returned for an @path mention of a file over maxMentionSize
+var ErrMentionTooLarge = errors.New("file too large to include")
+
+// mentionTrailing is punctuation that ends the sentence a mention is in rather than its path
+const mentionTrailing = `.,;:!?)]}"'`
+
+// expandMentions replaces every @path in prompt with the contents of the file at path,
+// relative to root, in a fenced code block. A mention starts a word, so an address like
+// me@example.com is left alone, and @@ is a literal @. Paths outside of root, files that
+// can't be read and files over maxMentionSize are errors.
+func expandMentions(prompt, root string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(prompt); i++ {
+		if prompt[i] != '@' {
+			b.WriteByte(prompt[i])
+			continue
+		}
+		if i+1 < len(prompt) && prompt[i+1] == '@' {
+			b.WriteByte('@')
+			i++
+			continue
+		}
+		if i > 0 && !isSpace(prompt[i-1]) {
+			b.WriteByte('@')
+			continue
+		}
+
+		end := i + 1
+		for end < len(prompt) && !isSpace(prompt[end]) {
+			end++
+		}
+		path := strings.TrimRight(prompt[i+1:end], mentionTrailing)
+		if path == "" {
+			b.WriteByte('@')
+			continue
+		}
+
+		block, err := mentionBlock(root, path)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(block)
+		i += len(path)
+	}
+	return b.String(), nil
+}
+
+// mentionBlock is the file at path, under root, as a fenced code block headed by its path
+func mentionBlock(root, path string) (string, error) {
+	target, err := tools.SandboxPath(root, path)
+	if err != nil {
+		return "", fmt.Errorf("@%s: %w", path, err)
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to include @%s: %w", path, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("failed to include @%s: it's a directory", path)
+	}
+	if info.Size() > maxMentionSize {
+		return "", fmt.Errorf("@%s is %d bytes: %w, the limit is %d", path, info.Size(), ErrMentionTooLarge, maxMentionSize)
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to include @%s: %w", path, err)
+	}
+	content := strings.TrimSuffix(string(data), "\n")
+
+	// the fence has to be longer than any run of backticks in the file
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	lang := strings.TrimPrefix(filepath.Ext(path), ".")
+	return fmt.Sprintf("%s\n%s%s\n%s\n%s\n", path, fence, lang, content, fence), nil
+}
+
+// isSpace reports whether c separates words
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
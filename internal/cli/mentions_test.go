@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/tools"
+)
+
+func TestExpandMentions(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"main.go":      "package main\n",
+		"pkg/util.txt": "util",
+		"README.md":    "```sh\nmake\n```\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		prompt string
+		want   string
+	}{
+		{"no mentions", "what is a goroutine", "what is a goroutine"},
+		{"file", "explain @main.go", "explain main.go\n```go\npackage main\n```\n"},
+		{"nested path and trailing punctuation", "what's in @pkg/util.txt?", "what's in pkg/util.txt\n```txt\nutil\n```\n?"},
+		{"fence longer than the file's", "@README.md", "README.md\n````md\n```sh\nmake\n```\n````\n"},
+		{"escaped", "ping @@main.go", "ping @main.go"},
+		{"inside a word", "mail me@example.com", "mail me@example.com"},
+		{"bare", "a @ b", "a @ b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandMentions(tt.prompt, root)
+			if err != nil {
+				t.Fatalf("expandMentions() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expandMentions() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandMentions_Errors(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "project")
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "big.log"), []byte(strings.Repeat("x", maxMentionSize+1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		prompt string
+		want   error
+	}{
+		{"read @../secret.txt", tools.ErrPathEscape},
+		{"read @" + filepath.ToSlash(filepath.Join(parent, "secret.txt")), tools.ErrPathEscape},
+		{"read @missing.go", os.ErrNotExist},
+		{"summarize @big.log", ErrMentionTooLarge},
+	}
+
+	for _, tt := range tests {
+		got, err := expandMentions(tt.prompt, root)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("expandMentions(%q) = %q, %v, want %v", tt.prompt, got, err, tt.want)
+		}
+	}
+}
+
+func TestExpandMentions_SymlinkEscape(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "project")
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("notes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"secret.txt": filepath.Join(parent, "secret.txt"),
+		"up":         parent,
+		"notes.link": filepath.Join(root, "notes.txt"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+
+	for _, prompt := range []string{"read @secret.txt", "read @up/secret.txt"} {
+		if got, err := expandMentions(prompt, root); !errors.Is(err, tools.ErrPathEscape) {
+			t.Errorf("expandMentions(%q) = %q, %v, want %v", prompt, got, err, tools.ErrPathEscape)
+		}
+	}
+
+	// a link that stays inside of the root is fine
+	got, err := expandMentions("read @notes.link", root)
+	if err != nil || !strings.Contains(got, "notes") {
+		t.Errorf("expandMentions() = %q, %v, want the linked file inlined", got, err)
+	}
+}
+
+func TestParseArgs_OneShotMentions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := parseArgs([]string{"-dir", dir, "-oneshot", "explain", "@main.go"})
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if want := "explain main.go\n```go\npackage main\n```\n"; config.Prompt != want {
+		t.Errorf("Prompt = %q, want %q", config.Prompt, want)
+	}
+
+	if _, err := parseArgs([]string{"-dir", dir, "-oneshot", "explain @missing.go"}); err == nil {
+		t.Error("Expected a mention of a missing file to fail")
+	}
+}
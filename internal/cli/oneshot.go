@@ -3,6 +3,8 @@ package cli
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -14,27 +16,62 @@ import (
 	"github.com/adamveld12/tai/internal/state"
 )
 
+// ErrContentFiltered is returned when the provider blocked the model's response
+var ErrContentFiltered = errors.New("response blocked by content filter")
+
+// ErrInvalidJSON is returned in -json mode when the model's answer doesn't parse as JSON
+var ErrInvalidJSON = errors.New("response is not valid JSON")
+
 // OneShotHandler handles one-shot mode execution
 type OneShotHandler struct {
 	state.Dispatcher
 	llm.Provider
 	config *Config
+
+	// tty opens the terminal used to confirm large prompts, stdin is usually the piped prompt
+	tty func() (io.ReadWriteCloser, error)
+
+	// stdout receives the response, os.Stdout when nil
+	stdout io.Writer
+}
+
+// output returns the writer the response is printed to
+func (h *OneShotHandler) output() io.Writer {
+	if h.stdout == nil {
+		return os.Stdout
+	}
+	return h.stdout
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return (stat.Mode() & os.ModeCharDevice) != 0
+}
+
+// openTTY opens the controlling terminal
+func openTTY() (io.ReadWriteCloser, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
 }
 
 // NewOneShotHandler creates a new one-shot handler
 func NewOneShotHandler(config *Config) *OneShotHandler {
-	provider, err := llm.NewLMStudioProvider(llm.ProviderConfig{})
+	provider, err := llm.GetProvider(llm.SupportedProvider(config.Provider), config.ProviderConfig())
 
 	if err != nil {
 		log.Fatalf("Failed to initialize LLM provider: %v", err)
 	}
 
-	s := state.NewMemoryState("", config.WorkingDirectory, time.Now().Format("20060102150405"))
+	s := state.NewMemoryState(config.SystemPrompt, config.WorkingDirectory, time.Now().Format("20060102150405"))
 
 	return &OneShotHandler{
 		Dispatcher: s,
 		Provider:   provider,
 		config:     config,
+		tty:        openTTY,
 	}
 }
 
@@ -48,35 +85,236 @@ func (h *OneShotHandler) Execute() error {
 		return fmt.Errorf("failed to read from stdin: %w", err)
 	}
 
-	stdin := strings.TrimSpace(input)
-	prompt := h.config.Prompt
-	if prompt == "" && stdin == "" {
+	prompt := combinePrompt(h.config.Prompt, input)
+	if prompt == "" {
 		return nil
-	} else if prompt == "" && stdin != "" {
-		prompt = stdin
-	} else if prompt != "" && stdin == "" {
-		prompt = strings.TrimSpace(prompt)
-	} else {
-		prompt = fmt.Sprintf("%s\n%s", strings.TrimSpace(prompt), stdin)
 	}
 
 	s := h.GetState()
-	response, err := h.Provider.ChatCompletion(context.Background(), llm.ChatRequest{
-		Messages: []state.Message{
-			{Role: state.RoleUser, Content: prompt, Timestamp: time.Now()},
-		},
+	messages := []state.Message{
+		{Role: state.RoleUser, Content: prompt, Timestamp: time.Now()},
+	}
+
+	if ok, err := h.confirmSend(llm.EstimatePromptTokens(s.Context.SystemPrompt, messages)); err != nil {
+		return fmt.Errorf("failed to confirm prompt: %w", err)
+	} else if !ok {
+		return fmt.Errorf("prompt not sent")
+	}
+
+	tools, err := loadTools(h.config.ToolsFile)
+	if err != nil {
+		return err
+	}
+
+	params := h.config.ParamsFor(string(h.Provider.Name()))
+	req := llm.ChatRequest{
+		Messages:     messages,
 		SystemPrompt: s.Context.SystemPrompt,
-	})
+		Temperature:  params.Temperature,
+		TopP:         params.TopP,
+		MaxTokens:    params.MaxTokens,
+		Stop:         h.config.Stop,
+		Seed:         h.config.Seed,
+		Tools:        tools,
+
+		PresencePenalty:  params.PresencePenalty,
+		FrequencyPenalty: params.FrequencyPenalty,
+	}
+
+	if h.config.JSON {
+		req.ResponseFormat = &llm.ResponseFormat{Type: llm.ResponseFormatJSONObject}
+	}
 
+	// emitted tool calls have to be the only thing on stdout, JSON has to be checked
+	// before anything is printed, and -output json needs the whole response, so none
+	// of them are streamed
+	if h.config.Stream && !h.config.EmitToolCalls && !h.config.JSON && h.config.Output != OutputJSON {
+		return h.stream(req)
+	}
+
+	response, err := h.Provider.ChatCompletion(context.Background(), req)
 	if err != nil {
-		return fmt.Errorf("failed to get chat completion:\n\t%w", err)
+		return h.completionError(err)
 	}
 
 	// Output the response
-	fmt.Println(response.Content)
+	if response.FinishReason == llm.FinishReasonContentFilter {
+		if h.config.Output == OutputJSON || strings.TrimSpace(response.Content) != "" {
+			if err := h.printResponse(response); err != nil {
+				return err
+			}
+		}
+		return ErrContentFiltered
+	}
+
+	// hand the tool calls to whoever is orchestrating tai instead of running them
+	if h.config.EmitToolCalls && response.FinishReason == llm.FinishReasonToolCalls {
+		if err := json.NewEncoder(h.output()).Encode(response.ToolCalls); err != nil {
+			return fmt.Errorf("failed to write tool calls: %w", err)
+		}
+		return nil
+	}
+
+	if h.config.JSON && !json.Valid([]byte(response.Content)) {
+		return fmt.Errorf("%w: %q", ErrInvalidJSON, truncate(response.Content, 200))
+	}
+
+	return h.printResponse(response)
+}
+
+// oneShotResult is what -output json prints for a response
+type oneShotResult struct {
+	Content    string         `json:"content"`
+	Model      string         `json:"model"`
+	Usage      llm.TokenUsage `json:"usage"`
+	DurationMS int64          `json:"duration_ms"`
+}
+
+// printResponse writes the response's content to stdout, or with -output json the
+// content, model, token usage and duration as one JSON object
+func (h *OneShotHandler) printResponse(response *llm.ChatResponse) error {
+	if h.config.Output != OutputJSON {
+		fmt.Fprintln(h.output(), response.Content)
+		return nil
+	}
+
+	usage := response.Usage
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	result := oneShotResult{
+		Content:    response.Content,
+		Model:      response.Model,
+		Usage:      usage,
+		DurationMS: response.Duration.Milliseconds(),
+	}
+	if err := json.NewEncoder(h.output()).Encode(result); err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+	return nil
+}
+
+// combinePrompt joins a prompt and the input it's about, the prompt first and on its own
+// line. Either may be empty.
+func combinePrompt(prompt, input string) string {
+	prompt, input = strings.TrimSpace(prompt), strings.TrimSpace(input)
+	switch {
+	case prompt == "":
+		return input
+	case input == "":
+		return prompt
+	default:
+		return prompt + "\n" + input
+	}
+}
+
+// truncate shortens s to at most n bytes for error messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
+
+// stream writes the response to stdout as it's generated. Each delta is written as
+// soon as it arrives, stdout isn't buffered so nothing waits for the full answer.
+func (h *OneShotHandler) stream(req llm.ChatRequest) error {
+	req.Stream = true
+	chunks, err := h.Provider.StreamChatCompletion(context.Background(), req)
+	if err != nil {
+		return h.completionError(err)
+	}
+
+	out := h.output()
+	var finishReason string
+	var wrote, endsInNewline bool
+	for chunk := range chunks {
+		if chunk.Error != nil {
+			if wrote && !endsInNewline {
+				fmt.Fprintln(out)
+			}
+			return h.completionError(chunk.Error)
+		}
+
+		if chunk.FinishReason != "" {
+			finishReason = chunk.FinishReason
+		}
+
+		if chunk.Delta != "" {
+			if _, err := io.WriteString(out, chunk.Delta); err != nil {
+				return fmt.Errorf("failed to write response: %w", err)
+			}
+			wrote = true
+			endsInNewline = strings.HasSuffix(chunk.Delta, "\n")
+		}
+
+		if chunk.Done {
+			break
+		}
+	}
+
+	if wrote && !endsInNewline {
+		fmt.Fprintln(out)
+	}
+
+	if finishReason == llm.FinishReasonContentFilter {
+		return ErrContentFiltered
+	}
 	return nil
 }
 
+// completionError wraps a failed completion, pointing at -model when the model doesn't exist
+func (h *OneShotHandler) completionError(err error) error {
+	if llm.IsModelNotFoundError(err) {
+		return fmt.Errorf("failed to get chat completion:\n\t%w\n\tcheck the -model flag against the models %s has available", err, h.Provider.Name())
+	}
+	return fmt.Errorf("failed to get chat completion:\n\t%w", err)
+}
+
+// loadTools reads the tool definitions in path, a JSON array of llm.Tool. An empty path offers no tools.
+func loadTools(path string) ([]llm.Tool, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tools: %w", err)
+	}
+
+	var tools []llm.Tool
+	if err := json.Unmarshal(data, &tools); err != nil {
+		return nil, fmt.Errorf("failed to parse tools in %s: %w", path, err)
+	}
+
+	return tools, nil
+}
+
+// confirmSend asks on the terminal whether to send a prompt estimated above the
+// -confirm-tokens threshold. -yes, or having no terminal to ask on, sends it without asking.
+func (h *OneShotHandler) confirmSend(estimate int) (bool, error) {
+	if h.config.Yes || !llm.ExceedsTokenThreshold(estimate, h.config.ConfirmTokens) || h.tty == nil {
+		return true, nil
+	}
+
+	tty, err := h.tty()
+	if err != nil {
+		// non-interactive, there's nobody to ask
+		return true, nil
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "This prompt is estimated at ~%d tokens, over the %d token threshold. Send it? [y/N] ", estimate, h.config.ConfirmTokens)
+
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
 // readFromStdin reads input from stdin
 func (h *OneShotHandler) readFromStdin() (string, error) {
 	// Check if stdin has data
@@ -85,7 +323,7 @@ func (h *OneShotHandler) readFromStdin() (string, error) {
 		return "", err
 	}
 
-	if (stat.Mode() & os.ModeCharDevice) != 0 {
+	if (stat.Mode()&os.ModeCharDevice) != 0 && !h.config.promptFromStdin() {
 		// Terminal mode - no piped input
 		return "", nil
 	}
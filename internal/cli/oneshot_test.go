@@ -2,10 +2,17 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/adamveld12/tai/internal/llm"
 	"github.com/adamveld12/tai/internal/state"
@@ -46,7 +53,8 @@ func (m *mockDispatcher) GetState() state.AppState {
 	return m.state
 }
 
-func (m *mockDispatcher) OnStateChange(state.OnStateChangeHandler) {
+func (m *mockDispatcher) OnStateChange(state.OnStateChangeHandler) func() {
+	return func() {}
 }
 
 func (m *mockDispatcher) Dispatch(state.Action) {
@@ -381,3 +389,445 @@ func TestOneShotHandler_MessageConstruction(t *testing.T) {
 		})
 	}
 }
+
+func TestOneShotHandler_PromptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompt.md")
+	if err := os.WriteFile(path, []byte("Review this diff:\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+		want  string
+	}{
+		{"file and stdin combined", []string{"-oneshot", "-f", path}, "+ added a line", "Review this diff:\n+ added a line"},
+		{"prompt, file and stdin", []string{"-oneshot", "-f", path, "Be brief."}, "+ added a line", "Be brief.\nReview this diff:\n+ added a line"},
+		{"dash reads stdin", []string{"-oneshot", "-f", "-"}, "What is 2+2?", "What is 2+2?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("parseArgs() error = %v", err)
+			}
+
+			oldStdin := os.Stdin
+			r, w, _ := os.Pipe()
+			go func() {
+				_, _ = w.WriteString(tt.stdin)
+				w.Close()
+			}()
+			os.Stdin = r
+			defer func() {
+				r.Close()
+				os.Stdin = oldStdin
+			}()
+
+			provider := &mockProvider{response: &llm.ChatResponse{Content: "response"}}
+			config.Stream = false
+			handler := &OneShotHandler{Dispatcher: &mockDispatcher{}, Provider: provider, config: config, stdout: io.Discard}
+			if err := handler.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if got := provider.request.Messages[0].Content; got != tt.want {
+				t.Errorf("prompt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeTTY answers a confirmation prompt and records what was written to it
+type fakeTTY struct {
+	io.Reader
+	strings.Builder
+}
+
+func (f *fakeTTY) Close() error { return nil }
+
+func TestOneShotHandler_ConfirmSend(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		estimate   int
+		answer     string
+		ttyErr     error
+		want       bool
+		wantPrompt bool
+	}{
+		{name: "below threshold", config: &Config{ConfirmTokens: 100}, estimate: 50, want: true},
+		{name: "threshold disabled", config: &Config{ConfirmTokens: 0}, estimate: 1_000_000, want: true},
+		{name: "yes flag skips the prompt", config: &Config{ConfirmTokens: 100, Yes: true}, estimate: 500, want: true},
+		{name: "non-interactive skips the prompt", config: &Config{ConfirmTokens: 100}, estimate: 500, ttyErr: errors.New("no tty"), want: true},
+		{name: "confirmed", config: &Config{ConfirmTokens: 100}, estimate: 500, answer: "y\n", want: true, wantPrompt: true},
+		{name: "declined", config: &Config{ConfirmTokens: 100}, estimate: 500, answer: "\n", want: false, wantPrompt: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tty := &fakeTTY{Reader: strings.NewReader(tt.answer)}
+			opened := false
+
+			handler := &OneShotHandler{
+				config: tt.config,
+				tty: func() (io.ReadWriteCloser, error) {
+					opened = true
+					if tt.ttyErr != nil {
+						return nil, tt.ttyErr
+					}
+					return tty, nil
+				},
+			}
+
+			got, err := handler.confirmSend(tt.estimate)
+			if err != nil {
+				t.Fatalf("confirmSend() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("confirmSend() = %v, want %v", got, tt.want)
+			}
+
+			if prompted := tty.Len() > 0; prompted != tt.wantPrompt {
+				t.Errorf("prompted = %v, want %v (output %q)", prompted, tt.wantPrompt, tty.String())
+			}
+			if (tt.config.Yes || tt.estimate <= tt.config.ConfirmTokens) && opened {
+				t.Error("Expected the terminal not to be opened")
+			}
+		})
+	}
+}
+
+func TestOneShotHandler_ContentFilter(t *testing.T) {
+	handler := &OneShotHandler{
+		Dispatcher: &mockDispatcher{},
+		Provider: &mockProvider{response: &llm.ChatResponse{
+			FinishReason: llm.FinishReasonContentFilter,
+		}},
+		config: &Config{Prompt: "Test prompt"},
+	}
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := handler.Execute()
+
+	w.Close()
+	out, _ := io.ReadAll(r)
+	os.Stdout = oldStdout
+
+	if !errors.Is(err, ErrContentFiltered) {
+		t.Fatalf("Execute() error = %v, want ErrContentFiltered", err)
+	}
+	if code := ExitCode(err); code != ExitContentFiltered {
+		t.Errorf("ExitCode() = %d, want %d", code, ExitContentFiltered)
+	}
+	if len(out) != 0 {
+		t.Errorf("Expected no blank output for a filtered response, got %q", out)
+	}
+}
+
+func TestOneShotHandler_EmitToolCalls(t *testing.T) {
+	toolsFile := filepath.Join(t.TempDir(), "tools.json")
+	if err := os.WriteFile(toolsFile, []byte(`[{"type":"function","function":{"name":"deploy","description":"Deploy a service","parameters":{"type":"object"}}}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := []state.ToolCall{
+		{ID: "call_1", Type: "function", Function: state.ToolCallFunction{Name: "deploy", Arguments: `{"service":"api"}`}},
+	}
+	provider := &mockProvider{response: &llm.ChatResponse{
+		Content:      "I'll deploy the api",
+		ToolCalls:    calls,
+		FinishReason: llm.FinishReasonToolCalls,
+	}}
+	handler := &OneShotHandler{
+		Dispatcher: &mockDispatcher{},
+		Provider:   provider,
+		config:     &Config{Prompt: "ship it", EmitToolCalls: true, ToolsFile: toolsFile},
+	}
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := handler.Execute()
+
+	w.Close()
+	out, _ := io.ReadAll(r)
+	os.Stdout = oldStdout
+
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if len(provider.request.Tools) != 1 || provider.request.Tools[0].Function.Name != "deploy" {
+		t.Errorf("Expected the tools file to be offered to the model, got %+v", provider.request.Tools)
+	}
+
+	var emitted []state.ToolCall
+	if err := json.Unmarshal(out, &emitted); err != nil {
+		t.Fatalf("Expected the tool calls as JSON, got %q: %v", out, err)
+	}
+	if !reflect.DeepEqual(emitted, calls) {
+		t.Errorf("emitted %+v, want %+v", emitted, calls)
+	}
+	if strings.Contains(string(out), "I'll deploy the api") {
+		t.Error("Expected only the tool calls to be printed")
+	}
+}
+
+// streamingProvider streams chunks and lets the test observe what was written before each one
+type streamingProvider struct {
+	mockProvider
+	chunks []llm.ChatStreamChunk
+	// before is called ahead of sending each chunk
+	before func(i int)
+}
+
+func (p *streamingProvider) StreamChatCompletion(ctx context.Context, req llm.ChatRequest) (<-chan llm.ChatStreamChunk, error) {
+	p.request = req
+	ch := make(chan llm.ChatStreamChunk)
+	go func() {
+		defer close(ch)
+		for i, chunk := range p.chunks {
+			if p.before != nil {
+				p.before(i)
+			}
+			ch <- chunk
+		}
+	}()
+	return ch, nil
+}
+
+// syncBuffer collects output and is safe to read while the handler writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestOneShotHandler_Stream(t *testing.T) {
+	out := &syncBuffer{}
+	var seen []string
+	provider := &streamingProvider{
+		chunks: []llm.ChatStreamChunk{
+			{Delta: "Hello"},
+			{Delta: ", world"},
+			{Delta: "!", FinishReason: "stop", Done: true},
+		},
+	}
+	// hold each chunk back until the ones before it reach stdout, a buffered handler never gets there
+	provider.before = func(i int) {
+		var want string
+		for _, chunk := range provider.chunks[:i] {
+			want += chunk.Delta
+		}
+		deadline := time.Now().Add(time.Second)
+		for out.String() != want && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		seen = append(seen, out.String())
+	}
+
+	handler := &OneShotHandler{
+		Dispatcher: &mockDispatcher{},
+		Provider:   provider,
+		config:     &Config{Prompt: "greet me", Stream: true},
+		stdout:     out,
+	}
+
+	if err := handler.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if provider.called {
+		t.Error("Expected the blocking completion not to be used when streaming")
+	}
+	if !provider.request.Stream {
+		t.Error("Expected the request to ask for a stream")
+	}
+	if want := []string{"", "Hello", "Hello, world"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("output seen before each chunk = %q, want %q", seen, want)
+	}
+	if got := out.String(); got != "Hello, world!\n" {
+		t.Errorf("output = %q, want %q", got, "Hello, world!\n")
+	}
+}
+
+func TestOneShotHandler_StreamError(t *testing.T) {
+	out := &syncBuffer{}
+	handler := &OneShotHandler{
+		Dispatcher: &mockDispatcher{},
+		Provider: &streamingProvider{chunks: []llm.ChatStreamChunk{
+			{Delta: "partial"},
+			{Error: errors.New("connection reset"), Done: true},
+		}},
+		config: &Config{Prompt: "greet me", Stream: true},
+		stdout: out,
+	}
+
+	err := handler.Execute()
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("Execute() error = %v, want the stream error", err)
+	}
+	if got := out.String(); got != "partial\n" {
+		t.Errorf("output = %q, want the partial answer ended with a newline", got)
+	}
+}
+
+func TestOneShotHandler_ModelNotFound(t *testing.T) {
+	handler := &OneShotHandler{
+		Dispatcher: &mockDispatcher{},
+		Provider:   &mockProvider{err: fmt.Errorf("chat completion failed: %w", llm.ErrModelNotFound)},
+		config:     &Config{Prompt: "hi", Model: "gpt-9"},
+		stdout:     io.Discard,
+	}
+
+	err := handler.Execute()
+	if !errors.Is(err, llm.ErrModelNotFound) {
+		t.Fatalf("Execute() error = %v, want ErrModelNotFound", err)
+	}
+	if !strings.Contains(err.Error(), "-model") {
+		t.Errorf("Expected the error to point at -model, got %q", err)
+	}
+}
+
+func TestOneShotHandler_SamplingFlags(t *testing.T) {
+	provider := &mockProvider{response: &llm.ChatResponse{Content: "ok"}}
+	handler := &OneShotHandler{
+		Dispatcher: &mockDispatcher{},
+		Provider:   provider,
+		config:     &Config{Prompt: "hi", Temperature: state.Float(1.2), TopP: state.Float(0.5), MaxTokens: 64, Stop: []string{"END"}},
+		stdout:     io.Discard,
+	}
+
+	if err := handler.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	req := provider.request
+	if formatParam(req.Temperature) != "1.2" || formatParam(req.TopP) != "0.5" || req.MaxTokens != 64 {
+		t.Errorf("request params = (%s, %s, %v), want the flag values", formatParam(req.Temperature), formatParam(req.TopP), req.MaxTokens)
+	}
+	if !reflect.DeepEqual(req.Stop, []string{"END"}) {
+		t.Errorf("request Stop = %q, want the -stop values", req.Stop)
+	}
+}
+
+func TestOneShotHandler_JSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid JSON is printed", `{"colors": ["red", "green", "blue"]}`, false},
+		{"prose is rejected", "Sure! Here are three colors: red, green and blue.", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			provider := &mockProvider{response: &llm.ChatResponse{Content: tt.content, FinishReason: "stop"}}
+			handler := &OneShotHandler{
+				Dispatcher: &mockDispatcher{},
+				Provider:   provider,
+				// -json wins over -stream since the answer has to be checked before it's printed
+				config: &Config{Prompt: "name 3 colors", JSON: true, Stream: true},
+				stdout: &out,
+			}
+
+			err := handler.Execute()
+
+			if !provider.called {
+				t.Fatal("Expected the blocking completion to be used in -json mode")
+			}
+			if f := provider.request.ResponseFormat; f == nil || f.Type != llm.ResponseFormatJSONObject {
+				t.Errorf("ResponseFormat = %+v, want json_object", f)
+			}
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidJSON) {
+					t.Errorf("Execute() error = %v, want ErrInvalidJSON", err)
+				}
+				if out.Len() != 0 {
+					t.Errorf("Expected nothing printed for invalid JSON, got %q", out.String())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := strings.TrimSpace(out.String()); got != tt.content {
+				t.Errorf("output = %q, want %q", got, tt.content)
+			}
+		})
+	}
+}
+
+func TestOneShotHandler_OutputJSON(t *testing.T) {
+	var out strings.Builder
+	provider := &mockProvider{response: &llm.ChatResponse{
+		Content:      "Red, green and blue.",
+		Model:        "mock-model",
+		Usage:        llm.TokenUsage{PromptTokens: 12, CompletionTokens: 5},
+		Duration:     1500 * time.Millisecond,
+		FinishReason: "stop",
+	}}
+	handler := &OneShotHandler{
+		Dispatcher: &mockDispatcher{},
+		Provider:   provider,
+		// the whole response is needed, so -output json wins over -stream
+		config: &Config{Prompt: "name 3 colors", Output: OutputJSON, Stream: true},
+		stdout: &out,
+	}
+
+	if err := handler.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !provider.called {
+		t.Fatal("Expected the blocking completion to be used with -output json")
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(out.String()), &got); err != nil {
+		t.Fatalf("output isn't valid JSON: %v\n%s", err, out.String())
+	}
+
+	want := map[string]interface{}{
+		"content": "Red, green and blue.",
+		"model":   "mock-model",
+		"usage": map[string]interface{}{
+			"prompt_tokens":     float64(12),
+			"completion_tokens": float64(5),
+			"total_tokens":      float64(17),
+		},
+		"duration_ms": float64(1500),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("output = %v, want %v", got, want)
+	}
+}
+
+func TestNewOneShotHandler_SystemPrompt(t *testing.T) {
+	handler := NewOneShotHandler(&Config{Provider: "lmstudio", SystemPrompt: "Answer in one word.", WorkingDirectory: t.TempDir()})
+
+	if got := handler.Dispatcher.GetState().Context.SystemPrompt; got != "Answer in one word." {
+		t.Errorf("system prompt = %q, want the configured one", got)
+	}
+}
@@ -1,11 +1,18 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/adamveld12/tai/internal/llm"
 	"github.com/adamveld12/tai/internal/state"
+	"github.com/adamveld12/tai/internal/tools"
 	"github.com/adamveld12/tai/internal/ui"
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -16,20 +23,77 @@ type ReplHandler struct {
 	ui.Stack
 	*Config
 	*tea.Program
+	repl     *ui.REPLScreen
+	appState *state.MemoryState
+	store    *state.FileStore
+	debugLog io.Closer
 }
 
 func NewReplHandler(config *Config) *ReplHandler {
-	provider, err := llm.NewLMStudioProvider(llm.ProviderConfig{})
+	var debugLog io.Closer
+	if config.Verbose && !config.NoAltScreen {
+		// logging to the terminal would draw over the REPL
+		path, err := DefaultDebugLogPath()
+		if err == nil {
+			debugLog, err = tea.LogToFile(path, "")
+		}
+		if err != nil {
+			log.Printf("warning: verbose logs go to stderr: %v", err)
+		}
+	}
+
+	provider, err := llm.GetProvider(llm.SupportedProvider(config.Provider), config.ProviderConfig())
 	if err != nil {
 		log.Fatalf("Failed to initialize LLM provider: %v", err)
 	}
 
-	s := state.NewMemoryState(config.SystemPrompt, config.WorkingDirectory, "")
-	stack := ui.NewScreenStack(
-		ui.NewREPL(s, provider),
-	)
+	ui.SetNoColor(config.NoColor)
+	if config.Theme != "" {
+		// applied before the REPL is built so it starts out with the theme's styles
+		if _, err := (ui.SwitchThemeAction{Name: config.Theme}).Execute(state.AppState{}); err != nil {
+			log.Printf("warning: %v, using the %s theme", err, ui.DefaultTheme)
+		}
+	}
 
-	program := tea.NewProgram(stack, tea.WithAltScreen())
+	session, opts := resumeSession(config.Session)
+	if config.Verbose {
+		opts = append(opts, state.WithMiddleware(state.LoggingMiddleware(log.Default())))
+	}
+	s := state.NewMemoryStateWithOptions(config.SystemPrompt, config.WorkingDirectory, session, opts...)
+	s.Dispatch(ui.ChangeProviderAction{
+		Provider: string(provider.Name()),
+		Name:     config.Model,
+		Params:   config.ParamsFor(string(provider.Name())),
+	})
+
+	var store *state.FileStore
+	if dir, err := state.DefaultSessionsDir(); err == nil {
+		sessionFile := state.SessionPath(dir, s.GetState().Context.SessionID)
+		store = state.NewFileStore(sessionFile, config.AutosaveInterval, state.WithMaxSessions(config.MaxSessions))
+	}
+
+	replOpts := []ui.REPLOption{
+		ui.WithStallWarning(config.StallWarning),
+		ui.WithAltScreen(!config.NoAltScreen),
+		ui.WithUserMarkdown(config.UserMarkdown),
+		ui.WithConfirmThreshold(config.ConfirmTokens),
+		ui.WithConfigSummary(FormatSettings(config.Effective())),
+		ui.WithAgentOptions(
+			ui.WithToolExecutor(tools.NewDefaultRegistry(s)),
+			ui.WithMaxToolIterations(config.MaxToolIterations),
+			ui.WithPlanReview(config.ReviewPlan),
+			ui.WithContextBudget(config.ProviderConfig().ContextBudget),
+		),
+	}
+	if store != nil {
+		replOpts = append(replOpts, ui.WithSessionPruner(store.Prune))
+	}
+
+	repl := ui.NewREPL(s, provider, replOpts...)
+	stack := ui.NewScreenStack(s, repl)
+
+	program := tea.NewProgram(stack, programOptions(config)...)
+	stack.SetProgram(program)
 
 	return &ReplHandler{
 		Dispatcher: s,
@@ -37,19 +101,112 @@ func NewReplHandler(config *Config) *ReplHandler {
 		Stack:      stack,
 		Config:     config,
 		Program:    program,
+		repl:       repl,
+		appState:   s,
+		store:      store,
+		debugLog:   debugLog,
 	}
 }
 
 func (h *ReplHandler) Execute() error {
-	// wire the state change handler to the UI
-	h.Dispatcher.OnStateChange(func(a state.Action, as state.AppState, os state.AppState) {
-		cmd := h.Stack.Active().OnStateChange(a, as, os)
-		h.Program.Send(cmd)
-	})
+	if h.store != nil {
+		h.Dispatcher.OnStateChange(h.store.OnStateChange)
+	}
+
+	_, err := h.Program.Run()
+
+	// the reply in flight is stopped and finishes before the session is saved
+	if !h.repl.Shutdown(ui.DefaultShutdownTimeout) {
+		log.Printf("warning: the agent didn't stop within %s, its last changes may not be saved", ui.DefaultShutdownTimeout)
+	}
+
+	if h.debugLog != nil {
+		defer h.debugLog.Close()
+	}
 
-	if _, err := h.Program.Run(); err != nil {
+	// the listeners, the store's among them, catch up before the state stops notifying them
+	if h.appState != nil {
+		h.appState.Close()
+	}
+
+	// always persist the latest state on the way out, even if the interval hasn't elapsed
+	if h.store != nil {
+		if cerr := h.store.Close(); cerr != nil {
+			log.Printf("failed to save session: %v", cerr)
+		}
+	}
+
+	if err != nil {
 		return fmt.Errorf("😢 failed to start REPL:\n%w", err)
 	}
 
+	// without the alt screen, leave the full conversation behind in the terminal scrollback
+	if h.Config.NoAltScreen {
+		fmt.Print(transcript(h.Dispatcher.GetState()))
+	}
+
 	return nil
 }
+
+// DefaultDebugLogPath is where -verbose logs are written while the REPL is on the alt screen
+func DefaultDebugLogPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+
+	dir := filepath.Join(home, ".tai")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return filepath.Join(dir, "debug.log"), nil
+}
+
+// resumeSession returns the session name and options that load the saved session id
+// into the state. A session that doesn't exist yet starts fresh under that id, one that
+// can't be read starts fresh under a new id so the unreadable file isn't overwritten.
+func resumeSession(id string) (string, []state.MemoryStateOption) {
+	if id == "" {
+		return "", nil
+	}
+
+	dir, err := state.DefaultSessionsDir()
+	if err != nil {
+		log.Printf("warning: not resuming session %q: %v", id, err)
+		return id, nil
+	}
+
+	ctx, err := state.LoadContext(state.SessionPath(dir, id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return id, nil
+	}
+	if err != nil {
+		log.Printf("warning: starting a new session, %q could not be loaded: %v", id, err)
+		return "", nil
+	}
+
+	return id, []state.MemoryStateOption{state.WithContext(ctx)}
+}
+
+// programOptions returns the Bubble Tea options used to construct the REPL program.
+// The alt screen reports mouse wheel events so scrolling the conversation doesn't
+// arrive as up and down keys, which recall input history.
+func programOptions(config *Config) []tea.ProgramOption {
+	if config.NoAltScreen {
+		return nil
+	}
+	return []tea.ProgramOption{tea.WithAltScreen(), tea.WithMouseCellMotion()}
+}
+
+// transcript renders the conversation as plain text
+func transcript(s state.AppState) string {
+	var b strings.Builder
+	for _, msg := range s.Context.Messages {
+		content := strings.TrimSpace(msg.Content)
+		if notice := ui.FinishNotice(msg.FinishReason); notice != "" {
+			content = strings.TrimSpace(fmt.Sprintf("%s\n[%s]", content, notice))
+		}
+		fmt.Fprintf(&b, "%s:\n%s\n\n", msg.Role, content)
+	}
+	return b.String()
+}
@@ -2,6 +2,8 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
+	"os"
 	"testing"
 
 	"github.com/adamveld12/tai/internal/llm"
@@ -320,6 +322,26 @@ func TestReplHandler_ComponentIntegration(t *testing.T) {
 	})
 }
 
+func TestNewReplHandler_ProviderWiring(t *testing.T) {
+	handler := NewReplHandler(&Config{WorkingDirectory: "/test", Model: "test-model"})
+
+	repl, ok := handler.Stack.Active().(*ui.REPLScreen)
+	if !ok {
+		t.Fatalf("Active screen = %T, want the REPL", handler.Stack.Active())
+	}
+	if repl.Provider != handler.Provider {
+		t.Error("Expected the REPL to answer with the handler's provider")
+	}
+	if repl.Dispatcher != handler.Dispatcher {
+		t.Error("Expected the REPL to share the handler's dispatcher")
+	}
+
+	model := handler.Dispatcher.GetState().Model
+	if model.Provider != string(handler.Provider.Name()) || model.Name != "test-model" {
+		t.Errorf("state model = %s/%s, want the provider and model the handler was built with", model.Provider, model.Name)
+	}
+}
+
 func TestReplHandler_ErrorHandling(t *testing.T) {
 	// Test various error conditions that might occur
 	t.Run("nil_config", func(t *testing.T) {
@@ -383,3 +405,77 @@ func TestReplHandler_MemoryUsage(t *testing.T) {
 		}
 	}
 }
+
+func TestReplHandler_NoAltScreen(t *testing.T) {
+	tests := []struct {
+		name        string
+		noAltScreen bool
+		wantOptions int
+	}{
+		{name: "alt screen by default", noAltScreen: false, wantOptions: 2},
+		{name: "inline when disabled", noAltScreen: true, wantOptions: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{WorkingDirectory: "/tmp", NoAltScreen: tt.noAltScreen}
+			if got := len(programOptions(config)); got != tt.wantOptions {
+				t.Errorf("programOptions() returned %d options, want %d", got, tt.wantOptions)
+			}
+
+			handler := NewReplHandler(config)
+			if handler.Program == nil {
+				t.Fatal("Program should not be nil")
+			}
+		})
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	s := state.AppState{Context: state.Context{Messages: []state.Message{
+		{Role: state.RoleUser, Content: "hello"},
+		{Role: state.RoleAssistant, Content: "hi there\n"},
+	}}}
+
+	want := "user:\nhello\n\nassistant:\nhi there\n\n"
+	if got := transcript(s); got != want {
+		t.Errorf("transcript() = %q, want %q", got, want)
+	}
+}
+
+func TestResumeSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir, err := state.DefaultSessionsDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := state.NewMemoryState("Saved prompt", "/saved", "saved").GetState().Context
+	saved.Messages = []state.Message{{Role: state.RoleUser, Content: "remember me"}}
+	data, _ := json.Marshal(saved)
+	if err := os.WriteFile(state.SessionPath(dir, "saved"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(state.SessionPath(dir, "corrupt"), []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	name, opts := resumeSession("saved")
+	s := state.NewMemoryStateWithOptions("", "", name, opts...).GetState()
+	if s.Context.SessionID != "saved" || len(s.Context.Messages) != 1 || s.Context.Messages[0].Content != "remember me" {
+		t.Errorf("resumed context = %+v, want the saved session", s.Context)
+	}
+
+	name, opts = resumeSession("new")
+	if name != "new" || len(opts) != 0 {
+		t.Errorf("resumeSession(new) = %q, %d options; want a fresh session named new", name, len(opts))
+	}
+
+	name, opts = resumeSession("corrupt")
+	if name != "" || len(opts) != 0 {
+		t.Errorf("resumeSession(corrupt) = %q, %d options; want a fresh session under a new name", name, len(opts))
+	}
+}
@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Defaults for the build details of a binary built without -ldflags
+const (
+	DefaultVersion = "dev"
+	DefaultCommit  = "none"
+	DefaultDate    = "unknown"
+)
+
+// readBuildInfo is replaced in tests so they don't depend on how the test binary was built
+var readBuildInfo = debug.ReadBuildInfo
+
+// FormatVersion renders the -version output, e.g. "tai v1.2.0 (commit 1a2b3c4, built
+// 2025-01-02T03:04:05Z)". Details left at their defaults are filled in from what the Go
+// toolchain recorded in the binary where it can, as for go install ...@v1.2.0.
+func FormatVersion(version, commit, date string) string {
+	if info, ok := readBuildInfo(); ok {
+		if version == DefaultVersion && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && commit == DefaultCommit:
+				commit = setting.Value
+			case setting.Key == "vcs.time" && date == DefaultDate:
+				date = setting.Value
+			}
+		}
+	}
+
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	return fmt.Sprintf("tai %s (commit %s, built %s)", version, commit, date)
+}
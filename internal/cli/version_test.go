@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestFormatVersion(t *testing.T) {
+	defer func(read func() (*debug.BuildInfo, bool)) { readBuildInfo = read }(readBuildInfo)
+
+	recorded := &debug.BuildInfo{
+		Main: debug.Module{Version: "v0.9.0"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123456789abcdef0123456789abcdef01234567"},
+			{Key: "vcs.time", Value: "2025-01-01T00:00:00Z"},
+		},
+	}
+
+	tests := []struct {
+		name                  string
+		info                  *debug.BuildInfo
+		version, commit, date string
+		want                  string
+	}{
+		{
+			name:    "injected",
+			info:    recorded,
+			version: "v1.2.0", commit: "1a2b3c4", date: "2025-06-01T12:00:00Z",
+			want: "tai v1.2.0 (commit 1a2b3c4, built 2025-06-01T12:00:00Z)",
+		},
+		{
+			name:    "defaults",
+			version: DefaultVersion, commit: DefaultCommit, date: DefaultDate,
+			want: "tai dev (commit none, built unknown)",
+		},
+		{
+			name:    "recorded by the toolchain",
+			info:    recorded,
+			version: DefaultVersion, commit: DefaultCommit, date: DefaultDate,
+			want: "tai v0.9.0 (commit 0123456789ab, built 2025-01-01T00:00:00Z)",
+		},
+		{
+			name:    "local build",
+			info:    &debug.BuildInfo{Main: debug.Module{Version: "(devel)"}},
+			version: DefaultVersion, commit: DefaultCommit, date: DefaultDate,
+			want: "tai dev (commit none, built unknown)",
+		},
+	}
+
+	for _, tt := range tests {
+		readBuildInfo = func() (*debug.BuildInfo, bool) { return tt.info, tt.info != nil }
+		if got := FormatVersion(tt.version, tt.commit, tt.date); got != tt.want {
+			t.Errorf("%s: FormatVersion() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,549 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adamveld12/tai/internal/state"
+)
+
+const (
+	ProviderClaude SupportedProvider = "claude"
+
+	// claudeAPIVersion is the Anthropic API version header value
+	claudeAPIVersion = "2023-06-01"
+
+	// claudeDefaultMaxTokens is used when a request doesn't set MaxTokens, since Claude requires it
+	claudeDefaultMaxTokens = 4096
+)
+
+// ClaudeProvider implements the Provider interface for the Anthropic Messages API
+type ClaudeProvider struct {
+	client       *http.Client
+	config       ProviderConfig
+	defaultModel string
+	jitter       *backoffJitter
+}
+
+// ClaudeAPIError is returned when the Anthropic API responds with a non-2xx status
+type ClaudeAPIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *ClaudeAPIError) Error() string {
+	return fmt.Sprintf("claude API error (status %d): %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// NewClaudeProvider creates a new Claude provider instance
+func NewClaudeProvider(config ProviderConfig) (*ClaudeProvider, error) {
+	if config.APIKey == "" {
+		return nil, errors.New("claude provider requires an API key (set ANTHROPIC_API_KEY)")
+	}
+
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURLs[ProviderClaude]
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	if config.DefaultModel == "" {
+		config.DefaultModel = DefaultModels[ProviderClaude]
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	return &ClaudeProvider{
+		client:       newHTTPClient(config),
+		config:       config,
+		defaultModel: config.DefaultModel,
+		jitter:       newBackoffJitter(time.Now().UnixNano()),
+	}, nil
+}
+
+// Name returns the provider name
+func (p *ClaudeProvider) Name() SupportedProvider {
+	return ProviderClaude
+}
+
+// ChatCompletion sends a chat completion request and returns the response
+func (p *ClaudeProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	if err := checkClaudeRequest(req); err != nil {
+		return nil, fmt.Errorf("chat completion failed: %w", err)
+	}
+
+	claudeReq := p.convertToClaudeRequest(req, false)
+
+	// Apply timeout
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	startTime := time.Now()
+
+	var resp claudeResponse
+	err := retryRequest(ctx, p.config, p.jitter, func(ctx context.Context) error {
+		httpResp, err := p.do(ctx, http.MethodPost, "/messages", claudeReq)
+		if err != nil {
+			return err
+		}
+		defer httpResp.Body.Close()
+
+		return json.NewDecoder(httpResp.Body).Decode(&resp)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("chat completion failed: %w", err)
+	}
+
+	return p.convertFromClaudeResponse(resp, time.Since(startTime)), nil
+}
+
+// checkClaudeRequest rejects the parts of a request the Messages API has no equivalent
+// for, and messages it couldn't take
+func checkClaudeRequest(req ChatRequest) error {
+	if req.ResponseFormat != nil {
+		return fmt.Errorf("response format %q: %w", req.ResponseFormat.Type, ErrUnsupported)
+	}
+	if err := checkRoles(req.Messages); err != nil {
+		return err
+	}
+	return checkToolResults(req.Messages)
+}
+
+// StreamChatCompletion sends a streaming chat completion request
+func (p *ClaudeProvider) StreamChatCompletion(ctx context.Context, req ChatRequest) (<-chan ChatStreamChunk, error) {
+	if err := checkClaudeRequest(req); err != nil {
+		return nil, fmt.Errorf("stream creation failed: %w", err)
+	}
+
+	claudeReq := p.convertToClaudeRequest(req, true)
+
+	// Apply timeout
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+
+	httpResp, idle, err := openStream(ctx, p.config, p.jitter, func(ctx context.Context) (*http.Response, error) {
+		return p.do(ctx, http.MethodPost, "/messages", claudeReq)
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("stream creation failed: %w", err)
+	}
+
+	chunkChan := make(chan ChatStreamChunk)
+
+	go func() {
+		defer close(chunkChan)
+		defer cancel()
+		defer idle.stop()
+		defer httpResp.Body.Close()
+
+		send := func(chunk ChatStreamChunk) bool {
+			select {
+			case chunkChan <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var model, finishReason string
+		var usage TokenUsage
+		toolCalls := map[int]*state.ToolCall{}
+
+		reader := bufio.NewReader(httpResp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					send(ChatStreamChunk{Model: model, Usage: usage, FinishReason: finishReason, Done: true})
+				} else {
+					send(ChatStreamChunk{Error: fmt.Errorf("stream error: %w", idle.err(err)), Done: true})
+				}
+				return
+			}
+			idle.reset()
+
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+
+			var event claudeStreamEvent
+			if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+				send(ChatStreamChunk{Error: fmt.Errorf("stream error: %w", err), Done: true})
+				return
+			}
+
+			switch event.Type {
+			case "message_start":
+				if event.Message != nil {
+					model = event.Message.Model
+					usage.PromptTokens = event.Message.Usage.InputTokens
+				}
+			case "content_block_start":
+				if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+					toolCalls[event.Index] = &state.ToolCall{
+						ID:       event.ContentBlock.ID,
+						Type:     "function",
+						Function: state.ToolCallFunction{Name: event.ContentBlock.Name},
+					}
+				}
+			case "content_block_delta":
+				if event.Delta == nil {
+					continue
+				}
+				switch event.Delta.Type {
+				case "text_delta":
+					if !send(ChatStreamChunk{Model: model, Delta: event.Delta.Text}) {
+						return
+					}
+				case "input_json_delta":
+					if tc, ok := toolCalls[event.Index]; ok {
+						tc.Function.Arguments += event.Delta.PartialJSON
+					}
+				}
+			case "content_block_stop":
+				// tool calls are only emitted once their arguments are complete
+				if tc, ok := toolCalls[event.Index]; ok {
+					delete(toolCalls, event.Index)
+					if tc.Function.Arguments == "" {
+						tc.Function.Arguments = "{}"
+					}
+					if !send(ChatStreamChunk{Model: model, ToolCalls: []state.ToolCall{*tc}}) {
+						return
+					}
+				}
+			case "message_delta":
+				if event.Delta != nil && event.Delta.StopReason != "" {
+					finishReason = claudeFinishReason(event.Delta.StopReason)
+				}
+				if event.Usage != nil {
+					usage.CompletionTokens = event.Usage.OutputTokens
+					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+				}
+			case "message_stop":
+				send(ChatStreamChunk{Model: model, Usage: usage, FinishReason: finishReason, Done: true})
+				return
+			case "error":
+				apiErr := &ClaudeAPIError{StatusCode: http.StatusOK}
+				if event.Error != nil {
+					apiErr.Type = event.Error.Type
+					apiErr.Message = event.Error.Message
+				}
+				send(ChatStreamChunk{Error: fmt.Errorf("stream error: %w", apiErr), Done: true})
+				return
+			}
+		}
+	}()
+
+	return chunkChan, nil
+}
+
+// Models returns the models available to the configured API key
+func (p *ClaudeProvider) Models(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	resp, err := p.do(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode models: %w", err)
+	}
+
+	models := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// do sends a request to the Anthropic API, turning non-2xx responses into a ClaudeAPIError.
+// Client errors other than timeouts and rate limits are marked as permanent so they aren't retried.
+func (p *ClaudeProvider) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, permanent(fmt.Errorf("failed to encode request: %w", err))
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, p.config.BaseURL+path, reader)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("failed to create request: %w", err))
+	}
+
+	httpReq.Header.Set("x-api-key", p.config.APIKey)
+	httpReq.Header.Set("anthropic-version", claudeAPIVersion)
+	httpReq.Header.Set("content-type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &ClaudeAPIError{StatusCode: resp.StatusCode, Type: "api_error", Message: http.StatusText(resp.StatusCode)}
+	var errResp struct {
+		Error claudeErrorDetail `json:"error"`
+	}
+	if data, err := io.ReadAll(resp.Body); err == nil && json.Unmarshal(data, &errResp) == nil && errResp.Error.Type != "" {
+		apiErr.Type = errResp.Error.Type
+		apiErr.Message = errResp.Error.Message
+	}
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return nil, permanent(apiErr)
+	}
+
+	return nil, apiErr
+}
+
+// convertToClaudeRequest converts our ChatRequest to the Messages API format
+func (p *ClaudeProvider) convertToClaudeRequest(req ChatRequest, stream bool) claudeRequest {
+	model := req.Model
+	if model == "" {
+		model = p.defaultModel
+	}
+
+	claudeReq := claudeRequest{
+		Model:     model,
+		MaxTokens: req.MaxTokens,
+		Stream:    stream,
+		Messages:  make([]claudeMessage, 0, len(req.Messages)),
+	}
+
+	if claudeReq.MaxTokens <= 0 {
+		claudeReq.MaxTokens = claudeDefaultMaxTokens
+	}
+
+	claudeReq.Temperature = req.Temperature
+	claudeReq.TopP = req.TopP
+
+	if len(req.Stop) > 0 {
+		claudeReq.StopSequences = req.Stop
+	}
+
+	// Claude takes the system prompt as a top level field rather than a message
+	system := []string{}
+	if req.SystemPrompt != "" {
+		system = append(system, req.SystemPrompt)
+	}
+
+	for _, msg := range req.Messages {
+		var role string
+		var blocks []claudeContentBlock
+
+		switch msg.Role {
+		case state.RoleSystem:
+			if msg.Content != "" {
+				system = append(system, msg.Content)
+			}
+			continue
+		case state.RoleTool:
+			// tool results are sent back as user content blocks referencing the tool_use id
+			role = string(state.RoleUser)
+			for _, tc := range msg.ToolCalls {
+				blocks = append(blocks, claudeContentBlock{Type: "tool_result", ToolUseID: tc.ID, Content: msg.Content})
+			}
+		default:
+			role = string(msg.Role)
+			if msg.Content != "" {
+				blocks = append(blocks, claudeContentBlock{Type: "text", Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				input := tc.Function.Arguments
+				if input == "" {
+					input = "{}"
+				}
+				blocks = append(blocks, claudeContentBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: json.RawMessage(input)})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		// consecutive messages from the same role are merged since Claude expects roles to alternate
+		if last := len(claudeReq.Messages) - 1; last >= 0 && claudeReq.Messages[last].Role == role {
+			claudeReq.Messages[last].Content = append(claudeReq.Messages[last].Content, blocks...)
+			continue
+		}
+
+		claudeReq.Messages = append(claudeReq.Messages, claudeMessage{Role: role, Content: blocks})
+	}
+
+	claudeReq.System = strings.Join(system, "\n\n")
+
+	if len(req.Tools) > 0 {
+		claudeReq.Tools = make([]claudeTool, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			claudeReq.Tools = append(claudeReq.Tools, claudeTool{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				InputSchema: tool.Function.Parameters,
+			})
+		}
+	}
+
+	switch req.ToolChoice {
+	case "":
+	case "auto", "none":
+		claudeReq.ToolChoice = &claudeToolChoice{Type: req.ToolChoice}
+	case "required", "any":
+		claudeReq.ToolChoice = &claudeToolChoice{Type: "any"}
+	default:
+		claudeReq.ToolChoice = &claudeToolChoice{Type: "tool", Name: req.ToolChoice}
+	}
+
+	return claudeReq
+}
+
+// convertFromClaudeResponse converts a Messages API response to our format
+func (p *ClaudeProvider) convertFromClaudeResponse(resp claudeResponse, duration time.Duration) *ChatResponse {
+	response := &ChatResponse{
+		Model:        resp.Model,
+		CreatedAt:    time.Now(),
+		Duration:     duration,
+		FinishReason: claudeFinishReason(resp.StopReason),
+		Usage: TokenUsage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	}
+
+	var content strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			content.WriteString(block.Text)
+		case "tool_use":
+			args := string(block.Input)
+			if args == "" {
+				args = "{}"
+			}
+			response.ToolCalls = append(response.ToolCalls, state.ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: state.ToolCallFunction{Name: block.Name, Arguments: args},
+			})
+		}
+	}
+	response.Content = content.String()
+
+	return response
+}
+
+// claudeFinishReason maps Claude's stop_reason onto the OpenAI style finish reasons used elsewhere
+func claudeFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return FinishReasonToolCalls
+	case "refusal":
+		return FinishReasonContentFilter
+	default:
+		return stopReason
+	}
+}
+
+type claudeRequest struct {
+	Model         string            `json:"model"`
+	System        string            `json:"system,omitempty"`
+	Messages      []claudeMessage   `json:"messages"`
+	MaxTokens     int               `json:"max_tokens"`
+	Temperature   *float64          `json:"temperature,omitempty"`
+	TopP          *float64          `json:"top_p,omitempty"`
+	StopSequences []string          `json:"stop_sequences,omitempty"`
+	Stream        bool              `json:"stream,omitempty"`
+	Tools         []claudeTool      `json:"tools,omitempty"`
+	ToolChoice    *claudeToolChoice `json:"tool_choice,omitempty"`
+}
+
+type claudeMessage struct {
+	Role    string               `json:"role"`
+	Content []claudeContentBlock `json:"content"`
+}
+
+type claudeContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type claudeTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type claudeToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type claudeResponse struct {
+	ID         string               `json:"id"`
+	Model      string               `json:"model"`
+	Content    []claudeContentBlock `json:"content"`
+	StopReason string               `json:"stop_reason"`
+	Usage      claudeUsage          `json:"usage"`
+}
+
+type claudeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type claudeErrorDetail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type claudeStreamEvent struct {
+	Type         string              `json:"type"`
+	Index        int                 `json:"index"`
+	Message      *claudeResponse     `json:"message,omitempty"`
+	ContentBlock *claudeContentBlock `json:"content_block,omitempty"`
+	Delta        *struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta,omitempty"`
+	Usage *claudeUsage       `json:"usage,omitempty"`
+	Error *claudeErrorDetail `json:"error,omitempty"`
+}
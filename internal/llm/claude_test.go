@@ -0,0 +1,428 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// Test Infrastructure
+// =============================================================================
+
+// claudeMockServer records Messages API requests and replies with a canned handler
+type claudeMockServer struct {
+	server   *httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newClaudeMockServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, call int)) *claudeMockServer {
+	t.Helper()
+
+	ms := &claudeMockServer{}
+	ms.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		ms.mu.Lock()
+		ms.requests = append(ms.requests, r)
+		ms.bodies = append(ms.bodies, body)
+		call := len(ms.requests)
+		ms.mu.Unlock()
+
+		handler(w, r, call)
+	}))
+
+	return ms
+}
+
+func (ms *claudeMockServer) RequestCount() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.requests)
+}
+
+func (ms *claudeMockServer) Request(i int) (*http.Request, map[string]interface{}) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var body map[string]interface{}
+	_ = json.Unmarshal(ms.bodies[i], &body)
+	return ms.requests[i], body
+}
+
+func newTestClaudeProvider(t *testing.T, config ProviderConfig) *ClaudeProvider {
+	t.Helper()
+
+	if config.APIKey == "" {
+		config.APIKey = "test-key"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = testTimeout
+	}
+
+	provider, err := NewClaudeProvider(config)
+	require.NoError(t, err, "failed to create provider")
+	return provider
+}
+
+func writeSSE(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range events {
+		var typed struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal([]byte(event), &typed)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// =============================================================================
+// Constructor Tests
+// =============================================================================
+
+func TestNewClaudeProvider(t *testing.T) {
+	t.Run("defaults_applied_correctly", func(t *testing.T) {
+		p, err := NewClaudeProvider(ProviderConfig{APIKey: "key"})
+		require.NoError(t, err)
+
+		assert.Equal(t, "https://api.anthropic.com/v1", p.config.BaseURL)
+		assert.NotEmpty(t, p.defaultModel)
+		assert.NotZero(t, p.config.Timeout)
+		assert.Equal(t, ProviderClaude, p.Name())
+	})
+
+	t.Run("api_key_required", func(t *testing.T) {
+		_, err := NewClaudeProvider(ProviderConfig{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ANTHROPIC_API_KEY")
+	})
+}
+
+// =============================================================================
+// ChatCompletion Tests
+// =============================================================================
+
+func TestClaudeChatCompletion_SuccessScenarios(t *testing.T) {
+	mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{
+			"id": "msg_1",
+			"model": "claude-test",
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 12, "output_tokens": 7},
+			"content": [
+				{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"location": "New York"}}
+			]
+		}`)
+	})
+	defer mock.server.Close()
+
+	provider := newTestClaudeProvider(t, ProviderConfig{BaseURL: mock.server.URL, APIKey: "secret"})
+
+	resp, err := provider.ChatCompletion(context.Background(), ChatRequest{
+		SystemPrompt: "You are helpful",
+		Messages: []state.Message{
+			{Role: state.RoleUser, Content: "Weather?"},
+			{Role: state.RoleAssistant, ToolCalls: []state.ToolCall{{ID: "toolu_0", Type: "function", Function: state.ToolCallFunction{Name: "get_weather", Arguments: `{"location":"Paris"}`}}}},
+			{Role: state.RoleTool, Content: "sunny", ToolCalls: []state.ToolCall{{ID: "toolu_0"}}},
+		},
+		Tools: []Tool{{
+			Type: "function",
+			Function: ToolFunction{
+				Name:        "get_weather",
+				Description: "Get the weather",
+				Parameters:  map[string]interface{}{"type": "object"},
+			},
+		}},
+		ToolChoice: "auto",
+	})
+	require.NoError(t, err)
+
+	t.Run("response_mapped", func(t *testing.T) {
+		assert.Equal(t, "Let me check.", resp.Content)
+		assert.Equal(t, "claude-test", resp.Model)
+		assert.Equal(t, "tool_calls", resp.FinishReason)
+		assert.Equal(t, TokenUsage{PromptTokens: 12, CompletionTokens: 7, TotalTokens: 19}, resp.Usage)
+		require.Len(t, resp.ToolCalls, 1)
+		assert.Equal(t, "toolu_1", resp.ToolCalls[0].ID)
+		assert.Equal(t, "get_weather", resp.ToolCalls[0].Function.Name)
+		assert.JSONEq(t, `{"location":"New York"}`, resp.ToolCalls[0].Function.Arguments)
+	})
+
+	t.Run("request_shape", func(t *testing.T) {
+		require.Equal(t, 1, mock.RequestCount())
+		r, body := mock.Request(0)
+
+		assert.Equal(t, "/messages", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("x-api-key"))
+		assert.Equal(t, claudeAPIVersion, r.Header.Get("anthropic-version"))
+
+		assert.Equal(t, "You are helpful", body["system"], "system prompt should be a top level field")
+		assert.EqualValues(t, claudeDefaultMaxTokens, body["max_tokens"], "max_tokens is required by Claude")
+		assert.Equal(t, map[string]interface{}{"type": "auto"}, body["tool_choice"])
+
+		tools := body["tools"].([]interface{})
+		require.Len(t, tools, 1)
+		assert.Equal(t, "get_weather", tools[0].(map[string]interface{})["name"])
+		assert.NotNil(t, tools[0].(map[string]interface{})["input_schema"])
+
+		messages := body["messages"].([]interface{})
+		require.Len(t, messages, 3)
+
+		assistant := messages[1].(map[string]interface{})
+		assert.Equal(t, "assistant", assistant["role"])
+		toolUse := assistant["content"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "tool_use", toolUse["type"])
+		assert.Equal(t, map[string]interface{}{"location": "Paris"}, toolUse["input"])
+
+		toolResult := messages[2].(map[string]interface{})
+		assert.Equal(t, "user", toolResult["role"], "tool results are sent as user content")
+		block := toolResult["content"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "tool_result", block["type"])
+		assert.Equal(t, "toolu_0", block["tool_use_id"])
+		assert.Equal(t, "sunny", block["content"])
+	})
+}
+
+func TestClaudeChatCompletion_ErrorScenarios(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		maxRetries    int
+		expectedCalls int
+		errorContains string
+	}{
+		{
+			name:          "authentication_error_not_retried",
+			status:        http.StatusUnauthorized,
+			maxRetries:    3,
+			expectedCalls: 1,
+			errorContains: "authentication_error",
+		},
+		{
+			name:          "server_error_retried",
+			status:        http.StatusInternalServerError,
+			maxRetries:    2,
+			expectedCalls: 2,
+			errorContains: "request failed after 2 retries",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+				errType := "api_error"
+				if tt.status == http.StatusUnauthorized {
+					errType = "authentication_error"
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprintf(w, `{"type":"error","error":{"type":%q,"message":"nope"}}`, errType)
+			})
+			defer mock.server.Close()
+
+			provider := newTestClaudeProvider(t, ProviderConfig{BaseURL: mock.server.URL, MaxRetries: tt.maxRetries})
+
+			resp, err := provider.ChatCompletion(context.Background(), ChatRequest{
+				Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+			})
+
+			require.Error(t, err)
+			assert.Nil(t, resp)
+			assert.Contains(t, err.Error(), tt.errorContains)
+			assert.Equal(t, tt.expectedCalls, mock.RequestCount())
+
+			var apiErr *ClaudeAPIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.status, apiErr.StatusCode)
+		})
+	}
+}
+
+// =============================================================================
+// StreamChatCompletion Tests
+// =============================================================================
+
+func TestClaudeStreamChatCompletion_SuccessScenarios(t *testing.T) {
+	mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		writeSSE(w,
+			`{"type":"message_start","message":{"id":"msg_1","model":"claude-test","usage":{"input_tokens":10,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"location\":"}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":" \"New York\"}"}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":15}}`,
+			`{"type":"message_stop"}`,
+		)
+	})
+	defer mock.server.Close()
+
+	provider := newTestClaudeProvider(t, ProviderConfig{BaseURL: mock.server.URL})
+
+	chunks, err := provider.StreamChatCompletion(context.Background(), ChatRequest{
+		Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+	})
+	require.NoError(t, err)
+
+	var content strings.Builder
+	var toolCalls []state.ToolCall
+	var final ChatStreamChunk
+	for chunk := range chunks {
+		require.NoError(t, chunk.Error)
+		content.WriteString(chunk.Delta)
+		toolCalls = append(toolCalls, chunk.ToolCalls...)
+		final = chunk
+	}
+
+	assert.Equal(t, "Hello world", content.String())
+	assert.True(t, final.Done)
+	assert.Equal(t, TokenUsage{PromptTokens: 10, CompletionTokens: 15, TotalTokens: 25}, final.Usage)
+
+	require.Len(t, toolCalls, 1, "tool call should be emitted once, fully assembled")
+	assert.Equal(t, "toolu_1", toolCalls[0].ID)
+	assert.JSONEq(t, `{"location":"New York"}`, toolCalls[0].Function.Arguments)
+
+	_, body := mock.Request(0)
+	assert.Equal(t, true, body["stream"])
+}
+
+func TestClaudeStreamChatCompletion_ErrorScenarios(t *testing.T) {
+	t.Run("error_event", func(t *testing.T) {
+		mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+			writeSSE(w,
+				`{"type":"message_start","message":{"id":"msg_1","model":"claude-test","usage":{"input_tokens":1}}}`,
+				`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			)
+		})
+		defer mock.server.Close()
+
+		provider := newTestClaudeProvider(t, ProviderConfig{BaseURL: mock.server.URL})
+		chunks, err := provider.StreamChatCompletion(context.Background(), ChatRequest{
+			Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+		})
+		require.NoError(t, err)
+
+		var last ChatStreamChunk
+		for chunk := range chunks {
+			last = chunk
+		}
+
+		require.Error(t, last.Error)
+		assert.Contains(t, last.Error.Error(), "overloaded_error")
+		assert.True(t, last.Done)
+	})
+
+	t.Run("creation_failure", func(t *testing.T) {
+		mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`)
+		})
+		defer mock.server.Close()
+
+		provider := newTestClaudeProvider(t, ProviderConfig{BaseURL: mock.server.URL})
+		chunks, err := provider.StreamChatCompletion(context.Background(), ChatRequest{
+			Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+		})
+		require.Error(t, err)
+		assert.Nil(t, chunks)
+		assert.Contains(t, err.Error(), "invalid_request_error")
+	})
+}
+
+// =============================================================================
+// Models and Registration Tests
+// =============================================================================
+
+func TestClaudeModels(t *testing.T) {
+	mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		assert.Equal(t, "/models", r.URL.Path)
+		_, _ = io.WriteString(w, `{"data":[{"id":"claude-a"},{"id":"claude-b"}]}`)
+	})
+	defer mock.server.Close()
+
+	provider := newTestClaudeProvider(t, ProviderConfig{BaseURL: mock.server.URL})
+	models, err := provider.Models(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claude-a", "claude-b"}, models)
+}
+
+func TestGetProvider(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "env-key")
+
+	tests := []struct {
+		name     string
+		provider SupportedProvider
+		expected SupportedProvider
+		wantErr  bool
+	}{
+		{name: "default", provider: "", expected: ProviderLMStudio},
+		{name: "lmstudio", provider: ProviderLMStudio, expected: ProviderLMStudio},
+		{name: "claude", provider: ProviderClaude, expected: ProviderClaude},
+		{name: "unknown", provider: "nope", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := GetProvider(tt.provider, ProviderConfig{})
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Nil(t, p)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, p.Name())
+		})
+	}
+
+	p, err := GetProvider(ProviderClaude, ProviderConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, "env-key", p.(*ClaudeProvider).config.APIKey)
+}
+
+func TestConvertToClaudeRequest_StopSequences(t *testing.T) {
+	provider, err := NewClaudeProvider(ProviderConfig{APIKey: "test-key"})
+	require.NoError(t, err)
+
+	req := provider.convertToClaudeRequest(ChatRequest{
+		Messages: []state.Message{{Role: state.RoleUser, Content: "Hello"}},
+		Stop:     []string{"END"},
+	}, false)
+	assert.Equal(t, []string{"END"}, req.StopSequences)
+}
+
+func TestClaudeProvider_ResponseFormatUnsupported(t *testing.T) {
+	provider, err := NewClaudeProvider(ProviderConfig{APIKey: "test-key", BaseURL: "http://127.0.0.1:0"})
+	require.NoError(t, err)
+
+	req := ChatRequest{
+		Messages:       []state.Message{{Role: state.RoleUser, Content: "Hello"}},
+		ResponseFormat: &ResponseFormat{Type: ResponseFormatJSONObject},
+	}
+
+	_, err = provider.ChatCompletion(context.Background(), req)
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	_, err = provider.StreamChatCompletion(context.Background(), req)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
@@ -0,0 +1,636 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adamveld12/tai/internal/state"
+)
+
+const ProviderGemini SupportedProvider = "gemini"
+
+// GeminiProvider implements the Provider interface for Google's Gemini API
+// (generativelanguage.googleapis.com)
+type GeminiProvider struct {
+	client       *http.Client
+	config       ProviderConfig
+	defaultModel string
+	jitter       *backoffJitter
+}
+
+// GeminiAPIError is returned when the Gemini API responds with a non-2xx status
+type GeminiAPIError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *GeminiAPIError) Error() string {
+	return fmt.Sprintf("gemini API error (status %d): %s: %s", e.StatusCode, e.Status, e.Message)
+}
+
+// NewGeminiProvider creates a new Gemini provider instance
+func NewGeminiProvider(config ProviderConfig) (*GeminiProvider, error) {
+	if config.APIKey == "" {
+		return nil, errors.New("gemini provider requires an API key (set GEMINI_API_KEY)")
+	}
+
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURLs[ProviderGemini]
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	if config.DefaultModel == "" {
+		config.DefaultModel = DefaultModels[ProviderGemini]
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	return &GeminiProvider{
+		client:       newHTTPClient(config),
+		config:       config,
+		defaultModel: config.DefaultModel,
+		jitter:       newBackoffJitter(time.Now().UnixNano()),
+	}, nil
+}
+
+// Name returns the provider name
+func (p *GeminiProvider) Name() SupportedProvider {
+	return ProviderGemini
+}
+
+// ChatCompletion sends a chat completion request and returns the response
+func (p *GeminiProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	if err := checkRoles(req.Messages); err != nil {
+		return nil, fmt.Errorf("chat completion failed: %w", err)
+	}
+
+	model, geminiReq := p.convertToGeminiRequest(req)
+
+	// Apply timeout
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	startTime := time.Now()
+
+	var resp geminiResponse
+	err := retryRequest(ctx, p.config, p.jitter, func(ctx context.Context) error {
+		httpResp, err := p.do(ctx, http.MethodPost, geminiModelPath(model)+":generateContent", geminiReq)
+		if err != nil {
+			return err
+		}
+		defer httpResp.Body.Close()
+
+		return json.NewDecoder(httpResp.Body).Decode(&resp)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("chat completion failed: %w", geminiModelError(err, model))
+	}
+
+	response := &ChatResponse{
+		Model:     resp.ModelVersion,
+		CreatedAt: time.Now(),
+		Duration:  time.Since(startTime),
+		Usage:     resp.UsageMetadata.usage(),
+	}
+	if response.Model == "" {
+		response.Model = model
+	}
+
+	var content strings.Builder
+	var reason string
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			content.WriteString(part.Text)
+		}
+		response.ToolCalls = convertToolCallsFromGemini(candidate.Content.Parts)
+		reason = candidate.FinishReason
+	}
+	response.Content = content.String()
+	response.FinishReason = geminiFinishReason(reason, resp.PromptFeedback, len(response.ToolCalls) > 0)
+
+	return response, nil
+}
+
+// StreamChatCompletion sends a streaming chat completion request
+func (p *GeminiProvider) StreamChatCompletion(ctx context.Context, req ChatRequest) (<-chan ChatStreamChunk, error) {
+	if err := checkRoles(req.Messages); err != nil {
+		return nil, fmt.Errorf("stream creation failed: %w", err)
+	}
+
+	model, geminiReq := p.convertToGeminiRequest(req)
+
+	// Apply timeout
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+
+	httpResp, idle, err := openStream(ctx, p.config, p.jitter, func(ctx context.Context) (*http.Response, error) {
+		return p.do(ctx, http.MethodPost, geminiModelPath(model)+":streamGenerateContent?alt=sse", geminiReq)
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("stream creation failed: %w", geminiModelError(err, model))
+	}
+
+	chunkChan := make(chan ChatStreamChunk)
+
+	go func() {
+		defer close(chunkChan)
+		defer cancel()
+		defer idle.stop()
+		defer httpResp.Body.Close()
+
+		send := func(chunk ChatStreamChunk) bool {
+			select {
+			case chunkChan <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// every event is a whole response holding only what was generated since the last
+		// one, except the usage, which is the running total
+		var reason string
+		var usage TokenUsage
+		var feedback *geminiPromptFeedback
+		toolCalls := false
+
+		reader := bufio.NewReader(httpResp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					send(ChatStreamChunk{Model: model, Usage: usage, FinishReason: geminiFinishReason(reason, feedback, toolCalls), Done: true})
+				} else {
+					send(ChatStreamChunk{Error: fmt.Errorf("stream error: %w", idle.err(err)), Done: true})
+				}
+				return
+			}
+			idle.reset()
+
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+
+			var resp geminiResponse
+			if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &resp); err != nil {
+				send(ChatStreamChunk{Error: fmt.Errorf("stream error: %w", err), Done: true})
+				return
+			}
+
+			if resp.Error != nil {
+				apiErr := &GeminiAPIError{StatusCode: resp.Error.Code, Status: resp.Error.Status, Message: resp.Error.Message}
+				send(ChatStreamChunk{Error: fmt.Errorf("stream error: %w", apiErr), Done: true})
+				return
+			}
+
+			if resp.UsageMetadata != nil {
+				usage = resp.UsageMetadata.usage()
+			}
+			if resp.PromptFeedback != nil {
+				feedback = resp.PromptFeedback
+			}
+			if resp.ModelVersion != "" {
+				model = resp.ModelVersion
+			}
+			if len(resp.Candidates) == 0 {
+				continue
+			}
+
+			candidate := resp.Candidates[0]
+			if candidate.FinishReason != "" {
+				reason = candidate.FinishReason
+			}
+
+			var delta strings.Builder
+			for _, part := range candidate.Content.Parts {
+				delta.WriteString(part.Text)
+			}
+			chunk := ChatStreamChunk{Model: model, Delta: delta.String(), ToolCalls: convertToolCallsFromGemini(candidate.Content.Parts)}
+			toolCalls = toolCalls || len(chunk.ToolCalls) > 0
+
+			if chunk.Delta == "" && len(chunk.ToolCalls) == 0 {
+				continue
+			}
+			if !send(chunk) {
+				return
+			}
+		}
+	}()
+
+	return chunkChan, nil
+}
+
+// Models returns the models available to the configured API key that can generate content
+func (p *GeminiProvider) Models(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	var models []string
+	pageToken := ""
+	for {
+		path := "/models?pageSize=1000"
+		if pageToken != "" {
+			path += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+
+		resp, err := p.do(ctx, http.MethodGet, path, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list models: %w", err)
+		}
+
+		var list struct {
+			Models []struct {
+				Name                       string   `json:"name"`
+				SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+			} `json:"models"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode models: %w", err)
+		}
+
+		for _, m := range list.Models {
+			// embedding and other models can't be chatted with
+			if len(m.SupportedGenerationMethods) > 0 && !containsString(m.SupportedGenerationMethods, "generateContent") {
+				continue
+			}
+			models = append(models, strings.TrimPrefix(m.Name, "models/"))
+		}
+
+		if list.NextPageToken == "" {
+			return models, nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+// do sends a request to the Gemini API, turning non-2xx responses into a GeminiAPIError.
+// Client errors other than timeouts and rate limits are marked as permanent so they aren't
+// retried. The API key goes in a header rather than the URL so it stays out of errors.
+func (p *GeminiProvider) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, permanent(fmt.Errorf("failed to encode request: %w", err))
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, p.config.BaseURL+path, reader)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("failed to create request: %w", err))
+	}
+
+	httpReq.Header.Set("x-goog-api-key", p.config.APIKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &GeminiAPIError{StatusCode: resp.StatusCode, Status: http.StatusText(resp.StatusCode), Message: http.StatusText(resp.StatusCode)}
+	var errResp struct {
+		Error *geminiErrorDetail `json:"error"`
+	}
+	if data, err := io.ReadAll(resp.Body); err == nil && json.Unmarshal(data, &errResp) == nil && errResp.Error != nil {
+		if errResp.Error.Status != "" {
+			apiErr.Status = errResp.Error.Status
+		}
+		apiErr.Message = errResp.Error.Message
+	}
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return nil, permanent(apiErr)
+	}
+
+	return nil, apiErr
+}
+
+// geminiModelPath is the path of model's resource, which also takes the "models/" form
+// the API lists models in
+func geminiModelPath(model string) string {
+	return "/models/" + url.PathEscape(strings.TrimPrefix(model, "models/"))
+}
+
+// geminiModelError tags err with ErrModelNotFound when the API didn't find model
+func geminiModelError(err error, model string) error {
+	var apiErr *GeminiAPIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %q: %w", ErrModelNotFound, model, err)
+	}
+	return err
+}
+
+// convertToGeminiRequest converts our ChatRequest to the generateContent format and
+// returns it along with the model it's for, which is part of the URL rather than the body
+func (p *GeminiProvider) convertToGeminiRequest(req ChatRequest) (string, geminiRequest) {
+	model := req.Model
+	if model == "" {
+		model = p.defaultModel
+	}
+
+	geminiReq := geminiRequest{Contents: make([]geminiContent, 0, len(req.Messages))}
+
+	// unset fields are left out so the model's own defaults apply
+	config := geminiGenerationConfig{
+		MaxOutputTokens: req.MaxTokens,
+		StopSequences:   req.Stop,
+		Seed:            req.Seed,
+
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+	}
+	if req.ResponseFormat != nil {
+		config.ResponseMimeType = "application/json"
+		if req.ResponseFormat.Type == ResponseFormatJSONSchema {
+			config.ResponseSchema = req.ResponseFormat.Schema
+		}
+	}
+	geminiReq.GenerationConfig = &config
+
+	// Gemini takes the system prompt as a top level instruction rather than a message
+	var system []geminiPart
+	if req.SystemPrompt != "" {
+		system = append(system, geminiPart{Text: req.SystemPrompt})
+	}
+
+	// function responses are matched to their calls by name, which tool results don't
+	// always carry, so remember the name of every call made so far
+	callNames := map[string]string{}
+
+	for _, msg := range req.Messages {
+		var role string
+		var parts []geminiPart
+
+		switch msg.Role {
+		case state.RoleSystem:
+			if msg.Content != "" {
+				system = append(system, geminiPart{Text: msg.Content})
+			}
+			continue
+		case state.RoleTool:
+			role = string(state.RoleUser)
+			for _, tc := range msg.ToolCalls {
+				name := tc.Function.Name
+				if name == "" {
+					name = callNames[tc.ID]
+				}
+				parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{
+					ID:       tc.ID,
+					Name:     name,
+					Response: map[string]interface{}{"content": msg.Content},
+				}})
+			}
+		case state.RoleAssistant:
+			role = "model"
+			if msg.Content != "" {
+				parts = append(parts, geminiPart{Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				callNames[tc.ID] = tc.Function.Name
+				args := json.RawMessage(tc.Function.Arguments)
+				if len(args) == 0 {
+					args = json.RawMessage("{}")
+				}
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{ID: tc.ID, Name: tc.Function.Name, Args: args}})
+			}
+		default:
+			role = string(state.RoleUser)
+			if msg.Content != "" {
+				parts = append(parts, geminiPart{Text: msg.Content})
+			}
+		}
+
+		if len(parts) == 0 {
+			continue
+		}
+
+		// consecutive messages from the same role are merged since Gemini expects turns to alternate
+		if last := len(geminiReq.Contents) - 1; last >= 0 && geminiReq.Contents[last].Role == role {
+			geminiReq.Contents[last].Parts = append(geminiReq.Contents[last].Parts, parts...)
+			continue
+		}
+
+		geminiReq.Contents = append(geminiReq.Contents, geminiContent{Role: role, Parts: parts})
+	}
+
+	if len(system) > 0 {
+		geminiReq.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if len(req.Tools) > 0 {
+		declarations := make([]geminiFunctionDeclaration, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			declarations = append(declarations, geminiFunctionDeclaration{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			})
+		}
+		geminiReq.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+	}
+
+	switch req.ToolChoice {
+	case "":
+	case "auto":
+		geminiReq.ToolConfig = &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "AUTO"}}
+	case "none":
+		geminiReq.ToolConfig = &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "NONE"}}
+	case "required", "any":
+		geminiReq.ToolConfig = &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "ANY"}}
+	default:
+		geminiReq.ToolConfig = &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{req.ToolChoice}}}
+	}
+
+	return model, geminiReq
+}
+
+// convertToolCallsFromGemini returns the function calls in parts as tool calls. Gemini
+// doesn't always give calls an ID, so the ones without are given one to match their results by.
+func convertToolCallsFromGemini(parts []geminiPart) []state.ToolCall {
+	var calls []state.ToolCall
+	for _, part := range parts {
+		if part.FunctionCall == nil {
+			continue
+		}
+
+		id := part.FunctionCall.ID
+		if id == "" {
+			id = "call_" + strings.ReplaceAll(state.NewMessageID(), "-", "")
+		}
+		args := string(part.FunctionCall.Args)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		calls = append(calls, state.ToolCall{
+			ID:       id,
+			Type:     "function",
+			Function: state.ToolCallFunction{Name: part.FunctionCall.Name, Arguments: args},
+		})
+	}
+	return calls
+}
+
+// geminiFinishReason maps Gemini's finishReason onto the OpenAI style finish reasons used
+// elsewhere. A prompt blocked before anything was generated only has a block reason.
+func geminiFinishReason(reason string, feedback *geminiPromptFeedback, toolCalls bool) string {
+	if reason == "" && feedback != nil && feedback.BlockReason != "" {
+		return FinishReasonContentFilter
+	}
+
+	switch reason {
+	case "":
+		return ""
+	case "STOP":
+		if toolCalls {
+			return FinishReasonToolCalls
+		}
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return FinishReasonContentFilter
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+// containsString reports whether values holds s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string                 `json:"id,omitempty"`
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig geminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type geminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature      *float64        `json:"temperature,omitempty"`
+	TopP             *float64        `json:"topP,omitempty"`
+	MaxOutputTokens  int             `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string        `json:"stopSequences,omitempty"`
+	PresencePenalty  *float64        `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64        `json:"frequencyPenalty,omitempty"`
+	Seed             *int            `json:"seed,omitempty"`
+	ResponseMimeType string          `json:"responseMimeType,omitempty"`
+	ResponseSchema   json.RawMessage `json:"responseSchema,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates     []geminiCandidate     `json:"candidates"`
+	UsageMetadata  *geminiUsage          `json:"usageMetadata,omitempty"`
+	PromptFeedback *geminiPromptFeedback `json:"promptFeedback,omitempty"`
+	ModelVersion   string                `json:"modelVersion,omitempty"`
+	Error          *geminiErrorDetail    `json:"error,omitempty"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+}
+
+type geminiPromptFeedback struct {
+	BlockReason string `json:"blockReason,omitempty"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// usage converts the usage metadata, which may be missing, to TokenUsage
+func (u *geminiUsage) usage() TokenUsage {
+	if u == nil {
+		return TokenUsage{}
+	}
+	total := u.TotalTokenCount
+	if total == 0 {
+		total = u.PromptTokenCount + u.CandidatesTokenCount
+	}
+	return TokenUsage{PromptTokens: u.PromptTokenCount, CompletionTokens: u.CandidatesTokenCount, TotalTokens: total}
+}
+
+type geminiErrorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
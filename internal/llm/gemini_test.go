@@ -0,0 +1,392 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// Test Infrastructure
+// =============================================================================
+
+func newTestGeminiProvider(t *testing.T, config ProviderConfig) *GeminiProvider {
+	t.Helper()
+
+	if config.APIKey == "" {
+		config.APIKey = "test-key"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = testTimeout
+	}
+
+	provider, err := NewGeminiProvider(config)
+	require.NoError(t, err, "failed to create provider")
+	return provider
+}
+
+// writeGeminiSSE writes events the way streamGenerateContent?alt=sse does, as data lines only
+func writeGeminiSSE(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range events {
+		fmt.Fprintf(w, "data: %s\r\n\r\n", event)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// =============================================================================
+// Constructor Tests
+// =============================================================================
+
+func TestNewGeminiProvider(t *testing.T) {
+	t.Run("defaults_applied_correctly", func(t *testing.T) {
+		p, err := NewGeminiProvider(ProviderConfig{APIKey: "key"})
+		require.NoError(t, err)
+
+		assert.Equal(t, "https://generativelanguage.googleapis.com/v1beta", p.config.BaseURL)
+		assert.Equal(t, DefaultModels[ProviderGemini], p.defaultModel)
+		assert.NotZero(t, p.config.Timeout)
+		assert.Equal(t, ProviderGemini, p.Name())
+	})
+
+	t.Run("api_key_required", func(t *testing.T) {
+		_, err := NewGeminiProvider(ProviderConfig{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), GeminiAPIKeyEnv)
+	})
+}
+
+// =============================================================================
+// ChatCompletion Tests
+// =============================================================================
+
+func TestGeminiChatCompletion_SuccessScenarios(t *testing.T) {
+	mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{
+			"modelVersion": "gemini-test-001",
+			"usageMetadata": {"promptTokenCount": 12, "candidatesTokenCount": 7, "totalTokenCount": 19},
+			"candidates": [{
+				"finishReason": "STOP",
+				"content": {"role": "model", "parts": [
+					{"text": "Let me check."},
+					{"functionCall": {"name": "get_weather", "args": {"location": "Paris"}}}
+				]}
+			}]
+		}`)
+	})
+	defer mock.server.Close()
+
+	provider := newTestGeminiProvider(t, ProviderConfig{BaseURL: mock.server.URL})
+
+	resp, err := provider.ChatCompletion(context.Background(), ChatRequest{
+		Model:        "gemini-test",
+		SystemPrompt: "Be brief.",
+		Temperature:  state.Float(0.5),
+		MaxTokens:    256,
+		Messages: []state.Message{
+			{Role: state.RoleUser, Content: "Weather in Paris?"},
+			{Role: state.RoleAssistant, ToolCalls: []state.ToolCall{{
+				ID:       "call_1",
+				Type:     "function",
+				Function: state.ToolCallFunction{Name: "get_weather", Arguments: `{"location":"Paris"}`},
+			}}},
+			{Role: state.RoleTool, Content: "Sunny", ToolCalls: []state.ToolCall{{ID: "call_1"}}},
+			{Role: state.RoleUser, Content: "And tomorrow?"},
+		},
+		Tools: []Tool{{
+			Type: "function",
+			Function: ToolFunction{
+				Name:        "get_weather",
+				Description: "Get the weather",
+				Parameters:  map[string]interface{}{"type": "object"},
+			},
+		}},
+		ToolChoice: "get_weather",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Let me check.", resp.Content)
+	assert.Equal(t, "gemini-test-001", resp.Model)
+	assert.Equal(t, FinishReasonToolCalls, resp.FinishReason)
+	assert.Equal(t, TokenUsage{PromptTokens: 12, CompletionTokens: 7, TotalTokens: 19}, resp.Usage)
+	require.Len(t, resp.ToolCalls, 1)
+	assert.NotEmpty(t, resp.ToolCalls[0].ID, "calls without an id should be given one")
+	assert.Equal(t, "get_weather", resp.ToolCalls[0].Function.Name)
+	assert.JSONEq(t, `{"location":"Paris"}`, resp.ToolCalls[0].Function.Arguments)
+
+	req, body := mock.Request(0)
+	assert.Equal(t, "/models/gemini-test:generateContent", req.URL.Path)
+	assert.Equal(t, "test-key", req.Header.Get("x-goog-api-key"))
+	assert.Empty(t, req.URL.Query().Get("key"), "the api key should stay out of the url")
+
+	assert.Equal(t, map[string]interface{}{"parts": []interface{}{map[string]interface{}{"text": "Be brief."}}}, body["systemInstruction"])
+
+	contents := body["contents"].([]interface{})
+	require.Len(t, contents, 3, "the tool result and the next user message should share a turn")
+	assert.Equal(t, "user", contents[0].(map[string]interface{})["role"])
+	assert.Equal(t, "model", contents[1].(map[string]interface{})["role"])
+
+	call := contents[1].(map[string]interface{})["parts"].([]interface{})[0].(map[string]interface{})["functionCall"]
+	assert.Equal(t, map[string]interface{}{"id": "call_1", "name": "get_weather", "args": map[string]interface{}{"location": "Paris"}}, call)
+
+	turn := contents[2].(map[string]interface{})
+	assert.Equal(t, "user", turn["role"])
+	parts := turn["parts"].([]interface{})
+	require.Len(t, parts, 2)
+	assert.Equal(t, map[string]interface{}{
+		"id":       "call_1",
+		"name":     "get_weather",
+		"response": map[string]interface{}{"content": "Sunny"},
+	}, parts[0].(map[string]interface{})["functionResponse"], "the result should be named after its call")
+	assert.Equal(t, "And tomorrow?", parts[1].(map[string]interface{})["text"])
+
+	tools := body["tools"].([]interface{})
+	require.Len(t, tools, 1)
+	declarations := tools[0].(map[string]interface{})["functionDeclarations"].([]interface{})
+	require.Len(t, declarations, 1)
+	assert.Equal(t, "get_weather", declarations[0].(map[string]interface{})["name"])
+
+	assert.Equal(t, map[string]interface{}{"functionCallingConfig": map[string]interface{}{
+		"mode":                 "ANY",
+		"allowedFunctionNames": []interface{}{"get_weather"},
+	}}, body["toolConfig"])
+
+	config := body["generationConfig"].(map[string]interface{})
+	assert.Equal(t, 0.5, config["temperature"])
+	assert.Equal(t, float64(256), config["maxOutputTokens"])
+	assert.NotContains(t, config, "topP", "unset parameters should be left to the model")
+}
+
+func TestGeminiChatCompletion_FinishReasons(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"stop", `{"candidates":[{"finishReason":"STOP","content":{"parts":[{"text":"hi"}]}}]}`, "stop"},
+		{"max_tokens", `{"candidates":[{"finishReason":"MAX_TOKENS","content":{"parts":[{"text":"hi"}]}}]}`, "length"},
+		{"safety", `{"candidates":[{"finishReason":"SAFETY","content":{"parts":[]}}]}`, FinishReasonContentFilter},
+		{"blocked_prompt", `{"promptFeedback":{"blockReason":"SAFETY"}}`, FinishReasonContentFilter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+				_, _ = io.WriteString(w, tt.response)
+			})
+			defer mock.server.Close()
+
+			provider := newTestGeminiProvider(t, ProviderConfig{BaseURL: mock.server.URL})
+			resp, err := provider.ChatCompletion(context.Background(), ChatRequest{
+				Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, resp.FinishReason)
+		})
+	}
+}
+
+func TestGeminiChatCompletion_ErrorScenarios(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		maxRetries    int
+		expectedCalls int
+		errorContains string
+		modelNotFound bool
+	}{
+		{
+			name:          "invalid_argument_not_retried",
+			status:        http.StatusBadRequest,
+			maxRetries:    3,
+			expectedCalls: 1,
+			errorContains: "INVALID_ARGUMENT",
+		},
+		{
+			name:          "unknown_model_not_retried",
+			status:        http.StatusNotFound,
+			maxRetries:    3,
+			expectedCalls: 1,
+			errorContains: "NOT_FOUND",
+			modelNotFound: true,
+		},
+		{
+			name:          "server_error_retried",
+			status:        http.StatusServiceUnavailable,
+			maxRetries:    2,
+			expectedCalls: 2,
+			errorContains: "request failed after 2 retries",
+		},
+	}
+
+	statuses := map[int]string{
+		http.StatusBadRequest:         "INVALID_ARGUMENT",
+		http.StatusNotFound:           "NOT_FOUND",
+		http.StatusServiceUnavailable: "UNAVAILABLE",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+				w.WriteHeader(tt.status)
+				fmt.Fprintf(w, `{"error":{"code":%d,"message":"nope","status":%q}}`, tt.status, statuses[tt.status])
+			})
+			defer mock.server.Close()
+
+			provider := newTestGeminiProvider(t, ProviderConfig{BaseURL: mock.server.URL, MaxRetries: tt.maxRetries})
+
+			resp, err := provider.ChatCompletion(context.Background(), ChatRequest{
+				Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+			})
+
+			require.Error(t, err)
+			assert.Nil(t, resp)
+			assert.Contains(t, err.Error(), tt.errorContains)
+			assert.Equal(t, tt.expectedCalls, mock.RequestCount())
+			assert.Equal(t, tt.modelNotFound, IsModelNotFoundError(err))
+
+			var apiErr *GeminiAPIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.status, apiErr.StatusCode)
+		})
+	}
+}
+
+// =============================================================================
+// StreamChatCompletion Tests
+// =============================================================================
+
+func TestGeminiStreamChatCompletion_SuccessScenarios(t *testing.T) {
+	mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		writeGeminiSSE(w,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hello"}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":1,"totalTokenCount":11}}`,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":" world"}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":3,"totalTokenCount":13}}`,
+			`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"id":"fc_1","name":"get_weather","args":{"location":"New York"}}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":15,"totalTokenCount":25}}`,
+		)
+	})
+	defer mock.server.Close()
+
+	provider := newTestGeminiProvider(t, ProviderConfig{BaseURL: mock.server.URL})
+
+	chunks, err := provider.StreamChatCompletion(context.Background(), ChatRequest{
+		Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+	})
+	require.NoError(t, err)
+
+	var content strings.Builder
+	var toolCalls []state.ToolCall
+	var final ChatStreamChunk
+	for chunk := range chunks {
+		require.NoError(t, chunk.Error)
+		content.WriteString(chunk.Delta)
+		toolCalls = append(toolCalls, chunk.ToolCalls...)
+		final = chunk
+	}
+
+	assert.Equal(t, "Hello world", content.String())
+	assert.True(t, final.Done)
+	assert.Equal(t, FinishReasonToolCalls, final.FinishReason)
+	assert.Equal(t, TokenUsage{PromptTokens: 10, CompletionTokens: 15, TotalTokens: 25}, final.Usage)
+
+	require.Len(t, toolCalls, 1)
+	assert.Equal(t, "fc_1", toolCalls[0].ID)
+	assert.JSONEq(t, `{"location":"New York"}`, toolCalls[0].Function.Arguments)
+
+	req, _ := mock.Request(0)
+	assert.Equal(t, "/models/"+DefaultModels[ProviderGemini]+":streamGenerateContent", req.URL.Path)
+	assert.Equal(t, "sse", req.URL.Query().Get("alt"))
+}
+
+func TestGeminiStreamChatCompletion_ErrorScenarios(t *testing.T) {
+	t.Run("error_event", func(t *testing.T) {
+		mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+			writeGeminiSSE(w,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}]}`,
+				`{"error":{"code":503,"message":"The model is overloaded.","status":"UNAVAILABLE"}}`,
+			)
+		})
+		defer mock.server.Close()
+
+		provider := newTestGeminiProvider(t, ProviderConfig{BaseURL: mock.server.URL})
+		chunks, err := provider.StreamChatCompletion(context.Background(), ChatRequest{
+			Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+		})
+		require.NoError(t, err)
+
+		var last ChatStreamChunk
+		for chunk := range chunks {
+			last = chunk
+		}
+
+		require.Error(t, last.Error)
+		assert.Contains(t, last.Error.Error(), "UNAVAILABLE")
+		assert.True(t, last.Done)
+	})
+
+	t.Run("creation_failure", func(t *testing.T) {
+		mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `{"error":{"code":403,"message":"API key not valid.","status":"PERMISSION_DENIED"}}`)
+		})
+		defer mock.server.Close()
+
+		provider := newTestGeminiProvider(t, ProviderConfig{BaseURL: mock.server.URL})
+		chunks, err := provider.StreamChatCompletion(context.Background(), ChatRequest{
+			Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+		})
+		require.Error(t, err)
+		assert.Nil(t, chunks)
+		assert.Contains(t, err.Error(), "API key not valid")
+	})
+}
+
+// =============================================================================
+// Models and Registration Tests
+// =============================================================================
+
+func TestGeminiModels(t *testing.T) {
+	mock := newClaudeMockServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		assert.Equal(t, "/models", r.URL.Path)
+		switch r.URL.Query().Get("pageToken") {
+		case "":
+			_, _ = io.WriteString(w, `{"models":[
+				{"name":"models/gemini-a","supportedGenerationMethods":["generateContent","countTokens"]},
+				{"name":"models/text-embedding","supportedGenerationMethods":["embedContent"]}
+			],"nextPageToken":"page-2"}`)
+		case "page-2":
+			_, _ = io.WriteString(w, `{"models":[{"name":"models/gemini-b","supportedGenerationMethods":["generateContent"]}]}`)
+		default:
+			t.Errorf("unexpected page token %q", r.URL.Query().Get("pageToken"))
+		}
+	})
+	defer mock.server.Close()
+
+	provider := newTestGeminiProvider(t, ProviderConfig{BaseURL: mock.server.URL})
+	models, err := provider.Models(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gemini-a", "gemini-b"}, models)
+	assert.Equal(t, 2, mock.RequestCount())
+}
+
+func TestGetProvider_Gemini(t *testing.T) {
+	t.Setenv(GeminiAPIKeyEnv, "")
+	_, err := GetProvider(ProviderGemini, ProviderConfig{})
+	assert.ErrorContains(t, err, GeminiAPIKeyEnv)
+
+	t.Setenv(GeminiAPIKeyEnv, "env-key")
+	p, err := GetProvider(ProviderGemini, ProviderConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, ProviderGemini, p.Name())
+	assert.Equal(t, "env-key", p.(*GeminiProvider).config.APIKey)
+}
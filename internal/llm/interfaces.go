@@ -2,6 +2,11 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
 	"time"
 
 	"github.com/adamveld12/tai/internal/state"
@@ -29,6 +34,60 @@ type Provider interface {
 	Models(ctx context.Context) ([]string, error)
 }
 
+// FinishReasonContentFilter is the finish reason reported when the provider blocked the output
+const FinishReasonContentFilter = "content_filter"
+
+// FinishReasonToolCalls is the finish reason reported when the model stopped to call tools
+const FinishReasonToolCalls = "tool_calls"
+
+// ErrUnsupported is returned when a request asks for something the provider can't do
+var ErrUnsupported = errors.New("not supported by this provider")
+
+// ErrInvalidMessage is returned when a message in a request can't be sent as it is
+var ErrInvalidMessage = errors.New("invalid message")
+
+// checkRoles rejects messages with a role other than user, assistant, system or tool,
+// which the APIs only report back as a malformed request
+func checkRoles(messages []state.Message) error {
+	for i, msg := range messages {
+		switch msg.Role {
+		case state.RoleUser, state.RoleAssistant, state.RoleSystem, state.RoleTool:
+		default:
+			return fmt.Errorf("message %d has unknown role %q: %w", i, msg.Role, ErrInvalidMessage)
+		}
+	}
+	return nil
+}
+
+// checkToolResults rejects tool results that don't name the tool call they answer, for
+// the APIs that match results to calls by ID
+func checkToolResults(messages []state.Message) error {
+	for i, msg := range messages {
+		if msg.Role == state.RoleTool && (len(msg.ToolCalls) == 0 || msg.ToolCalls[0].ID == "") {
+			return fmt.Errorf("message %d is a tool result without a tool call ID: %w", i, ErrInvalidMessage)
+		}
+	}
+	return nil
+}
+
+// Response format types understood by ResponseFormat
+const (
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// ResponseFormat constrains the model's output to JSON
+type ResponseFormat struct {
+	// Type is ResponseFormatJSONObject for any JSON object, or ResponseFormatJSONSchema to follow Schema
+	Type string `json:"type"`
+
+	// Name identifies the schema, required by some providers for ResponseFormatJSONSchema
+	Name string `json:"name,omitempty"`
+
+	// Schema is the JSON schema the output must match
+	Schema json.RawMessage `json:"schema,omitempty"`
+}
+
 // ChatRequest represents a request to the language model
 type ChatRequest struct {
 	// Messages in the conversation
@@ -40,12 +99,32 @@ type ChatRequest struct {
 	// Maximum tokens to generate
 	MaxTokens int `json:"max_tokens,omitempty"`
 
-	// Temperature for response randomness (0.0 to 1.0)
-	Temperature float64 `json:"temperature,omitempty"`
+	// Temperature for response randomness (0.0 to 2.0). The sampling parameters are
+	// pointers because 0 is a valid value for each, nil leaves it to the provider.
+	Temperature *float64 `json:"temperature,omitempty"`
+
+	// Nucleus sampling probability mass (0.0 to 1.0)
+	TopP *float64 `json:"top_p,omitempty"`
+
+	// Penalizes tokens that already appeared at all (-2.0 to 2.0)
+	PresencePenalty *float64 `json:"presence_penalty,omitempty"`
+
+	// Penalizes tokens by how often they already appeared (-2.0 to 2.0)
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
 
 	// Whether to stream the response
 	Stream bool `json:"stream,omitempty"`
 
+	// Seed for sampling so repeated requests give the same response, nil for a random
+	// seed. A pointer because 0 is a valid seed.
+	Seed *int `json:"seed,omitempty"`
+
+	// Sequences that end generation when the model produces them
+	Stop []string `json:"stop,omitempty"`
+
+	// Constrains the output to JSON, nil for free text
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+
 	// System prompt override
 	SystemPrompt string `json:"system_prompt,omitempty"`
 
@@ -89,6 +168,9 @@ type ChatStreamChunk struct {
 	// Usage statistics
 	Usage TokenUsage `json:"usage"`
 
+	// Why the model stopped generating, set on the chunk that carries it
+	FinishReason string `json:"finish_reason,omitempty"`
+
 	// Whether this is the final chunk
 	Done bool `json:"done"`
 
@@ -156,9 +238,54 @@ type ProviderConfig struct {
 	// Default model to use
 	DefaultModel string `json:"default_model"`
 
-	// Timeout for requests
+	// Timeout for requests, a stream's included. Zero uses DefaultTimeout.
 	Timeout time.Duration `json:"timeout"`
 
 	// Maximum retries on failure
 	MaxRetries int `json:"max_retries"`
+
+	// DisableRetryJitter turns off the randomising of each retry backoff between zero
+	// and its full length, which keeps concurrent clients from retrying in lockstep
+	DisableRetryJitter bool `json:"disable_retry_jitter,omitempty"`
+
+	// MaxBackoff caps the exponential wait between two attempts. A server's longer
+	// Retry-After is still honoured, MaxElapsed and the deadline bound it instead.
+	// Zero uses DefaultMaxBackoff.
+	MaxBackoff time.Duration `json:"max_backoff,omitempty"`
+
+	// MaxElapsed is how long a request may keep being retried, counted from its first
+	// attempt. Retrying stops once the next attempt would start later, even with attempts
+	// left. Zero leaves only the context's deadline and MaxRetries to stop it.
+	MaxElapsed time.Duration `json:"max_elapsed,omitempty"`
+
+	// StreamIdleTimeout ends a stream with ErrStreamIdle when the server sends nothing
+	// for this long, for servers that stall without closing the connection. Zero uses
+	// DefaultStreamIdleTimeout and a negative value waits for as long as Timeout allows.
+	StreamIdleTimeout time.Duration `json:"stream_idle_timeout,omitempty"`
+
+	// ContextBudget is the estimated prompt size in tokens the agent truncates the
+	// conversation to before each request. Zero sends the whole conversation.
+	ContextBudget int `json:"context_budget,omitempty"`
+
+	// Organization and Project select the OpenAI organization and project requests are
+	// billed to, for keys that belong to more than one. Empty uses the key's default.
+	Organization string `json:"organization,omitempty"`
+	Project      string `json:"project,omitempty"`
+
+	// HTTPClient sends the provider's requests, e.g. one with a custom proxy or TLS
+	// configuration. Nil uses a default client, which honours HTTP_PROXY and HTTPS_PROXY.
+	HTTPClient *http.Client `json:"-"`
+
+	// Logger receives every request sent to the provider and its response, with the API
+	// key redacted. Nil logs nothing.
+	Logger *log.Logger `json:"-"`
+}
+
+// DefaultTimeout is how long a request may take when ProviderConfig.Timeout is unset
+const DefaultTimeout = 300 * time.Second
+
+// DefaultProviderConfig returns the configuration providers are created with
+// when nothing is overridden
+func DefaultProviderConfig() ProviderConfig {
+	return ProviderConfig{}
 }
@@ -5,7 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strings"
+	"math"
+	"net/http"
 	"time"
 
 	"github.com/adamveld12/tai/internal/state"
@@ -19,12 +20,13 @@ type LMStudioProvider struct {
 	client       *openai.Client
 	config       ProviderConfig
 	defaultModel string
+	jitter       *backoffJitter
 }
 
 // NewLMStudioProvider creates a new LM Studio provider instance
 func NewLMStudioProvider(config ProviderConfig) (*LMStudioProvider, error) {
 	if config.BaseURL == "" {
-		config.BaseURL = "http://localhost:1234/v1"
+		config.BaseURL = DefaultBaseURLs[ProviderLMStudio]
 	}
 
 	if config.APIKey == "" {
@@ -33,21 +35,32 @@ func NewLMStudioProvider(config ProviderConfig) (*LMStudioProvider, error) {
 	}
 
 	if config.DefaultModel == "" {
-		config.DefaultModel = "gemma-3n-e4b-it"
+		config.DefaultModel = DefaultModels[ProviderLMStudio]
 	}
 
 	if config.Timeout == 0 {
-		config.Timeout = 300 * time.Second
+		config.Timeout = DefaultTimeout
 	}
 
 	clientConfig := openai.DefaultConfig(config.APIKey)
 	clientConfig.BaseURL = config.BaseURL
+	clientConfig.OrgID = config.Organization
+	httpClient := newHTTPClient(config)
+	if config.Project != "" {
+		// the client has no setting for the project, so it's added to every request
+		httpClient.Transport = &headerTransport{
+			base:   httpClient.Transport,
+			header: http.Header{"OpenAI-Project": {config.Project}},
+		}
+	}
+	clientConfig.HTTPClient = httpClient
 	client := openai.NewClientWithConfig(clientConfig)
 
 	return &LMStudioProvider{
 		client:       client,
 		config:       config,
 		defaultModel: config.DefaultModel,
+		jitter:       newBackoffJitter(time.Now().UnixNano()),
 	}, nil
 }
 
@@ -59,7 +72,10 @@ func (p *LMStudioProvider) Name() SupportedProvider {
 // ChatCompletion sends a chat completion request and returns the response
 func (p *LMStudioProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
 	// Convert our ChatRequest to OpenAI format
-	openAIReq := p.convertToOpenAIRequest(req, false)
+	openAIReq, err := p.convertToOpenAIRequest(req, false)
+	if err != nil {
+		return nil, fmt.Errorf("chat completion failed: %w", err)
+	}
 
 	// Apply timeout
 	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
@@ -68,14 +84,14 @@ func (p *LMStudioProvider) ChatCompletion(ctx context.Context, req ChatRequest)
 	startTime := time.Now()
 
 	var resp openai.ChatCompletionResponse
-	err := p.retryRequest(ctx, func() error {
+	err = retryRequest(ctx, p.config, p.jitter, func(ctx context.Context) error {
 		var err error
 		resp, err = p.client.CreateChatCompletion(ctx, openAIReq)
 		return err
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("chat completion failed: %w", err)
+		return nil, fmt.Errorf("chat completion failed: %w", modelError(err, openAIReq.Model))
 	}
 
 	duration := time.Since(startTime)
@@ -87,16 +103,21 @@ func (p *LMStudioProvider) ChatCompletion(ctx context.Context, req ChatRequest)
 // StreamChatCompletion sends a streaming chat completion request
 func (p *LMStudioProvider) StreamChatCompletion(ctx context.Context, req ChatRequest) (<-chan ChatStreamChunk, error) {
 	// Convert our ChatRequest to OpenAI format
-	openAIReq := p.convertToOpenAIRequest(req, true)
+	openAIReq, err := p.convertToOpenAIRequest(req, true)
+	if err != nil {
+		return nil, fmt.Errorf("stream creation failed: %w", err)
+	}
 
 	// Apply timeout
 	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
 
 	// Create the stream
-	stream, err := p.client.CreateChatCompletionStream(ctx, openAIReq)
+	stream, idle, err := openStream(ctx, p.config, p.jitter, func(ctx context.Context) (*openai.ChatCompletionStream, error) {
+		return p.client.CreateChatCompletionStream(ctx, openAIReq)
+	})
 	if err != nil {
 		cancel()
-		return nil, fmt.Errorf("stream creation failed: %w", err)
+		return nil, fmt.Errorf("stream creation failed: %w", modelError(err, openAIReq.Model))
 	}
 
 	// Create channel for chunks
@@ -106,49 +127,31 @@ func (p *LMStudioProvider) StreamChatCompletion(ctx context.Context, req ChatReq
 	go func() {
 		defer close(chunkChan)
 		defer cancel()
+		defer idle.stop()
 		defer stream.Close()
 
+		assembler := &streamAssembler{}
 		for {
 			response, err := stream.Recv()
 			if errors.Is(err, io.EOF) {
-				// Send final chunk
-				chunkChan <- ChatStreamChunk{Done: true}
+				chunkChan <- assembler.finish()
 				return
 			}
 
 			if err != nil {
-				chunkChan <- ChatStreamChunk{Error: fmt.Errorf("stream error: %w", err), Done: true}
+				chunkChan <- ChatStreamChunk{Error: fmt.Errorf("stream error: %w", idle.err(err)), Done: true}
 				return
 			}
+			idle.reset()
 
-			// Convert response to our chunk format
-			if len(response.Choices) > 0 {
-				var usage TokenUsage
-				if response.Usage != nil {
-					usage = TokenUsage{
-						PromptTokens:     response.Usage.PromptTokens,
-						CompletionTokens: response.Usage.CompletionTokens,
-						TotalTokens:      response.Usage.TotalTokens,
-					}
-				}
-
-				chunk := ChatStreamChunk{
-					Usage: usage,
-					Model: response.Model,
-					Delta: response.Choices[0].Delta.Content,
-					Done:  false,
-				}
-
-				// Handle tool calls if present
-				if len(response.Choices[0].Delta.ToolCalls) > 0 {
-					chunk.ToolCalls = p.convertToolCallsFromOpenAI(response.Choices[0].Delta.ToolCalls)
-				}
-
-				select {
-				case chunkChan <- chunk:
-				case <-ctx.Done():
-					return
-				}
+			chunk, ok := assembler.add(response)
+			if !ok {
+				continue
+			}
+			select {
+			case chunkChan <- chunk:
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
@@ -156,14 +159,51 @@ func (p *LMStudioProvider) StreamChatCompletion(ctx context.Context, req ChatReq
 	return chunkChan, nil
 }
 
-// We don't support listing models for LM Studio as it typically runs local models
-// Empty list is returned to indicate no specific models are available
+// Models lists the models loaded in LM Studio via its OpenAI-compatible /v1/models endpoint.
+// An unreachable server yields an empty list so callers can keep working offline,
+// while an error response from a running server is returned.
 func (p *LMStudioProvider) Models(ctx context.Context) ([]string, error) {
-	return []string{}, nil
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	list, err := p.client.ListModels(ctx)
+	if err != nil {
+		var apiErr *openai.APIError
+		var reqErr *openai.RequestError
+		if errors.As(err, &apiErr) || errors.As(err, &reqErr) {
+			return nil, fmt.Errorf("failed to list models: %w", err)
+		}
+
+		return []string{}, nil
+	}
+
+	models := make([]string, 0, len(list.Models))
+	for _, m := range list.Models {
+		models = append(models, m.ID)
+	}
+
+	return models, nil
+}
+
+// openAIFloat converts a sampling parameter for go-openai, which omits zero floats from
+// the request body. an explicit 0 is sent as the smallest float32 instead, which
+// serializes as 1e-45 and reaches the server as 0.
+func openAIFloat(v float64) float32 {
+	if v == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return float32(v)
 }
 
 // convertToOpenAIRequest converts our ChatRequest to OpenAI format
-func (p *LMStudioProvider) convertToOpenAIRequest(req ChatRequest, stream bool) openai.ChatCompletionRequest {
+func (p *LMStudioProvider) convertToOpenAIRequest(req ChatRequest, stream bool) (openai.ChatCompletionRequest, error) {
+	if err := checkRoles(req.Messages); err != nil {
+		return openai.ChatCompletionRequest{}, err
+	}
+	if err := checkToolResults(req.Messages); err != nil {
+		return openai.ChatCompletionRequest{}, err
+	}
+
 	model := req.Model
 	if model == "" {
 		model = p.defaultModel
@@ -175,9 +215,22 @@ func (p *LMStudioProvider) convertToOpenAIRequest(req ChatRequest, stream bool)
 		Stream:   stream,
 	}
 
-	// Set temperature if provided
-	if req.Temperature > 0 {
-		openAIReq.Temperature = float32(req.Temperature)
+	// the usage of a stream is only reported when asked for, in a final chunk without choices
+	if stream {
+		openAIReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+
+	if req.Temperature != nil {
+		openAIReq.Temperature = openAIFloat(*req.Temperature)
+	}
+	if req.TopP != nil {
+		openAIReq.TopP = openAIFloat(*req.TopP)
+	}
+	if req.PresencePenalty != nil {
+		openAIReq.PresencePenalty = openAIFloat(*req.PresencePenalty)
+	}
+	if req.FrequencyPenalty != nil {
+		openAIReq.FrequencyPenalty = openAIFloat(*req.FrequencyPenalty)
 	}
 
 	// Set max tokens if provided
@@ -185,6 +238,32 @@ func (p *LMStudioProvider) convertToOpenAIRequest(req ChatRequest, stream bool)
 		openAIReq.MaxTokens = req.MaxTokens
 	}
 
+	if req.Seed != nil {
+		seed := *req.Seed
+		openAIReq.Seed = &seed
+	}
+
+	if len(req.Stop) > 0 {
+		openAIReq.Stop = req.Stop
+	}
+
+	if f := req.ResponseFormat; f != nil {
+		openAIReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatType(f.Type),
+		}
+		if f.Type == ResponseFormatJSONSchema {
+			name := f.Name
+			if name == "" {
+				name = "response"
+			}
+			openAIReq.ResponseFormat.JSONSchema = &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   name,
+				Schema: f.Schema,
+				Strict: true,
+			}
+		}
+	}
+
 	// Convert messages
 	for _, msg := range req.Messages {
 		openAIMsg := openai.ChatCompletionMessage{
@@ -193,8 +272,10 @@ func (p *LMStudioProvider) convertToOpenAIRequest(req ChatRequest, stream bool)
 			Name:    "",
 		}
 
-		// // Handle tool calls
-		if len(req.Tools) > 0 {
+		// tool results reference the call they answer, assistant messages carry the calls made
+		if msg.Role == state.RoleTool {
+			openAIMsg.ToolCallID = msg.ToolCalls[0].ID
+		} else if len(req.Tools) > 0 {
 			openAIMsg.ToolCalls = p.convertToolCallsToOpenAI(msg.ToolCalls)
 		}
 
@@ -234,7 +315,7 @@ func (p *LMStudioProvider) convertToOpenAIRequest(req ChatRequest, stream bool)
 		openAIReq.ToolChoice = req.ToolChoice
 	}
 
-	return openAIReq
+	return openAIReq, nil
 }
 
 // convertFromOpenAIResponse converts OpenAI response to our format
@@ -297,43 +378,17 @@ func (p *LMStudioProvider) convertToolCallsFromOpenAI(openAIToolCalls []openai.T
 	return toolCalls
 }
 
-// Retry logic for failed requests
-func (p *LMStudioProvider) retryRequest(ctx context.Context, fn func() error) error {
-	maxRetries := p.config.MaxRetries
-	if maxRetries <= 0 {
-		maxRetries = 3
-	}
-
-	var lastErr error
-	for i := 0; i < maxRetries; i++ {
-		if err := fn(); err != nil {
-			lastErr = err
-
-			// Check if context is cancelled
-			if ctx.Err() != nil {
-				return ctx.Err()
-			}
-
-			// Don't retry on certain errors
-			if strings.Contains(err.Error(), "invalid_api_key") ||
-				strings.Contains(err.Error(), "model_not_found") {
-				return err
-			}
+// headerTransport adds header to every request it sends with base
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
 
-			// Exponential backoff
-			if i < maxRetries-1 {
-				backoff := time.Duration(1<<uint(i)) * time.Second
-				select {
-				case <-time.After(backoff):
-					// Continue to next retry
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-			}
-		} else {
-			return nil
-		}
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers mustn't modify the caller's request
+	req = req.Clone(req.Context())
+	for name, values := range t.header {
+		req.Header[name] = values
 	}
-
-	return fmt.Errorf("request failed after %d retries: %w", maxRetries, lastErr)
+	return t.base.RoundTrip(req)
 }
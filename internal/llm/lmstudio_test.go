@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"runtime"
 	"strings"
 	"sync"
@@ -213,7 +216,7 @@ func TestNewLMStudioProvider(t *testing.T) {
 				assert.Equal(t, "http://localhost:1234/v1", p.config.BaseURL)
 				assert.Equal(t, "lm-studio", p.config.APIKey)
 				assert.Equal(t, "gemma-3n-e4b-it", p.config.DefaultModel)
-				assert.Equal(t, 60*time.Second, p.config.Timeout)
+				assert.Equal(t, DefaultTimeout, p.config.Timeout)
 				assert.Equal(t, 0, p.config.MaxRetries) // Default is 0, retryRequest uses 3 if 0
 			},
 		},
@@ -461,11 +464,12 @@ func TestChatCompletion_ErrorScenarios(t *testing.T) {
 				require.Error(t, err)
 				assert.Nil(t, resp)
 				assert.Contains(t, err.Error(), "chat completion failed")
+				assert.ErrorIs(t, err, ErrModelNotFound)
 			},
 		},
 		{
-			name:        "retryable_error_general",
-			description: "General errors (400s, 500s) should be retried",
+			name:        "bad_request_not_retried",
+			description: "Client errors (400s) fail the same way again, so they're not retried",
 			request: ChatRequest{
 				Messages: []state.Message{
 					{Role: state.RoleUser, Content: "Hello"},
@@ -473,14 +477,12 @@ func TestChatCompletion_ErrorScenarios(t *testing.T) {
 			},
 			responses: []mockResponse{
 				{StatusCode: http.StatusBadRequest, Error: errors.New("Bad request")},
-				{StatusCode: http.StatusBadRequest, Error: errors.New("Bad request")},
-				{StatusCode: http.StatusBadRequest, Error: errors.New("Bad request")},
 			},
-			expectedReqCount: 3, // Should retry general errors
+			expectedReqCount: 1,
 			verify: func(t *testing.T, resp *ChatResponse, err error) {
 				require.Error(t, err)
 				assert.Nil(t, resp)
-				assert.Contains(t, err.Error(), "request failed after 3 retries")
+				assert.NotContains(t, err.Error(), "retries")
 			},
 		},
 		{
@@ -741,19 +743,76 @@ func TestStreamChatCompletion_SuccessScenarios(t *testing.T) {
 				require.NoError(t, err)
 				require.GreaterOrEqual(t, len(chunks), 1)
 
-				// Check that we received tool calls
-				hasToolCall := false
+				// Tool calls should only be emitted once, fully assembled, when the model finishes calling tools
+				var toolCallChunks []ChatStreamChunk
 				for _, chunk := range chunks {
 					if len(chunk.ToolCalls) > 0 {
-						hasToolCall = true
-						assert.Equal(t, "call_123", chunk.ToolCalls[0].ID)
-						assert.Equal(t, "function", chunk.ToolCalls[0].Type)
-						assert.Equal(t, "get_weather", chunk.ToolCalls[0].Function.Name)
-						// Note: In real streaming, arguments would be assembled across chunks
-						break
+						toolCallChunks = append(toolCallChunks, chunk)
+					}
+				}
+				require.Len(t, toolCallChunks, 1, "should receive the tool calls in a single chunk")
+
+				toolCalls := toolCallChunks[0].ToolCalls
+				require.Len(t, toolCalls, 1)
+				assert.Equal(t, "call_123", toolCalls[0].ID)
+				assert.Equal(t, "function", toolCalls[0].Type)
+				assert.Equal(t, "get_weather", toolCalls[0].Function.Name)
+				assert.JSONEq(t, `{"location":"New York"}`, toolCalls[0].Function.Arguments)
+			},
+		},
+		{
+			name:        "streaming_with_parallel_tool_calls",
+			description: "Interleaved fragments of several tool calls should be merged by index",
+			request: ChatRequest{
+				Messages: []state.Message{
+					{Role: state.RoleUser, Content: "Weather in New York and Paris?"},
+				},
+			},
+			chunks: []string{
+				`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"loc"}}]},"finish_reason":null}]}`,
+				`data: {"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_weather","arguments":"{\"location\":"}}]},"finish_reason":null}]}`,
+				`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ation\":\"New York\"}"}}]},"finish_reason":null}]}`,
+				`data: {"choices":[{"delta":{"tool_calls":[{"index":1,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+				`data: [DONE]`,
+			},
+			verify: func(t *testing.T, chunks []ChatStreamChunk, err error) {
+				require.NoError(t, err)
+
+				var toolCalls []state.ToolCall
+				for _, chunk := range chunks {
+					toolCalls = append(toolCalls, chunk.ToolCalls...)
+				}
+
+				require.Len(t, toolCalls, 2)
+				assert.Equal(t, "call_1", toolCalls[0].ID)
+				assert.JSONEq(t, `{"location":"New York"}`, toolCalls[0].Function.Arguments)
+				assert.Equal(t, "call_2", toolCalls[1].ID)
+				assert.Equal(t, "get_weather", toolCalls[1].Function.Name)
+				assert.JSONEq(t, `{"location":"Paris"}`, toolCalls[1].Function.Arguments)
+			},
+		},
+		{
+			name:        "streaming_content_filter",
+			description: "A content_filter finish reason should be surfaced on the chunk",
+			request: ChatRequest{
+				Messages: []state.Message{
+					{Role: state.RoleUser, Content: "Hello"},
+				},
+			},
+			chunks: []string{
+				`data: {"choices":[{"delta":{"content":""},"finish_reason":"content_filter"}]}`,
+				`data: [DONE]`,
+			},
+			verify: func(t *testing.T, chunks []ChatStreamChunk, err error) {
+				require.NoError(t, err)
+
+				var finishReason string
+				for _, chunk := range chunks {
+					if chunk.FinishReason != "" {
+						finishReason = chunk.FinishReason
 					}
 				}
-				assert.True(t, hasToolCall, "should receive tool calls in streaming")
+				assert.Equal(t, FinishReasonContentFilter, finishReason)
 			},
 		},
 		{
@@ -776,6 +835,27 @@ func TestStreamChatCompletion_SuccessScenarios(t *testing.T) {
 				assert.Equal(t, "", chunks[0].Delta)
 			},
 		},
+		{
+			name:        "usage_in_final_chunk",
+			description: "The usage reported after the last choice should be passed on",
+			request: ChatRequest{
+				Messages: []state.Message{
+					{Role: state.RoleUser, Content: "Hello"},
+				},
+			},
+			chunks: []string{
+				`data: {"choices":[{"delta":{"content":"Hi"},"finish_reason":"stop"}]}`,
+				`data: {"choices":[],"usage":{"prompt_tokens":9,"completion_tokens":1,"total_tokens":10}}`,
+				`data: [DONE]`,
+			},
+			verify: func(t *testing.T, chunks []ChatStreamChunk, err error) {
+				require.NoError(t, err)
+				require.Len(t, chunks, 3)
+				assert.Equal(t, "Hi", chunks[0].Delta)
+				assert.Equal(t, TokenUsage{PromptTokens: 9, CompletionTokens: 1, TotalTokens: 10}, chunks[1].Usage)
+				assert.True(t, chunks[2].Done)
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1063,9 +1143,10 @@ func TestRetryLogic_ExponentialBackoff(t *testing.T) {
 			defer mock.Close()
 
 			provider := newTestProvider(t, ProviderConfig{
-				BaseURL:    mock.URL(),
-				MaxRetries: tt.maxRetries,
-				Timeout:    testTimeout,
+				BaseURL:            mock.URL(),
+				MaxRetries:         tt.maxRetries,
+				Timeout:            testTimeout,
+				DisableRetryJitter: true,
 			})
 
 			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
@@ -1104,8 +1185,9 @@ func TestRetryLogic_ExponentialBackoff(t *testing.T) {
 	}
 }
 
-// TestRetryLogic_ContextCancellation verifies context cancellation during retries.
-// Context cancellation should be respected immediately, even during backoff periods.
+// TestRetryLogic_ContextCancellation verifies retrying stops at the context's deadline.
+// A backoff that would end past it gives up right away with the last API error rather
+// than sleeping until the deadline and reporting only that it passed.
 func TestRetryLogic_ContextCancellation(t *testing.T) {
 	// Create responses that would trigger retries
 	responses := []mockResponse{
@@ -1118,12 +1200,13 @@ func TestRetryLogic_ContextCancellation(t *testing.T) {
 	defer mock.Close()
 
 	provider := newTestProvider(t, ProviderConfig{
-		BaseURL:    mock.URL(),
-		MaxRetries: 5, // Lots of retries to ensure cancellation happens first
-		Timeout:    testTimeout,
+		BaseURL:            mock.URL(),
+		MaxRetries:         5, // Lots of retries to ensure the deadline stops them first
+		Timeout:            testTimeout,
+		DisableRetryJitter: true,
 	})
 
-	// Create a context that will be cancelled during the backoff period
+	// the 1s backoff fits before the deadline, the 2s one after it doesn't
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
@@ -1135,16 +1218,341 @@ func TestRetryLogic_ContextCancellation(t *testing.T) {
 
 	elapsed := time.Since(startTime)
 
-	// Should fail with context error
 	require.Error(t, err)
 	assert.Nil(t, resp)
-	assert.Contains(t, err.Error(), "context")
+	assert.NotErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "second error", "the API error should be returned, not the deadline")
+	assert.Equal(t, 2, mock.RequestCount())
+
+	// Should give up as soon as the next wait can't fit, without sitting out the deadline
+	assert.Less(t, elapsed, 1500*time.Millisecond)
+
+	t.Run("cancelled_during_backoff", func(t *testing.T) {
+		mock := newMockServer(t, responses...)
+		defer mock.Close()
+
+		provider := newTestProvider(t, ProviderConfig{BaseURL: mock.URL(), MaxRetries: 5, Timeout: testTimeout, DisableRetryJitter: true})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		time.AfterFunc(200*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err := provider.ChatCompletion(ctx, ChatRequest{
+			Messages: []state.Message{{Role: state.RoleUser, Content: "Test"}},
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, time.Since(start), time.Second, "should respect context cancellation quickly")
+	})
+}
+
+// TestRetryLogic_RetryAfter verifies that a 429 with a Retry-After header delays
+// the next attempt by at least the requested time instead of the 1s backoff.
+func TestRetryLogic_RetryAfter(t *testing.T) {
+	mock := newMockServer(t,
+		mockResponse{
+			StatusCode: http.StatusTooManyRequests,
+			Error:      errors.New("rate limited"),
+			Headers:    map[string]string{"Retry-After": "2"},
+		},
+		mockResponse{
+			StatusCode: http.StatusOK,
+			Body: openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{Message: openai.ChatCompletionMessage{Content: "Success"}},
+				},
+			},
+		},
+	)
+	defer mock.Close()
+
+	provider := newTestProvider(t, ProviderConfig{
+		BaseURL:    mock.URL(),
+		MaxRetries: 3,
+		Timeout:    testTimeout,
+	})
+
+	startTime := time.Now()
+	resp, err := provider.ChatCompletion(context.Background(), ChatRequest{
+		Messages: []state.Message{{Role: state.RoleUser, Content: "Test"}},
+	})
+	elapsed := time.Since(startTime)
+
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, 2, mock.RequestCount())
+
+	requests := mock.GetRequests()
+	gap := requests[1].Timestamp.Sub(requests[0].Timestamp)
+	assert.GreaterOrEqual(t, gap, 2*time.Second, "retry should wait for Retry-After")
+	assert.Less(t, elapsed, 4*time.Second, "retry should not wait much longer than Retry-After")
+}
+
+// TestRetryLogic_Jitter verifies that jittered backoffs vary between attempts
+// instead of following the deterministic 1<<i schedule, and that each one stays
+// within its exponential bound.
+func TestRetryLogic_Jitter(t *testing.T) {
+	t.Run("samples_vary_within_bound", func(t *testing.T) {
+		jitter := newBackoffJitter(42)
+		seen := map[time.Duration]bool{}
+
+		for i := 0; i < 100; i++ {
+			d := jitter.apply(time.Second)
+			assert.GreaterOrEqual(t, d, time.Duration(0))
+			assert.LessOrEqual(t, d, time.Second)
+			seen[d] = true
+		}
+
+		assert.Greater(t, len(seen), 90, "jittered backoffs should rarely repeat")
+	})
+
+	t.Run("retries_sleep_varying_durations", func(t *testing.T) {
+		defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+		retryBaseDelay = 5 * time.Millisecond
+
+		const attempts = 8
+		var calls []time.Time
+		err := retryRequest(context.Background(), ProviderConfig{MaxRetries: attempts}, newBackoffJitter(7),
+			func(ctx context.Context) error {
+				calls = append(calls, time.Now())
+				return errors.New("temporary error")
+			})
+		require.Error(t, err)
+		require.Len(t, calls, attempts)
+
+		belowSchedule := 0
+		for i := 1; i < len(calls); i++ {
+			if calls[i].Sub(calls[i-1]) < time.Duration(1<<uint(i-1))*retryBaseDelay {
+				belowSchedule++
+			}
+		}
+		assert.Greater(t, belowSchedule, 0, "jitter should shorten at least some backoffs")
+	})
+
+	t.Run("cancellation_during_jittered_sleep", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		time.AfterFunc(200*time.Millisecond, cancel)
+
+		start := time.Now()
+		err := retryRequest(ctx, ProviderConfig{MaxRetries: 10}, newBackoffJitter(1),
+			func(ctx context.Context) error {
+				return errors.New("temporary error")
+			})
+
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, time.Since(start), time.Second, "cancellation should interrupt the sleep")
+	})
+}
+
+// TestRetryLogic_MaxBackoff checks that no wait between attempts goes over MaxBackoff,
+// however many attempts came before it, unless the server asks to wait longer
+func TestRetryLogic_MaxBackoff(t *testing.T) {
+	jitter := newBackoffJitter(3)
+
+	for _, config := range []ProviderConfig{
+		{},
+		{MaxBackoff: 5 * time.Second},
+		{MaxBackoff: 5 * time.Second},
+		{MaxBackoff: 5 * time.Second, DisableRetryJitter: true},
+		{MaxBackoff: 500 * time.Millisecond},
+	} {
+		maxBackoff := config.MaxBackoff
+		if maxBackoff == 0 {
+			maxBackoff = DefaultMaxBackoff
+		}
+
+		for attempt := 0; attempt < 100; attempt++ {
+			for _, retryAfter := range []time.Duration{0, time.Second, time.Hour} {
+				d := retryBackoff(attempt, config, jitter, retryAfter)
+				assert.GreaterOrEqual(t, d, time.Duration(0), "attempt %d", attempt)
+				assert.LessOrEqual(t, d, max(maxBackoff, retryAfter), "attempt %d with max %s and Retry-After %s", attempt, maxBackoff, retryAfter)
+				assert.GreaterOrEqual(t, d, retryAfter, "attempt %d should wait at least Retry-After", attempt)
+			}
+		}
+	}
+
+	assert.Equal(t, time.Second, retryBackoff(0, ProviderConfig{}, nil, 0))
+	assert.Equal(t, 8*time.Second, retryBackoff(3, ProviderConfig{}, nil, 0))
+	assert.Equal(t, DefaultMaxBackoff, retryBackoff(10, ProviderConfig{}, nil, 0))
+	assert.Equal(t, 2*time.Second, retryBackoff(0, ProviderConfig{}, nil, 2*time.Second), "Retry-After stretches the backoff")
+	assert.Equal(t, time.Minute, retryBackoff(0, ProviderConfig{MaxBackoff: 5 * time.Second}, nil, time.Minute), "Retry-After isn't cut down to MaxBackoff")
+}
+
+// TestRetryLogic_RetryAfterPastDeadline checks that a Retry-After longer than the time
+// left gives up with the server's error instead of retrying early
+func TestRetryLogic_RetryAfterPastDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	calls := 0
+	err := retryRequest(ctx, ProviderConfig{MaxRetries: 3, MaxBackoff: time.Millisecond}, nil, func(ctx context.Context) error {
+		calls++
+		ctx.Value(retryAfterKey{}).(*retryAfterHint).set(time.Minute)
+		return errors.New("rate limited")
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "retrying would pass the deadline: rate limited")
+	assert.Equal(t, 1, calls)
+}
+
+// TestRetryLogic_MaxElapsed checks that retrying stops once the budget would run out
+// even though attempts are left
+func TestRetryLogic_MaxElapsed(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = 20 * time.Millisecond
+
+	calls := 0
+	start := time.Now()
+	err := retryRequest(context.Background(), ProviderConfig{MaxRetries: 10, MaxElapsed: 100 * time.Millisecond}, nil,
+		func(ctx context.Context) error {
+			calls++
+			return errors.New("temporary error")
+		})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "retrying would take longer than 100ms")
+	// waits of 20ms, 40ms and then 80ms would end past the budget
+	assert.Equal(t, 3, calls)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	t.Run("deadline_takes_precedence", func(t *testing.T) {
+		// waits of 20ms, 40ms and 80ms fit, the 160ms one after them doesn't
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		err := retryRequest(ctx, ProviderConfig{MaxRetries: 10, MaxElapsed: time.Minute}, nil,
+			func(ctx context.Context) error { return errors.New("temporary error") })
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "after 4 attempts, retrying would pass the deadline: temporary error")
+		assert.NoError(t, ctx.Err(), "should give up without waiting for the deadline")
+	})
+}
+
+// TestRetryLogic_RetryFunc checks that every retry is reported to the context's RetryFunc
+func TestRetryLogic_RetryFunc(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	var attempts []string
+	ctx := WithRetryFunc(context.Background(), func(attempt, maxAttempts int, err error) {
+		attempts = append(attempts, fmt.Sprintf("%d/%d %v", attempt, maxAttempts, err))
+	})
+
+	calls := 0
+	err := retryRequest(ctx, ProviderConfig{MaxRetries: 3}, nil, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("temporary error %d", calls)
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2/3 temporary error 1", "3/3 temporary error 2"}, attempts)
+}
+
+// TestRetryable checks which typed API errors are retried by status code, and the
+// fallbacks for errors without one
+func TestRetryable(t *testing.T) {
+	statuses := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusForbidden, false},
+		{http.StatusNotFound, false},
+		{http.StatusUnprocessableEntity, false},
+		{http.StatusRequestTimeout, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+	}
+
+	for _, tt := range statuses {
+		errs := map[string]error{
+			"api_error":     &openai.APIError{HTTPStatusCode: tt.status, Message: "boom"},
+			"request_error": &openai.RequestError{HTTPStatusCode: tt.status, Err: errors.New("boom")},
+			"claude_error":  &ClaudeAPIError{StatusCode: tt.status, Type: "api_error"},
+			"ollama_error":  &OllamaAPIError{StatusCode: tt.status},
+		}
+		for name, err := range errs {
+			wrapped := fmt.Errorf("chat completion failed: %w", err)
+			assert.Equal(t, tt.want, retryable(wrapped), "%s with status %d", name, tt.status)
+		}
+	}
+
+	t.Run("status_wins_over_message", func(t *testing.T) {
+		// a server error that mentions a permanent code is still a server error
+		err := &openai.APIError{HTTPStatusCode: http.StatusBadGateway, Message: "upstream said invalid_api_key"}
+		assert.True(t, retryable(err))
+	})
+
+	t.Run("error_code_without_status", func(t *testing.T) {
+		assert.False(t, retryable(&openai.APIError{Code: "invalid_api_key"}))
+		assert.False(t, retryable(&openai.APIError{Code: "model_not_found"}))
+		assert.True(t, retryable(&openai.APIError{Code: "server_error"}))
+	})
 
-	// Should have cancelled before completing all retries
-	assert.Less(t, mock.RequestCount(), 5, "should have been cancelled before all retries")
+	t.Run("network_errors", func(t *testing.T) {
+		err := &url.Error{Op: "Post", URL: "http://localhost:1234", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+		assert.True(t, retryable(fmt.Errorf("request failed: %w", err)))
+	})
+
+	t.Run("untyped_errors", func(t *testing.T) {
+		assert.False(t, retryable(errors.New("error: invalid_api_key")))
+		assert.False(t, retryable(errors.New("error: model_not_found")))
+		assert.True(t, retryable(errors.New("temporary error")))
+	})
 
-	// Should complete within reasonable time (context timeout + some buffer)
-	assert.Less(t, elapsed, 3*time.Second, "should respect context cancellation quickly")
+	t.Run("retry_request_stops_on_client_errors", func(t *testing.T) {
+		defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+		retryBaseDelay = time.Millisecond
+
+		for _, tt := range statuses {
+			calls := 0
+			err := retryRequest(context.Background(), ProviderConfig{MaxRetries: 3}, nil, func(ctx context.Context) error {
+				calls++
+				return &openai.APIError{HTTPStatusCode: tt.status}
+			})
+			require.Error(t, err)
+
+			want := 1
+			if tt.want {
+				want = 3
+			}
+			assert.Equal(t, want, calls, "attempts for status %d", tt.status)
+		}
+	})
+}
+
+// TestParseRetryAfter covers both the delta-seconds and HTTP-date forms
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"delta_seconds", "2", 2 * time.Second, true},
+		{"http_date", now.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second, true},
+		{"past_http_date", now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"empty", "", 0, false},
+		{"negative", "-1", 0, false},
+		{"garbage", "soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
 }
 
 // =============================================================================
@@ -1277,3 +1685,271 @@ func TestProviderMetadata(t *testing.T) {
 		assert.Empty(t, models, "LMStudio provider should return empty models list")
 	})
 }
+
+// TestModels verifies model discovery against LM Studio's /v1/models endpoint
+func TestModels(t *testing.T) {
+	t.Run("returns_model_ids", func(t *testing.T) {
+		mock := newMockServer(t, mockResponse{
+			StatusCode: http.StatusOK,
+			Body: openai.ModelsList{
+				Models: []openai.Model{
+					{ID: "gemma-3n-e4b-it", Object: "model"},
+					{ID: "qwen2.5-coder-7b", Object: "model"},
+				},
+			},
+		})
+		defer mock.Close()
+
+		provider := newTestProvider(t, ProviderConfig{BaseURL: mock.URL()})
+		models, err := provider.Models(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"gemma-3n-e4b-it", "qwen2.5-coder-7b"}, models)
+
+		requests := mock.GetRequests()
+		require.Len(t, requests, 1)
+		assert.Equal(t, http.MethodGet, requests[0].Method)
+		assert.Equal(t, "/models", requests[0].Path)
+	})
+
+	t.Run("server_error_is_wrapped", func(t *testing.T) {
+		mock := newMockServer(t, mockResponse{
+			StatusCode: http.StatusInternalServerError,
+			Error:      errors.New("model index unavailable"),
+		})
+		defer mock.Close()
+
+		provider := newTestProvider(t, ProviderConfig{BaseURL: mock.URL()})
+		models, err := provider.Models(context.Background())
+		require.Error(t, err)
+		assert.Nil(t, models)
+		assert.Contains(t, err.Error(), "failed to list models")
+	})
+
+	t.Run("unreachable_server_returns_empty_list", func(t *testing.T) {
+		mock := newMockServer(t)
+		url := mock.URL()
+		mock.Close()
+
+		provider := newTestProvider(t, ProviderConfig{BaseURL: url})
+		models, err := provider.Models(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, models)
+	})
+}
+
+func TestConvertToOpenAIRequest_SamplingParams(t *testing.T) {
+	provider := newTestProvider(t, ProviderConfig{})
+
+	req, err := provider.convertToOpenAIRequest(ChatRequest{
+		Messages:    []state.Message{{Role: state.RoleUser, Content: "Hello"}},
+		Temperature: state.Float(0.7),
+		TopP:        state.Float(0.9),
+		MaxTokens:   256,
+	}, false)
+	require.NoError(t, err)
+
+	assert.InDelta(t, 0.7, req.Temperature, 1e-6)
+	assert.InDelta(t, 0.9, req.TopP, 1e-6)
+	assert.Equal(t, 256, req.MaxTokens)
+
+	// unset parameters are left for the server to default
+	req, err = provider.convertToOpenAIRequest(ChatRequest{
+		Messages: []state.Message{{Role: state.RoleUser, Content: "Hello"}},
+	}, false)
+	require.NoError(t, err)
+	assert.Zero(t, req.Temperature)
+	assert.Zero(t, req.TopP)
+	assert.Zero(t, req.MaxTokens)
+}
+
+func TestConvertToOpenAIRequest_Penalties(t *testing.T) {
+	provider := newTestProvider(t, ProviderConfig{})
+
+	tests := []struct {
+		name     string
+		request  ChatRequest
+		want     []string
+		wantNone []string
+	}{
+		{
+			name:     "unset penalties are omitted",
+			request:  ChatRequest{},
+			wantNone: []string{"presence_penalty", "frequency_penalty"},
+		},
+		{
+			name:    "both penalties",
+			request: ChatRequest{PresencePenalty: state.Float(0.5), FrequencyPenalty: state.Float(-1.5)},
+			want:    []string{`"presence_penalty":0.5`, `"frequency_penalty":-1.5`},
+		},
+		{
+			name:     "only the set penalty",
+			request:  ChatRequest{FrequencyPenalty: state.Float(2)},
+			want:     []string{`"frequency_penalty":2`},
+			wantNone: []string{"presence_penalty"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.request.Messages = []state.Message{{Role: state.RoleUser, Content: "Hello"}}
+			req, err := provider.convertToOpenAIRequest(tt.request, false)
+			require.NoError(t, err)
+			body, err := json.Marshal(req)
+			require.NoError(t, err)
+
+			for _, want := range tt.want {
+				assert.Contains(t, string(body), want)
+			}
+			for _, field := range tt.wantNone {
+				assert.NotContains(t, string(body), field)
+			}
+		})
+	}
+}
+
+func TestConvertToOpenAIRequest_Seed(t *testing.T) {
+	provider := newTestProvider(t, ProviderConfig{})
+	messages := []state.Message{{Role: state.RoleUser, Content: "Hello"}}
+
+	req, err := provider.convertToOpenAIRequest(ChatRequest{Messages: messages}, false)
+	require.NoError(t, err)
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "seed", "an unset seed is left for the server to pick")
+
+	for _, seed := range []int{0, 42} {
+		req, err := provider.convertToOpenAIRequest(ChatRequest{Messages: messages, Seed: &seed}, false)
+		require.NoError(t, err)
+		require.NotNil(t, req.Seed)
+		assert.Equal(t, seed, *req.Seed)
+
+		body, err := json.Marshal(req)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), fmt.Sprintf(`"seed":%d`, seed))
+	}
+}
+
+func TestChatCompletion_StopSequences(t *testing.T) {
+	mock := newMockServer(t, mockResponse{
+		StatusCode: http.StatusOK,
+		Body: openai.ChatCompletionResponse{
+			Model: "test-model",
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Content: "step 1"}, FinishReason: openai.FinishReasonStop},
+			},
+		},
+	})
+	defer mock.Close()
+
+	provider := newTestProvider(t, ProviderConfig{BaseURL: mock.URL(), MaxRetries: 0})
+	_, err := provider.ChatCompletion(context.Background(), ChatRequest{
+		Messages: []state.Message{{Role: state.RoleUser, Content: "List the steps"}},
+		Stop:     []string{"\n\n", "END"},
+	})
+	require.NoError(t, err)
+
+	requests := mock.GetRequests()
+	require.Len(t, requests, 1)
+
+	var body struct {
+		Stop []string `json:"stop"`
+	}
+	require.NoError(t, json.Unmarshal(requests[0].Body, &body))
+	assert.Equal(t, []string{"\n\n", "END"}, body.Stop)
+}
+
+func TestConvertToOpenAIRequest_ResponseFormat(t *testing.T) {
+	provider := newTestProvider(t, ProviderConfig{})
+	messages := []state.Message{{Role: state.RoleUser, Content: "Hello"}}
+
+	req, err := provider.convertToOpenAIRequest(ChatRequest{Messages: messages}, false)
+	require.NoError(t, err)
+	assert.Nil(t, req.ResponseFormat, "free text requests shouldn't set a response format")
+
+	req, err = provider.convertToOpenAIRequest(ChatRequest{
+		Messages:       messages,
+		ResponseFormat: &ResponseFormat{Type: ResponseFormatJSONObject},
+	}, false)
+	require.NoError(t, err)
+	require.NotNil(t, req.ResponseFormat)
+	assert.Equal(t, openai.ChatCompletionResponseFormatTypeJSONObject, req.ResponseFormat.Type)
+	assert.Nil(t, req.ResponseFormat.JSONSchema)
+
+	schema := json.RawMessage(`{"type":"object","properties":{"colors":{"type":"array"}}}`)
+	req, err = provider.convertToOpenAIRequest(ChatRequest{
+		Messages:       messages,
+		ResponseFormat: &ResponseFormat{Type: ResponseFormatJSONSchema, Name: "colors", Schema: schema},
+	}, false)
+	require.NoError(t, err)
+	require.NotNil(t, req.ResponseFormat)
+	require.NotNil(t, req.ResponseFormat.JSONSchema)
+	assert.Equal(t, openai.ChatCompletionResponseFormatTypeJSONSchema, req.ResponseFormat.Type)
+	assert.Equal(t, "colors", req.ResponseFormat.JSONSchema.Name)
+
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"schema":{"type":"object","properties":{"colors":{"type":"array"}}}`)
+}
+
+func TestConvertToOpenAIRequest_ToolResult(t *testing.T) {
+	provider := newTestProvider(t, ProviderConfig{})
+
+	req, err := provider.convertToOpenAIRequest(ChatRequest{Messages: []state.Message{
+		{Role: state.RoleUser, Content: "What's in main.go?"},
+		{Role: state.RoleAssistant, ToolCalls: []state.ToolCall{{ID: "call_1", Type: "function", Function: state.ToolCallFunction{Name: "read_file"}}}},
+		{Role: state.RoleTool, Content: "package main", ToolCalls: []state.ToolCall{{ID: "call_1"}}},
+	}}, false)
+	require.NoError(t, err)
+	require.Len(t, req.Messages, 3)
+	assert.Equal(t, openai.ChatMessageRoleTool, req.Messages[2].Role)
+	assert.Equal(t, "call_1", req.Messages[2].ToolCallID)
+	assert.Equal(t, "package main", req.Messages[2].Content)
+}
+
+func TestChatCompletion_InvalidMessages(t *testing.T) {
+	mock := newMockServer(t, mockResponse{StatusCode: http.StatusOK})
+	defer mock.Close()
+	provider := newTestProvider(t, ProviderConfig{BaseURL: mock.URL(), MaxRetries: 0})
+
+	tests := []struct {
+		name     string
+		messages []state.Message
+		want     string
+	}{
+		{
+			name: "unknown role",
+			messages: []state.Message{
+				{Role: state.RoleUser, Content: "Hello"},
+				{Role: "robot", Content: "Beep"},
+			},
+			want: `message 1 has unknown role "robot"`,
+		},
+		{
+			name: "tool result without a tool call",
+			messages: []state.Message{
+				{Role: state.RoleUser, Content: "Hello"},
+				{Role: state.RoleTool, Content: "package main"},
+			},
+			want: "message 1 is a tool result without a tool call ID",
+		},
+		{
+			name: "tool result with an empty ID",
+			messages: []state.Message{
+				{Role: state.RoleTool, Content: "package main", ToolCalls: []state.ToolCall{{}}},
+			},
+			want: "message 0 is a tool result without a tool call ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.ChatCompletion(context.Background(), ChatRequest{Messages: tt.messages})
+			require.ErrorIs(t, err, ErrInvalidMessage)
+			assert.Contains(t, err.Error(), tt.want)
+
+			_, err = provider.StreamChatCompletion(context.Background(), ChatRequest{Messages: tt.messages})
+			require.ErrorIs(t, err, ErrInvalidMessage)
+		})
+	}
+	assert.Zero(t, mock.RequestCount(), "invalid messages shouldn't be sent")
+}
@@ -0,0 +1,157 @@
+package llm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLoggedBody is how much of each request and response body is logged
+const maxLoggedBody = 2048
+
+// redacted replaces secrets in logged output
+const redacted = "[redacted]"
+
+// sensitiveHeaders are never logged with their values
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Api-Key":             true,
+	"X-Api-Key":           true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// loggingTransport logs the requests sent to a provider and the responses it returns.
+// Credentials are redacted from headers, and the secrets it's given are scrubbed from
+// everything it logs in case they turn up anywhere else, e.g. echoed back in an error.
+type loggingTransport struct {
+	base    http.RoundTripper
+	logger  *log.Logger
+	secrets []string
+}
+
+// newLoggingTransport returns a transport that sends requests with base and logs them to
+// logger, or base itself when logger is nil
+func newLoggingTransport(base http.RoundTripper, logger *log.Logger, secrets ...string) http.RoundTripper {
+	if logger == nil {
+		return base
+	}
+
+	var scrub []string
+	for _, s := range secrets {
+		if s != "" {
+			scrub = append(scrub, s)
+		}
+	}
+	return &loggingTransport{base: base, logger: logger, secrets: scrub}
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body.Close()
+
+		// the body was consumed logging it, so send a copy of the request with it restored
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	t.logf("--> %s %s\n%s%s", req.Method, req.URL, formatHeaders(req.Header), truncateBody(body))
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		t.logf("<-- %s %s failed after %s: %v", req.Method, req.URL, time.Since(start).Round(time.Millisecond), err)
+		return resp, err
+	}
+
+	t.logf("<-- %s %s %s (%s)\n%s", resp.Status, req.Method, req.URL, time.Since(start).Round(time.Millisecond), formatHeaders(resp.Header))
+
+	// streamed responses are read as they arrive, so the body is logged once it's closed
+	// instead of being read up front
+	resp.Body = &loggedBody{ReadCloser: resp.Body, transport: t, url: req.URL.String()}
+	return resp, nil
+}
+
+// logf logs the formatted message with every secret scrubbed out
+func (t *loggingTransport) logf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	for _, s := range t.secrets {
+		msg = strings.ReplaceAll(msg, s, redacted)
+	}
+	t.logger.Print(strings.TrimRight(msg, "\n"))
+}
+
+// loggedBody keeps the start of a response body as it's read and logs it when closed
+type loggedBody struct {
+	io.ReadCloser
+	transport *loggingTransport
+	url       string
+
+	buf   bytes.Buffer
+	total int
+	once  sync.Once
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if keep := min(n, maxLoggedBody-b.buf.Len()); keep > 0 {
+		b.buf.Write(p[:keep])
+	}
+	b.total += n
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	b.once.Do(func() {
+		body := b.buf.String()
+		if b.total > b.buf.Len() {
+			body += fmt.Sprintf("... (%d more bytes)", b.total-b.buf.Len())
+		}
+		b.transport.logf("<-- body %s\n%s", b.url, body)
+	})
+	return b.ReadCloser.Close()
+}
+
+// formatHeaders renders headers one per line in a stable order with credentials redacted
+func formatHeaders(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		value := strings.Join(h[name], ", ")
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			value = redacted
+		}
+		fmt.Fprintf(&b, "%s: %s\n", name, value)
+	}
+	return b.String()
+}
+
+// truncateBody returns body cut to maxLoggedBody, noting how much was left out
+func truncateBody(body []byte) string {
+	if len(body) <= maxLoggedBody {
+		return string(body)
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", body[:maxLoggedBody], len(body)-maxLoggedBody)
+}
@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggingTransport_RedactsAPIKey(t *testing.T) {
+	const apiKey = "sk-test-0123456789abcdef"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"model":"test"}`, string(body), "the request body must still be sent after it's logged")
+
+		w.Header().Set("Content-Type", "application/json")
+		// an error that echoes the key back must not leak it either
+		_, _ = w.Write([]byte(`{"error":"invalid key ` + apiKey + `"}`))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	client := newHTTPClient(ProviderConfig{APIKey: apiKey, Logger: log.New(&out, "", 0)})
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", strings.NewReader(`{"model":"test"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("X-Api-Key", apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Contains(t, string(body), apiKey, "the caller still gets the response unchanged")
+
+	logged := out.String()
+	assert.NotContains(t, logged, apiKey)
+	assert.NotContains(t, logged, "0123456789abcdef")
+	assert.Contains(t, logged, "Authorization: [redacted]")
+	assert.Contains(t, logged, "X-Api-Key: [redacted]")
+	assert.Contains(t, logged, "--> POST "+server.URL+"/v1/chat/completions")
+	assert.Contains(t, logged, `{"model":"test"}`)
+	assert.Contains(t, logged, "<-- 200 OK")
+	assert.Contains(t, logged, `invalid key [redacted]`)
+}
+
+func TestLoggingTransport_TruncatesBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("b", maxLoggedBody+100)))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	client := newHTTPClient(ProviderConfig{Logger: log.New(&out, "", 0)})
+
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader(strings.Repeat("a", maxLoggedBody+10)))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Len(t, body, maxLoggedBody+100)
+
+	logged := out.String()
+	assert.Contains(t, logged, "... (10 more bytes)")
+	assert.Contains(t, logged, "... (100 more bytes)")
+	assert.NotContains(t, logged, strings.Repeat("a", maxLoggedBody+1))
+}
+
+func TestLMStudioProvider_VerboseLogging(t *testing.T) {
+	const apiKey = "sk-live-secret"
+
+	mock := newMockServer(t, mockResponse{
+		StatusCode: http.StatusOK,
+		Body:       map[string]any{"object": "list", "data": []map[string]any{{"id": "test-model"}}},
+	})
+	defer mock.Close()
+
+	var out bytes.Buffer
+	provider := newTestProvider(t, ProviderConfig{APIKey: apiKey, BaseURL: mock.URL(), Logger: log.New(&out, "", 0)})
+
+	_, err := provider.Models(context.Background())
+	require.NoError(t, err)
+
+	assert.Contains(t, out.String(), "GET "+mock.URL()+"/models")
+	assert.NotContains(t, out.String(), apiKey)
+}
@@ -0,0 +1,424 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adamveld12/tai/internal/state"
+)
+
+const ProviderOllama SupportedProvider = "ollama"
+
+// OllamaProvider implements the Provider interface against Ollama's native /api/chat endpoint
+type OllamaProvider struct {
+	client       *http.Client
+	config       ProviderConfig
+	defaultModel string
+	jitter       *backoffJitter
+}
+
+// OllamaAPIError is returned when the Ollama server responds with a non-2xx status
+type OllamaAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *OllamaAPIError) Error() string {
+	return fmt.Sprintf("ollama API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// NewOllamaProvider creates a new Ollama provider instance
+func NewOllamaProvider(config ProviderConfig) (*OllamaProvider, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURLs[ProviderOllama]
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	if config.DefaultModel == "" {
+		config.DefaultModel = DefaultModels[ProviderOllama]
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	return &OllamaProvider{
+		client:       newHTTPClient(config),
+		config:       config,
+		defaultModel: config.DefaultModel,
+		jitter:       newBackoffJitter(time.Now().UnixNano()),
+	}, nil
+}
+
+// Name returns the provider name
+func (p *OllamaProvider) Name() SupportedProvider {
+	return ProviderOllama
+}
+
+// ChatCompletion sends a chat completion request and returns the response
+func (p *OllamaProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	ollamaReq, err := p.convertToOllamaRequest(req, false)
+	if err != nil {
+		return nil, fmt.Errorf("chat completion failed: %w", err)
+	}
+
+	// Apply timeout
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	startTime := time.Now()
+
+	var resp ollamaChatResponse
+	err = retryRequest(ctx, p.config, p.jitter, func(ctx context.Context) error {
+		httpResp, err := p.do(ctx, http.MethodPost, "/api/chat", ollamaReq)
+		if err != nil {
+			return err
+		}
+		defer httpResp.Body.Close()
+
+		return json.NewDecoder(httpResp.Body).Decode(&resp)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("chat completion failed: %w", err)
+	}
+
+	response := &ChatResponse{
+		Content:      resp.Message.Content,
+		ToolCalls:    convertToolCallsFromOllama(resp.Message.ToolCalls, 0),
+		Model:        resp.Model,
+		CreatedAt:    resp.CreatedAt,
+		Duration:     time.Since(startTime),
+		FinishReason: resp.DoneReason,
+		Usage:        resp.usage(),
+	}
+
+	if len(response.ToolCalls) > 0 {
+		response.FinishReason = FinishReasonToolCalls
+	}
+
+	return response, nil
+}
+
+// StreamChatCompletion sends a streaming chat completion request
+func (p *OllamaProvider) StreamChatCompletion(ctx context.Context, req ChatRequest) (<-chan ChatStreamChunk, error) {
+	ollamaReq, err := p.convertToOllamaRequest(req, true)
+	if err != nil {
+		return nil, fmt.Errorf("stream creation failed: %w", err)
+	}
+
+	// Apply timeout
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+
+	httpResp, idle, err := openStream(ctx, p.config, p.jitter, func(ctx context.Context) (*http.Response, error) {
+		return p.do(ctx, http.MethodPost, "/api/chat", ollamaReq)
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("stream creation failed: %w", err)
+	}
+
+	chunkChan := make(chan ChatStreamChunk)
+
+	go func() {
+		defer close(chunkChan)
+		defer cancel()
+		defer idle.stop()
+		defer httpResp.Body.Close()
+
+		send := func(chunk ChatStreamChunk) bool {
+			select {
+			case chunkChan <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		toolCallCount := 0
+		scanner := bufio.NewScanner(httpResp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		// Ollama streams one JSON object per line
+		for scanner.Scan() {
+			idle.reset()
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var resp ollamaChatResponse
+			if err := json.Unmarshal(line, &resp); err != nil {
+				send(ChatStreamChunk{Error: fmt.Errorf("stream error: %w", err), Done: true})
+				return
+			}
+
+			if resp.Error != "" {
+				send(ChatStreamChunk{Error: fmt.Errorf("stream error: %w", &OllamaAPIError{StatusCode: http.StatusOK, Message: resp.Error}), Done: true})
+				return
+			}
+
+			chunk := ChatStreamChunk{
+				Model:     resp.Model,
+				Delta:     resp.Message.Content,
+				ToolCalls: convertToolCallsFromOllama(resp.Message.ToolCalls, toolCallCount),
+				Usage:     resp.usage(),
+				Done:      resp.Done,
+			}
+			if resp.Done {
+				chunk.FinishReason = resp.DoneReason
+			}
+			toolCallCount += len(chunk.ToolCalls)
+
+			if !send(chunk) || resp.Done {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			send(ChatStreamChunk{Error: fmt.Errorf("stream error: %w", idle.err(err)), Done: true})
+			return
+		}
+
+		// the server closed the stream without a final done message
+		send(ChatStreamChunk{Done: true})
+	}()
+
+	return chunkChan, nil
+}
+
+// Models returns the names of the models installed on the Ollama server
+func (p *OllamaProvider) Models(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	resp, err := p.do(ctx, http.MethodGet, "/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to decode models: %w", err)
+	}
+
+	models := make([]string, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		models = append(models, m.Name)
+	}
+	return models, nil
+}
+
+// do sends a request to the Ollama server, turning non-2xx responses into an OllamaAPIError.
+// Client errors other than timeouts and rate limits are marked as permanent so they aren't retried.
+func (p *OllamaProvider) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, permanent(fmt.Errorf("failed to encode request: %w", err))
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, p.config.BaseURL+path, reader)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("failed to create request: %w", err))
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &OllamaAPIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if data, err := io.ReadAll(resp.Body); err == nil && json.Unmarshal(data, &errResp) == nil && errResp.Error != "" {
+		apiErr.Message = errResp.Error
+	}
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return nil, permanent(apiErr)
+	}
+
+	return nil, apiErr
+}
+
+// convertToOllamaRequest converts our ChatRequest to the /api/chat format
+func (p *OllamaProvider) convertToOllamaRequest(req ChatRequest, stream bool) (ollamaChatRequest, error) {
+	model := req.Model
+	if model == "" {
+		model = p.defaultModel
+	}
+
+	ollamaReq := ollamaChatRequest{
+		Model:    model,
+		Stream:   stream,
+		Messages: make([]ollamaMessage, 0, len(req.Messages)+1),
+		Options:  map[string]interface{}{},
+	}
+
+	if req.Temperature != nil {
+		ollamaReq.Options["temperature"] = *req.Temperature
+	}
+
+	if req.TopP != nil {
+		ollamaReq.Options["top_p"] = *req.TopP
+	}
+
+	if req.PresencePenalty != nil {
+		ollamaReq.Options["presence_penalty"] = *req.PresencePenalty
+	}
+
+	if req.FrequencyPenalty != nil {
+		ollamaReq.Options["frequency_penalty"] = *req.FrequencyPenalty
+	}
+
+	if req.MaxTokens > 0 {
+		ollamaReq.Options["num_predict"] = req.MaxTokens
+	}
+
+	if req.Seed != nil {
+		ollamaReq.Options["seed"] = *req.Seed
+	}
+
+	if len(req.Stop) > 0 {
+		ollamaReq.Options["stop"] = req.Stop
+	}
+
+	// Ollama takes "json" for any JSON, or the schema itself
+	if f := req.ResponseFormat; f != nil {
+		switch f.Type {
+		case ResponseFormatJSONObject:
+			ollamaReq.Format = json.RawMessage(`"json"`)
+		case ResponseFormatJSONSchema:
+			ollamaReq.Format = f.Schema
+		default:
+			return ollamaReq, fmt.Errorf("response format %q: %w", f.Type, ErrUnsupported)
+		}
+	}
+
+	if err := checkRoles(req.Messages); err != nil {
+		return ollamaReq, err
+	}
+
+	if req.SystemPrompt != "" && (len(req.Messages) == 0 || req.Messages[0].Role != state.RoleSystem) {
+		ollamaReq.Messages = append(ollamaReq.Messages, ollamaMessage{Role: string(state.RoleSystem), Content: req.SystemPrompt})
+	}
+
+	for _, msg := range req.Messages {
+		ollamaMsg := ollamaMessage{Role: string(msg.Role), Content: msg.Content}
+
+		if msg.Role == state.RoleAssistant {
+			for _, tc := range msg.ToolCalls {
+				args := map[string]interface{}{}
+				if tc.Function.Arguments != "" {
+					if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+						return ollamaReq, fmt.Errorf("invalid arguments for tool call %q: %w", tc.ID, err)
+					}
+				}
+				ollamaMsg.ToolCalls = append(ollamaMsg.ToolCalls, ollamaToolCall{
+					Function: ollamaToolCallFunction{Name: tc.Function.Name, Arguments: args},
+				})
+			}
+		}
+
+		ollamaReq.Messages = append(ollamaReq.Messages, ollamaMsg)
+	}
+
+	// Ollama accepts tools in the same shape as the OpenAI API
+	ollamaReq.Tools = req.Tools
+
+	return ollamaReq, nil
+}
+
+// convertToolCallsFromOllama converts Ollama tool calls to our format. Ollama doesn't
+// assign IDs, so they are generated from the call's position in the response.
+func convertToolCallsFromOllama(calls []ollamaToolCall, offset int) []state.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	toolCalls := make([]state.ToolCall, 0, len(calls))
+	for i, tc := range calls {
+		args, err := json.Marshal(tc.Function.Arguments)
+		if err != nil || tc.Function.Arguments == nil {
+			args = []byte("{}")
+		}
+
+		toolCalls = append(toolCalls, state.ToolCall{
+			ID:   fmt.Sprintf("call_%d", offset+i),
+			Type: "function",
+			Function: state.ToolCallFunction{
+				Name:      tc.Function.Name,
+				Arguments: string(args),
+			},
+		})
+	}
+	return toolCalls
+}
+
+type ollamaChatRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaMessage        `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Tools    []Tool                 `json:"tools,omitempty"`
+	Format   json.RawMessage        `json:"format,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function ollamaToolCallFunction `json:"function"`
+}
+
+type ollamaToolCallFunction struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       time.Time     `json:"created_at"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// usage maps Ollama's eval counters onto TokenUsage
+func (r ollamaChatResponse) usage() TokenUsage {
+	return TokenUsage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
@@ -0,0 +1,247 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// Test Infrastructure
+// =============================================================================
+
+// newOllamaMockServer serves handler and records every request body it receives
+func newOllamaMockServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, func() []map[string]interface{}) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var bodies []map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		_ = json.Unmarshal(data, &body)
+
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+
+		handler(w, r)
+	}))
+
+	return server, func() []map[string]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]map[string]interface{}{}, bodies...)
+	}
+}
+
+func newTestOllamaProvider(t *testing.T, baseURL string) *OllamaProvider {
+	t.Helper()
+
+	provider, err := NewOllamaProvider(ProviderConfig{BaseURL: baseURL, Timeout: testTimeout, MaxRetries: 1})
+	require.NoError(t, err, "failed to create provider")
+	return provider
+}
+
+// =============================================================================
+// Tests
+// =============================================================================
+
+func TestNewOllamaProvider(t *testing.T) {
+	p, err := NewOllamaProvider(ProviderConfig{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "http://localhost:11434", p.config.BaseURL)
+	assert.NotEmpty(t, p.defaultModel)
+	assert.Equal(t, ProviderOllama, p.Name())
+}
+
+func TestOllamaChatCompletion_SuccessScenarios(t *testing.T) {
+	server, bodies := newOllamaMockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/chat", r.URL.Path)
+		_, _ = io.WriteString(w, `{
+			"model": "llama3.2",
+			"created_at": "2024-01-01T00:00:00Z",
+			"message": {
+				"role": "assistant",
+				"content": "",
+				"tool_calls": [{"function": {"name": "get_weather", "arguments": {"location": "New York"}}}]
+			},
+			"done": true,
+			"done_reason": "stop",
+			"prompt_eval_count": 26,
+			"eval_count": 12
+		}`)
+	})
+	defer server.Close()
+
+	provider := newTestOllamaProvider(t, server.URL)
+	resp, err := provider.ChatCompletion(context.Background(), ChatRequest{
+		SystemPrompt: "Be brief",
+		Temperature:  state.Float(0.5),
+		MaxTokens:    64,
+		Messages:     []state.Message{{Role: state.RoleUser, Content: "Weather?"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "llama3.2", resp.Model)
+	assert.Equal(t, "tool_calls", resp.FinishReason)
+	assert.Equal(t, TokenUsage{PromptTokens: 26, CompletionTokens: 12, TotalTokens: 38}, resp.Usage)
+	require.Len(t, resp.ToolCalls, 1)
+	assert.Equal(t, "get_weather", resp.ToolCalls[0].Function.Name)
+	assert.JSONEq(t, `{"location":"New York"}`, resp.ToolCalls[0].Function.Arguments)
+	assert.NotEmpty(t, resp.ToolCalls[0].ID)
+
+	body := bodies()[0]
+	assert.Equal(t, false, body["stream"])
+	assert.Equal(t, map[string]interface{}{"temperature": 0.5, "num_predict": float64(64)}, body["options"])
+
+	messages := body["messages"].([]interface{})
+	require.Len(t, messages, 2)
+	assert.Equal(t, "system", messages[0].(map[string]interface{})["role"])
+	assert.Equal(t, "Be brief", messages[0].(map[string]interface{})["content"])
+}
+
+func TestOllamaChatCompletion_ErrorScenarios(t *testing.T) {
+	calls := 0
+	server, _ := newOllamaMockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"error":"model \"nope\" not found, try pulling it first"}`)
+	})
+	defer server.Close()
+
+	provider, err := NewOllamaProvider(ProviderConfig{BaseURL: server.URL, Timeout: testTimeout, MaxRetries: 3})
+	require.NoError(t, err)
+
+	resp, err := provider.ChatCompletion(context.Background(), ChatRequest{
+		Model:    "nope",
+		Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+	})
+	require.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Contains(t, err.Error(), "not found")
+	assert.Equal(t, 1, calls, "client errors should not be retried")
+
+	var apiErr *OllamaAPIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+func TestOllamaStreamChatCompletion_SuccessScenarios(t *testing.T) {
+	server, bodies := newOllamaMockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, delta := range []string{"Hello", " from", " Ollama"} {
+			fmt.Fprintf(w, `{"model":"llama3.2","message":{"role":"assistant","content":%q},"done":false}`+"\n", delta)
+			w.(http.Flusher).Flush()
+		}
+		_, _ = io.WriteString(w, `{"model":"llama3.2","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":3}`+"\n")
+	})
+	defer server.Close()
+
+	provider := newTestOllamaProvider(t, server.URL)
+	chunks, err := provider.StreamChatCompletion(context.Background(), ChatRequest{
+		Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+	})
+	require.NoError(t, err)
+
+	var content strings.Builder
+	var final ChatStreamChunk
+	count := 0
+	for chunk := range chunks {
+		require.NoError(t, chunk.Error)
+		content.WriteString(chunk.Delta)
+		final = chunk
+		count++
+	}
+
+	assert.Equal(t, 4, count)
+	assert.Equal(t, "Hello from Ollama", content.String())
+	assert.True(t, final.Done)
+	assert.Equal(t, TokenUsage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8}, final.Usage)
+	assert.Equal(t, true, bodies()[0]["stream"])
+}
+
+func TestOllamaStreamChatCompletion_ErrorScenarios(t *testing.T) {
+	server, _ := newOllamaMockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"model":"llama3.2","message":{"role":"assistant","content":"Hi"},"done":false}`+"\n")
+		_, _ = io.WriteString(w, `{"error":"model runner crashed"}`+"\n")
+	})
+	defer server.Close()
+
+	provider := newTestOllamaProvider(t, server.URL)
+	chunks, err := provider.StreamChatCompletion(context.Background(), ChatRequest{
+		Messages: []state.Message{{Role: state.RoleUser, Content: "Hi"}},
+	})
+	require.NoError(t, err)
+
+	var last ChatStreamChunk
+	for chunk := range chunks {
+		last = chunk
+	}
+
+	require.Error(t, last.Error)
+	assert.Contains(t, last.Error.Error(), "model runner crashed")
+	assert.True(t, last.Done)
+}
+
+func TestOllamaModels(t *testing.T) {
+	server, _ := newOllamaMockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/tags", r.URL.Path)
+		_, _ = io.WriteString(w, `{"models":[{"name":"llama3.2:latest"},{"name":"qwen2.5-coder:7b"}]}`)
+	})
+	defer server.Close()
+
+	provider := newTestOllamaProvider(t, server.URL)
+	models, err := provider.Models(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"llama3.2:latest", "qwen2.5-coder:7b"}, models)
+
+	p, err := GetProvider(ProviderOllama, ProviderConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, ProviderOllama, p.Name())
+}
+
+func TestConvertToOllamaRequest_StopSequences(t *testing.T) {
+	provider, err := NewOllamaProvider(ProviderConfig{})
+	require.NoError(t, err)
+
+	req, err := provider.convertToOllamaRequest(ChatRequest{
+		Messages: []state.Message{{Role: state.RoleUser, Content: "Hello"}},
+		Stop:     []string{"END"},
+	}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"END"}, req.Options["stop"])
+}
+
+func TestConvertToOllamaRequest_ResponseFormat(t *testing.T) {
+	provider, err := NewOllamaProvider(ProviderConfig{})
+	require.NoError(t, err)
+	messages := []state.Message{{Role: state.RoleUser, Content: "Hello"}}
+
+	req, err := provider.convertToOllamaRequest(ChatRequest{
+		Messages:       messages,
+		ResponseFormat: &ResponseFormat{Type: ResponseFormatJSONObject},
+	}, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `"json"`, string(req.Format))
+
+	schema := json.RawMessage(`{"type":"object"}`)
+	req, err = provider.convertToOllamaRequest(ChatRequest{
+		Messages:       messages,
+		ResponseFormat: &ResponseFormat{Type: ResponseFormatJSONSchema, Schema: schema},
+	}, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"object"}`, string(req.Format))
+}
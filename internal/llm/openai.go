@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"errors"
+)
+
+// OpenAIProvider talks to the OpenAI API. It speaks the same protocol LM Studio
+// emulates, so it shares the LM Studio client and only differs in its defaults.
+type OpenAIProvider struct {
+	*LMStudioProvider
+}
+
+// NewOpenAIProvider creates a new OpenAI provider instance
+func NewOpenAIProvider(config ProviderConfig) (*OpenAIProvider, error) {
+	if config.APIKey == "" {
+		return nil, errors.New("openai provider requires an API key (set OPENAI_API_KEY)")
+	}
+
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURLs[ProviderOpenAI]
+	}
+
+	if config.DefaultModel == "" {
+		config.DefaultModel = DefaultModels[ProviderOpenAI]
+	}
+
+	provider, err := NewLMStudioProvider(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OpenAIProvider{LMStudioProvider: provider}, nil
+}
+
+// Name returns the provider name
+func (p *OpenAIProvider) Name() SupportedProvider {
+	return ProviderOpenAI
+}
@@ -0,0 +1,189 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultParams are the built-in sampling parameters for each provider. Local models
+// tend to do better a little warmer, hosted API models a little cooler.
+var DefaultParams = map[SupportedProvider]state.ModelParams{
+	ProviderLMStudio: {Temperature: state.Float(0.8)},
+	ProviderOllama:   {Temperature: state.Float(0.8)},
+	ProviderClaude:   {Temperature: state.Float(0.2)},
+	ProviderOpenAI:   {Temperature: state.Float(0.2)},
+	ProviderGemini:   {Temperature: state.Float(0.2)},
+}
+
+// Environment variables providers read their API key and base URL from when they aren't configured
+const (
+	AnthropicAPIKeyEnv = "ANTHROPIC_API_KEY"
+	OpenAIAPIKeyEnv    = "OPENAI_API_KEY"
+	GeminiAPIKeyEnv    = "GEMINI_API_KEY"
+	OpenAIBaseURLEnv   = "OPENAI_BASE_URL"
+	OpenAIOrgIDEnv     = "OPENAI_ORG_ID"
+	OpenAIProjectEnv   = "OPENAI_PROJECT"
+	LMStudioBaseURLEnv = "LMSTUDIO_BASE_URL"
+)
+
+// APIKeyEnvs maps each provider that authenticates to the environment variable holding its API key
+var APIKeyEnvs = map[SupportedProvider]string{
+	ProviderClaude: AnthropicAPIKeyEnv,
+	ProviderOpenAI: OpenAIAPIKeyEnv,
+	ProviderGemini: GeminiAPIKeyEnv,
+}
+
+// BaseURLEnvs maps providers to the environment variable that overrides their default base URL
+var BaseURLEnvs = map[SupportedProvider]string{
+	ProviderLMStudio: LMStudioBaseURLEnv,
+	ProviderOpenAI:   OpenAIBaseURLEnv,
+}
+
+// DefaultBaseURLs are the endpoints each provider talks to when no base URL is configured
+var DefaultBaseURLs = map[SupportedProvider]string{
+	ProviderLMStudio: "http://localhost:1234/v1",
+	ProviderOllama:   "http://localhost:11434",
+	ProviderClaude:   "https://api.anthropic.com/v1",
+	ProviderOpenAI:   "https://api.openai.com/v1",
+	ProviderGemini:   "https://generativelanguage.googleapis.com/v1beta",
+}
+
+// DefaultModels are the models each provider uses when no model is configured
+var DefaultModels = map[SupportedProvider]string{
+	ProviderLMStudio: "gemma-3n-e4b-it",
+	ProviderOllama:   "llama3.2",
+	ProviderClaude:   "claude-3-5-sonnet-latest",
+	ProviderOpenAI:   "gpt-4o-mini",
+	ProviderGemini:   "gemini-2.0-flash",
+}
+
+// ErrModelNotFound is returned when the provider doesn't have the requested model
+var ErrModelNotFound = errors.New(ModelNotAvailableError)
+
+// IsModelNotFoundError reports whether err is a provider rejecting a request for a model it doesn't have
+func IsModelNotFoundError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrModelNotFound) {
+		return true
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		if code, ok := apiErr.Code.(string); ok && code == "model_not_found" {
+			return true
+		}
+	}
+
+	return strings.Contains(strings.ToLower(err.Error()), "model_not_found")
+}
+
+// modelError tags err with ErrModelNotFound when it's a rejection of model
+func modelError(err error, model string) error {
+	if !IsModelNotFoundError(err) || errors.Is(err, ErrModelNotFound) {
+		return err
+	}
+	return fmt.Errorf("%w: %q: %w", ErrModelNotFound, model, err)
+}
+
+// SupportedProviders lists the built-in providers, see RegisteredProviders for every
+// provider GetProvider can construct
+var SupportedProviders = []SupportedProvider{ProviderLMStudio, ProviderOllama, ProviderClaude, ProviderOpenAI, ProviderGemini}
+
+// ProviderFactory constructs a provider from its configuration
+type ProviderFactory func(ProviderConfig) (Provider, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[SupportedProvider]ProviderFactory{}
+	// registered keeps the order providers were registered in
+	registered []SupportedProvider
+)
+
+func init() {
+	RegisterProvider(ProviderLMStudio, func(c ProviderConfig) (Provider, error) { return NewLMStudioProvider(c) })
+	RegisterProvider(ProviderOllama, func(c ProviderConfig) (Provider, error) { return NewOllamaProvider(c) })
+	RegisterProvider(ProviderClaude, func(c ProviderConfig) (Provider, error) { return NewClaudeProvider(c) })
+	RegisterProvider(ProviderOpenAI, func(c ProviderConfig) (Provider, error) { return NewOpenAIProvider(c) })
+	RegisterProvider(ProviderGemini, func(c ProviderConfig) (Provider, error) { return NewGeminiProvider(c) })
+}
+
+// RegisterProvider makes the provider built by factory available to GetProvider as name.
+// Registering a name again replaces its factory, so built-in providers can be swapped out.
+// It panics if name is empty or factory is nil.
+func RegisterProvider(name SupportedProvider, factory ProviderFactory) {
+	if name == "" {
+		panic("llm: RegisterProvider with an empty name")
+	}
+	if factory == nil {
+		panic(fmt.Sprintf("llm: RegisterProvider %q with a nil factory", name))
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; !ok {
+		registered = append(registered, name)
+	}
+	registry[name] = factory
+}
+
+// RegisteredProviders lists every provider GetProvider can construct in the order they
+// were registered, the built-in ones first
+func RegisteredProviders() []SupportedProvider {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return slices.Clone(registered)
+}
+
+// GetProvider constructs the provider registered as name. An empty name selects LM Studio.
+// An API key or base URL left empty in config is read from the provider's environment variable,
+// and for OpenAI so are the organization and project.
+func GetProvider(name SupportedProvider, config ProviderConfig) (Provider, error) {
+	if name == "" {
+		name = ProviderLMStudio
+	}
+
+	if env, ok := APIKeyEnvs[name]; ok && config.APIKey == "" {
+		config.APIKey = os.Getenv(env)
+	}
+	if env, ok := BaseURLEnvs[name]; ok && config.BaseURL == "" {
+		config.BaseURL = os.Getenv(env)
+	}
+	if name == ProviderOpenAI {
+		if config.Organization == "" {
+			config.Organization = os.Getenv(OpenAIOrgIDEnv)
+		}
+		if config.Project == "" {
+			config.Project = os.Getenv(OpenAIProjectEnv)
+		}
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		providers := RegisteredProviders()
+		names := make([]string, 0, len(providers))
+		for _, p := range providers {
+			names = append(names, string(p))
+		}
+		return nil, fmt.Errorf("unknown provider %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+
+	// a factory returning a typed nil alongside its error mustn't become a non-nil Provider
+	provider, err := factory(config)
+	if err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
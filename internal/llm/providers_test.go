@@ -0,0 +1,317 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetProvider_ReadsEnvironment(t *testing.T) {
+	t.Setenv(OpenAIAPIKeyEnv, "sk-env")
+	t.Setenv(OpenAIBaseURLEnv, "https://proxy.example.com/v1")
+	t.Setenv(LMStudioBaseURLEnv, "http://gpu-box:1234/v1")
+
+	tests := []struct {
+		name        string
+		provider    SupportedProvider
+		config      ProviderConfig
+		wantAPIKey  string
+		wantBaseURL string
+	}{
+		{
+			name:        "openai reads its key and base url from the environment",
+			provider:    ProviderOpenAI,
+			wantAPIKey:  "sk-env",
+			wantBaseURL: "https://proxy.example.com/v1",
+		},
+		{
+			name:        "configured values override the environment",
+			provider:    ProviderOpenAI,
+			config:      ProviderConfig{APIKey: "sk-flag", BaseURL: "https://api.openai.com/v1"},
+			wantAPIKey:  "sk-flag",
+			wantBaseURL: "https://api.openai.com/v1",
+		},
+		{
+			name:        "lmstudio reads its base url and keeps its placeholder key",
+			provider:    ProviderLMStudio,
+			wantAPIKey:  "lm-studio",
+			wantBaseURL: "http://gpu-box:1234/v1",
+		},
+		{
+			name:        "an empty provider name is lmstudio",
+			provider:    "",
+			wantAPIKey:  "lm-studio",
+			wantBaseURL: "http://gpu-box:1234/v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := GetProvider(tt.provider, tt.config)
+			require.NoError(t, err)
+
+			var config ProviderConfig
+			switch p := provider.(type) {
+			case *OpenAIProvider:
+				config = p.config
+			case *LMStudioProvider:
+				config = p.config
+			default:
+				t.Fatalf("unexpected provider %T", provider)
+			}
+
+			assert.Equal(t, tt.wantAPIKey, config.APIKey)
+			assert.Equal(t, tt.wantBaseURL, config.BaseURL)
+		})
+	}
+}
+
+func TestGetProvider_OpenAIRequiresAPIKey(t *testing.T) {
+	t.Setenv(OpenAIAPIKeyEnv, "")
+
+	_, err := GetProvider(ProviderOpenAI, DefaultProviderConfig())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), OpenAIAPIKeyEnv)
+
+	t.Setenv(OpenAIAPIKeyEnv, "sk-env")
+	provider, err := GetProvider(ProviderOpenAI, DefaultProviderConfig())
+	require.NoError(t, err)
+	assert.Equal(t, ProviderOpenAI, provider.Name())
+
+	p := provider.(*OpenAIProvider)
+	assert.Equal(t, DefaultBaseURLs[ProviderOpenAI], p.config.BaseURL)
+	assert.Equal(t, DefaultModels[ProviderOpenAI], p.defaultModel)
+}
+
+func TestGetProvider_SupportedProviders(t *testing.T) {
+	for _, name := range SupportedProviders {
+		provider, err := GetProvider(name, ProviderConfig{APIKey: "test-key"})
+		require.NoError(t, err, name)
+		assert.Equal(t, name, provider.Name())
+	}
+
+	_, err := GetProvider("mistral", ProviderConfig{})
+	assert.ErrorContains(t, err, "unknown provider")
+}
+
+// fakeProvider is a Provider that only knows its name and the config it was built with
+type fakeProvider struct {
+	name   SupportedProvider
+	config ProviderConfig
+}
+
+func (p *fakeProvider) Name() SupportedProvider { return p.name }
+
+func (p *fakeProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	return &ChatResponse{Content: "fake"}, nil
+}
+
+func (p *fakeProvider) StreamChatCompletion(ctx context.Context, req ChatRequest) (<-chan ChatStreamChunk, error) {
+	return nil, ErrUnsupported
+}
+
+func (p *fakeProvider) Models(ctx context.Context) ([]string, error) {
+	return []string{"fake-model"}, nil
+}
+
+// registerTestProvider registers factory as name until the test ends
+func registerTestProvider(t *testing.T, name SupportedProvider, factory ProviderFactory) {
+	t.Helper()
+
+	registryMu.RLock()
+	previous, existed := registry[name]
+	order := slices.Clone(registered)
+	registryMu.RUnlock()
+
+	RegisterProvider(name, factory)
+	t.Cleanup(func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		if existed {
+			registry[name] = previous
+		} else {
+			delete(registry, name)
+		}
+		registered = order
+	})
+}
+
+func TestRegisterProvider(t *testing.T) {
+	registerTestProvider(t, "fake", func(config ProviderConfig) (Provider, error) {
+		return &fakeProvider{name: "fake", config: config}, nil
+	})
+
+	provider, err := GetProvider("fake", ProviderConfig{DefaultModel: "fake-model"})
+	require.NoError(t, err)
+	assert.Equal(t, SupportedProvider("fake"), provider.Name())
+	assert.Equal(t, "fake-model", provider.(*fakeProvider).config.DefaultModel, "the factory should get the config")
+
+	registered := RegisteredProviders()
+	assert.Equal(t, SupportedProviders, registered[:len(SupportedProviders)], "built-in providers should come first")
+	assert.Equal(t, SupportedProvider("fake"), registered[len(registered)-1])
+}
+
+func TestRegisterProvider_Replaces(t *testing.T) {
+	registerTestProvider(t, ProviderOllama, func(config ProviderConfig) (Provider, error) {
+		return &fakeProvider{name: ProviderOllama}, nil
+	})
+
+	provider, err := GetProvider(ProviderOllama, ProviderConfig{})
+	require.NoError(t, err)
+	assert.IsType(t, &fakeProvider{}, provider)
+	assert.Equal(t, SupportedProviders, RegisteredProviders(), "replacing a provider shouldn't list it twice")
+}
+
+func TestRegisterProvider_FactoryError(t *testing.T) {
+	registerTestProvider(t, "broken", func(config ProviderConfig) (Provider, error) {
+		var p *fakeProvider
+		return p, errors.New("no credentials")
+	})
+
+	provider, err := GetProvider("broken", ProviderConfig{})
+	assert.EqualError(t, err, "no credentials")
+	assert.Nil(t, provider, "a typed nil from the factory shouldn't be returned as a provider")
+}
+
+func TestGetProvider_Unknown(t *testing.T) {
+	_, err := GetProvider("mistral", ProviderConfig{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown provider "mistral"`)
+	for _, name := range SupportedProviders {
+		assert.Contains(t, err.Error(), string(name), "the error should list the providers that are registered")
+	}
+}
+
+// countingTransport records how many requests were sent through it
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGetProvider_CustomHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"object":"list","data":[],"models":[]}`))
+	}))
+	defer server.Close()
+
+	for _, name := range []SupportedProvider{ProviderLMStudio, ProviderOpenAI, ProviderOllama, ProviderClaude, ProviderGemini} {
+		t.Run(string(name), func(t *testing.T) {
+			transport := &countingTransport{}
+			client := &http.Client{Transport: transport}
+
+			provider, err := GetProvider(name, ProviderConfig{APIKey: "sk-test", BaseURL: server.URL, HTTPClient: client})
+			require.NoError(t, err)
+
+			_, err = provider.Models(context.Background())
+			require.NoError(t, err)
+
+			assert.Positive(t, transport.requests.Load(), "the request should go through the configured client")
+			assert.Same(t, transport, client.Transport, "the caller's client should be left as it was")
+		})
+	}
+}
+
+func TestGetProvider_OpenAIOrganizationAndProject(t *testing.T) {
+	t.Setenv(OpenAIOrgIDEnv, "org-env")
+	t.Setenv(OpenAIProjectEnv, "proj-env")
+
+	tests := []struct {
+		name        string
+		provider    SupportedProvider
+		config      ProviderConfig
+		wantOrg     string
+		wantProject string
+	}{
+		{name: "openai reads them from the environment", provider: ProviderOpenAI, wantOrg: "org-env", wantProject: "proj-env"},
+		{
+			name:        "configured values override the environment",
+			provider:    ProviderOpenAI,
+			config:      ProviderConfig{Organization: "org-flag", Project: "proj-flag"},
+			wantOrg:     "org-flag",
+			wantProject: "proj-flag",
+		},
+		{name: "lmstudio doesn't send them", provider: ProviderLMStudio},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockServer(t, mockResponse{StatusCode: http.StatusOK, Body: map[string]any{"object": "list", "data": []any{}}})
+			defer mock.Close()
+
+			tt.config.APIKey = "sk-test"
+			tt.config.BaseURL = mock.URL()
+			provider, err := GetProvider(tt.provider, tt.config)
+			require.NoError(t, err)
+
+			_, err = provider.Models(context.Background())
+			require.NoError(t, err)
+
+			requests := mock.GetRequests()
+			require.Len(t, requests, 1)
+			assert.Equal(t, tt.wantOrg, requests[0].Headers.Get("OpenAI-Organization"))
+			assert.Equal(t, tt.wantProject, requests[0].Headers.Get("OpenAI-Project"))
+		})
+	}
+}
+
+func TestProviders_ZeroTemperatureReachesRequestBody(t *testing.T) {
+	req := ChatRequest{
+		Messages:    []state.Message{{Role: state.RoleUser, Content: "Hello"}},
+		Temperature: state.Float(0),
+		TopP:        state.Float(0),
+	}
+
+	claude, err := NewClaudeProvider(ProviderConfig{APIKey: "test-key"})
+	require.NoError(t, err)
+	gemini := newTestGeminiProvider(t, ProviderConfig{})
+	ollama := newTestOllamaProvider(t, "http://127.0.0.1:0")
+	lmstudio := newTestProvider(t, ProviderConfig{})
+
+	tests := []struct {
+		name  string
+		build func() (any, error)
+		// the object in the body that holds the sampling parameters, and their names in it
+		path []string
+		keys []string
+	}{
+		{"claude", func() (any, error) { return claude.convertToClaudeRequest(req, false), nil }, nil, []string{"temperature", "top_p"}},
+		{"gemini", func() (any, error) { _, r := gemini.convertToGeminiRequest(req); return r, nil }, []string{"generationConfig"}, []string{"temperature", "topP"}},
+		{"ollama", func() (any, error) { return ollama.convertToOllamaRequest(req, false) }, []string{"options"}, []string{"temperature", "top_p"}},
+		{"openai compatible", func() (any, error) { return lmstudio.convertToOpenAIRequest(req, false) }, nil, []string{"temperature", "top_p"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			built, err := tt.build()
+			require.NoError(t, err)
+			data, err := json.Marshal(built)
+			require.NoError(t, err)
+
+			var body map[string]any
+			require.NoError(t, json.Unmarshal(data, &body))
+			for _, key := range tt.path {
+				body, _ = body[key].(map[string]any)
+			}
+
+			for _, key := range tt.keys {
+				value, ok := body[key].(float64)
+				require.True(t, ok, "%s is missing from %s", key, data)
+				assert.InDelta(t, 0, value, 1e-6)
+			}
+		})
+	}
+}
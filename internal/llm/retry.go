@@ -0,0 +1,315 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// permanentError marks an error that retryRequest must not retry
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent wraps err so that retryRequest returns it immediately
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// retryBaseDelay is the backoff before the second attempt, doubling on every attempt after it
+var retryBaseDelay = time.Second
+
+// DefaultMaxBackoff is the longest wait between two attempts when ProviderConfig.MaxBackoff is unset
+const DefaultMaxBackoff = 30 * time.Second
+
+// retryBackoff returns how long to wait after the attempt numbered attempt, counting from
+// zero, failed: retryBaseDelay doubled once per earlier attempt but never longer than
+// config.MaxBackoff, drawn from jitter unless config.DisableRetryJitter is set, and
+// stretched to the server's retryAfter, which the cap doesn't apply to since retrying
+// any sooner would only be rate limited again
+func retryBackoff(attempt int, config ProviderConfig, jitter *backoffJitter, retryAfter time.Duration) time.Duration {
+	maxBackoff := config.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	// doubling stops at the cap, so many attempts can't overflow
+	backoff := retryBaseDelay
+	for n := 0; n < attempt && backoff < maxBackoff; n++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, maxBackoff)
+
+	if !config.DisableRetryJitter && jitter != nil {
+		backoff = jitter.apply(backoff)
+	}
+	return max(backoff, retryAfter)
+}
+
+// backoffJitter draws full jitter for retry backoffs. Each provider owns one
+// seeded source so that concurrent providers don't share a lock or a sequence.
+type backoffJitter struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newBackoffJitter(seed int64) *backoffJitter {
+	return &backoffJitter{rng: rand.New(rand.NewSource(seed))}
+}
+
+// apply returns a random duration between 0 and d
+func (j *backoffJitter) apply(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return time.Duration(j.rng.Int63n(int64(d) + 1))
+}
+
+// retryAfterKey is the context key for the retryAfterHint of the current attempt
+type retryAfterKey struct{}
+
+// retryAfterHint carries the server's Retry-After delay from retryAfterTransport back to retryRequest
+type retryAfterHint struct {
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+func (h *retryAfterHint) set(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.delay = d
+}
+
+func (h *retryAfterHint) take() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d := h.delay
+	h.delay = 0
+	return d
+}
+
+// retryAfterTransport records the Retry-After header of 429 and 503 responses on the
+// request context's retryAfterHint. Client libraries such as go-openai drop response
+// headers when they build their error values, so the hint is captured here instead.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if hint, ok := req.Context().Value(retryAfterKey{}).(*retryAfterHint); ok {
+			if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				hint.set(d)
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+// newHTTPClient returns the http.Client a provider sends its requests with: a copy of
+// config.HTTPClient, or a plain client when it's nil, whose responses feed retryRequest's
+// Retry-After handling and are logged to config.Logger. A nil transport is
+// http.DefaultTransport, which uses the proxy set in HTTP_PROXY and HTTPS_PROXY.
+func newHTTPClient(config ProviderConfig) *http.Client {
+	client := &http.Client{}
+	if config.HTTPClient != nil {
+		// a copy, so the caller's client doesn't end up with our transports
+		c := *config.HTTPClient
+		client = &c
+	}
+
+	client.Transport = &retryAfterTransport{base: newLoggingTransport(client.Transport, config.Logger, config.APIKey)}
+	return client
+}
+
+// parseRetryAfter parses a Retry-After value in either delta-seconds or HTTP-date form
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	d := at.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// permanentErrorCodes are the API error codes that fail the same way however often they're retried
+var permanentErrorCodes = []string{"invalid_api_key", "model_not_found"}
+
+// retryable reports whether a request that failed with err may succeed when sent again.
+// Timeouts, rate limits, server errors and network errors are retried, any other 4xx
+// response isn't. Errors without a status code fall back to their error code, and
+// failing that to their message.
+func retryable(err error) bool {
+	status, code := 0, ""
+
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	var claudeErr *ClaudeAPIError
+	var ollamaErr *OllamaAPIError
+	var geminiErr *GeminiAPIError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+		code, _ = apiErr.Code.(string)
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	case errors.As(err, &claudeErr):
+		status, code = claudeErr.StatusCode, claudeErr.Type
+	case errors.As(err, &ollamaErr):
+		status = ollamaErr.StatusCode
+	case errors.As(err, &geminiErr):
+		status = geminiErr.StatusCode
+	}
+
+	switch {
+	case status == http.StatusRequestTimeout || status == http.StatusTooManyRequests:
+		return true
+	case status >= http.StatusInternalServerError:
+		return true
+	case status >= http.StatusBadRequest:
+		return false
+	}
+
+	if code != "" {
+		return !slices.Contains(permanentErrorCodes, code)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	msg := err.Error()
+	for _, code := range permanentErrorCodes {
+		if strings.Contains(msg, code) {
+			return false
+		}
+	}
+	return true
+}
+
+// RetryFunc is told when a failed request is about to be sent again, as attempt out of
+// maxAttempts, along with the error the last attempt failed with
+type RetryFunc func(attempt, maxAttempts int, err error)
+
+// retryFuncKey is the context key for the RetryFunc of a request
+type retryFuncKey struct{}
+
+// WithRetryFunc returns a copy of ctx that has requests made with it report their
+// retries to fn, e.g. so the UI can show that the provider is being retried
+func WithRetryFunc(ctx context.Context, fn RetryFunc) context.Context {
+	return context.WithValue(ctx, retryFuncKey{}, fn)
+}
+
+// retryRequest calls fn until it succeeds or fails with an error that isn't retryable,
+// backing off exponentially between attempts, up to config.MaxRetries attempts (3 when
+// unset), or until the next attempt would start after config.MaxElapsed or ctx's
+// deadline. Unless config.DisableRetryJitter is set the backoff is drawn from jitter.
+// fn must use the context it's given so a Retry-After header from the server can
+// stretch the backoff past config.MaxBackoff. Every retry is reported to the RetryFunc
+// set on ctx with WithRetryFunc.
+func retryRequest(ctx context.Context, config ProviderConfig, jitter *backoffJitter, fn func(ctx context.Context) error) error {
+	maxRetries := config.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+
+	hint := &retryAfterHint{}
+	attemptCtx := context.WithValue(ctx, retryAfterKey{}, hint)
+	onRetry, _ := ctx.Value(retryFuncKey{}).(RetryFunc)
+	start := time.Now()
+
+	var lastErr error
+	for i := 0; i < maxRetries; i++ {
+		if err := fn(attemptCtx); err != nil {
+			lastErr = err
+
+			// Check if context is cancelled
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Don't retry on certain errors
+			var perr *permanentError
+			if errors.As(err, &perr) {
+				return perr.err
+			}
+			if !retryable(err) {
+				return err
+			}
+
+			// Exponential backoff, stretched to honour the server's Retry-After
+			retryAfter := hint.take()
+			if i < maxRetries-1 {
+				backoff := retryBackoff(i, config, jitter, retryAfter)
+				// the next attempt would start after the deadline, so give up with the real error now
+				if deadline, ok := ctx.Deadline(); ok && backoff >= time.Until(deadline) {
+					return fmt.Errorf("request failed after %d attempts, retrying would pass the deadline: %w", i+1, err)
+				}
+				if config.MaxElapsed > 0 && time.Since(start)+backoff > config.MaxElapsed {
+					return fmt.Errorf("request failed after %d attempts, retrying would take longer than %s: %w", i+1, config.MaxElapsed, err)
+				}
+				if onRetry != nil {
+					onRetry(i+2, maxRetries, err)
+				}
+
+				select {
+				case <-time.After(backoff):
+					// Continue to next retry
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		} else {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("request failed after %d retries: %w", maxRetries, lastErr)
+}
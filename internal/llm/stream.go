@@ -0,0 +1,198 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultStreamIdleTimeout is how long a stream may go without data when
+// ProviderConfig.StreamIdleTimeout is unset
+const DefaultStreamIdleTimeout = 60 * time.Second
+
+// ErrStreamIdle ends a stream the server stopped sending data on without closing it
+var ErrStreamIdle = errors.New("stream idle timeout")
+
+// idleTimer cancels a stream's request once the server has sent nothing for its timeout,
+// every read that gets data pushes the deadline back
+type idleTimer struct {
+	ctx     context.Context
+	timer   *time.Timer
+	timeout time.Duration
+	cancel  context.CancelCauseFunc
+}
+
+// withIdleTimeout derives the context a stream's request is sent with from ctx. It's
+// cancelled with ErrStreamIdle when timeout passes without a reset, a zero timeout uses
+// DefaultStreamIdleTimeout and a negative one never times out.
+func withIdleTimeout(ctx context.Context, timeout time.Duration) (context.Context, *idleTimer) {
+	if timeout == 0 {
+		timeout = DefaultStreamIdleTimeout
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	t := &idleTimer{ctx: ctx, timeout: timeout, cancel: cancel}
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, func() {
+			cancel(fmt.Errorf("%w: no data for %s", ErrStreamIdle, timeout))
+		})
+	}
+	return ctx, t
+}
+
+// reset pushes the deadline back after data arrived
+func (t *idleTimer) reset() {
+	if t.timer != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+// stop releases the timer and the request's context once the stream is done
+func (t *idleTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.cancel(nil)
+}
+
+// err is the error a failed read should report, the idle timeout when that's what
+// cancelled the request and err otherwise
+func (t *idleTimer) err(err error) error {
+	if cause := context.Cause(t.ctx); errors.Is(cause, ErrStreamIdle) {
+		return cause
+	}
+	return err
+}
+
+// openStream sends a stream's request with open, retrying it like any other request until
+// the server accepts it. Every attempt gets its own idle timer so time spent backing off
+// doesn't count as the stream going quiet, the timer of the attempt that got through is
+// returned with its stream.
+func openStream[T any](ctx context.Context, config ProviderConfig, jitter *backoffJitter, open func(ctx context.Context) (T, error)) (T, *idleTimer, error) {
+	var stream T
+	var idle *idleTimer
+	err := retryRequest(ctx, config, jitter, func(ctx context.Context) error {
+		reqCtx, attempt := withIdleTimeout(ctx, config.StreamIdleTimeout)
+		s, err := open(reqCtx)
+		if err != nil {
+			err = attempt.err(err)
+			attempt.stop()
+			return err
+		}
+
+		stream, idle = s, attempt
+		return nil
+	})
+	return stream, idle, err
+}
+
+// streamAssembler turns the responses of an OpenAI compatible stream into chunks, so a
+// provider only has to supply the transport. Text is passed on as it arrives, tool call
+// fragments are merged until the model finishes calling tools, and the last chunk has
+// the last usage the server reported.
+type streamAssembler struct {
+	toolCalls toolCallAccumulator
+	model     string
+	usage     TokenUsage
+}
+
+// add converts resp into the chunk to send, false when it has nothing in it to send
+func (a *streamAssembler) add(resp openai.ChatCompletionStreamResponse) (ChatStreamChunk, bool) {
+	if resp.Model != "" {
+		a.model = resp.Model
+	}
+
+	var usage TokenUsage
+	if resp.Usage != nil {
+		usage = TokenUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		}
+		a.usage = usage
+	}
+
+	// servers asked to include usage send it on its own after the last choice
+	if len(resp.Choices) == 0 {
+		return ChatStreamChunk{Model: resp.Model, Usage: usage}, resp.Usage != nil
+	}
+
+	choice := resp.Choices[0]
+	chunk := ChatStreamChunk{
+		Usage:        usage,
+		Model:        resp.Model,
+		Delta:        choice.Delta.Content,
+		FinishReason: string(choice.FinishReason),
+	}
+
+	// tool calls are only emitted once they're complete
+	a.toolCalls.add(choice.Delta.ToolCalls)
+	if choice.FinishReason == openai.FinishReasonToolCalls {
+		chunk.ToolCalls = a.toolCalls.flush()
+	}
+	return chunk, true
+}
+
+// finish is the chunk that ends the stream, with any tool calls the server never marked
+// finished, e.g. ones it ended with a "stop" finish reason
+func (a *streamAssembler) finish() ChatStreamChunk {
+	return ChatStreamChunk{Model: a.model, Usage: a.usage, ToolCalls: a.toolCalls.flush(), Done: true}
+}
+
+// toolCallAccumulator merges streamed tool call fragments by their index. The first
+// fragment of a call carries its ID and name, later ones only append to the arguments.
+type toolCallAccumulator struct {
+	calls map[int]*state.ToolCall
+	order []int
+}
+
+func (a *toolCallAccumulator) add(deltas []openai.ToolCall) {
+	for i, delta := range deltas {
+		index := i
+		if delta.Index != nil {
+			index = *delta.Index
+		}
+
+		if a.calls == nil {
+			a.calls = map[int]*state.ToolCall{}
+		}
+
+		call, ok := a.calls[index]
+		if !ok {
+			call = &state.ToolCall{Type: "function"}
+			a.calls[index] = call
+			a.order = append(a.order, index)
+		}
+
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = string(delta.Type)
+		}
+		if delta.Function.Name != "" {
+			call.Function.Name = delta.Function.Name
+		}
+		call.Function.Arguments += delta.Function.Arguments
+	}
+}
+
+// flush returns the assembled tool calls in the order they were started and resets the accumulator
+func (a *toolCallAccumulator) flush() []state.ToolCall {
+	if len(a.order) == 0 {
+		return nil
+	}
+
+	toolCalls := make([]state.ToolCall, 0, len(a.order))
+	for _, index := range a.order {
+		toolCalls = append(toolCalls, *a.calls[index])
+	}
+
+	a.calls = nil
+	a.order = nil
+	return toolCalls
+}
@@ -0,0 +1,284 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// idleStreamProviders builds every streaming provider against baseURL, each with the
+// line format its server streams a chunk of text in
+var idleStreamProviders = []struct {
+	name  string
+	new   func(config ProviderConfig) (Provider, error)
+	chunk func(text string) string
+}{
+	{
+		name: "lmstudio",
+		new:  func(c ProviderConfig) (Provider, error) { return NewLMStudioProvider(c) },
+		chunk: func(text string) string {
+			return fmt.Sprintf(`data: {"id":"1","object":"chat.completion.chunk","model":"m","choices":[{"index":0,"delta":{"content":%q}}]}`+"\n\n", text)
+		},
+	},
+	{
+		name: "ollama",
+		new:  func(c ProviderConfig) (Provider, error) { return NewOllamaProvider(c) },
+		chunk: func(text string) string {
+			return fmt.Sprintf(`{"model":"m","message":{"role":"assistant","content":%q},"done":false}`+"\n", text)
+		},
+	},
+	{
+		name: "claude",
+		new:  func(c ProviderConfig) (Provider, error) { return NewClaudeProvider(c) },
+		chunk: func(text string) string {
+			return fmt.Sprintf(`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":%q}}`+"\n\n", text)
+		},
+	},
+	{
+		name: "gemini",
+		new:  func(c ProviderConfig) (Provider, error) { return NewGeminiProvider(c) },
+		chunk: func(text string) string {
+			return fmt.Sprintf(`data: {"candidates":[{"content":{"parts":[{"text":%q}]}}]}`+"\n\n", text)
+		},
+	},
+}
+
+// newStallingServer streams lines every interval and then holds the connection open
+// without sending anything else until the client gives up
+func newStallingServer(t *testing.T, lines []string, interval time.Duration) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		for i, line := range lines {
+			if i > 0 {
+				time.Sleep(interval)
+			}
+			fmt.Fprint(w, line)
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// collectStream reads the stream to its end and returns the text streamed and the error it ended with
+func collectStream(t *testing.T, stream <-chan ChatStreamChunk) (string, error) {
+	t.Helper()
+
+	var text string
+	for {
+		select {
+		case chunk, ok := <-stream:
+			if !ok {
+				return text, nil
+			}
+			if chunk.Error != nil {
+				return text, chunk.Error
+			}
+			text += chunk.Delta
+		case <-time.After(testTimeout):
+			t.Fatal("timed out waiting for the stream to end")
+		}
+	}
+}
+
+func TestStreamChatCompletion_IdleTimeout(t *testing.T) {
+	for _, p := range idleStreamProviders {
+		t.Run(p.name, func(t *testing.T) {
+			server := newStallingServer(t, []string{p.chunk("partial")}, 0)
+			provider, err := p.new(ProviderConfig{
+				APIKey:            "test-key",
+				BaseURL:           server.URL,
+				DefaultModel:      "m",
+				Timeout:           time.Minute,
+				StreamIdleTimeout: 100 * time.Millisecond,
+			})
+			require.NoError(t, err)
+
+			start := time.Now()
+			stream, err := provider.StreamChatCompletion(context.Background(), ChatRequest{Model: "m", Messages: []state.Message{{Role: state.RoleUser, Content: "Hello"}}})
+			require.NoError(t, err)
+
+			text, err := collectStream(t, stream)
+			assert.Equal(t, "partial", text, "what streamed before the stall is kept")
+			assert.True(t, errors.Is(err, ErrStreamIdle), "expected an idle timeout, got %v", err)
+			assert.Less(t, time.Since(start), 5*time.Second, "the idle timeout should fire long before Timeout")
+		})
+	}
+}
+
+func TestStreamChatCompletion_IdleTimeoutResetsOnData(t *testing.T) {
+	for _, p := range idleStreamProviders {
+		t.Run(p.name, func(t *testing.T) {
+			// every gap is under the idle timeout, but together they're well over it
+			lines := []string{p.chunk("a"), p.chunk("b"), p.chunk("c"), p.chunk("d"), p.chunk("e")}
+			server := newStallingServer(t, lines, 80*time.Millisecond)
+			provider, err := p.new(ProviderConfig{
+				APIKey:            "test-key",
+				BaseURL:           server.URL,
+				DefaultModel:      "m",
+				Timeout:           time.Minute,
+				StreamIdleTimeout: 200 * time.Millisecond,
+			})
+			require.NoError(t, err)
+
+			stream, err := provider.StreamChatCompletion(context.Background(), ChatRequest{Model: "m", Messages: []state.Message{{Role: state.RoleUser, Content: "Hello"}}})
+			require.NoError(t, err)
+
+			text, err := collectStream(t, stream)
+			assert.Equal(t, "abcde", text)
+			assert.True(t, errors.Is(err, ErrStreamIdle), "expected the stall after the last chunk to time out, got %v", err)
+		})
+	}
+}
+
+// streamDelta is a stream response with a single choice
+func streamDelta(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{
+		Model:   "m",
+		Choices: []openai.ChatCompletionStreamChoice{{Delta: delta, FinishReason: finish}},
+	}
+}
+
+// toolCallDelta is a fragment of the tool call at index
+func toolCallDelta(index int, id, name, arguments string) openai.ToolCall {
+	return openai.ToolCall{Index: &index, ID: id, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: name, Arguments: arguments}}
+}
+
+// assemble feeds every response to a new streamAssembler and returns the chunks it
+// produced, the finishing one last
+func assemble(responses ...openai.ChatCompletionStreamResponse) []ChatStreamChunk {
+	a := &streamAssembler{}
+	var chunks []ChatStreamChunk
+	for _, resp := range responses {
+		if chunk, ok := a.add(resp); ok {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return append(chunks, a.finish())
+}
+
+func TestStreamAssembler_Content(t *testing.T) {
+	chunks := assemble(
+		streamDelta(openai.ChatCompletionStreamChoiceDelta{Role: "assistant"}, ""),
+		streamDelta(openai.ChatCompletionStreamChoiceDelta{Content: "Hel"}, ""),
+		streamDelta(openai.ChatCompletionStreamChoiceDelta{Content: "lo"}, openai.FinishReasonStop),
+	)
+
+	require.Len(t, chunks, 4)
+	var text string
+	for _, c := range chunks {
+		text += c.Delta
+		assert.Empty(t, c.ToolCalls)
+	}
+	assert.Equal(t, "Hello", text)
+	assert.Equal(t, "stop", chunks[2].FinishReason)
+	assert.Equal(t, ChatStreamChunk{Model: "m", Done: true}, chunks[3])
+}
+
+func TestStreamAssembler_ToolCalls(t *testing.T) {
+	chunks := assemble(
+		streamDelta(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{
+			toolCallDelta(0, "call_1", "read_file", `{"pa`),
+		}}, ""),
+		streamDelta(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{
+			toolCallDelta(1, "call_2", "grep", `{"pattern":`),
+			toolCallDelta(0, "", "", `th":"a.go"}`),
+		}}, ""),
+		streamDelta(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{
+			toolCallDelta(1, "", "", `"TODO"}`),
+		}}, openai.FinishReasonToolCalls),
+	)
+
+	require.Len(t, chunks, 4)
+	assert.Empty(t, chunks[0].ToolCalls, "tool calls wait until they're complete")
+	assert.Empty(t, chunks[1].ToolCalls, "tool calls wait until they're complete")
+	assert.Equal(t, []state.ToolCall{
+		{ID: "call_1", Type: "function", Function: state.ToolCallFunction{Name: "read_file", Arguments: `{"path":"a.go"}`}},
+		{ID: "call_2", Type: "function", Function: state.ToolCallFunction{Name: "grep", Arguments: `{"pattern":"TODO"}`}},
+	}, chunks[2].ToolCalls)
+	assert.Empty(t, chunks[3].ToolCalls, "emitted tool calls aren't repeated at the end")
+}
+
+func TestStreamAssembler_ToolCallsWithoutFinishReason(t *testing.T) {
+	// some servers end a turn of tool calls with "stop", or with no finish reason at all
+	chunks := assemble(
+		streamDelta(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{
+			{ID: "call_1", Function: openai.FunctionCall{Name: "list_files", Arguments: "{}"}},
+		}}, openai.FinishReasonStop),
+	)
+
+	require.Len(t, chunks, 2)
+	assert.Empty(t, chunks[0].ToolCalls)
+	last := chunks[1]
+	assert.True(t, last.Done)
+	assert.Equal(t, []state.ToolCall{
+		{ID: "call_1", Type: "function", Function: state.ToolCallFunction{Name: "list_files", Arguments: "{}"}},
+	}, last.ToolCalls)
+}
+
+func TestStreamAssembler_Usage(t *testing.T) {
+	usage := &openai.Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}
+	chunks := assemble(
+		streamDelta(openai.ChatCompletionStreamChoiceDelta{Content: "hi"}, openai.FinishReasonStop),
+		openai.ChatCompletionStreamResponse{},
+		openai.ChatCompletionStreamResponse{Model: "m", Usage: usage},
+	)
+
+	require.Len(t, chunks, 3, "a response without choices or usage is skipped")
+	want := TokenUsage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}
+	assert.Equal(t, want, chunks[1].Usage)
+	assert.Empty(t, chunks[1].Delta)
+	assert.Equal(t, ChatStreamChunk{Model: "m", Usage: want, Done: true}, chunks[2], "the final chunk has the final usage")
+}
+
+func TestStreamChatCompletion_RetriesCreation(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	for _, p := range idleStreamProviders {
+		t.Run(p.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests == 1 {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusServiceUnavailable)
+					fmt.Fprint(w, `{"error":{"message":"overloaded"}}`)
+					return
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, p.chunk("hello"))
+			}))
+			t.Cleanup(server.Close)
+
+			provider, err := p.new(ProviderConfig{APIKey: "test-key", BaseURL: server.URL, DefaultModel: "m", Timeout: time.Minute, MaxRetries: 3})
+			require.NoError(t, err)
+
+			var retries []string
+			ctx := WithRetryFunc(context.Background(), func(attempt, maxAttempts int, err error) {
+				retries = append(retries, fmt.Sprintf("%d/%d", attempt, maxAttempts))
+			})
+			stream, err := provider.StreamChatCompletion(ctx, ChatRequest{Model: "m", Messages: []state.Message{{Role: state.RoleUser, Content: "Hello"}}})
+			require.NoError(t, err, "a failed stream request should be retried")
+
+			text, err := collectStream(t, stream)
+			require.NoError(t, err)
+			assert.Equal(t, "hello", text)
+			assert.Equal(t, 2, requests)
+			assert.Equal(t, []string{"2/3"}, retries)
+		})
+	}
+}
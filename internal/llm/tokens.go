@@ -0,0 +1,258 @@
+package llm
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/sashabaranov/go-openai"
+)
+
+// messageOverheadTokens approximates the role and framing tokens each message adds
+const messageOverheadTokens = 4
+
+// EstimateTokens estimates the tokens in text without a tokenizer. It splits text the
+// way OpenAI's cl100k BPE pre-tokenizer does, into words, numbers, punctuation and
+// whitespace, and counts each piece: short words are a single token, longer words and
+// identifiers split every few letters, numbers every three digits. For English prose
+// and code it usually lands within 20% of the real count.
+func EstimateTokens(text string) int {
+	tokens := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		// a single space is part of the word or punctuation after it
+		if r == ' ' && i+size < len(text) {
+			if next, nextSize := utf8.DecodeRuneInString(text[i+size:]); !unicode.IsSpace(next) {
+				i += size
+				r, size = next, nextSize
+			}
+		}
+
+		switch {
+		case unicode.IsSpace(r):
+			i = scan(text, i, unicode.IsSpace)
+			tokens++
+		case unicode.IsNumber(r):
+			end := scan(text, i, unicode.IsNumber)
+			tokens += (utf8.RuneCountInString(text[i:end]) + 2) / 3
+			i = end
+		case isIdeograph(r):
+			// scripts without spaces between words are roughly a token per character
+			i += size
+			tokens++
+		case unicode.IsLetter(r):
+			end := scan(text, i, func(r rune) bool { return unicode.IsLetter(r) && !isIdeograph(r) })
+			tokens += wordTokens(text[i:end])
+			i = end
+		default:
+			// about two punctuation characters per token, multibyte symbols like emoji count more
+			end := scan(text, i, isSymbol)
+			tokens += (end - i + 1) / 2
+			// trailing newlines go with the punctuation, e.g. " {\n"
+			i = scan(text, end, func(r rune) bool { return r == '\r' || r == '\n' })
+		}
+	}
+	return tokens
+}
+
+// scan returns the index just past the run of runes matching f that starts at i
+func scan(text string, i int, f func(rune) bool) int {
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !f(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// isSymbol reports whether r is punctuation or a symbol rather than a letter, digit or space
+func isSymbol(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// isIdeograph reports whether r is from a script written without spaces between words
+func isIdeograph(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Thai)
+}
+
+// wordTokens estimates the tokens in a run of letters. camelCase humps are counted as
+// separate words, words up to eight letters are usually a single token and longer ones
+// split about every five letters.
+func wordTokens(word string) int {
+	tokens := 0
+	start := 0
+	prevLower := false
+	for i, r := range word {
+		if unicode.IsUpper(r) && prevLower {
+			tokens += pieceTokens(utf8.RuneCountInString(word[start:i]))
+			start = i
+		}
+		prevLower = unicode.IsLower(r)
+	}
+	return tokens + pieceTokens(utf8.RuneCountInString(word[start:]))
+}
+
+// pieceTokens estimates the tokens in a single word of n letters
+func pieceTokens(n int) int {
+	if n <= 8 {
+		return 1
+	}
+	return 1 + (n-8+4)/5
+}
+
+// modelTokenFactors scale the cl100k estimate for model families whose tokenizers
+// produce noticeably more tokens for the same text, matched against the model name
+var modelTokenFactors = map[string]float64{
+	"claude": 1.15,
+}
+
+// TokenCounterFor returns the estimator for model's tokenizer. Models without a known
+// factor are estimated as cl100k, which is close for most modern tokenizers.
+func TokenCounterFor(model string) TokenCounter {
+	model = strings.ToLower(model)
+	for family, factor := range modelTokenFactors {
+		if strings.Contains(model, family) {
+			return func(text string) int {
+				return int(math.Ceil(float64(EstimateTokens(text)) * factor))
+			}
+		}
+	}
+	return EstimateTokens
+}
+
+// EstimateMessageTokens estimates the prompt tokens messages use with model, including
+// the framing each message adds, so the UI can warn before a request gets too big
+func EstimateMessageTokens(messages []state.Message, model string) int {
+	return promptTokens("", messages, TokenCounterFor(model))
+}
+
+// TokenCounter counts the tokens in text. EstimateTokens is used when none is given.
+type TokenCounter func(text string) int
+
+// EstimatePromptTokens estimates the prompt tokens a request with this system prompt and history would use
+func EstimatePromptTokens(systemPrompt string, messages []state.Message) int {
+	return promptTokens(systemPrompt, messages, EstimateTokens)
+}
+
+// promptTokens counts the prompt tokens of a request with this system prompt and history
+func promptTokens(systemPrompt string, messages []state.Message, count TokenCounter) int {
+	total := count(systemPrompt)
+	for _, m := range messages {
+		total += messageTokens(m, count)
+	}
+	return total
+}
+
+// messageTokens counts the tokens m adds to a prompt
+func messageTokens(m state.Message, count TokenCounter) int {
+	total := messageOverheadTokens + count(m.Content)
+	for _, tc := range m.ToolCalls {
+		total += count(tc.Function.Name) + count(tc.Function.Arguments)
+	}
+	return total
+}
+
+// TruncateMessages drops the oldest messages until a request with systemPrompt and the
+// rest of messages is counted at no more than maxTokens. System messages are kept, and
+// so is everything from the latest user message on since that's what the model is
+// answering, so the result can still be over budget. Tool results are dropped with the
+// assistant message that called them. A non-positive maxTokens doesn't truncate.
+func TruncateMessages(systemPrompt string, messages []state.Message, maxTokens int, count TokenCounter) []state.Message {
+	if count == nil {
+		count = EstimateTokens
+	}
+
+	total := promptTokens(systemPrompt, messages, count)
+	if maxTokens <= 0 || total <= maxTokens {
+		return messages
+	}
+
+	keepFrom := len(messages) - 1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == state.RoleUser {
+			keepFrom = i
+			break
+		}
+	}
+
+	kept := make([]state.Message, 0, len(messages))
+	// orphaned is set while the tool results being walked belong to a dropped tool call
+	orphaned := false
+	for i, m := range messages {
+		if i >= keepFrom || m.Role == state.RoleSystem {
+			kept = append(kept, m)
+			continue
+		}
+
+		if total > maxTokens || (orphaned && m.Role == state.RoleTool) {
+			total -= messageTokens(m, count)
+			if m.Role == state.RoleAssistant && len(m.ToolCalls) > 0 {
+				orphaned = true
+			}
+			continue
+		}
+
+		orphaned = false
+		kept = append(kept, m)
+	}
+
+	return kept
+}
+
+// ExceedsTokenThreshold reports whether a prompt estimated at estimate tokens
+// should be confirmed before sending. A non-positive threshold never does.
+func ExceedsTokenThreshold(estimate, threshold int) bool {
+	return threshold > 0 && estimate > threshold
+}
+
+// contextLengthMarkers are fragments of the errors providers return when a prompt
+// doesn't fit in the model's context window
+var contextLengthMarkers = []string{
+	"context_length_exceeded",
+	"context length",
+	"context window",
+	"maximum context",
+	"prompt is too long",
+	"too many tokens",
+	"exceeds the maximum number of tokens",
+}
+
+// IsContextLengthError reports whether err is a provider rejecting a prompt for
+// exceeding the model's context window
+func IsContextLengthError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		if code, ok := apiErr.Code.(string); ok && code == "context_length_exceeded" {
+			return true
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, marker := range contextLengthMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrimOldestMessages drops the oldest half of messages so a retried request has a
+// better chance of fitting. The latest message is always kept.
+func TrimOldestMessages(messages []state.Message) []state.Message {
+	if len(messages) <= 1 {
+		return messages
+	}
+
+	drop := len(messages) / 2
+	return messages[drop:]
+}
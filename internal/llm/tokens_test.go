@@ -0,0 +1,192 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimatePromptTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(""))
+	assert.Equal(t, 1, EstimateTokens("abc"))
+	assert.Equal(t, 3, EstimateTokens("hello world!"))
+
+	estimate := EstimatePromptTokens("be brief", []state.Message{
+		{Role: state.RoleUser, Content: "hello world!"},
+	})
+	assert.Equal(t, 2+messageOverheadTokens+3, estimate)
+}
+
+func TestEstimateTokens_KnownCounts(t *testing.T) {
+	// token counts from OpenAI's cl100k_base tokenizer
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"hello world", 2},
+		{"Hello, world!", 4},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"1234567890", 4},
+		{"func main() {", 4},
+		{"Tokenization splits text into smaller units called tokens.", 10},
+	}
+
+	for _, tt := range tests {
+		got := EstimateTokens(tt.text)
+		// within 20% or a single token for the short samples
+		tolerance := max(1, tt.want/5)
+		assert.InDelta(t, tt.want, got, float64(tolerance), "EstimateTokens(%q)", tt.text)
+	}
+}
+
+func TestEstimateMessageTokens(t *testing.T) {
+	messages := []state.Message{
+		{Role: state.RoleUser, Content: "The quick brown fox jumps over the lazy dog."},
+		{Role: state.RoleAssistant, Content: "hello world"},
+	}
+
+	gpt := EstimateMessageTokens(messages, "gpt-4o-mini")
+	assert.Equal(t, 2*messageOverheadTokens+EstimateTokens(messages[0].Content)+EstimateTokens(messages[1].Content), gpt)
+	assert.Greater(t, EstimateMessageTokens(messages, "claude-3-5-sonnet-latest"), gpt, "Claude's tokenizer produces more tokens")
+	assert.Equal(t, 0, EstimateMessageTokens(nil, "gpt-4o-mini"))
+}
+
+func TestExceedsTokenThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		estimate  int
+		threshold int
+		want      bool
+	}{
+		{"below", 99, 100, false},
+		{"at", 100, 100, false},
+		{"above", 101, 100, true},
+		{"disabled", 1_000_000, 0, false},
+		{"negative_disables", 1_000_000, -1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ExceedsTokenThreshold(tt.estimate, tt.threshold))
+		})
+	}
+}
+
+func TestIsContextLengthError(t *testing.T) {
+	assert.False(t, IsContextLengthError(nil))
+	assert.False(t, IsContextLengthError(errors.New("connection refused")))
+	assert.True(t, IsContextLengthError(errors.New("This model's maximum context length is 8192 tokens")))
+	assert.True(t, IsContextLengthError(&ClaudeAPIError{StatusCode: 400, Type: "invalid_request_error", Message: "prompt is too long: 210000 tokens > 200000 maximum"}))
+	assert.True(t, IsContextLengthError(fmt.Errorf("stream failed: %w", &openai.APIError{Code: "context_length_exceeded", Message: "too long"})))
+}
+
+func TestTrimOldestMessages(t *testing.T) {
+	msgs := []state.Message{{Content: "1"}, {Content: "2"}, {Content: "3"}, {Content: "4"}, {Content: "5"}}
+
+	trimmed := TrimOldestMessages(msgs)
+	assert.Len(t, trimmed, 3)
+	assert.Equal(t, "5", trimmed[len(trimmed)-1].Content)
+
+	assert.Len(t, TrimOldestMessages(msgs[:1]), 1)
+}
+
+func TestTruncateMessages(t *testing.T) {
+	// one token per word keeps the budgets in the cases below readable
+	words := func(text string) int { return len(strings.Fields(text)) }
+	call := state.ToolCall{ID: "call_1", Function: state.ToolCallFunction{Name: "read", Arguments: "a"}}
+
+	contents := func(msgs []state.Message) []string {
+		var out []string
+		for _, m := range msgs {
+			out = append(out, m.Content)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		system    string
+		messages  []state.Message
+		maxTokens int
+		want      []string
+	}{
+		{
+			name: "fits",
+			messages: []state.Message{
+				{Role: state.RoleUser, Content: "one two"},
+				{Role: state.RoleAssistant, Content: "three"},
+			},
+			maxTokens: 100,
+			want:      []string{"one two", "three"},
+		},
+		{
+			name: "no budget",
+			messages: []state.Message{
+				{Role: state.RoleUser, Content: "one two three four five six"},
+				{Role: state.RoleUser, Content: "seven"},
+			},
+			want: []string{"one two three four five six", "seven"},
+		},
+		{
+			name:   "drops oldest first",
+			system: "be brief",
+			messages: []state.Message{
+				{Role: state.RoleUser, Content: "a a a a"},
+				{Role: state.RoleAssistant, Content: "b b b b"},
+				{Role: state.RoleUser, Content: "c c"},
+				{Role: state.RoleAssistant, Content: "d d"},
+				{Role: state.RoleUser, Content: "latest"},
+			},
+			// 2 system + 4 messages of overhead each: c, d and latest fit in 2+6+6+5
+			maxTokens: 19,
+			want:      []string{"c c", "d d", "latest"},
+		},
+		{
+			name: "keeps system messages",
+			messages: []state.Message{
+				{Role: state.RoleSystem, Content: "rules"},
+				{Role: state.RoleUser, Content: "a a a a a a"},
+				{Role: state.RoleUser, Content: "latest"},
+			},
+			maxTokens: 10,
+			want:      []string{"rules", "latest"},
+		},
+		{
+			name: "keeps the latest user message even over budget",
+			messages: []state.Message{
+				{Role: state.RoleUser, Content: "a"},
+				{Role: state.RoleUser, Content: "far too long for the budget"},
+				{Role: state.RoleAssistant, Content: "reply", ToolCalls: []state.ToolCall{call}},
+				{Role: state.RoleTool, Content: "result", ToolCalls: []state.ToolCall{call}},
+			},
+			maxTokens: 5,
+			want:      []string{"far too long for the budget", "reply", "result"},
+		},
+		{
+			name: "drops tool results with their call",
+			messages: []state.Message{
+				{Role: state.RoleUser, Content: "a"},
+				{Role: state.RoleAssistant, ToolCalls: []state.ToolCall{call}},
+				{Role: state.RoleTool, Content: "x", ToolCalls: []state.ToolCall{call}},
+				{Role: state.RoleTool, Content: "y", ToolCalls: []state.ToolCall{call}},
+				{Role: state.RoleAssistant, Content: "done"},
+				{Role: state.RoleUser, Content: "latest"},
+			},
+			// dropping the user message and the call is enough, the results go with the call
+			maxTokens: 18,
+			want:      []string{"done", "latest"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TruncateMessages(tt.system, tt.messages, tt.maxTokens, words)
+			assert.Equal(t, tt.want, contents(got))
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultAutosaveInterval is the minimum time between two writes of the same session
+const DefaultAutosaveInterval = 2 * time.Second
+
+// DefaultMaxSessions is how many session files are kept before the oldest are pruned
+const DefaultMaxSessions = 100
+
+// FileStore persists the conversation Context to a JSON file on disk.
+// Saves are coalesced so that at most one write happens per interval, no matter
+// how many actions (e.g. streaming chunks) are dispatched in the meantime.
+type FileStore struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending *Context
+	timer   *time.Timer
+	closed  bool
+
+	// maxSessions caps the session files kept next to path, 0 keeps them all
+	maxSessions int
+
+	// writeFile is swapped out in tests to observe writes
+	writeFile func(name string, data []byte, perm os.FileMode) error
+}
+
+// FileStoreOption configures optional FileStore behavior
+type FileStoreOption func(*FileStore)
+
+// WithMaxSessions keeps at most n session files, including the active one, in the
+// store's directory. The least recently updated are removed on save. n <= 0 keeps them all.
+func WithMaxSessions(n int) FileStoreOption {
+	return func(f *FileStore) {
+		f.maxSessions = n
+	}
+}
+
+// NewFileStore creates a FileStore writing to path, throttled to one write per interval.
+// A non-positive interval falls back to DefaultAutosaveInterval.
+func NewFileStore(path string, interval time.Duration, opts ...FileStoreOption) *FileStore {
+	if interval <= 0 {
+		interval = DefaultAutosaveInterval
+	}
+
+	f := &FileStore{
+		path:      path,
+		interval:  interval,
+		writeFile: os.WriteFile,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// DefaultSessionsDir returns the directory sessions are stored in (~/.tai/sessions)
+func DefaultSessionsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+
+	return filepath.Join(home, ".tai", "sessions"), nil
+}
+
+// SessionPath returns the file the session with id is stored in under dir
+func SessionPath(dir, id string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s.json", id))
+}
+
+// LoadContext reads a session previously written by a FileStore
+func LoadContext(path string) (Context, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Context{}, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var ctx Context
+	if err := json.Unmarshal(data, &ctx); err != nil {
+		return Context{}, fmt.Errorf("failed to decode session %s: %w", path, err)
+	}
+
+	return ctx, nil
+}
+
+// Path returns the file the store writes to
+func (f *FileStore) Path() string {
+	return f.path
+}
+
+// OnStateChange implements OnStateChangeHandler so the store can be registered as a listener
+func (f *FileStore) OnStateChange(_ Action, newState, _ AppState) {
+	f.Save(newState)
+}
+
+// Save schedules the state to be written. Calls made before the pending write
+// fires replace the pending state instead of causing additional writes.
+func (f *FileStore) Save(s AppState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+
+	// listeners are notified concurrently, so never let an older snapshot replace a newer one
+	if f.pending != nil && s.Context.Updated.Before(f.pending.Updated) {
+		return
+	}
+
+	ctx := s.Context
+	f.pending = &ctx
+
+	if f.timer == nil {
+		f.timer = time.AfterFunc(f.interval, func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.timer = nil
+			_ = f.flushLocked()
+		})
+	}
+}
+
+// Flush immediately writes any pending state to disk
+func (f *FileStore) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+
+	return f.flushLocked()
+}
+
+// Close flushes any pending state and stops accepting new saves
+func (f *FileStore) Close() error {
+	err := f.Flush()
+
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+
+	return err
+}
+
+func (f *FileStore) flushLocked() error {
+	if f.pending == nil {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(f.pending, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	if err := f.writeFile(f.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+
+	f.pending = nil
+
+	if _, err := f.pruneLocked(); err != nil {
+		return fmt.Errorf("failed to prune sessions: %w", err)
+	}
+	return nil
+}
+
+// Prune removes the least recently updated sessions beyond the configured maximum
+// and returns their paths. The active session is never removed.
+func (f *FileStore) Prune() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.pruneLocked()
+}
+
+// MaxSessions returns the configured session limit, 0 when unlimited
+func (f *FileStore) MaxSessions() int {
+	return f.maxSessions
+}
+
+func (f *FileStore) pruneLocked() ([]string, error) {
+	if f.maxSessions <= 0 {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	type session struct {
+		path    string
+		updated time.Time
+	}
+
+	var others []session
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		p := filepath.Join(filepath.Dir(f.path), entry.Name())
+		if p == f.path {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		others = append(others, session{path: p, updated: info.ModTime()})
+	}
+
+	// the active session always takes one of the slots
+	keep := f.maxSessions - 1
+	if len(others) <= keep {
+		return nil, nil
+	}
+
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].updated.After(others[j].updated)
+	})
+
+	var removed []string
+	for _, s := range others[keep:] {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, s.path)
+	}
+
+	return removed, nil
+}
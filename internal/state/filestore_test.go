@@ -0,0 +1,243 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingFileStore returns a FileStore that counts the writes it performs
+func countingFileStore(t *testing.T, interval time.Duration) (*FileStore, func() int) {
+	t.Helper()
+
+	fs := NewFileStore(filepath.Join(t.TempDir(), "session.json"), interval)
+
+	var mu sync.Mutex
+	writes := 0
+	fs.writeFile = func(name string, data []byte, perm os.FileMode) error {
+		mu.Lock()
+		writes++
+		mu.Unlock()
+		return os.WriteFile(name, data, perm)
+	}
+
+	return fs, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return writes
+	}
+}
+
+func TestFileStore_CoalescesRapidSaves(t *testing.T) {
+	fs, writes := countingFileStore(t, 100*time.Millisecond)
+	ms := NewMemoryState("Test", "/test", "test")
+	ms.OnStateChange(fs.OnStateChange)
+
+	for i := 0; i < 50; i++ {
+		ms.Dispatch(&mockAction{
+			execFunc: func(s AppState) (AppState, error) {
+				s.Context.Messages = append(s.Context.Messages, Message{Role: RoleAssistant, Content: "chunk"})
+				return s, nil
+			},
+		})
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if got := writes(); got != 1 {
+		t.Errorf("Expected rapid dispatches to coalesce into 1 write, got %d", got)
+	}
+}
+
+func TestFileStore_CloseFlushesLatestState(t *testing.T) {
+	fs, writes := countingFileStore(t, time.Hour)
+
+	s := NewMemoryState("Test", "/test", "test").GetState()
+	for i := 0; i < 5; i++ {
+		s.Context.Messages = append(s.Context.Messages, Message{Role: RoleUser, Content: "hello"})
+		s.Context.Updated = s.Context.Updated.Add(time.Millisecond)
+		fs.Save(s)
+	}
+
+	if got := writes(); got != 0 {
+		t.Fatalf("Expected no writes before the interval elapsed, got %d", got)
+	}
+
+	if err := fs.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if got := writes(); got != 1 {
+		t.Errorf("Expected Close() to flush exactly once, got %d writes", got)
+	}
+
+	data, err := os.ReadFile(fs.Path())
+	if err != nil {
+		t.Fatalf("failed to read session file: %v", err)
+	}
+
+	var saved Context
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("failed to decode session file: %v", err)
+	}
+
+	if len(saved.Messages) != 5 {
+		t.Errorf("Expected latest state with 5 messages to be persisted, got %d", len(saved.Messages))
+	}
+
+	// saves after close are ignored
+	fs.Save(s)
+	if err := fs.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if got := writes(); got != 1 {
+		t.Errorf("Expected no writes after Close(), got %d", got)
+	}
+}
+
+func TestFileStore_IgnoresStaleSnapshots(t *testing.T) {
+	fs, _ := countingFileStore(t, time.Hour)
+
+	newer := NewMemoryState("Test", "/test", "test").GetState()
+	newer.Context.SystemPrompt = "newer"
+	older := newer
+	older.Context.SystemPrompt = "older"
+	older.Context.Updated = newer.Context.Updated.Add(-time.Second)
+
+	fs.Save(newer)
+	fs.Save(older)
+
+	if err := fs.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(fs.Path())
+	if err != nil {
+		t.Fatalf("failed to read session file: %v", err)
+	}
+
+	var saved Context
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("failed to decode session file: %v", err)
+	}
+
+	if saved.SystemPrompt != "newer" {
+		t.Errorf("SystemPrompt = %q, want %q", saved.SystemPrompt, "newer")
+	}
+}
+
+func TestFileStore_PrunesOldestSessionsOnSave(t *testing.T) {
+	dir := t.TempDir()
+	active := filepath.Join(dir, "active.json")
+
+	// five older sessions, oldest first; the active session is older than all of them
+	base := time.Now().Add(-time.Hour)
+	var older []string
+	for i := 0; i < 5; i++ {
+		p := filepath.Join(dir, fmt.Sprintf("session-%d.json", i))
+		if err := os.WriteFile(p, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, base.Add(time.Duration(i)*time.Minute), base.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		older = append(older, p)
+	}
+
+	fs := NewFileStore(active, time.Hour, WithMaxSessions(3))
+	fs.Save(NewMemoryState("Test", "/test", "test").GetState())
+	if err := fs.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if _, err := os.Stat(active); err != nil {
+		t.Errorf("active session should survive pruning: %v", err)
+	}
+	for i, p := range older {
+		_, err := os.Stat(p)
+		if i < 3 && !os.IsNotExist(err) {
+			t.Errorf("expected %s to be pruned", filepath.Base(p))
+		}
+		if i >= 3 && err != nil {
+			t.Errorf("expected %s to be kept: %v", filepath.Base(p), err)
+		}
+	}
+
+	// nothing left to prune
+	removed, err := fs.Prune()
+	if err != nil || len(removed) != 0 {
+		t.Errorf("Prune() = %v, %v; want nothing removed", removed, err)
+	}
+}
+
+func TestFileStore_PruneNeverRemovesActiveSession(t *testing.T) {
+	dir := t.TempDir()
+	active := filepath.Join(dir, "active.json")
+	other := filepath.Join(dir, "other.json")
+
+	for _, p := range []string{active, other} {
+		if err := os.WriteFile(p, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the active session is the least recently updated
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(active, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := NewFileStore(active, time.Hour, WithMaxSessions(1)).Prune()
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0] != other {
+		t.Errorf("Prune() removed %v, want [%s]", removed, other)
+	}
+	if _, err := os.Stat(active); err != nil {
+		t.Errorf("active session should survive pruning: %v", err)
+	}
+}
+
+func TestFileStore_SaveLoadRoundTrip(t *testing.T) {
+	path := SessionPath(t.TempDir(), "round-trip")
+	fs := NewFileStore(path, time.Hour)
+
+	s := NewMemoryState("Test", "/test", "round-trip").GetState()
+	s.Context.Mode = ExecuteMode
+	s.Context.Messages = []Message{
+		{ID: "1", Role: RoleUser, Content: "hello"},
+		{ID: "2", Role: RoleAssistant, Content: "hi there", FinishReason: "stop"},
+	}
+	fs.Save(s)
+	if err := fs.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	ctx, err := LoadContext(path)
+	if err != nil {
+		t.Fatalf("LoadContext() error = %v", err)
+	}
+
+	restored := NewMemoryStateWithOptions("", "", "", WithContext(ctx)).GetState().Context
+	if restored.SessionID != "round-trip" || restored.Mode != ExecuteMode || restored.WorkingDirectory != "/test" {
+		t.Errorf("restored context = %+v, want the saved session", restored)
+	}
+	if len(restored.Messages) != 2 || restored.Messages[1].Content != "hi there" || restored.Messages[1].FinishReason != "stop" {
+		t.Errorf("restored messages = %+v, want the saved conversation", restored.Messages)
+	}
+}
+
+func TestLoadContext_CorruptFile(t *testing.T) {
+	path := SessionPath(t.TempDir(), "corrupt")
+	if err := os.WriteFile(path, []byte(`{"sessionId": "corrupt", "messages": [`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadContext(path); err == nil {
+		t.Error("Expected a partial session file to fail to load")
+	}
+}
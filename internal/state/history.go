@@ -0,0 +1,98 @@
+package state
+
+import "slices"
+
+// DefaultHistoryDepth is how many earlier states MemoryState keeps for UndoAction
+const DefaultHistoryDepth = 50
+
+// UndoAction rolls the conversation back to before the last change that wasn't
+// transient. The mode, model, input history and status are settings rather than part of
+// the conversation, so they're kept as they are. With nothing left to undo it changes nothing.
+type UndoAction struct{}
+
+// Execute leaves s as it is, the history isn't part of AppState so MemoryState rolls
+// the state back itself. Other dispatchers treat undo as a no-op.
+func (a UndoAction) Execute(s AppState) (AppState, error) {
+	return s, nil
+}
+
+// RedoAction reapplies the last change UndoAction rolled back. Any new change that isn't
+// transient clears what can be redone.
+type RedoAction struct{}
+
+// Execute leaves s as it is, see UndoAction.Execute
+func (a RedoAction) Execute(s AppState) (AppState, error) {
+	return s, nil
+}
+
+// TransientAction is implemented by actions that aren't undone on their own, like each
+// chunk of a streamed reply. Their changes are undone along with the last action before
+// them that isn't transient.
+type TransientAction interface {
+	Action
+	Transient()
+}
+
+// WithHistoryDepth caps how many earlier states are kept for UndoAction. 0 turns undo
+// off, values below 0 fall back to DefaultHistoryDepth.
+func WithHistoryDepth(n int) MemoryStateOption {
+	return func(m *MemoryState) {
+		if n < 0 {
+			n = DefaultHistoryDepth
+		}
+		m.historyDepth = n
+	}
+}
+
+// history holds the states UndoAction and RedoAction move between, newest last
+type history struct {
+	undo []AppState
+	redo []AppState
+}
+
+// apply runs action against current, handling undo and redo itself and recording
+// current before any other change that isn't transient. It must be called with m.mu held.
+func (m *MemoryState) apply(action Action, current AppState) (AppState, error) {
+	switch action.(type) {
+	case UndoAction:
+		return m.history.step(&m.history.undo, &m.history.redo, current), nil
+	case RedoAction:
+		return m.history.step(&m.history.redo, &m.history.undo, current), nil
+	}
+
+	next, err := action.Execute(current)
+	if err != nil || m.historyDepth == 0 {
+		return next, err
+	}
+	if _, ok := action.(TransientAction); !ok {
+		m.history.undo = push(m.history.undo, current, m.historyDepth)
+		m.history.redo = nil
+	}
+	return next, nil
+}
+
+// step pops the newest state off from, pushing current onto to, and returns it. current
+// is returned as it is when from is empty.
+func (h *history) step(from, to *[]AppState, current AppState) AppState {
+	if len(*from) == 0 {
+		return current
+	}
+
+	prev := (*from)[len(*from)-1]
+	*from = slices.Delete(*from, len(*from)-1, len(*from))
+	*to = append(*to, current)
+
+	prev.Model = current.Model
+	prev.Status = current.Status
+	prev.Context.Mode = current.Context.Mode
+	prev.Context.InputHistory = current.Context.InputHistory
+	return prev
+}
+
+// push appends s to states, dropping the oldest when there are more than depth
+func push(states []AppState, s AppState, depth int) []AppState {
+	if len(states) >= depth {
+		states = slices.Delete(states, 0, len(states)-depth+1)
+	}
+	return append(states, s)
+}
@@ -0,0 +1,105 @@
+package state
+
+import "testing"
+
+// appendAction adds a user message with Content, every one is an undo step
+type appendAction struct {
+	Content string
+}
+
+func (a appendAction) Execute(s AppState) (AppState, error) {
+	s.Context.Messages = append(append([]Message{}, s.Context.Messages...), Message{Role: RoleUser, Content: a.Content})
+	return s, nil
+}
+
+// transientModeAction switches the mode without being an undo step
+type transientModeAction struct {
+	Mode Mode
+}
+
+func (a transientModeAction) Execute(s AppState) (AppState, error) {
+	s.Context.Mode = a.Mode
+	return s, nil
+}
+
+func (a transientModeAction) Transient() {}
+
+func contents(s AppState) []string {
+	var out []string
+	for _, m := range s.Context.Messages {
+		out = append(out, m.Content)
+	}
+	return out
+}
+
+func assertContents(t *testing.T, ms *MemoryState, want ...string) {
+	t.Helper()
+	got := contents(ms.GetState())
+	if len(got) != len(want) {
+		t.Fatalf("messages = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("messages = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMemoryState_UndoRedo(t *testing.T) {
+	ms := NewMemoryState("Test", "/test", "test")
+	ms.Dispatch(appendAction{"a"})
+	ms.Dispatch(appendAction{"b"})
+
+	ms.Dispatch(UndoAction{})
+	assertContents(t, ms, "a")
+
+	ms.Dispatch(RedoAction{})
+	assertContents(t, ms, "a", "b")
+
+	// undoing past the beginning leaves the state alone
+	for i := 0; i < 5; i++ {
+		ms.Dispatch(UndoAction{})
+	}
+	assertContents(t, ms)
+
+	ms.Dispatch(RedoAction{})
+	assertContents(t, ms, "a")
+}
+
+func TestMemoryState_DispatchClearsRedo(t *testing.T) {
+	ms := NewMemoryState("Test", "/test", "test")
+	ms.Dispatch(appendAction{"a"})
+	ms.Dispatch(appendAction{"b"})
+	ms.Dispatch(UndoAction{})
+
+	// transient changes aren't undo steps and leave what can be redone alone
+	ms.Dispatch(transientModeAction{ExecuteMode})
+	ms.Dispatch(RedoAction{})
+	assertContents(t, ms, "a", "b")
+
+	ms.Dispatch(UndoAction{})
+	ms.Dispatch(appendAction{"c"})
+	ms.Dispatch(RedoAction{})
+	assertContents(t, ms, "a", "c")
+
+	if mode := ms.GetState().Context.Mode; mode != ExecuteMode {
+		t.Errorf("Expected undo to keep the mode, got %s", mode)
+	}
+}
+
+func TestMemoryState_HistoryDepth(t *testing.T) {
+	ms := NewMemoryStateWithOptions("Test", "/test", "test", WithHistoryDepth(2))
+	for _, c := range []string{"a", "b", "c", "d"} {
+		ms.Dispatch(appendAction{c})
+	}
+
+	for i := 0; i < 4; i++ {
+		ms.Dispatch(UndoAction{})
+	}
+	assertContents(t, ms, "a", "b")
+
+	off := NewMemoryStateWithOptions("Test", "/test", "test", WithHistoryDepth(0))
+	off.Dispatch(appendAction{"a"})
+	off.Dispatch(UndoAction{})
+	assertContents(t, off, "a")
+}
@@ -1,6 +1,7 @@
 package state
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -12,6 +13,46 @@ const (
 	YoloMode    Mode = "yolo"
 )
 
+// Modes lists every mode in the order they're cycled through
+var Modes = []Mode{PlanMode, ExecuteMode, YoloMode}
+
+// Next returns the mode after m, wrapping back around to the first. Unknown modes start the cycle over.
+func (m Mode) Next() Mode {
+	for i, mode := range Modes {
+		if mode == m {
+			return Modes[(i+1)%len(Modes)]
+		}
+	}
+	return Modes[0]
+}
+
+// Valid reports whether m is one of Modes
+func (m Mode) Valid() bool {
+	for _, mode := range Modes {
+		if mode == m {
+			return true
+		}
+	}
+	return false
+}
+
+// SetModeAction switches between plan, execute and yolo mode
+type SetModeAction struct {
+	Mode Mode
+}
+
+func (a SetModeAction) Execute(s AppState) (AppState, error) {
+	if !a.Mode.Valid() {
+		return s, fmt.Errorf("unknown mode %q", a.Mode)
+	}
+
+	s.Context.Mode = a.Mode
+	return s, nil
+}
+
+// Transient keeps switching modes out of the undo history
+func (a SetModeAction) Transient() {}
+
 // Role represents the role of a message sender
 type Role string
 
@@ -45,11 +86,19 @@ type ToolCallFunction struct {
 
 // Message represents a single message in a conversation
 type Message struct {
+	// ID identifies the message while its content is streamed in
+	ID        string     `json:"id,omitempty"`
 	Role      Role       `json:"role"`
 	Content   string     `json:"content"`
 	Usage     TokenUsage `json:"usage"`
 	ToolCalls []ToolCall `json:"toolCalls"`
 	Timestamp time.Time  `json:"timestamp"`
+
+	// FinishReason is why the model stopped generating this message, e.g. "stop" or "content_filter"
+	FinishReason string `json:"finishReason,omitempty"`
+
+	// ContextTrimmed is set when the request was sent without the oldest messages to fit the context budget or window
+	ContextTrimmed bool `json:"contextTrimmed,omitempty"`
 }
 
 type TokenUsage struct {
@@ -64,6 +113,13 @@ type AppState struct {
 	Model       Model       `json:"model"`
 	Status      struct {
 		Error error `json:"error,omitempty"`
+		// PendingToolCall is the tool call waiting on the user's approval
+		PendingToolCall *ToolCall `json:"pendingToolCall,omitempty"`
+		// PendingPlan is the round of tool calls waiting on the user's approval as a whole
+		PendingPlan []ToolCall `json:"pendingPlan,omitempty"`
+		// Activity is what the agent is doing while a completion is in flight, e.g. "thinking"
+		// or "running get_weather", empty once it's done
+		Activity string `json:"activity,omitempty"`
 	}
 }
 
@@ -74,6 +130,8 @@ type Permissions struct {
 
 type Context struct {
 	Mode             Mode      `json:"mode"`
+	AgentName        string    `json:"agentName"`
+	PersonaPrompt    string    `json:"personaPrompt,omitempty"`
 	SystemPrompt     string    `json:"systemPrompt"`
 	SessionID        string    `json:"sessionId"`
 	Messages         []Message `json:"messages"`
@@ -82,12 +140,85 @@ type Context struct {
 	Created          time.Time `json:"created"`
 	Updated          time.Time `json:"updated"`
 	WorkingDirectory string    `json:"workingDirectory"`
+
+	// Scratchpad holds notes the model keeps between turns via the scratchpad tools
+	Scratchpad map[string]string `json:"scratchpad,omitempty"`
+
+	// InputHistory is what was typed into the REPL, oldest first, so it can be recalled after resuming
+	InputHistory []string `json:"inputHistory,omitempty"`
 }
 
 type Model struct {
 	Provider string `json:"provider"`
 	Name     string `json:"name"`
 	Busy     bool   `json:"busy"`
+
+	// Params are the active provider's default sampling parameters
+	Params ModelParams `json:"params"`
+	// Overrides are parameters set explicitly by the user, they win over Params
+	Overrides ModelParams `json:"overrides"`
+}
+
+// ModelParams are the sampling parameters sent with each request. The floats are
+// pointers because 0 is a valid value for each of them, nil means unset. A MaxTokens of
+// 0 means unset.
+type ModelParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"topP,omitempty"`
+	MaxTokens   int      `json:"maxTokens,omitempty"`
+
+	PresencePenalty  *float64 `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
+}
+
+// Float returns a pointer to v, for setting a ModelParams field
+func Float(v float64) *float64 {
+	return &v
+}
+
+// Merge returns p with every field that is set in o replaced by o's value
+func (p ModelParams) Merge(o ModelParams) ModelParams {
+	if o.Temperature != nil {
+		p.Temperature = o.Temperature
+	}
+	if o.TopP != nil {
+		p.TopP = o.TopP
+	}
+	if o.MaxTokens != 0 {
+		p.MaxTokens = o.MaxTokens
+	}
+	if o.PresencePenalty != nil {
+		p.PresencePenalty = o.PresencePenalty
+	}
+	if o.FrequencyPenalty != nil {
+		p.FrequencyPenalty = o.FrequencyPenalty
+	}
+	return p
+}
+
+// Validate reports the first parameter that is out of range
+func (p ModelParams) Validate() error {
+	if t := p.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2, got %g", *t)
+	}
+	if t := p.TopP; t != nil && (*t < 0 || *t > 1) {
+		return fmt.Errorf("top_p must be between 0 and 1, got %g", *t)
+	}
+	if p.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens cannot be negative, got %d", p.MaxTokens)
+	}
+	if pp := p.PresencePenalty; pp != nil && (*pp < -2 || *pp > 2) {
+		return fmt.Errorf("presence_penalty must be between -2 and 2, got %g", *pp)
+	}
+	if fp := p.FrequencyPenalty; fp != nil && (*fp < -2 || *fp > 2) {
+		return fmt.Errorf("frequency_penalty must be between -2 and 2, got %g", *fp)
+	}
+	return nil
+}
+
+// Effective returns the parameters requests should use: the provider defaults with the user's overrides applied
+func (m Model) Effective() ModelParams {
+	return m.Params.Merge(m.Overrides)
 }
 
 type ActionID string
@@ -99,6 +230,7 @@ type Action interface {
 type OnStateChangeHandler func(Action, AppState, AppState)
 type Dispatcher interface {
 	GetState() AppState
-	OnStateChange(OnStateChangeHandler)
+	// OnStateChange registers a listener and returns a func that unregisters it
+	OnStateChange(OnStateChangeHandler) (unsubscribe func())
 	Dispatch(Action)
 }
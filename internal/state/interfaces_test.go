@@ -98,3 +98,34 @@ func TestDispatcher_Interface(t *testing.T) {
 		t.Error("OnStateChange listener was not called")
 	}
 }
+
+func TestSetModeAction(t *testing.T) {
+	tests := []struct {
+		mode    Mode
+		wantErr bool
+	}{
+		{PlanMode, false},
+		{ExecuteMode, false},
+		{YoloMode, false},
+		{Mode("reckless"), true},
+		{Mode(""), true},
+		{Mode("YOLO"), true},
+	}
+
+	for _, tt := range tests {
+		s := NewMemoryState("Test prompt", "/test", "test").GetState()
+		s.Context.Mode = ExecuteMode
+
+		got, err := SetModeAction{Mode: tt.mode}.Execute(s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Execute(%q) error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr && got.Context.Mode != ExecuteMode {
+			t.Errorf("Execute(%q) changed the mode to %q, want it left alone", tt.mode, got.Context.Mode)
+		}
+		if !tt.wantErr && got.Context.Mode != tt.mode {
+			t.Errorf("Execute(%q) mode = %q", tt.mode, got.Context.Mode)
+		}
+	}
+}
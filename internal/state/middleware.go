@@ -0,0 +1,37 @@
+package state
+
+import (
+	"log"
+	"time"
+)
+
+// Middleware wraps every dispatch. It calls next to carry on dispatching action, or
+// another action in its place, or doesn't call it at all to drop it. No lock is held
+// while middleware runs, so it can read the state or dispatch again.
+type Middleware func(next func(Action), action Action)
+
+// WithMiddleware adds mw around every dispatch, the first one given runs outermost
+func WithMiddleware(mw ...Middleware) MemoryStateOption {
+	return func(m *MemoryState) {
+		m.middleware = append(m.middleware, mw...)
+	}
+}
+
+// LoggingMiddleware logs the type of every dispatched action and how long dispatching it
+// took, which includes calling the listeners only when they're synchronous
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	return func(next func(Action), action Action) {
+		start := time.Now()
+		next(action)
+		logger.Printf("dispatched %T in %s", action, time.Since(start))
+	}
+}
+
+// chain returns dispatch wrapped in the middleware, outermost first
+func (m *MemoryState) chain(dispatch func(Action)) func(Action) {
+	for i := len(m.middleware) - 1; i >= 0; i-- {
+		mw, next := m.middleware[i], dispatch
+		dispatch = func(action Action) { mw(next, action) }
+	}
+	return dispatch
+}
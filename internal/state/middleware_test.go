@@ -0,0 +1,71 @@
+package state
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestMemoryState_Middleware(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next func(Action), action Action) {
+			calls = append(calls, name+" before "+action.(*mockAction).name)
+			next(action)
+			calls = append(calls, name+" after "+action.(*mockAction).name)
+		}
+	}
+
+	ms := NewMemoryStateWithOptions("Test", "/test", "test",
+		WithSyncListeners(),
+		WithMiddleware(record("outer"), record("inner")),
+	)
+	ms.OnStateChange(func(action Action, newState, oldState AppState) {
+		calls = append(calls, "listener "+action.(*mockAction).name)
+	})
+
+	ms.Dispatch(&mockAction{name: "a"})
+	ms.Dispatch(&mockAction{name: "b"})
+
+	want := []string{
+		"outer before a", "inner before a", "listener a", "inner after a", "outer after a",
+		"outer before b", "inner before b", "listener b", "inner after b", "outer after b",
+	}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %v, want each dispatch wrapped once %v", calls, want)
+	}
+}
+
+func TestMemoryState_MiddlewareCanDropAndDispatch(t *testing.T) {
+	var ms *MemoryState
+	ms = NewMemoryStateWithOptions("Test", "/test", "test", WithMiddleware(func(next func(Action), action Action) {
+		switch action.(type) {
+		case transientModeAction:
+			// dropped, and dispatching from middleware must not deadlock
+			ms.Dispatch(appendAction{"replaced"})
+		default:
+			ms.GetState()
+			next(action)
+		}
+	}))
+
+	ms.Dispatch(transientModeAction{YoloMode})
+	ms.Dispatch(appendAction{"kept"})
+
+	if mode := ms.GetState().Context.Mode; mode != PlanMode {
+		t.Errorf("Expected the dropped action not to run, mode is %s", mode)
+	}
+	assertContents(t, ms, "replaced", "kept")
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	ms := NewMemoryStateWithOptions("Test", "/test", "test", WithMiddleware(LoggingMiddleware(log.New(&buf, "", 0))))
+
+	ms.Dispatch(appendAction{"a"})
+
+	if out := buf.String(); !strings.HasPrefix(out, "dispatched state.appendAction in ") {
+		t.Errorf("log = %q, want the action type and timing", out)
+	}
+}
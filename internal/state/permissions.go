@@ -0,0 +1,90 @@
+package state
+
+import (
+	"path"
+	"strings"
+)
+
+// IsAllowed reports whether p permits command. A rule matches a command's leading
+// words, so "git" matches "git status". Each word of a rule may be a glob, and a
+// trailing "*" matches any remaining words, so "git *" and "go test*" work as expected
+// and "*" on its own matches everything. Deny rules are checked before allow rules, and
+// an empty allow list permits anything that isn't denied. Chained commands must each be
+// permitted. Command and process substitution and redirections are refused whenever
+// there are rules, since what they run or write can't be checked, and so is a command
+// word with grouping, negation, quoting or escapes like "(rm", "{", "!" or "\rm", which
+// would otherwise slip past a rule matched against it literally.
+func (p Permissions) IsAllowed(command string) bool {
+	if len(p.Allow) == 0 && len(p.Deny) == 0 {
+		return true
+	}
+
+	if strings.ContainsAny(command, "`<>") || strings.Contains(command, "$(") {
+		return false
+	}
+
+	segments := strings.FieldsFunc(command, func(r rune) bool {
+		return r == ';' || r == '&' || r == '|' || r == '\n'
+	})
+	if len(segments) == 0 {
+		return false
+	}
+
+	for _, segment := range segments {
+		if !p.segmentAllowed(segment) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p Permissions) segmentAllowed(command string) bool {
+	if fields := strings.Fields(command); len(fields) > 0 && strings.ContainsAny(fields[0], "(){}!\\'\"") {
+		return false
+	}
+
+	for _, rule := range p.Deny {
+		if ruleMatches(rule, command) {
+			return false
+		}
+	}
+
+	if len(p.Allow) == 0 {
+		return true
+	}
+
+	for _, rule := range p.Allow {
+		if ruleMatches(rule, command) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleMatches reports whether rule matches the leading words of command
+func ruleMatches(rule, command string) bool {
+	ruleFields := strings.Fields(rule)
+	commandFields := strings.Fields(command)
+	if len(ruleFields) == 0 {
+		return false
+	}
+
+	// a trailing * matches whatever is left, including nothing
+	if ruleFields[len(ruleFields)-1] == "*" {
+		ruleFields = ruleFields[:len(ruleFields)-1]
+		if len(ruleFields) == 0 {
+			return true
+		}
+	}
+
+	if len(ruleFields) > len(commandFields) {
+		return false
+	}
+
+	for i, f := range ruleFields {
+		if ok, err := path.Match(f, commandFields[i]); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
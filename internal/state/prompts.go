@@ -79,6 +79,11 @@ You are allowed to be proactive, but only when the user asks you to do something
 - The date and time right now is "{{.Context.Updated.Format "January 2nd, 2006 3:04:05.000 PM MST"}}"
 - The current working directory is "{{.Context.WorkingDirectory}}"
 {{if and .Model.Provider .Model.Name}}- The current LLM Provider is "{{.Model.Provider}}" using "{{.Model.Name}}"{{end}}
+{{if .Context.AgentName}}- You are acting as the "{{.Context.AgentName}}" persona{{end}}
+{{if .Context.PersonaPrompt}}
+## Persona Instructions
+{{ .Context.PersonaPrompt }}
+{{end}}
 
 
 ## System Instructions
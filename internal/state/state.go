@@ -1,20 +1,168 @@
 package state
 
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// DefaultAgentName is the persona name the agent starts every session with
+const DefaultAgentName = "orchestrator"
+
+// NewMessageID returns a random (version 4) UUID identifying a Message
+func NewMessageID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand doesn't fail on supported platforms, but stay unique if it does
+		binary.BigEndian.PutUint64(b, uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint64(b[8:], messageIDFallback.Add(1))
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// messageIDFallback keeps fallback message IDs unique within the process
+var messageIDFallback atomic.Uint64
+
 type MemoryState struct {
-	state     AppState
-	mu        sync.RWMutex
-	listeners []OnStateChangeHandler
+	state      AppState
+	mu         sync.RWMutex
+	listeners  []listenerEntry
+	nextID     uint64
+	closed     bool
+	deliveries sync.WaitGroup
+
+	syncListeners bool
+	historyDepth  int
+	history       history
+	middleware    []Middleware
+	dispatchChain func(Action)
+
+	// OnError, when set, is called with the error of every action that fails to execute
+	OnError func(error)
+}
+
+// listenerEntry is a registered listener, the id its unsubscribe func removes it by and
+// the queue its notifications wait in for the goroutine started when it was registered,
+// which delivers them one at a time
+type listenerEntry struct {
+	id    uint64
+	fn    OnStateChangeHandler
+	queue *listenerQueue
+}
+
+// notification is a single listener call waiting to be delivered
+type notification struct {
+	action   Action
+	newState AppState
+	oldState AppState
+}
+
+// listenerQueue holds the notifications a listener hasn't been called with yet, in the
+// order they were dispatched. Pushing never blocks, so a listener that falls behind, or
+// that dispatches an action itself, never holds Dispatch up.
+type listenerQueue struct {
+	mu      sync.Mutex
+	pending []notification
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+func newListenerQueue() *listenerQueue {
+	return &listenerQueue{
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+// push queues n and wakes the goroutine delivering the queue
+func (q *listenerQueue) push(n notification) {
+	q.mu.Lock()
+	q.pending = append(q.pending, n)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take empties the queue and returns what was in it
+func (q *listenerQueue) take() []notification {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending := q.pending
+	q.pending = nil
+	return pending
+}
+
+// deliver calls fn with every notification pushed until stop is called, then with the
+// ones still queued
+func (q *listenerQueue) deliver(fn OnStateChangeHandler) {
+	for {
+		for _, n := range q.take() {
+			fn(n.action, n.newState, n.oldState)
+		}
+
+		select {
+		case <-q.wake:
+		case <-q.done:
+			for _, n := range q.take() {
+				fn(n.action, n.newState, n.oldState)
+			}
+			return
+		}
+	}
+}
+
+// stop ends deliver once the queue is empty
+func (q *listenerQueue) stop() {
+	close(q.done)
+}
+
+// MemoryStateOption configures optional MemoryState behavior
+type MemoryStateOption func(*MemoryState)
+
+// WithSyncListeners makes Dispatch call every listener itself, one after the other in
+// registration order, before it returns, instead of queueing the calls for them.
+// No lock is held while they run, so a listener can read the state or dispatch again.
+func WithSyncListeners() MemoryStateOption {
+	return func(m *MemoryState) {
+		m.syncListeners = true
+	}
+}
+
+// WithContext starts the state from a previously saved conversation, e.g. one
+// read with LoadContext, instead of an empty one
+func WithContext(ctx Context) MemoryStateOption {
+	return func(m *MemoryState) {
+		m.state.Context = ctx
+	}
+}
+
+// WithOnError sets the hook called when an action fails to execute
+func WithOnError(fn func(error)) MemoryStateOption {
+	return func(m *MemoryState) {
+		m.OnError = fn
+	}
 }
 
 // NewMemoryState creates a new MemoryState instance
 func NewMemoryState(systemPrompt, workingDirectory, sessionName string) *MemoryState {
+	return NewMemoryStateWithOptions(systemPrompt, workingDirectory, sessionName)
+}
+
+// NewMemoryStateWithOptions creates a new MemoryState instance configured with opts
+func NewMemoryStateWithOptions(systemPrompt, workingDirectory, sessionName string, opts ...MemoryStateOption) *MemoryState {
 	now := time.Now()
 	if systemPrompt == "" {
 		systemPrompt = "You are an AI assistant that autonomously writes code and helps the user with programming tasks."
@@ -37,17 +185,27 @@ func NewMemoryState(systemPrompt, workingDirectory, sessionName string) *MemoryS
 			Created:          now,
 			Updated:          now,
 			Mode:             PlanMode,
+			AgentName:        DefaultAgentName,
 			SystemPrompt:     systemPrompt,
 			WorkingDirectory: workingDirectory,
 			SessionID:        sessionName,
 		},
 	}
 
-	return &MemoryState{
-		state:     state,
-		listeners: make([]OnStateChangeHandler, 0),
-		mu:        sync.RWMutex{},
+	m := &MemoryState{
+		state:        state,
+		listeners:    make([]listenerEntry, 0),
+		mu:           sync.RWMutex{},
+		historyDepth: DefaultHistoryDepth,
 	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	m.dispatchChain = m.chain(m.dispatch)
+
+	return m
 }
 
 // Returns a copy of the current state to prevent external mutations
@@ -57,31 +215,107 @@ func (m *MemoryState) GetState() AppState {
 	return m.state
 }
 
-func (m *MemoryState) OnStateChange(listener OnStateChangeHandler) {
+// OnStateChange registers listener to be notified of every dispatched action, in the
+// order they were dispatched, and returns a func that unregisters it. Calling the func
+// more than once is a no-op. Listeners registered after Close are never notified.
+func (m *MemoryState) OnStateChange(listener OnStateChangeHandler) (unsubscribe func()) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.listeners = append(m.listeners, listener)
+	if m.closed {
+		return func() {}
+	}
+
+	m.nextID++
+	id := m.nextID
+	entry := listenerEntry{id: id, fn: listener}
+	if !m.syncListeners {
+		entry.queue = newListenerQueue()
+		m.deliveries.Add(1)
+		go func() {
+			defer m.deliveries.Done()
+			entry.queue.deliver(entry.fn)
+		}()
+	}
+	m.listeners = append(m.listeners, entry)
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// Dispatch calls sync listeners from a snapshot of the slice outside the lock, so
+		// build a new one rather than removing in place
+		listeners := make([]listenerEntry, 0, len(m.listeners))
+		for _, l := range m.listeners {
+			if l.id != id {
+				listeners = append(listeners, l)
+			} else if l.queue != nil {
+				l.queue.stop()
+			}
+		}
+		m.listeners = listeners
+	}
+}
+
+// Close stops notifying listeners. The notifications already queued are delivered before
+// it returns, actions dispatched after it still change the state but notify nobody.
+func (m *MemoryState) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	for _, l := range m.listeners {
+		if l.queue != nil {
+			l.queue.stop()
+		}
+	}
+	m.listeners = nil
+	m.mu.Unlock()
+
+	m.deliveries.Wait()
 }
 
-// dispatch implements Dispatcher interface
+// Dispatch implements Dispatcher interface, running action through the middleware first
 func (m *MemoryState) Dispatch(action Action) {
+	m.dispatchChain(action)
+}
+
+// dispatch applies action and notifies the listeners, it's the end of the middleware chain
+func (m *MemoryState) dispatch(action Action) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
 
 	oldState := m.state
 	// Execute the action to get the new state
-	newState, err := action.Execute(m.state)
+	newState, err := m.apply(action, m.state)
 	if err != nil {
-		// TODO: Handle error - for now, we'll just return without updating state
-		// In a production app, you might want to log this or handle it differently
-		panic(fmt.Errorf("💩 failed to execute action %v: %w", action, err))
+		// keep the previous state, only recording the error so listeners can surface it
+		err = fmt.Errorf("failed to execute action %T: %w", action, err)
+		newState = oldState
+		newState.Status.Error = err
+	} else {
+		newState.Context.Updated = time.Now()
 	}
 
-	newState.Context.Updated = time.Now()
 	m.state = newState
+	listeners := m.listeners
+	onError := m.OnError
+	if !m.syncListeners {
+		// queued before the lock is released so every listener sees the changes in the
+		// order they were made, pushing never blocks so holding it here is fine
+		n := notification{action: action, newState: newState, oldState: oldState}
+		for _, l := range listeners {
+			l.queue.push(n)
+		}
+	}
+	m.mu.Unlock()
+
+	if err != nil && onError != nil {
+		onError(err)
+	}
 
-	// Notify all listeners
-	for _, listener := range m.listeners {
-		go listener(action, newState, oldState)
+	if m.syncListeners {
+		for _, l := range listeners {
+			l.fn(action, newState, oldState)
+		}
 	}
 }
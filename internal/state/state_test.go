@@ -3,7 +3,9 @@ package state
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -97,6 +99,40 @@ func TestMemoryState_OnStateChange(t *testing.T) {
 	}
 }
 
+func TestMemoryState_Unsubscribe(t *testing.T) {
+	ms := NewMemoryState("Test", "/test", "test")
+
+	calls := make(chan struct{}, 10)
+	unsubscribe := ms.OnStateChange(func(action Action, oldState, newState AppState) {
+		calls <- struct{}{}
+	})
+
+	action := &mockAction{
+		name: "test-action",
+		execFunc: func(state AppState) (AppState, error) {
+			return state, nil
+		},
+	}
+
+	ms.Dispatch(action)
+	select {
+	case <-calls:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the listener to be called before unsubscribing")
+	}
+
+	unsubscribe()
+	// a second call must not remove anything else or panic
+	unsubscribe()
+
+	ms.Dispatch(action)
+	select {
+	case <-calls:
+		t.Error("Expected the listener not to be called after unsubscribing")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
 func TestMemoryState_Dispatch(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -122,10 +158,11 @@ func TestMemoryState_Dispatch(t *testing.T) {
 			action: &mockAction{
 				name: "error-action",
 				execFunc: func(state AppState) (AppState, error) {
+					state.Context.SystemPrompt = "Partially modified"
 					return state, errors.New("action error")
 				},
 			},
-			expectListeners: false,
+			expectListeners: true,
 			listenerCount:   2,
 		},
 	}
@@ -152,19 +189,18 @@ func TestMemoryState_Dispatch(t *testing.T) {
 				})
 			}
 
-			// Dispatch action - handle panics for error actions
-			if tt.name == "action returns error" {
+			var hookErr error
+			ms.OnError = func(err error) { hookErr = err }
+
+			// Dispatch must not panic, even for error actions
+			func() {
 				defer func() {
-					if r := recover(); r == nil {
-						t.Error("Expected panic for error action, but no panic occurred")
+					if r := recover(); r != nil {
+						t.Fatalf("Dispatch panicked: %v", r)
 					}
 				}()
 				ms.Dispatch(tt.action)
-				// If we reach here, the panic didn't happen (test will fail via defer)
-				return
-			}
-
-			ms.Dispatch(tt.action)
+			}()
 
 			if tt.expectListeners {
 				// Wait for all listeners to be called
@@ -182,12 +218,26 @@ func TestMemoryState_Dispatch(t *testing.T) {
 				}
 
 				// Verify state was updated
+				state := ms.GetState()
 				if tt.name == "successful action" {
-					state := ms.GetState()
 					if state.Context.SystemPrompt != "Modified by action" {
 						t.Errorf("State not updated: SystemPrompt = %q, want %q",
 							state.Context.SystemPrompt, "Modified by action")
 					}
+					if state.Status.Error != nil || hookErr != nil {
+						t.Errorf("Unexpected error for successful action: %v", state.Status.Error)
+					}
+				} else {
+					// the error is recorded, everything else is left as it was
+					if state.Status.Error == nil || !strings.Contains(state.Status.Error.Error(), "action error") {
+						t.Errorf("Status.Error = %v, want it to wrap the action error", state.Status.Error)
+					}
+					if state.Context.SystemPrompt != "Initial prompt" {
+						t.Error("State should not be updated when action returns error")
+					}
+					if !errors.Is(hookErr, state.Status.Error) {
+						t.Errorf("OnError got %v, want %v", hookErr, state.Status.Error)
+					}
 				}
 			} else {
 				// For error case, ensure listeners weren't called
@@ -253,3 +303,170 @@ func TestMemoryState_ConcurrentDispatch(t *testing.T) {
 		t.Errorf("Expected %d state changes, got %d", actionCount, len(stateChanges))
 	}
 }
+
+func TestMemoryState_ListenerOrder(t *testing.T) {
+	ms := NewMemoryState("Test", "/test", "test")
+	defer ms.Close()
+
+	const dispatches = 500
+	var slow, fast []string
+	var wg sync.WaitGroup
+	wg.Add(2 * dispatches)
+	ms.OnStateChange(func(action Action, newState, oldState AppState) {
+		defer wg.Done()
+		if len(slow)%64 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		slow = append(slow, action.(*mockAction).name)
+	})
+	ms.OnStateChange(func(action Action, newState, oldState AppState) {
+		defer wg.Done()
+		fast = append(fast, action.(*mockAction).name)
+	})
+
+	want := make([]string, dispatches)
+	for i := range want {
+		want[i] = fmt.Sprintf("action-%d", i)
+		ms.Dispatch(&mockAction{name: want[i]})
+	}
+	wg.Wait()
+
+	for name, got := range map[string][]string{"slow": slow, "fast": fast} {
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s listener got the actions out of order or missed some: %v", name, got)
+		}
+	}
+}
+
+func TestMemoryState_ListenerDispatches(t *testing.T) {
+	ms := NewMemoryState("Test", "/test", "test")
+	defer ms.Close()
+
+	// a listener far behind that dispatches again mustn't wait on its own queue
+	const dispatches = 1000
+	var calls atomic.Int32
+	done := make(chan struct{})
+	ms.OnStateChange(func(action Action, newState, oldState AppState) {
+		if action.(*mockAction).name == "first" {
+			time.Sleep(10 * time.Millisecond)
+			for i := 0; i < dispatches; i++ {
+				ms.Dispatch(&mockAction{name: "again"})
+			}
+		}
+		if calls.Add(1) == 2*dispatches+1 {
+			close(done)
+		}
+	})
+
+	ms.Dispatch(&mockAction{name: "first"})
+	for i := 0; i < dispatches; i++ {
+		ms.Dispatch(&mockAction{name: "more"})
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("listener got %d of %d notifications, dispatching from it deadlocked", calls.Load(), 2*dispatches+1)
+	}
+}
+
+func TestMemoryState_Close(t *testing.T) {
+	ms := NewMemoryState("Test", "/test", "test")
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	ms.OnStateChange(func(action Action, newState, oldState AppState) {
+		<-release
+		calls.Add(1)
+	})
+
+	for i := 0; i < 3; i++ {
+		ms.Dispatch(&mockAction{})
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		ms.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Expected Close to wait for the queued notifications")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't return once the listener caught up")
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("listener calls before Close returned = %d, want the 3 queued", got)
+	}
+
+	ms.Dispatch(&mockAction{})
+	ms.OnStateChange(func(Action, AppState, AppState) { t.Error("Expected no notifications after Close") })
+	ms.Dispatch(&mockAction{})
+	ms.Close()
+	if got := calls.Load(); got != 3 {
+		t.Errorf("listener calls after Close = %d, want none", got)
+	}
+}
+
+func TestMemoryState_SyncListeners(t *testing.T) {
+	ms := NewMemoryStateWithOptions("Test", "/test", "test", WithSyncListeners())
+
+	// no locking, every call happens on the dispatching goroutine
+	var calls []string
+	for _, name := range []string{"first", "second", "third"} {
+		ms.OnStateChange(func(action Action, newState, oldState AppState) {
+			calls = append(calls, fmt.Sprintf("%s:%s", name, action.(*mockAction).name))
+			// reading the state from a listener must not deadlock
+			ms.GetState()
+		})
+	}
+
+	ms.Dispatch(&mockAction{name: "a"})
+	ms.Dispatch(&mockAction{name: "b"})
+
+	want := []string{"first:a", "second:a", "third:a", "first:b", "second:b", "third:b"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected listeners called in registration order %v, got %v", want, calls)
+	}
+}
+
+func BenchmarkMemoryState_Dispatch(b *testing.B) {
+	ms := NewMemoryState("Bench", "/test", "bench")
+	defer ms.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		ms.OnStateChange(func(action Action, newState, oldState AppState) {
+			wg.Done()
+		})
+	}
+
+	action := &mockAction{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(5)
+		ms.Dispatch(action)
+	}
+	wg.Wait()
+}
+
+func TestNewMessageID(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := NewMessageID()
+		if len(id) != 36 || id[14] != '4' || strings.Count(id, "-") != 4 {
+			t.Fatalf("NewMessageID() = %q, want a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("NewMessageID() returned duplicate %q", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// diffContext is how many unchanged lines are shown around an edit in its diff
+const diffContext = 3
+
+// ErrNoMatch is returned by EditFile when the text to replace isn't in the file
+var ErrNoMatch = errors.New("text to replace not found")
+
+// ErrAmbiguousMatch is returned by EditFile when the text to replace is in the file more
+// than once, so which one to change isn't clear
+var ErrAmbiguousMatch = errors.New("text to replace found more than once")
+
+// EditFile replaces the one occurrence of oldString in the file at path with newString
+// and returns the change as a unified diff. oldString has to match exactly, including
+// whitespace, and be unique in the file so the edit can't land in the wrong place.
+func (f *LocalFileTool) EditFile(ctx context.Context, path, oldString, newString string) (string, error) {
+	return f.edit(path, oldString, newString, true)
+}
+
+// PreviewEdit returns the diff EditFile would make without changing the file
+func (f *LocalFileTool) PreviewEdit(ctx context.Context, path, oldString, newString string) (string, error) {
+	return f.edit(path, oldString, newString, false)
+}
+
+func (f *LocalFileTool) edit(path, oldString, newString string, apply bool) (string, error) {
+	if oldString == "" {
+		return "", errors.New("text to replace cannot be empty")
+	}
+	if oldString == newString {
+		return "", errors.New("replacement is the same as the text it replaces")
+	}
+
+	target, err := SandboxPath(f.root, path)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	content := string(data)
+
+	switch n := strings.Count(content, oldString); {
+	case n == 0:
+		return "", fmt.Errorf("%w in %s", ErrNoMatch, path)
+	case n > 1:
+		return "", fmt.Errorf("%w in %s (%d times), include more of the surrounding text", ErrAmbiguousMatch, path, n)
+	}
+
+	updated := strings.Replace(content, oldString, newString, 1)
+	diff := editDiff(path, content, updated, strings.Index(content, oldString))
+
+	if apply {
+		info, err := os.Stat(target)
+		if err != nil {
+			return "", fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if err := os.WriteFile(target, []byte(updated), info.Mode().Perm()); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return diff, nil
+}
+
+// editDiff renders the single hunk unified diff between before and after, which differ
+// only in the lines from the one holding offset on
+func editDiff(path, before, after string, offset int) string {
+	oldLines, newLines := splitLines(before), splitLines(after)
+
+	// the edit starts on the line holding offset, and since only one region changed,
+	// everything past it that's the same at the end of both files is untouched too
+	start := strings.Count(before[:offset], "\n")
+	oldEnd, newEnd := len(oldLines), len(newLines)
+	for oldEnd > start && newEnd > start && oldLines[oldEnd-1] == newLines[newEnd-1] {
+		oldEnd--
+		newEnd--
+	}
+
+	from := max(start-diffContext, 0)
+	oldTo := min(oldEnd+diffContext, len(oldLines))
+	newTo := min(newEnd+diffContext, len(newLines))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", path, path)
+	fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(from, oldTo-from), hunkRange(from, newTo-from))
+	for _, line := range oldLines[from:start] {
+		diffLine(&b, ' ', line)
+	}
+	for _, line := range oldLines[start:oldEnd] {
+		diffLine(&b, '-', line)
+	}
+	for _, line := range newLines[start:newEnd] {
+		diffLine(&b, '+', line)
+	}
+	for _, line := range oldLines[oldEnd:oldTo] {
+		diffLine(&b, ' ', line)
+	}
+	return b.String()
+}
+
+// hunkRange formats the 0-based start and count of a hunk's lines the way unified diffs
+// number them, where an empty range names the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffLine writes line, which keeps its newline, with prefix, marking a last line that has none
+func diffLine(b *strings.Builder, prefix byte, line string) {
+	b.WriteByte(prefix)
+	b.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		b.WriteString("\n\\ No newline at end of file\n")
+	}
+}
@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const editSource = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+`
+
+func TestLocalFileTool_EditFile(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"main.go": editSource})
+	ft := NewLocalFileTool(root)
+
+	diff, err := ft.EditFile(context.Background(), "main.go", `"hello"`, `"hello, world"`)
+	if err != nil {
+		t.Fatalf("EditFile() error = %v", err)
+	}
+
+	want := "--- a/main.go\n+++ b/main.go\n@@ -3,5 +3,5 @@\n" +
+		" import \"fmt\"\n" +
+		" \n" +
+		" func main() {\n" +
+		"-\tfmt.Println(\"hello\")\n" +
+		"+\tfmt.Println(\"hello, world\")\n" +
+		" }\n"
+	if diff != want {
+		t.Errorf("EditFile() diff =\n%s\nwant\n%s", diff, want)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(root, "main.go"))
+	if got := string(data); got != `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello, world")
+}
+` {
+		t.Errorf("file after EditFile() =\n%s", got)
+	}
+}
+
+func TestLocalFileTool_EditFileDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		old, new string
+		want     string
+	}{
+		{
+			name:    "lines inserted",
+			content: "a\nb\nc\n",
+			old:     "b\n",
+			new:     "b\nb2\nb3\n",
+			want:    "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,5 @@\n a\n-b\n+b\n+b2\n+b3\n c\n",
+		},
+		{
+			name:    "lines removed",
+			content: "a\nb\nc\nd\n",
+			old:     "b\nc\n",
+			new:     "",
+			want:    "--- a/f.txt\n+++ b/f.txt\n@@ -1,4 +1,2 @@\n a\n-b\n-c\n d\n",
+		},
+		{
+			name:    "context is limited",
+			content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			old:     "5",
+			new:     "five",
+			want:    "--- a/f.txt\n+++ b/f.txt\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name:    "no newline at end of file",
+			content: "a\nb",
+			old:     "b",
+			new:     "c",
+			want:    "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, map[string]string{"f.txt": tt.content})
+
+			diff, err := NewLocalFileTool(root).EditFile(context.Background(), "f.txt", tt.old, tt.new)
+			if err != nil {
+				t.Fatalf("EditFile() error = %v", err)
+			}
+			if diff != tt.want {
+				t.Errorf("EditFile() diff =\n%q\nwant\n%q", diff, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalFileTool_EditFileRejects(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"main.go": editSource})
+	ft := NewLocalFileTool(root)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		path     string
+		old, new string
+		want     error
+	}{
+		{"ambiguous match", "main.go", "main", "app", ErrAmbiguousMatch},
+		{"no match", "main.go", "goodbye", "hello", ErrNoMatch},
+		{"missing file", "missing.go", "a", "b", os.ErrNotExist},
+		{"outside the root", "../main.go", "a", "b", ErrPathEscape},
+	}
+
+	for _, tt := range tests {
+		if _, err := ft.EditFile(ctx, tt.path, tt.old, tt.new); !errors.Is(err, tt.want) {
+			t.Errorf("%s: EditFile() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if _, err := ft.EditFile(ctx, "main.go", "", "x"); err == nil {
+		t.Error("Expected an empty old string to be rejected")
+	}
+
+	data, _ := os.ReadFile(filepath.Join(root, "main.go"))
+	if string(data) != editSource {
+		t.Errorf("Rejected edits changed the file:\n%s", data)
+	}
+}
+
+func TestLocalFileTool_PreviewEdit(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"main.go": editSource})
+	ft := NewLocalFileTool(root)
+
+	preview, err := ft.PreviewEdit(context.Background(), "main.go", `"hello"`, `"bye"`)
+	if err != nil {
+		t.Fatalf("PreviewEdit() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(root, "main.go"))
+	if string(data) != editSource {
+		t.Errorf("PreviewEdit() changed the file:\n%s", data)
+	}
+
+	diff, err := ft.EditFile(context.Background(), "main.go", `"hello"`, `"bye"`)
+	if err != nil || diff != preview {
+		t.Errorf("EditFile() = %q, %v, want the previewed diff %q", diff, err, preview)
+	}
+}
@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MaxBatchFiles is the most files a single ReadFiles call reads
+const MaxBatchFiles = 20
+
+// maxConcurrentReads is how many files ReadFiles reads at once
+const maxConcurrentReads = 4
+
+// FileResult is the content of one of the files ReadFiles read, or why it couldn't be read
+type FileResult struct {
+	Content string
+	Err     error
+}
+
+// LocalFileTool implements FileTool for files under a root directory. Paths are
+// relative to root, anything resolving outside of it is rejected with ErrPathEscape.
+type LocalFileTool struct {
+	root string
+}
+
+// NewLocalFileTool creates a LocalFileTool sandboxed to root
+func NewLocalFileTool(root string) *LocalFileTool {
+	return &LocalFileTool{root: root}
+}
+
+// ReadFile returns the contents of the file at path
+func (f *LocalFileTool) ReadFile(ctx context.Context, path string) (string, error) {
+	target, err := SandboxPath(f.root, path)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return string(data), nil
+}
+
+// ReadFiles reads every file in paths, a few at a time, and returns their results keyed
+// by path. A file that can't be read, or is outside of the root, only fails its own result.
+func (f *LocalFileTool) ReadFiles(ctx context.Context, paths []string) (map[string]FileResult, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no files to read")
+	}
+	if len(paths) > MaxBatchFiles {
+		return nil, fmt.Errorf("can read at most %d files at once, got %d", MaxBatchFiles, len(paths))
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]FileResult, len(paths))
+		limit   = make(chan struct{}, maxConcurrentReads)
+	)
+	for _, path := range slices.Compact(slices.Sorted(slices.Values(paths))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			var result FileResult
+			if result.Err = ctx.Err(); result.Err == nil {
+				result.Content, result.Err = f.ReadFile(ctx, path)
+			}
+
+			mu.Lock()
+			results[path] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// WriteFile replaces the file at path with content, creating it and any missing
+// parent directories
+func (f *LocalFileTool) WriteFile(ctx context.Context, path string, content string) error {
+	target, err := SandboxPath(f.root, path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(target, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// SearchFile returns every line of the file at path containing term, prefixed with
+// its 1-based line number, e.g. "12: func main() {"
+func (f *LocalFileTool) SearchFile(ctx context.Context, path string, term string) ([]string, error) {
+	if term == "" {
+		return nil, errors.New("search term cannot be empty")
+	}
+
+	target, err := SandboxPath(f.root, path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var matches []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if line := scanner.Text(); strings.Contains(line, term) {
+			matches = append(matches, fmt.Sprintf("%d: %s", n, line))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search %s: %w", path, err)
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var _ FileTool = (*LocalFileTool)(nil)
+
+func TestLocalFileTool_RejectsTraversal(t *testing.T) {
+	ft := NewLocalFileTool(t.TempDir())
+	ctx := context.Background()
+
+	for _, path := range []string{"../outside.txt", "a/../../outside.txt", "/etc/passwd"} {
+		if _, err := ft.ReadFile(ctx, path); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("ReadFile(%q) error = %v, want ErrPathEscape", path, err)
+		}
+		if err := ft.WriteFile(ctx, path, "x"); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("WriteFile(%q) error = %v, want ErrPathEscape", path, err)
+		}
+		if _, err := ft.SearchFile(ctx, path, "root"); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("SearchFile(%q) error = %v, want ErrPathEscape", path, err)
+		}
+	}
+}
+
+func TestLocalFileTool_RejectsSymlinkEscape(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "sandbox")
+	writeFiles(t, parent, map[string]string{"outside/secret.txt": "keep\n", "sandbox/inside/ok.txt": "ok\n"})
+	for link, target := range map[string]string{
+		"out":      filepath.Join(parent, "outside"),
+		"secret":   filepath.Join(parent, "outside", "secret.txt"),
+		"dangling": filepath.Join(parent, "outside", "new.txt"),
+		"in":       filepath.Join(root, "inside"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+	ft := NewLocalFileTool(root)
+	ctx := context.Background()
+
+	for _, path := range []string{"out/secret.txt", "secret", "out/new.txt", "out/sub/new.txt"} {
+		if _, err := ft.ReadFile(ctx, path); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("ReadFile(%q) error = %v, want ErrPathEscape", path, err)
+		}
+		if err := ft.WriteFile(ctx, path, "pwned\n"); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("WriteFile(%q) error = %v, want ErrPathEscape", path, err)
+		}
+		if _, err := ft.EditFile(ctx, path, "keep", "pwned"); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("EditFile(%q) error = %v, want ErrPathEscape", path, err)
+		}
+	}
+	if err := ft.WriteFile(ctx, "dangling", "pwned\n"); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("WriteFile(dangling) error = %v, want ErrPathEscape", err)
+	}
+
+	if got := readFile(t, parent, "outside/secret.txt"); got != "keep\n" {
+		t.Errorf("secret.txt = %q, want it untouched", got)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "outside", "new.txt")); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be created outside the root")
+	}
+
+	if got, err := ft.ReadFile(ctx, "in/ok.txt"); err != nil || got != "ok\n" {
+		t.Errorf("ReadFile(in/ok.txt) = %q, %v, want a symlink inside the root to work", got, err)
+	}
+}
+
+func TestLocalFileTool_MissingFile(t *testing.T) {
+	ft := NewLocalFileTool(t.TempDir())
+	ctx := context.Background()
+
+	if _, err := ft.ReadFile(ctx, "missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadFile() error = %v, want os.ErrNotExist", err)
+	}
+	if _, err := ft.SearchFile(ctx, "missing.txt", "x"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("SearchFile() error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestLocalFileTool_WriteThenRead(t *testing.T) {
+	root := t.TempDir()
+	ft := NewLocalFileTool(root)
+	ctx := context.Background()
+
+	if err := ft.WriteFile(ctx, "nested/dir/notes.md", "hello\n"); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	got, err := ft.ReadFile(ctx, "nested/dir/notes.md")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if got != "hello\n" {
+		t.Errorf("ReadFile() = %q, want %q", got, "hello\n")
+	}
+	if readFile(t, root, "nested/dir/notes.md") != "hello\n" {
+		t.Error("Expected the file to be written under root")
+	}
+}
+
+func TestLocalFileTool_SearchFileMultipleMatches(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"main.go": "package main\n\nfunc main() {\n\tprintln(\"main\")\n}\n",
+	})
+
+	matches, err := NewLocalFileTool(root).SearchFile(context.Background(), "main.go", "main")
+	if err != nil {
+		t.Fatalf("SearchFile() error = %v", err)
+	}
+
+	want := []string{"1: package main", "3: func main() {", "4: \tprintln(\"main\")"}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("SearchFile() = %q, want %q", matches, want)
+	}
+}
+
+func TestLocalFileTool_ReadFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.txt":        "alpha\n",
+		"nested/b.txt": "bravo\n",
+	})
+	ft := NewLocalFileTool(root)
+
+	results, err := ft.ReadFiles(context.Background(), []string{"a.txt", "nested/b.txt", "missing.txt", "../outside.txt", "/etc/passwd", "a.txt"})
+	if err != nil {
+		t.Fatalf("ReadFiles() error = %v", err)
+	}
+	if len(results) != 5 {
+		t.Errorf("ReadFiles() returned %d results, want one per distinct path", len(results))
+	}
+
+	for path, want := range map[string]string{"a.txt": "alpha\n", "nested/b.txt": "bravo\n"} {
+		if got := results[path]; got.Err != nil || got.Content != want {
+			t.Errorf("ReadFiles()[%q] = %q, %v, want %q", path, got.Content, got.Err, want)
+		}
+	}
+	if err := results["missing.txt"].Err; !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadFiles()[missing.txt] error = %v, want os.ErrNotExist", err)
+	}
+	for _, path := range []string{"../outside.txt", "/etc/passwd"} {
+		if got := results[path]; !errors.Is(got.Err, ErrPathEscape) || got.Content != "" {
+			t.Errorf("ReadFiles()[%q] = %q, %v, want ErrPathEscape", path, got.Content, got.Err)
+		}
+	}
+
+	if _, err := ft.ReadFiles(context.Background(), nil); err == nil {
+		t.Error("Expected an empty batch to be rejected")
+	}
+	if _, err := ft.ReadFiles(context.Background(), make([]string, MaxBatchFiles+1)); err == nil {
+		t.Errorf("Expected a batch over %d files to be rejected", MaxBatchFiles)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = ft.ReadFiles(ctx, []string{"a.txt"})
+	if err != nil || !errors.Is(results["a.txt"].Err, context.Canceled) {
+		t.Errorf("ReadFiles(cancelled) = %+v, %v, want each file cancelled", results, err)
+	}
+}
@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/adamveld12/tai/internal/state"
+)
+
+// ErrNotGitRepository is returned when the working directory isn't inside a git repository
+var ErrNotGitRepository = errors.New("not a git repository")
+
+// gitTool implements GitTool by running git in the session's working directory
+type gitTool struct {
+	dispatcher state.Dispatcher
+}
+
+// NewGitTool creates a GitTool for the repository in d's working directory. Every
+// subcommand is subject to the same permissions as shell commands.
+func NewGitTool(d state.Dispatcher) GitTool {
+	return &gitTool{dispatcher: d}
+}
+
+// Status returns the porcelain status of the working tree
+func (g *gitTool) Status(ctx context.Context) (string, error) {
+	if err := g.allow("git status"); err != nil {
+		return "", err
+	}
+	return g.git(ctx, "status", "--porcelain")
+}
+
+// Diff returns the unstaged changes in the working tree
+func (g *gitTool) Diff(ctx context.Context) (string, error) {
+	if err := g.allow("git diff"); err != nil {
+		return "", err
+	}
+	return g.git(ctx, "diff")
+}
+
+// Commit records the staged changes with message
+func (g *gitTool) Commit(ctx context.Context, message string) error {
+	if strings.TrimSpace(message) == "" {
+		return errors.New("commit message cannot be empty")
+	}
+
+	if err := g.allow("git commit"); err != nil {
+		return err
+	}
+
+	_, err := g.git(ctx, "commit", "-m", message)
+	return err
+}
+
+// Branch returns the current branch and how far it's ahead or behind its upstream,
+// e.g. "main (ahead 2, behind 0)"
+func (g *gitTool) Branch(ctx context.Context) (string, error) {
+	if err := g.allow("git branch"); err != nil {
+		return "", err
+	}
+
+	out, err := g.git(ctx, "status", "--porcelain=v2", "--branch")
+	if err != nil {
+		return "", err
+	}
+
+	var head, aheadBehind string
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "# branch.head "):
+			head = strings.TrimPrefix(line, "# branch.head ")
+		case strings.HasPrefix(line, "# branch.ab "):
+			aheadBehind = strings.TrimPrefix(line, "# branch.ab ")
+		}
+	}
+
+	if aheadBehind == "" {
+		return head, nil
+	}
+
+	var ahead, behind int
+	if _, err := fmt.Sscanf(aheadBehind, "+%d -%d", &ahead, &behind); err != nil {
+		return head, nil
+	}
+	return fmt.Sprintf("%s (ahead %d, behind %d)", head, ahead, behind), nil
+}
+
+// allow returns ErrCommandDenied unless the session's permissions allow command
+func (g *gitTool) allow(command string) error {
+	if !g.dispatcher.GetState().Permissions.IsAllowed(command) {
+		return fmt.Errorf("%w: %s", ErrCommandDenied, command)
+	}
+	return nil
+}
+
+// git runs git with args in the working directory and returns its stdout
+func (g *gitTool) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.dispatcher.GetState().Context.WorkingDirectory
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(strings.ToLower(msg), "not a git repository") {
+			return "", fmt.Errorf("%w: %s", ErrNotGitRepository, cmd.Dir)
+		}
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return "", fmt.Errorf("git %s failed: %s: %w", args[0], msg, err)
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/state"
+)
+
+// gitRepo initializes an empty repository in a temp directory and returns a GitTool for it
+func gitRepo(t *testing.T, permissions state.Permissions) (GitTool, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	for _, env := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(env, "tai")
+	}
+	for _, env := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(env, "tai@example.com")
+	}
+
+	dir := t.TempDir()
+	s := state.NewMemoryState("Test", dir, "test")
+	s.Dispatch(setPermissionsAction{permissions})
+
+	g := NewGitTool(s).(*gitTool)
+	if _, err := g.git(context.Background(), "init", "-b", "main"); err != nil {
+		t.Fatalf("git init failed: %v", err)
+	}
+	return g, dir
+}
+
+func TestGitTool_StatusDiffCommit(t *testing.T) {
+	g, dir := gitRepo(t, state.Permissions{})
+	ctx := context.Background()
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n"})
+
+	status, err := g.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status != "?? main.go\n" {
+		t.Errorf("Status() = %q, want main.go untracked", status)
+	}
+
+	if _, err := g.(*gitTool).git(ctx, "add", "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Commit(ctx, "Add main"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	if status, _ := g.Status(ctx); status != "" {
+		t.Errorf("Status() after commit = %q, want a clean tree", status)
+	}
+
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+	diff, err := g.Diff(ctx)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if !strings.Contains(diff, "+func main() {}") {
+		t.Errorf("Diff() = %q, want the added line", diff)
+	}
+
+	branch, err := g.Branch(ctx)
+	if err != nil {
+		t.Fatalf("Branch() error = %v", err)
+	}
+	if branch != "main" {
+		t.Errorf("Branch() = %q, want %q", branch, "main")
+	}
+}
+
+func TestGitTool_CommitRespectsPermissions(t *testing.T) {
+	g, dir := gitRepo(t, state.Permissions{Deny: []string{"git commit"}})
+	ctx := context.Background()
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n"})
+	if _, err := g.(*gitTool).git(ctx, "add", "main.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Commit(ctx, "Add main"); !errors.Is(err, ErrCommandDenied) {
+		t.Errorf("Commit() error = %v, want ErrCommandDenied", err)
+	}
+}
+
+func TestGitTool_EverySubcommandRespectsPermissions(t *testing.T) {
+	g, _ := gitRepo(t, state.Permissions{Deny: []string{"git *"}})
+	ctx := context.Background()
+
+	if _, err := g.Status(ctx); !errors.Is(err, ErrCommandDenied) {
+		t.Errorf("Status() error = %v, want ErrCommandDenied", err)
+	}
+	if _, err := g.Diff(ctx); !errors.Is(err, ErrCommandDenied) {
+		t.Errorf("Diff() error = %v, want ErrCommandDenied", err)
+	}
+	if _, err := g.Branch(ctx); !errors.Is(err, ErrCommandDenied) {
+		t.Errorf("Branch() error = %v, want ErrCommandDenied", err)
+	}
+	if err := g.Commit(ctx, "Add main"); !errors.Is(err, ErrCommandDenied) {
+		t.Errorf("Commit() error = %v, want ErrCommandDenied", err)
+	}
+}
+
+func TestGitTool_NotARepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	// stop git from finding a repository the temp directory happens to live in
+	dir := t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+
+	g := NewGitTool(state.NewMemoryState("Test", dir, "test"))
+	if _, err := g.Status(context.Background()); !errors.Is(err, ErrNotGitRepository) {
+		t.Errorf("Status() error = %v, want ErrNotGitRepository", err)
+	}
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitIgnoreRule is a single parsed line of a .gitignore file
+type gitIgnoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// GitIgnore matches slash separated paths, relative to the repository root,
+// against the rules of the root .gitignore file
+type GitIgnore struct {
+	rules []gitIgnoreRule
+}
+
+// LoadGitIgnore reads root/.gitignore. A missing file yields a GitIgnore that only ignores .git
+func LoadGitIgnore(root string) *GitIgnore {
+	gi := &GitIgnore{rules: []gitIgnoreRule{{pattern: ".git", dirOnly: true}}}
+
+	f, err := os.Open(filepath.Join(root, ".gitignore"))
+	if err != nil {
+		return gi
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := gitIgnoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		// a slash anywhere but the end anchors the pattern to the root
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		rule.pattern = line
+		gi.rules = append(gi.rules, rule)
+	}
+
+	return gi
+}
+
+// Match reports whether relPath should be ignored. Later rules take precedence over earlier ones.
+func (gi *GitIgnore) Match(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(relPath)
+	ignored := false
+
+	for _, rule := range gi.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		var matched bool
+		if rule.anchored {
+			matched, _ = path.Match(rule.pattern, relPath)
+		} else {
+			matched, _ = path.Match(rule.pattern, path.Base(relPath))
+		}
+
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+// WalkFiles calls fn with the slash separated path, relative to root, of every
+// file under root that isn't ignored. Returning fs.SkipAll from fn stops the walk.
+func WalkFiles(root string, fn func(relPath string) error) error {
+	gi := LoadGitIgnore(root)
+
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// unreadable entries are skipped rather than aborting the whole walk
+			if d != nil && d.IsDir() && p != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return nil
+		}
+
+		if gi.Match(rel, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		return fn(filepath.ToSlash(rel))
+	})
+}
@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestGitIgnore_Match(t *testing.T) {
+	dir := t.TempDir()
+	rules := "# comment\n*.log\nbuild/\n/vendor\ndocs/*.tmp\n!keep.log\n"
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	gi := LoadGitIgnore(dir)
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{".git", true, true},
+		{"app.log", false, true},
+		{"nested/app.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"src/build", true, true},
+		{"vendor", true, true},
+		{"src/vendor", true, false},
+		{"docs/a.tmp", false, true},
+		{"other/a.tmp", false, false},
+		{"main.go", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := gi.Match(tt.path, tt.isDir); got != tt.ignored {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.ignored)
+		}
+	}
+}
+
+func TestWalkFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"main.go", "debug.log", "build/out.bin", "pkg/a.go", ".git/HEAD"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.log\nbuild/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	if err := WalkFiles(dir, func(relPath string) error {
+		files = append(files, relPath)
+		return nil
+	}); err != nil {
+		t.Fatalf("WalkFiles() error = %v", err)
+	}
+
+	sort.Strings(files)
+	want := []string{".gitignore", "main.go", "pkg/a.go"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("WalkFiles() = %v, want %v", files, want)
+	}
+}
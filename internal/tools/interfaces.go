@@ -6,8 +6,14 @@ import "context"
 type FileTool interface {
 	// ReadFile reads the contents of a file
 	ReadFile(ctx context.Context, path string) (string, error)
+	// ReadFiles reads several files concurrently, each with its own result
+	ReadFiles(ctx context.Context, paths []string) (map[string]FileResult, error)
 	// WriteFile writes content to a file
 	WriteFile(ctx context.Context, path string, content string) error
+	// EditFile replaces a unique occurrence of oldString with newString and returns the diff
+	EditFile(ctx context.Context, path, oldString, newString string) (string, error)
+	// PreviewEdit returns the diff EditFile would make without changing the file
+	PreviewEdit(ctx context.Context, path, oldString, newString string) (string, error)
 	// SearchFile searches for a term in a file
 	SearchFile(ctx context.Context, path string, term string) ([]string, error)
 }
@@ -26,6 +32,14 @@ type WebTool interface {
 	FetchURL(ctx context.Context, url string) (string, error)
 }
 
+// SearchTool represents a tool that searches the files of the working directory
+type SearchTool interface {
+	// Glob returns the paths of the files matching pattern
+	Glob(ctx context.Context, pattern string) ([]string, error)
+	// Grep returns the lines matching the regular expression pattern in the files matching pathGlob
+	Grep(ctx context.Context, pattern, pathGlob string) ([]GrepMatch, error)
+}
+
 // GitTool represents a Git operation tool
 type GitTool interface {
 	// Status checks the current status of the repository
@@ -37,3 +51,9 @@ type GitTool interface {
 	// Branch shows the current branch status
 	Branch(ctx context.Context) (string, error)
 }
+
+// PatchTool represents a tool that applies unified diffs
+type PatchTool interface {
+	// ApplyPatch applies a multi-file unified diff atomically
+	ApplyPatch(ctx context.Context, diff string) (*PatchResult, error)
+}
@@ -0,0 +1,434 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrPathEscape is returned when a path resolves outside of the sandbox root
+var ErrPathEscape = errors.New("path escapes the sandbox")
+
+// FileChange summarises the effect of a patch on a single file
+type FileChange struct {
+	Path    string
+	Added   int
+	Removed int
+	Created bool
+	Deleted bool
+}
+
+// PatchResult is returned by ApplyPatch once every file has been written
+type PatchResult struct {
+	Files []FileChange
+}
+
+// Summary renders one line per changed file, e.g. "M internal/ui/repl.go (+3 -1)"
+func (r *PatchResult) Summary() string {
+	var b strings.Builder
+	for _, f := range r.Files {
+		op := "M"
+		switch {
+		case f.Created:
+			op = "A"
+		case f.Deleted:
+			op = "D"
+		}
+		fmt.Fprintf(&b, "%s %s (+%d -%d)\n", op, f.Path, f.Added, f.Removed)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Patcher applies unified diffs to files under root
+type Patcher struct {
+	root string
+}
+
+// NewPatcher creates a Patcher sandboxed to root
+func NewPatcher(root string) *Patcher {
+	return &Patcher{root: root}
+}
+
+// filePatch is the parsed diff for a single file
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []hunk
+}
+
+// hunk is a single @@ section. Lines keep their trailing newline unless the
+// diff marked them with "\ No newline at end of file".
+type hunk struct {
+	oldStart int
+	oldLines []string
+	newLines []string
+	added    int
+	removed  int
+}
+
+// ApplyPatch applies a unified diff touching one or more files. Every hunk is
+// applied in memory first, so either all files are written or none are.
+func (p *Patcher) ApplyPatch(ctx context.Context, diff string) (*PatchResult, error) {
+	patches, err := parsePatch(diff)
+	if err != nil {
+		return nil, err
+	}
+
+	type pendingWrite struct {
+		path     string
+		content  string
+		original string
+		existed  bool
+		remove   bool
+	}
+
+	result := &PatchResult{}
+	writes := make([]pendingWrite, 0, len(patches))
+
+	for _, fp := range patches {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		rel := fp.newPath
+		if rel == "" {
+			rel = fp.oldPath
+		}
+
+		target, err := SandboxPath(p.root, rel)
+		if err != nil {
+			return nil, err
+		}
+
+		change := FileChange{Path: filepath.ToSlash(rel), Created: fp.oldPath == "", Deleted: fp.newPath == ""}
+		w := pendingWrite{path: target, remove: change.Deleted}
+
+		if !change.Created {
+			data, err := os.ReadFile(target)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", rel, err)
+			}
+			w.original = string(data)
+			w.existed = true
+		} else if _, err := os.Stat(target); err == nil {
+			return nil, fmt.Errorf("cannot create %s: file already exists", rel)
+		}
+
+		lines := splitLines(w.original)
+		offset := 0
+		for i, h := range fp.hunks {
+			at, ok := findHunk(lines, h, offset)
+			if !ok {
+				return nil, fmt.Errorf("hunk %d of %s does not apply at line %d", i+1, rel, h.oldStart)
+			}
+
+			updated := make([]string, 0, len(lines)-len(h.oldLines)+len(h.newLines))
+			updated = append(updated, lines[:at]...)
+			updated = append(updated, h.newLines...)
+			updated = append(updated, lines[at+len(h.oldLines):]...)
+			lines = updated
+			offset = at + len(h.newLines)
+
+			change.Added += h.added
+			change.Removed += h.removed
+		}
+
+		w.content = strings.Join(lines, "")
+		writes = append(writes, w)
+		result.Files = append(result.Files, change)
+	}
+
+	// write everything, restoring the originals if any write fails part way through
+	for i, w := range writes {
+		var err error
+		if w.remove {
+			err = os.Remove(w.path)
+		} else {
+			if err = os.MkdirAll(filepath.Dir(w.path), 0o755); err == nil {
+				err = os.WriteFile(w.path, []byte(w.content), 0o644)
+			}
+		}
+
+		if err != nil {
+			for _, done := range writes[:i] {
+				if done.existed {
+					_ = os.WriteFile(done.path, []byte(done.original), 0o644)
+				} else {
+					_ = os.Remove(done.path)
+				}
+			}
+			return nil, fmt.Errorf("failed to write %s: %w", w.path, err)
+		}
+	}
+
+	return result, nil
+}
+
+// SandboxPath resolves rel against root and rejects anything that lands outside of it,
+// including through a symlink inside the root that points out of it, with ErrPathEscape
+func SandboxPath(root, rel string) (string, error) {
+	if filepath.IsAbs(rel) {
+		return "", fmt.Errorf("%w: %s", ErrPathEscape, rel)
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(absRoot, filepath.FromSlash(rel))
+	if !within(absRoot, target) {
+		return "", fmt.Errorf("%w: %s", ErrPathEscape, rel)
+	}
+
+	realRoot, err := resolveSymlinks(absRoot)
+	if err != nil {
+		return "", err
+	}
+	realTarget, err := resolveSymlinks(target)
+	if errors.Is(err, ErrPathEscape) || err == nil && !within(realRoot, realTarget) {
+		return "", fmt.Errorf("%w: %s", ErrPathEscape, rel)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return target, nil
+}
+
+// within reports whether path is root or inside of it, both cleaned and absolute
+func within(root, path string) bool {
+	inside, err := filepath.Rel(root, path)
+	return err == nil && inside != ".." && !strings.HasPrefix(inside, ".."+string(filepath.Separator))
+}
+
+// resolveSymlinks returns path with every symlink in it followed. The parts that don't
+// exist yet, like a file about to be created, are joined onto its nearest existing
+// parent as they are. A dangling symlink can't be checked, so it's an ErrPathEscape.
+func resolveSymlinks(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if _, err := os.Lstat(path); err == nil {
+			return "", ErrPathEscape
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, missing...)...), nil
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// parsePatch splits a unified diff into per-file patches
+func parsePatch(diff string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+
+	var patches []filePatch
+	var current *filePatch
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			patches = append(patches, filePatch{
+				oldPath: diffPath(line[4:]),
+				newPath: diffPath(lines[i+1][4:]),
+			})
+			current = &patches[len(patches)-1]
+			i++
+
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("invalid patch: hunk on line %d has no file header", i+1)
+			}
+
+			h, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.hunks = append(current.hunks, h)
+			i = next - 1
+		}
+	}
+
+	if len(patches) == 0 {
+		return nil, errors.New("invalid patch: no file headers found")
+	}
+
+	for _, fp := range patches {
+		if fp.oldPath == "" && fp.newPath == "" {
+			return nil, errors.New("invalid patch: both paths are /dev/null")
+		}
+		if len(fp.hunks) == 0 {
+			return nil, fmt.Errorf("invalid patch: no hunks for %s", fp.newPath+fp.oldPath)
+		}
+	}
+
+	return patches, nil
+}
+
+// parseHunk parses the hunk whose header is lines[start] and returns the index of the line after it
+func parseHunk(lines []string, start int) (hunk, int, error) {
+	header := lines[start]
+	var oldStart, oldCount, newCount int
+	if err := parseHunkHeader(header, &oldStart, &oldCount, &newCount); err != nil {
+		return hunk{}, 0, fmt.Errorf("invalid hunk header on line %d: %w", start+1, err)
+	}
+
+	h := hunk{oldStart: oldStart}
+	var last *[]string
+	var lastOther *[]string
+
+	i := start + 1
+	for ; i < len(lines) && (len(h.oldLines) < oldCount || len(h.newLines) < newCount); i++ {
+		line := lines[i]
+		if line == "" {
+			// some editors strip the leading space of empty context lines
+			line = " "
+		}
+
+		switch line[0] {
+		case ' ':
+			h.oldLines = append(h.oldLines, line[1:]+"\n")
+			h.newLines = append(h.newLines, line[1:]+"\n")
+			last, lastOther = &h.oldLines, &h.newLines
+		case '-':
+			h.oldLines = append(h.oldLines, line[1:]+"\n")
+			h.removed++
+			last, lastOther = &h.oldLines, nil
+		case '+':
+			h.newLines = append(h.newLines, line[1:]+"\n")
+			h.added++
+			last, lastOther = &h.newLines, nil
+		case '\\':
+			stripNewline(last, lastOther)
+		default:
+			return hunk{}, 0, fmt.Errorf("invalid patch: unexpected line %d in hunk: %q", i+1, line)
+		}
+	}
+
+	if len(h.oldLines) != oldCount || len(h.newLines) != newCount {
+		return hunk{}, 0, fmt.Errorf("invalid patch: hunk on line %d is truncated", start+1)
+	}
+
+	// a trailing "\ No newline at end of file" belongs to the last line of the hunk
+	if i < len(lines) && strings.HasPrefix(lines[i], `\`) {
+		stripNewline(last, lastOther)
+		i++
+	}
+
+	return h, i, nil
+}
+
+// parseHunkHeader reads "@@ -l[,s] +l[,s] @@"
+func parseHunkHeader(header string, oldStart, oldCount, newCount *int) error {
+	fields := strings.Fields(header)
+	if len(fields) < 4 || fields[0] != "@@" || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return fmt.Errorf("%q", header)
+	}
+
+	var err error
+	if *oldStart, *oldCount, err = parseRange(fields[1][1:]); err != nil {
+		return err
+	}
+	if _, *newCount, err = parseRange(fields[2][1:]); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseRange parses "l,s" or "l", where a missing size means one line
+func parseRange(r string) (int, int, error) {
+	start, count, found := strings.Cut(r, ",")
+	l, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !found {
+		return l, 1, nil
+	}
+	s, err := strconv.Atoi(count)
+	return l, s, err
+}
+
+// diffPath strips the a/ or b/ prefix and any timestamp from a --- or +++ header.
+// /dev/null is returned as an empty path.
+func diffPath(header string) string {
+	name, _, _ := strings.Cut(header, "\t")
+	name = strings.TrimSpace(name)
+	if name == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(name, "a/") || strings.HasPrefix(name, "b/") {
+		name = name[2:]
+	}
+	return name
+}
+
+func stripNewline(lines ...*[]string) {
+	for _, l := range lines {
+		if l != nil && len(*l) > 0 {
+			(*l)[len(*l)-1] = strings.TrimSuffix((*l)[len(*l)-1], "\n")
+		}
+	}
+}
+
+// splitLines splits content into lines that keep their trailing newline
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// findHunk locates the hunk's old lines, preferring the line number from the
+// header and searching outwards from it when earlier edits shifted the file
+func findHunk(lines []string, h hunk, minIndex int) (int, bool) {
+	expected := h.oldStart - 1
+	if len(h.oldLines) == 0 {
+		// pure insertions use the line before the insertion point as the start
+		expected = h.oldStart
+	}
+	if expected < minIndex {
+		expected = minIndex
+	}
+
+	for delta := 0; delta <= len(lines); delta++ {
+		for _, at := range []int{expected - delta, expected + delta} {
+			if at < minIndex || at+len(h.oldLines) > len(lines) {
+				continue
+			}
+			if matchesAt(lines, h.oldLines, at) {
+				return at, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func matchesAt(lines, want []string, at int) bool {
+	for i, l := range want {
+		if lines[at+i] != l {
+			return false
+		}
+	}
+	return true
+}
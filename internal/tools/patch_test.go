@@ -0,0 +1,197 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, root, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestPatcher_ApplyPatchMultiFile(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"main.go":      "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n",
+		"pkg/util.go":  "package pkg\n\nfunc A() {}\n\nfunc B() {}\n\nfunc C() {}\n",
+		"old/notes.md": "remove me\n",
+	})
+
+	diff := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,5 +1,5 @@
+ package main
+ 
+ func main() {
+-	println("hi")
++	println("hello")
+ }
+--- a/pkg/util.go
++++ b/pkg/util.go
+@@ -1,3 +1,4 @@
+ package pkg
+ 
++// A does nothing
+ func A() {}
+@@ -6,2 +7,3 @@
+ 
+ func C() {}
++func D() {}
+--- /dev/null
++++ b/docs/new.md
+@@ -0,0 +1,2 @@
++# New
++doc
+--- a/old/notes.md
++++ /dev/null
+@@ -1 +0,0 @@
+-remove me
+`
+
+	result, err := NewPatcher(root).ApplyPatch(context.Background(), diff)
+	if err != nil {
+		t.Fatalf("ApplyPatch() error = %v", err)
+	}
+
+	if got := readFile(t, root, "main.go"); got != "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n" {
+		t.Errorf("main.go = %q", got)
+	}
+	if got := readFile(t, root, "pkg/util.go"); got != "package pkg\n\n// A does nothing\nfunc A() {}\n\nfunc B() {}\n\nfunc C() {}\nfunc D() {}\n" {
+		t.Errorf("pkg/util.go = %q", got)
+	}
+	if got := readFile(t, root, "docs/new.md"); got != "# New\ndoc\n" {
+		t.Errorf("docs/new.md = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "old/notes.md")); !os.IsNotExist(err) {
+		t.Error("Expected old/notes.md to be deleted")
+	}
+
+	want := "M main.go (+1 -1)\nM pkg/util.go (+2 -0)\nA docs/new.md (+2 -0)\nD old/notes.md (+0 -1)"
+	if got := result.Summary(); got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
+
+func TestPatcher_FailingHunkRollsBack(t *testing.T) {
+	root := t.TempDir()
+	original := map[string]string{
+		"a.txt": "one\ntwo\nthree\n",
+		"b.txt": "alpha\nbeta\n",
+	}
+	writeFiles(t, root, original)
+
+	diff := `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+--- /dev/null
++++ b/c.txt
+@@ -0,0 +1 @@
++created
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,2 @@
+ alpha
+-gamma
++delta
+`
+
+	if _, err := NewPatcher(root).ApplyPatch(context.Background(), diff); err == nil {
+		t.Fatal("Expected an error for a hunk that doesn't apply")
+	}
+
+	for name, content := range original {
+		if got := readFile(t, root, name); got != content {
+			t.Errorf("%s = %q, want it untouched (%q)", name, got, content)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "c.txt")); !os.IsNotExist(err) {
+		t.Error("Expected c.txt not to be created")
+	}
+}
+
+func TestPatcher_RejectsPathEscape(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "sandbox")
+	writeFiles(t, parent, map[string]string{"secret.txt": "keep\n", "sandbox/ok.txt": "ok\n"})
+
+	for _, target := range []string{"../secret.txt", "sandbox/../../secret.txt", "/etc/passwd"} {
+		diff := "--- a/" + target + "\n+++ b/" + target + "\n@@ -1 +1 @@\n-keep\n+pwned\n"
+		if target[0] == '/' {
+			diff = "--- " + target + "\n+++ " + target + "\n@@ -1 +1 @@\n-keep\n+pwned\n"
+		}
+
+		_, err := NewPatcher(root).ApplyPatch(context.Background(), diff)
+		if !errors.Is(err, ErrPathEscape) {
+			t.Errorf("ApplyPatch(%q) error = %v, want ErrPathEscape", target, err)
+		}
+	}
+
+	if got := readFile(t, parent, "secret.txt"); got != "keep\n" {
+		t.Errorf("secret.txt = %q, want it untouched", got)
+	}
+}
+
+func TestPatcher_RejectsSymlinkEscape(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "sandbox")
+	writeFiles(t, parent, map[string]string{"outside/secret.txt": "keep\n", "sandbox/ok.txt": "ok\n"})
+	if err := os.Symlink(filepath.Join(parent, "outside"), filepath.Join(root, "out")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	diffs := []string{
+		"--- a/out/secret.txt\n+++ b/out/secret.txt\n@@ -1 +1 @@\n-keep\n+pwned\n",
+		"--- /dev/null\n+++ b/out/new.txt\n@@ -0,0 +1 @@\n+pwned\n",
+	}
+	for _, diff := range diffs {
+		if _, err := NewPatcher(root).ApplyPatch(context.Background(), diff); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("ApplyPatch(%q) error = %v, want ErrPathEscape", diff, err)
+		}
+	}
+
+	if got := readFile(t, parent, "outside/secret.txt"); got != "keep\n" {
+		t.Errorf("secret.txt = %q, want it untouched", got)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "outside", "new.txt")); !os.IsNotExist(err) {
+		t.Error("Expected new.txt not to be created outside the root")
+	}
+}
+
+func TestPatcher_NoNewlineAtEndOfFile(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.txt": "one\ntwo"})
+
+	diff := "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n\\ No newline at end of file\n+two\n"
+	if _, err := NewPatcher(root).ApplyPatch(context.Background(), diff); err != nil {
+		t.Fatalf("ApplyPatch() error = %v", err)
+	}
+	if got := readFile(t, root, "a.txt"); got != "one\ntwo\n" {
+		t.Errorf("a.txt = %q", got)
+	}
+}
@@ -0,0 +1,383 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adamveld12/tai/internal/llm"
+	"github.com/adamveld12/tai/internal/state"
+)
+
+// Handler runs a tool with the JSON encoded arguments the model gave it
+type Handler func(ctx context.Context, args string) (string, error)
+
+// Registry maps tool names to their handlers and describes them to the LLM
+type Registry struct {
+	mu       sync.RWMutex
+	tools    []llm.Tool
+	handlers map[string]Handler
+	readOnly map[string]bool
+	previews map[string]bool
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string]Handler), readOnly: make(map[string]bool), previews: make(map[string]bool)}
+}
+
+// RegisterReadOnly adds a tool that only reads, so it's safe to run without asking in execute mode
+func (r *Registry) RegisterReadOnly(name, description string, params map[string]interface{}, handler Handler) error {
+	if err := r.Register(name, description, params, handler); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.readOnly[name] = true
+	r.mu.Unlock()
+	return nil
+}
+
+// ReadOnly reports whether the tool called name was registered as read-only
+func (r *Registry) ReadOnly(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.readOnly[name]
+}
+
+// RegisterPreview adds a tool that changes things but checks the mode itself, so in plan
+// mode it can run and show what it would do without doing it
+func (r *Registry) RegisterPreview(name, description string, params map[string]interface{}, handler Handler) error {
+	if err := r.Register(name, description, params, handler); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.previews[name] = true
+	r.mu.Unlock()
+	return nil
+}
+
+// Previews reports whether the tool called name was registered as safe to run in plan mode
+func (r *Registry) Previews(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.previews[name]
+}
+
+// Register adds a tool called name. params is the JSON schema of its arguments.
+func (r *Registry) Register(name, description string, params map[string]interface{}, handler Handler) error {
+	if name == "" {
+		return fmt.Errorf("tool name cannot be empty")
+	}
+	if handler == nil {
+		return fmt.Errorf("tool %q needs a handler", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.handlers[name]; exists {
+		return fmt.Errorf("tool %q is already registered", name)
+	}
+
+	r.handlers[name] = handler
+	r.tools = append(r.tools, llm.Tool{
+		Type: "function",
+		Function: llm.ToolFunction{
+			Name:        name,
+			Description: description,
+			Parameters:  params,
+		},
+	})
+	return nil
+}
+
+// Tools returns the schema of every registered tool, in the order they were registered
+func (r *Registry) Tools() []llm.Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]llm.Tool(nil), r.tools...)
+}
+
+// Call runs the tool called name with the JSON encoded args from the LLM
+func (r *Registry) Call(ctx context.Context, name, args string) (string, error) {
+	r.mu.RLock()
+	handler, ok := r.handlers[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("unknown tool %q", name)
+	}
+	return handler(ctx, args)
+}
+
+// objectSchema builds the JSON schema for an object of string properties, all required
+func objectSchema(properties map[string]string) map[string]interface{} {
+	props := make(map[string]interface{}, len(properties))
+	required := make([]string, 0, len(properties))
+	for name, description := range properties {
+		props[name] = map[string]interface{}{"type": "string", "description": description}
+		required = append(required, name)
+	}
+	sort.Strings(required)
+	return map[string]interface{}{"type": "object", "properties": props, "required": required}
+}
+
+// decodeArgs unmarshals the model's JSON arguments into v
+func decodeArgs(name, args string, v interface{}) error {
+	if args == "" {
+		args = "{}"
+	}
+	if err := json.Unmarshal([]byte(args), v); err != nil {
+		return fmt.Errorf("invalid arguments for %s: %w", name, err)
+	}
+	return nil
+}
+
+// filesOutput formats the files read for paths in the order they were asked for, each
+// headed by its path like head(1) does, with the error for files that couldn't be read
+func filesOutput(paths []string, results map[string]FileResult) string {
+	var b strings.Builder
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		result := results[path]
+		fmt.Fprintf(&b, "==> %s <==\n", path)
+		if result.Err != nil {
+			fmt.Fprintf(&b, "error: %v\n\n", result.Err)
+			continue
+		}
+		b.WriteString(result.Content)
+		if !strings.HasSuffix(result.Content, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// searchOutput formats search results one per line, noting when there were more
+func searchOutput[T any](results []T, err error, format func(T) string) (string, error) {
+	if err != nil && !errors.Is(err, ErrSearchTruncated) {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "no matches", nil
+	}
+
+	lines := make([]string, 0, len(results)+1)
+	for _, r := range results {
+		lines = append(lines, format(r))
+	}
+	if err != nil {
+		lines = append(lines, fmt.Sprintf("(%v, narrow the search)", err))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// NewDefaultRegistry registers the file, patch, search, shell, git, web and scratchpad tools,
+// all working in d's working directory
+func NewDefaultRegistry(d state.Dispatcher) *Registry {
+	r := NewRegistry()
+	root := d.GetState().Context.WorkingDirectory
+
+	files := NewLocalFileTool(root)
+	r.RegisterReadOnly("read_file", "Read a file in the working directory.",
+		objectSchema(map[string]string{"path": "Path relative to the working directory"}),
+		func(ctx context.Context, args string) (string, error) {
+			var p struct{ Path string }
+			if err := decodeArgs("read_file", args, &p); err != nil {
+				return "", err
+			}
+			return files.ReadFile(ctx, p.Path)
+		})
+	r.RegisterReadOnly("read_files", fmt.Sprintf("Read up to %d files in the working directory in one call.", MaxBatchFiles),
+		map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"paths": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Paths relative to the working directory",
+				},
+			},
+			"required": []string{"paths"},
+		},
+		func(ctx context.Context, args string) (string, error) {
+			var p struct{ Paths []string }
+			if err := decodeArgs("read_files", args, &p); err != nil {
+				return "", err
+			}
+			results, err := files.ReadFiles(ctx, p.Paths)
+			if err != nil {
+				return "", err
+			}
+			return filesOutput(p.Paths, results), nil
+		})
+	r.Register("write_file", "Replace a file in the working directory with new content, creating it if needed.",
+		objectSchema(map[string]string{"path": "Path relative to the working directory", "content": "The complete new file content"}),
+		func(ctx context.Context, args string) (string, error) {
+			var p struct{ Path, Content string }
+			if err := decodeArgs("write_file", args, &p); err != nil {
+				return "", err
+			}
+			if err := files.WriteFile(ctx, p.Path, p.Content); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("wrote %s", p.Path), nil
+		})
+	r.RegisterPreview("edit_file", "Replace one exact, unique occurrence of some text in a file and show the diff. In plan mode the diff is shown without changing the file.",
+		objectSchema(map[string]string{
+			"path":       "Path relative to the working directory",
+			"old_string": "The exact text to replace, with enough surrounding lines to be unique in the file",
+			"new_string": "The text to replace it with",
+		}),
+		func(ctx context.Context, args string) (string, error) {
+			var p struct {
+				Path      string `json:"path"`
+				OldString string `json:"old_string"`
+				NewString string `json:"new_string"`
+			}
+			if err := decodeArgs("edit_file", args, &p); err != nil {
+				return "", err
+			}
+			if d.GetState().Context.Mode == state.PlanMode {
+				diff, err := files.PreviewEdit(ctx, p.Path, p.OldString, p.NewString)
+				if err != nil {
+					return "", err
+				}
+				return "not applied, tai is in plan mode:\n" + diff, nil
+			}
+			return files.EditFile(ctx, p.Path, p.OldString, p.NewString)
+		})
+
+	patcher := NewPatcher(root)
+	r.Register("apply_patch", "Apply a unified diff to one or more files in the working directory. Either every file changes or none do.",
+		objectSchema(map[string]string{"diff": "A unified diff with --- and +++ headers and @@ hunks, paths relative to the working directory"}),
+		func(ctx context.Context, args string) (string, error) {
+			var p struct{ Diff string }
+			if err := decodeArgs("apply_patch", args, &p); err != nil {
+				return "", err
+			}
+			result, err := patcher.ApplyPatch(ctx, p.Diff)
+			if err != nil {
+				return "", err
+			}
+			return result.Summary(), nil
+		})
+	r.RegisterReadOnly("search_file", "List the lines of a file containing a term, with their line numbers.",
+		objectSchema(map[string]string{"path": "Path relative to the working directory", "term": "Text to search for"}),
+		func(ctx context.Context, args string) (string, error) {
+			var p struct{ Path, Term string }
+			if err := decodeArgs("search_file", args, &p); err != nil {
+				return "", err
+			}
+			matches, err := files.SearchFile(ctx, p.Path, p.Term)
+			if err != nil {
+				return "", err
+			}
+			if len(matches) == 0 {
+				return "no matches", nil
+			}
+			b, _ := json.Marshal(matches)
+			return string(b), nil
+		})
+
+	search := NewLocalSearchTool(root)
+	r.RegisterReadOnly("glob", "List the files in the working directory matching a glob pattern, skipping ignored files.",
+		objectSchema(map[string]string{"pattern": "A file name pattern like *.go, or a path pattern like internal/**/*_test.go"}),
+		func(ctx context.Context, args string) (string, error) {
+			var p struct{ Pattern string }
+			if err := decodeArgs("glob", args, &p); err != nil {
+				return "", err
+			}
+			paths, err := search.Glob(ctx, p.Pattern)
+			return searchOutput(paths, err, func(path string) string { return path })
+		})
+	r.RegisterReadOnly("grep", "Search the files in the working directory for lines matching a regular expression, skipping ignored files.",
+		map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"pattern": map[string]interface{}{"type": "string", "description": "A Go regular expression"},
+				"path":    map[string]interface{}{"type": "string", "description": "Only search files matching this glob pattern, e.g. *.go"},
+			},
+			"required": []string{"pattern"},
+		},
+		func(ctx context.Context, args string) (string, error) {
+			var p struct{ Pattern, Path string }
+			if err := decodeArgs("grep", args, &p); err != nil {
+				return "", err
+			}
+			matches, err := search.Grep(ctx, p.Pattern, p.Path)
+			return searchOutput(matches, err, func(m GrepMatch) string { return fmt.Sprintf("%s:%d: %s", m.Path, m.Line, m.Text) })
+		})
+
+	shell := NewLocalShellTool(d, DefaultCommandTimeout)
+	r.Register("run_command", "Run a shell command in the working directory and return its output.",
+		objectSchema(map[string]string{"command": "The command to run with sh"}),
+		func(ctx context.Context, args string) (string, error) {
+			var p struct{ Command string }
+			if err := decodeArgs("run_command", args, &p); err != nil {
+				return "", err
+			}
+			out, err := shell.RunCommand(ctx, p.Command)
+			if err != nil {
+				return fmt.Sprintf("%s\n%v", out, err), nil
+			}
+			return out, nil
+		})
+
+	git := NewGitTool(d)
+	r.RegisterReadOnly("git_status", "Show the porcelain git status of the working tree.", objectSchema(nil),
+		func(ctx context.Context, args string) (string, error) { return git.Status(ctx) })
+	r.RegisterReadOnly("git_diff", "Show the unstaged changes in the working tree.", objectSchema(nil),
+		func(ctx context.Context, args string) (string, error) { return git.Diff(ctx) })
+	r.RegisterReadOnly("git_branch", "Show the current branch and how far it is ahead or behind its upstream.", objectSchema(nil),
+		func(ctx context.Context, args string) (string, error) { return git.Branch(ctx) })
+	r.Register("git_commit", "Commit the staged changes.",
+		objectSchema(map[string]string{"message": "The commit message"}),
+		func(ctx context.Context, args string) (string, error) {
+			var p struct{ Message string }
+			if err := decodeArgs("git_commit", args, &p); err != nil {
+				return "", err
+			}
+			if err := git.Commit(ctx, p.Message); err != nil {
+				return "", err
+			}
+			return "committed", nil
+		})
+
+	// fetching isn't read-only, the URL itself can carry data out, so it's approved like a command
+	web := NewWebTool(DefaultFetchTimeout, DefaultMaxFetchBytes)
+	r.Register("fetch_url", "Fetch a public web page, e.g. documentation, and return its readable text.",
+		objectSchema(map[string]string{"url": "The http or https URL to fetch"}),
+		func(ctx context.Context, args string) (string, error) {
+			var p struct{ URL string }
+			if err := decodeArgs("fetch_url", args, &p); err != nil {
+				return "", err
+			}
+			return web.FetchURL(ctx, p.URL)
+		})
+
+	// the scratchpad only holds the agent's own notes, so none of it needs the user's approval
+	pad := NewScratchpad(d)
+	for _, tool := range ScratchpadTools {
+		name := tool.Function.Name
+		r.RegisterReadOnly(name, tool.Function.Description, tool.Function.Parameters,
+			func(ctx context.Context, args string) (string, error) { return pad.Call(ctx, name, args) })
+	}
+
+	return r
+}
@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/llm"
+	"github.com/adamveld12/tai/internal/state"
+)
+
+func TestRegistry_RoundTrip(t *testing.T) {
+	r := NewRegistry()
+	err := r.Register("echo", "Echo the text back", objectSchema(map[string]string{"text": "Text to echo"}),
+		func(ctx context.Context, args string) (string, error) {
+			var p struct{ Text string }
+			if err := decodeArgs("echo", args, &p); err != nil {
+				return "", err
+			}
+			return p.Text, nil
+		})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	if err := r.Register("echo", "again", nil, func(ctx context.Context, args string) (string, error) { return "", nil }); err == nil {
+		t.Error("Expected registering a duplicate name to fail")
+	}
+
+	data, err := json.Marshal(llm.ChatRequest{Tools: r.Tools()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req llm.ChatRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Tools) != 1 || req.Tools[0].Type != "function" || req.Tools[0].Function.Name != "echo" {
+		t.Fatalf("request tools = %+v, want the echo tool", req.Tools)
+	}
+
+	call := state.ToolCall{ID: "call_1", Type: "function", Function: state.ToolCallFunction{Name: req.Tools[0].Function.Name, Arguments: `{"text":"hi"}`}}
+	out, err := r.Call(context.Background(), call.Function.Name, call.Function.Arguments)
+	if err != nil || out != "hi" {
+		t.Errorf("Call() = %q, %v; want %q", out, err, "hi")
+	}
+
+	if _, err := r.Call(context.Background(), "missing", "{}"); err == nil {
+		t.Error("Expected calling an unknown tool to fail")
+	}
+}
+
+func TestNewDefaultRegistry(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"notes.md": "remember the milk\n"})
+	r := NewDefaultRegistry(state.NewMemoryState("Test", root, "test"))
+
+	names := map[string]bool{}
+	for _, tool := range r.Tools() {
+		names[tool.Function.Name] = true
+	}
+	for _, name := range []string{"read_file", "write_file", "edit_file", "apply_patch", "search_file", "run_command", "glob", "grep", "git_status", "git_commit", "fetch_url", ToolScratchpadRead, ToolScratchpadWrite} {
+		if !names[name] {
+			t.Errorf("Expected %s to be registered", name)
+		}
+	}
+
+	out, err := r.Call(context.Background(), "read_file", `{"path":"notes.md"}`)
+	if err != nil || out != "remember the milk\n" {
+		t.Errorf("read_file = %q, %v", out, err)
+	}
+
+	out, err = r.Call(context.Background(), "read_files", `{"paths":["notes.md","missing.md"]}`)
+	if err != nil || !strings.HasPrefix(out, "==> notes.md <==\nremember the milk\n\n==> missing.md <==\nerror: ") {
+		t.Errorf("read_files = %q, %v", out, err)
+	}
+
+	out, err = r.Call(context.Background(), "grep", `{"pattern":"milk","path":"*.md"}`)
+	if err != nil || out != "notes.md:1: remember the milk" {
+		t.Errorf("grep = %q, %v", out, err)
+	}
+	out, err = r.Call(context.Background(), "glob", `{"pattern":"*.go"}`)
+	if err != nil || out != "no matches" {
+		t.Errorf("glob = %q, %v", out, err)
+	}
+}
+
+func TestNewDefaultRegistry_ReadOnlyTools(t *testing.T) {
+	r := NewDefaultRegistry(state.NewMemoryState("", t.TempDir(), "test"))
+
+	for _, name := range []string{"read_file", "read_files", "search_file", "glob", "grep", "git_status", "git_diff", "git_branch", ToolScratchpadRead, ToolScratchpadWrite} {
+		if !r.ReadOnly(name) {
+			t.Errorf("Expected %s to be read-only", name)
+		}
+	}
+	for _, name := range []string{"write_file", "edit_file", "apply_patch", "run_command", "git_commit", "fetch_url", "unknown"} {
+		if r.ReadOnly(name) {
+			t.Errorf("Expected %s to need approval", name)
+		}
+	}
+
+	if !r.Previews("edit_file") {
+		t.Error("Expected edit_file to preview its changes in plan mode")
+	}
+	for _, name := range []string{"write_file", "run_command", "read_file"} {
+		if r.Previews(name) {
+			t.Errorf("Expected %s not to run in plan mode", name)
+		}
+	}
+}
+
+func TestNewDefaultRegistry_EditFileFollowsMode(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"notes.md": "remember the milk\n"})
+	s := state.NewMemoryState("", root, "test")
+	r := NewDefaultRegistry(s)
+	args := `{"path":"notes.md","old_string":"milk","new_string":"eggs"}`
+
+	out, err := r.Call(context.Background(), "edit_file", args)
+	if err != nil || !strings.HasPrefix(out, "not applied") || !strings.Contains(out, "+remember the eggs\n") {
+		t.Errorf("edit_file in plan mode = %q, %v", out, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "notes.md")); string(data) != "remember the milk\n" {
+		t.Errorf("edit_file changed the file in plan mode: %q", data)
+	}
+
+	s.Dispatch(setModeAction{state.ExecuteMode})
+	out, err = r.Call(context.Background(), "edit_file", args)
+	if err != nil || !strings.HasPrefix(out, "--- a/notes.md") {
+		t.Errorf("edit_file in execute mode = %q, %v", out, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "notes.md")); string(data) != "remember the eggs\n" {
+		t.Errorf("file after edit_file = %q", data)
+	}
+}
+
+func TestNewDefaultRegistry_ApplyPatch(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"notes.md": "remember the milk\n"})
+	r := NewDefaultRegistry(state.NewMemoryState("", root, "test"))
+
+	args, _ := json.Marshal(map[string]string{"diff": "--- a/notes.md\n+++ b/notes.md\n@@ -1 +1 @@\n-remember the milk\n+remember the eggs\n"})
+	out, err := r.Call(context.Background(), "apply_patch", string(args))
+	if err != nil || out != "M notes.md (+1 -1)" {
+		t.Errorf("apply_patch = %q, %v", out, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "notes.md")); string(data) != "remember the eggs\n" {
+		t.Errorf("file after apply_patch = %q", data)
+	}
+
+	if _, err := r.Call(context.Background(), "apply_patch", `{"diff":"not a diff"}`); err == nil {
+		t.Error("Expected apply_patch to reject a malformed diff")
+	}
+}
+
+type setModeAction struct {
+	mode state.Mode
+}
+
+func (a setModeAction) Execute(s state.AppState) (state.AppState, error) {
+	s.Context.Mode = a.mode
+	return s, nil
+}
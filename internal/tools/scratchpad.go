@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/adamveld12/tai/internal/llm"
+	"github.com/adamveld12/tai/internal/state"
+)
+
+// MaxScratchpadSize caps the combined length of every scratchpad key and value, in bytes
+const MaxScratchpadSize = 16 * 1024
+
+const (
+	ToolScratchpadRead  = "scratchpad_read"
+	ToolScratchpadWrite = "scratchpad_write"
+)
+
+// ErrScratchpadFull is returned when a write would push the scratchpad past MaxScratchpadSize
+var ErrScratchpadFull = errors.New("scratchpad is full")
+
+// ScratchpadTools describes the scratchpad tools to the LLM
+var ScratchpadTools = []llm.Tool{
+	{
+		Type: "function",
+		Function: llm.ToolFunction{
+			Name:        ToolScratchpadWrite,
+			Description: "Save a note under a key so it can be read back in later turns. Writing an empty value deletes the key.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"key":   map[string]interface{}{"type": "string", "description": "Name of the note"},
+					"value": map[string]interface{}{"type": "string", "description": "Contents of the note"},
+				},
+				"required": []string{"key", "value"},
+			},
+		},
+	},
+	{
+		Type: "function",
+		Function: llm.ToolFunction{
+			Name:        ToolScratchpadRead,
+			Description: "Read a note previously saved with scratchpad_write.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"key": map[string]interface{}{"type": "string", "description": "Name of the note"},
+				},
+				"required": []string{"key"},
+			},
+		},
+	},
+}
+
+// ScratchpadWriteAction sets a scratchpad entry, or removes it when Value is empty
+type ScratchpadWriteAction struct {
+	Key   string
+	Value string
+}
+
+func (a ScratchpadWriteAction) Execute(s state.AppState) (state.AppState, error) {
+	if a.Key == "" {
+		return s, fmt.Errorf("scratchpad key cannot be empty")
+	}
+
+	// copy the map so earlier snapshots of the state aren't mutated
+	pad := make(map[string]string, len(s.Context.Scratchpad)+1)
+	for k, v := range s.Context.Scratchpad {
+		pad[k] = v
+	}
+
+	if a.Value == "" {
+		delete(pad, a.Key)
+	} else {
+		pad[a.Key] = a.Value
+	}
+
+	if ScratchpadSize(pad) > MaxScratchpadSize {
+		return s, ErrScratchpadFull
+	}
+
+	s.Context.Scratchpad = pad
+	return s, nil
+}
+
+// ScratchpadSize returns the combined length of every key and value in pad
+func ScratchpadSize(pad map[string]string) int {
+	size := 0
+	for k, v := range pad {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// Scratchpad reads and writes the session's scratchpad through the dispatcher
+type Scratchpad struct {
+	dispatcher state.Dispatcher
+}
+
+// NewScratchpad creates a Scratchpad backed by d
+func NewScratchpad(d state.Dispatcher) *Scratchpad {
+	return &Scratchpad{dispatcher: d}
+}
+
+// Read returns the value stored under key
+func (sp *Scratchpad) Read(ctx context.Context, key string) (string, error) {
+	value, ok := sp.dispatcher.GetState().Context.Scratchpad[key]
+	if !ok {
+		return "", fmt.Errorf("no scratchpad entry for %q", key)
+	}
+	return value, nil
+}
+
+// Write stores value under key. An empty value removes the key.
+func (sp *Scratchpad) Write(ctx context.Context, key, value string) error {
+	action := ScratchpadWriteAction{Key: key, Value: value}
+
+	// validate first, Dispatch only records action errors on the state rather than returning them
+	if _, err := action.Execute(sp.dispatcher.GetState()); err != nil {
+		return err
+	}
+
+	sp.dispatcher.Dispatch(action)
+	return nil
+}
+
+// Call runs the scratchpad tool called name with the JSON encoded args from the LLM
+func (sp *Scratchpad) Call(ctx context.Context, name, args string) (string, error) {
+	var params struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for %s: %w", name, err)
+	}
+
+	switch name {
+	case ToolScratchpadRead:
+		return sp.Read(ctx, params.Key)
+	case ToolScratchpadWrite:
+		if err := sp.Write(ctx, params.Key, params.Value); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("saved %q", params.Key), nil
+	default:
+		return "", fmt.Errorf("unknown scratchpad tool %q", name)
+	}
+}
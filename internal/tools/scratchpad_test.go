@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/state"
+)
+
+func TestScratchpad_ReadWrite(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	pad := NewScratchpad(s)
+	ctx := context.Background()
+
+	if _, err := pad.Read(ctx, "plan"); err == nil {
+		t.Error("Expected an error reading a missing key")
+	}
+
+	before := s.GetState()
+	if out, err := pad.Call(ctx, ToolScratchpadWrite, `{"key":"plan","value":"1. read 2. edit"}`); err != nil {
+		t.Fatalf("Call(%s) error = %v", ToolScratchpadWrite, err)
+	} else if !strings.Contains(out, "plan") {
+		t.Errorf("Call(%s) = %q, want it to mention the key", ToolScratchpadWrite, out)
+	}
+
+	if got := s.GetState().Context.Scratchpad["plan"]; got != "1. read 2. edit" {
+		t.Errorf("Scratchpad[plan] = %q, want %q", got, "1. read 2. edit")
+	}
+	if len(before.Context.Scratchpad) != 0 {
+		t.Error("Expected earlier state snapshots to be left untouched")
+	}
+
+	value, err := pad.Call(ctx, ToolScratchpadRead, `{"key":"plan"}`)
+	if err != nil || value != "1. read 2. edit" {
+		t.Errorf("Call(%s) = (%q, %v), want %q", ToolScratchpadRead, value, err, "1. read 2. edit")
+	}
+
+	if err := pad.Write(ctx, "plan", ""); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, ok := s.GetState().Context.Scratchpad["plan"]; ok {
+		t.Error("Expected an empty value to delete the key")
+	}
+}
+
+func TestScratchpad_SizeCap(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	pad := NewScratchpad(s)
+	ctx := context.Background()
+
+	half := strings.Repeat("x", MaxScratchpadSize/2)
+	if err := pad.Write(ctx, "a", half); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if err := pad.Write(ctx, "b", half); !errors.Is(err, ErrScratchpadFull) {
+		t.Fatalf("Write() error = %v, want ErrScratchpadFull", err)
+	}
+	if _, ok := s.GetState().Context.Scratchpad["b"]; ok {
+		t.Error("Expected the rejected write not to be stored")
+	}
+
+	// overwriting an existing key only counts its new size
+	if err := pad.Write(ctx, "a", half[:10]); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := pad.Write(ctx, "b", half); err != nil {
+		t.Errorf("Write() error = %v, want room after shrinking a", err)
+	}
+}
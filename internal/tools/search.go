@@ -0,0 +1,189 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MaxSearchResults is the most paths or lines a single search returns
+const MaxSearchResults = 200
+
+// maxGrepFileSize is the largest file Grep reads, bigger ones are skipped
+const maxGrepFileSize = 1 << 20
+
+// maxGrepLineLength is how much of a matching line Grep returns
+const maxGrepLineLength = 300
+
+// ErrSearchTruncated is returned along with the first MaxSearchResults results when a
+// search matched more than that
+var ErrSearchTruncated = fmt.Errorf("more than %d results, only the first %d are returned", MaxSearchResults, MaxSearchResults)
+
+// GrepMatch is a line Grep found
+type GrepMatch struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// LocalSearchTool implements SearchTool for the files under a root directory. Files
+// ignored by the root .gitignore are never searched or listed.
+type LocalSearchTool struct {
+	root string
+}
+
+// NewLocalSearchTool creates a LocalSearchTool for the files under root
+func NewLocalSearchTool(root string) *LocalSearchTool {
+	return &LocalSearchTool{root: root}
+}
+
+// Glob returns the slash separated paths, relative to the root, of the files matching
+// pattern. A pattern without a slash matches file names in any directory, e.g. "*.go",
+// otherwise it matches the whole path and ** stands for any number of directories,
+// e.g. "internal/**/*_test.go".
+func (s *LocalSearchTool) Glob(ctx context.Context, pattern string) ([]string, error) {
+	if err := checkGlob(pattern); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	err := WalkFiles(s.root, func(relPath string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !matchGlob(pattern, relPath) {
+			return nil
+		}
+		if len(paths) == MaxSearchResults {
+			return ErrSearchTruncated
+		}
+		paths = append(paths, relPath)
+		return nil
+	})
+	return paths, err
+}
+
+// Grep returns the lines matching the regular expression pattern in the files matching
+// pathGlob, as Glob matches them, or in every file when it's empty. Binary files and
+// files over 1MB are skipped.
+func (s *LocalSearchTool) Grep(ctx context.Context, pattern, pathGlob string) ([]GrepMatch, error) {
+	if pattern == "" {
+		return nil, errors.New("search pattern cannot be empty")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search pattern: %w", err)
+	}
+	if pathGlob != "" {
+		if err := checkGlob(pathGlob); err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []GrepMatch
+	err = WalkFiles(s.root, func(relPath string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if pathGlob != "" && !matchGlob(pathGlob, relPath) {
+			return nil
+		}
+
+		return grepFile(filepath.Join(s.root, filepath.FromSlash(relPath)), func(n int, line string) error {
+			if !re.MatchString(line) {
+				return nil
+			}
+			if len(matches) == MaxSearchResults {
+				return ErrSearchTruncated
+			}
+			if len(line) > maxGrepLineLength {
+				line = line[:maxGrepLineLength] + "..."
+			}
+			matches = append(matches, GrepMatch{Path: relPath, Line: n, Text: line})
+			return nil
+		})
+	})
+	return matches, err
+}
+
+// grepFile calls fn with every line of the text file at name and its 1-based number.
+// Symlinks are skipped rather than followed, since they can point outside of the root.
+func grepFile(name string, fn func(n int, line string) error) error {
+	info, err := os.Lstat(name)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxGrepFileSize {
+		return nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		// unreadable files are skipped like unreadable directories are
+		return nil
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxGrepFileSize)
+	for n := 1; scanner.Scan(); n++ {
+		if err := fn(n, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkGlob rejects patterns that are malformed or that could only match outside of the root
+func checkGlob(pattern string) error {
+	if pattern == "" {
+		return errors.New("glob pattern cannot be empty")
+	}
+	if path.IsAbs(pattern) || pattern == ".." || strings.HasPrefix(pattern, "../") || strings.Contains(pattern, "/../") {
+		return fmt.Errorf("%w: %s", ErrPathEscape, pattern)
+	}
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// matchGlob reports whether the slash separated relPath matches pattern, see Glob
+func matchGlob(pattern, relPath string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(relPath))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where a ** segment
+// matches zero or more path segments
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(segments); skip++ {
+				if matchSegments(pattern[1:], segments[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
@@ -0,0 +1,151 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var _ SearchTool = (*LocalSearchTool)(nil)
+
+func searchTree(t *testing.T) *LocalSearchTool {
+	t.Helper()
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore":                  "*.log\nbuild/\n",
+		"main.go":                     "package main\n\nfunc main() {\n\trun()\n}\n",
+		"internal/app/app.go":         "package app\n\n// TODO: handle errors\nfunc Run() error { return nil }\n",
+		"internal/app/app_test.go":    "package app\n\nfunc TestRun(t *testing.T) {}\n",
+		"docs/notes.md":               "TODO: write the docs\n",
+		"debug.log":                   "TODO: ignored log line\n",
+		"build/out.go":                "package build // TODO: generated\n",
+		"internal/app/image.png":      "\x89PNG\x00\x00TODO",
+		".git/config":                 "[core] TODO\n",
+		"internal/deep/x/y/z.go":      "package z\n",
+		"internal/deep/x/y/z_test.go": "package z\n",
+	})
+	return NewLocalSearchTool(root)
+}
+
+func TestLocalSearchTool_Glob(t *testing.T) {
+	search := searchTree(t)
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.go", []string{"internal/app/app.go", "internal/app/app_test.go", "internal/deep/x/y/z.go", "internal/deep/x/y/z_test.go", "main.go"}},
+		{"*_test.go", []string{"internal/app/app_test.go", "internal/deep/x/y/z_test.go"}},
+		{"internal/**/*_test.go", []string{"internal/app/app_test.go", "internal/deep/x/y/z_test.go"}},
+		{"internal/*/app.go", []string{"internal/app/app.go"}},
+		{"**/*.md", []string{"docs/notes.md"}},
+		{"*.log", nil},
+		{"build/*", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := search.Glob(context.Background(), tt.pattern)
+			if err != nil {
+				t.Fatalf("Glob() error = %v", err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Glob(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+
+	for _, pattern := range []string{"../*", "/etc/*", "docs/../../*"} {
+		if _, err := search.Glob(context.Background(), pattern); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("Glob(%q) error = %v, want ErrPathEscape", pattern, err)
+		}
+	}
+	if _, err := search.Glob(context.Background(), "[a-"); err == nil {
+		t.Error("Expected a malformed pattern to be rejected")
+	}
+}
+
+func TestLocalSearchTool_Grep(t *testing.T) {
+	search := searchTree(t)
+
+	got, err := search.Grep(context.Background(), `TODO:?\s`, "")
+	if err != nil {
+		t.Fatalf("Grep() error = %v", err)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+	want := []GrepMatch{
+		{Path: "docs/notes.md", Line: 1, Text: "TODO: write the docs"},
+		{Path: "internal/app/app.go", Line: 3, Text: "// TODO: handle errors"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Grep() = %+v, want %+v, ignored and binary files skipped", got, want)
+	}
+
+	got, err = search.Grep(context.Background(), `^func`, "*.go")
+	if err != nil {
+		t.Fatalf("Grep() error = %v", err)
+	}
+	if len(got) != 3 {
+		t.Errorf("Grep(^func, *.go) = %+v, want the three Go functions", got)
+	}
+
+	if _, err := search.Grep(context.Background(), `(`, ""); err == nil {
+		t.Error("Expected an invalid regular expression to be rejected")
+	}
+	if _, err := search.Grep(context.Background(), "x", "../*"); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("Grep() error = %v, want ErrPathEscape", err)
+	}
+}
+
+func TestLocalSearchTool_GrepSkipsSymlinks(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "sandbox")
+	writeFiles(t, parent, map[string]string{"outside/secret.txt": "TODO: secret\n", "sandbox/notes.txt": "TODO: notes\n"})
+	if err := os.Symlink(filepath.Join(parent, "outside", "secret.txt"), filepath.Join(root, "secret.txt")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(parent, "outside"), filepath.Join(root, "out")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	got, err := NewLocalSearchTool(root).Grep(context.Background(), "TODO", "")
+	if err != nil {
+		t.Fatalf("Grep() error = %v", err)
+	}
+	want := []GrepMatch{{Path: "notes.txt", Line: 1, Text: "TODO: notes"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Grep() = %+v, want %+v, symlinks out of the root skipped", got, want)
+	}
+}
+
+func TestLocalSearchTool_Truncates(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < MaxSearchResults+5; i++ {
+		files[fmt.Sprintf("f%03d.txt", i)] = "match\n"
+	}
+	writeFiles(t, root, files)
+	search := NewLocalSearchTool(root)
+
+	paths, err := search.Glob(context.Background(), "*.txt")
+	if !errors.Is(err, ErrSearchTruncated) || len(paths) != MaxSearchResults {
+		t.Errorf("Glob() = %d paths, %v, want %d and ErrSearchTruncated", len(paths), err, MaxSearchResults)
+	}
+
+	matches, err := search.Grep(context.Background(), "match", "")
+	if !errors.Is(err, ErrSearchTruncated) || len(matches) != MaxSearchResults {
+		t.Errorf("Grep() = %d matches, %v, want %d and ErrSearchTruncated", len(matches), err, MaxSearchResults)
+	}
+
+	out, err := searchOutput(matches, ErrSearchTruncated, func(m GrepMatch) string { return m.Path })
+	if err != nil || !strings.Contains(out, "narrow the search") {
+		t.Errorf("searchOutput() = %q, %v, want a note about the missing results", out, err)
+	}
+}
@@ -0,0 +1,169 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/adamveld12/tai/internal/state"
+)
+
+// DefaultCommandTimeout is how long a single command may run before it's killed
+const DefaultCommandTimeout = 2 * time.Minute
+
+// commandWaitDelay is how long to wait for output after a cancelled command is killed
+const commandWaitDelay = 500 * time.Millisecond
+
+// maxStreamLineLength is the longest line StreamCommand reads, a command writing a longer
+// one is killed
+const maxStreamLineLength = 1 << 20
+
+// ErrCommandDenied is returned when the session's permissions don't allow a command
+var ErrCommandDenied = errors.New("command not permitted")
+
+// LocalShellTool implements ShellTool by running commands with sh in the session's
+// working directory. Every command is checked against the session's permissions first.
+type LocalShellTool struct {
+	dispatcher state.Dispatcher
+	timeout    time.Duration
+}
+
+// NewLocalShellTool creates a LocalShellTool that reads the working directory and
+// permissions from d. A non-positive timeout falls back to DefaultCommandTimeout.
+func NewLocalShellTool(d state.Dispatcher, timeout time.Duration) *LocalShellTool {
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	return &LocalShellTool{dispatcher: d, timeout: timeout}
+}
+
+// RunCommand runs command and returns its combined stdout and stderr. A command that
+// fails returns its output along with an error carrying the exit code.
+func (sh *LocalShellTool) RunCommand(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, sh.timeout)
+	defer cancel()
+
+	cmd, err := sh.command(ctx, command)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := cmd.CombinedOutput()
+	return string(out), commandError(ctx, command, sh.timeout, err)
+}
+
+// StreamCommand runs command and sends each line it writes to stdout on the returned
+// channel as it's written. Lines aren't buffered, a slow reader holds the command up
+// instead. The command and everything it started are killed when ctx is done or the
+// timeout passes, and the channel ends with a status line saying how the command
+// finished, e.g. "[exited with code 0]", before it's closed.
+func (sh *LocalShellTool) StreamCommand(ctx context.Context, command string) (<-chan string, error) {
+	ctx, cancel := context.WithTimeout(ctx, sh.timeout)
+
+	cmd, err := sh.command(ctx, command)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to read output of %q: %w", command, err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start %q: %w", command, err)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		defer cancel()
+
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineLength)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				// the command is being killed, keep reading so it isn't stuck writing
+			}
+		}
+		scanErr := scanner.Err()
+		if scanErr != nil {
+			// nothing reads the rest of the output, so the command would block writing it
+			cancel()
+		}
+
+		status := streamStatus(ctx, sh.timeout, cmd.Wait())
+		if scanErr != nil {
+			status = fmt.Sprintf("[stopped reading output: %v]", scanErr)
+		}
+
+		// the reader may have given up once it cancelled, so don't wait on it for long
+		select {
+		case lines <- status:
+		case <-time.After(commandWaitDelay):
+		}
+	}()
+
+	return lines, nil
+}
+
+// streamStatus is the line StreamCommand ends with, saying how the command finished
+func streamStatus(ctx context.Context, timeout time.Duration, err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Sprintf("[timed out after %s]", timeout)
+	case ctx.Err() != nil:
+		return "[cancelled]"
+	case err == nil:
+		return "[exited with code 0]"
+	case errors.As(err, &exitErr):
+		return fmt.Sprintf("[exited with code %d]", exitErr.ExitCode())
+	default:
+		return fmt.Sprintf("[failed: %v]", err)
+	}
+}
+
+// command builds the exec.Cmd for command once the session's permissions allow it
+func (sh *LocalShellTool) command(ctx context.Context, command string) (*exec.Cmd, error) {
+	s := sh.dispatcher.GetState()
+	if !s.Permissions.IsAllowed(command) {
+		return nil, fmt.Errorf("%w: %s", ErrCommandDenied, command)
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = s.Context.WorkingDirectory
+	killProcessGroup(cmd)
+	// children of sh can hold the output pipes open after it's killed, don't wait on them for long
+	cmd.WaitDelay = commandWaitDelay
+	return cmd, nil
+}
+
+// commandError explains why command failed, including its exit code
+func commandError(ctx context.Context, command string, timeout time.Duration, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%q timed out after %s", command, timeout)
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%q was cancelled: %w", command, ctx.Err())
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("%q exited with code %d: %w", command, exitErr.ExitCode(), err)
+	}
+
+	return fmt.Errorf("failed to run %q: %w", command, err)
+}
@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamveld12/tai/internal/state"
+)
+
+func shellTool(t *testing.T, permissions state.Permissions) (*LocalShellTool, string) {
+	t.Helper()
+	dir := t.TempDir()
+	s := state.NewMemoryState("Test", dir, "test")
+	s.Dispatch(setPermissionsAction{permissions})
+	return NewLocalShellTool(s, time.Second), dir
+}
+
+// setPermissionsAction replaces the session's permissions
+type setPermissionsAction struct {
+	permissions state.Permissions
+}
+
+func (a setPermissionsAction) Execute(s state.AppState) (state.AppState, error) {
+	s.Permissions = a.permissions
+	return s, nil
+}
+
+func TestLocalShellTool_RunCommand(t *testing.T) {
+	sh, dir := shellTool(t, state.Permissions{})
+
+	out, err := sh.RunCommand(context.Background(), "echo hello; pwd")
+	if err != nil {
+		t.Fatalf("RunCommand() error = %v", err)
+	}
+	if out != "hello\n"+dir+"\n" {
+		t.Errorf("RunCommand() = %q, want the echo and the working directory", out)
+	}
+
+	out, err = sh.RunCommand(context.Background(), "echo oops >&2; false")
+	if err == nil || !strings.Contains(err.Error(), "exited with code 1") {
+		t.Errorf("RunCommand(false) error = %v, want the exit code", err)
+	}
+	if out != "oops\n" {
+		t.Errorf("RunCommand() = %q, want stderr in the output", out)
+	}
+}
+
+func TestLocalShellTool_StreamCommand(t *testing.T) {
+	sh, _ := shellTool(t, state.Permissions{})
+
+	lines, err := sh.StreamCommand(context.Background(), "echo one; echo two")
+	if err != nil {
+		t.Fatalf("StreamCommand() error = %v", err)
+	}
+
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	if strings.Join(got, ",") != "one,two,[exited with code 0]" {
+		t.Errorf("StreamCommand() lines = %q, want the output and then the exit code", got)
+	}
+
+	lines, err = sh.StreamCommand(context.Background(), "echo oops; exit 3")
+	if err != nil {
+		t.Fatalf("StreamCommand() error = %v", err)
+	}
+	if got := drain(lines); got[len(got)-1] != "[exited with code 3]" {
+		t.Errorf("StreamCommand() lines = %q, want the failing exit code last", got)
+	}
+}
+
+func TestLocalShellTool_StreamCommandTimeout(t *testing.T) {
+	sh, _ := shellTool(t, state.Permissions{})
+	sh.timeout = 100 * time.Millisecond
+
+	lines, err := sh.StreamCommand(context.Background(), "echo started; sleep 5")
+	if err != nil {
+		t.Fatalf("StreamCommand() error = %v", err)
+	}
+
+	start := time.Now()
+	got := drain(lines)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the command to be killed at the timeout, took %s", elapsed)
+	}
+	if strings.Join(got, ",") != "started,[timed out after 100ms]" {
+		t.Errorf("StreamCommand() lines = %q", got)
+	}
+}
+
+// drain reads lines until the channel is closed
+func drain(lines <-chan string) []string {
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	return got
+}
+
+func TestLocalShellTool_Cancellation(t *testing.T) {
+	sh, _ := shellTool(t, state.Permissions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := sh.RunCommand(ctx, "sleep 5"); err == nil {
+		t.Error("Expected a cancelled command to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("Expected the command to be killed on cancellation, took %s", elapsed)
+	}
+}
+
+func TestLocalShellTool_Permissions(t *testing.T) {
+	sh, _ := shellTool(t, state.Permissions{Allow: []string{"echo", "git status"}, Deny: []string{"echo secret"}})
+	ctx := context.Background()
+
+	if _, err := sh.RunCommand(ctx, "echo hi"); err != nil {
+		t.Errorf("RunCommand(echo hi) error = %v", err)
+	}
+
+	for _, command := range []string{"false", "echo secret", "git push", "echo hi; false", "echo $(false)"} {
+		if _, err := sh.RunCommand(ctx, command); !errors.Is(err, ErrCommandDenied) {
+			t.Errorf("RunCommand(%q) error = %v, want ErrCommandDenied", command, err)
+		}
+		if _, err := sh.StreamCommand(ctx, command); !errors.Is(err, ErrCommandDenied) {
+			t.Errorf("StreamCommand(%q) error = %v, want ErrCommandDenied", command, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/adamveld12/tai/internal/state"
+)
+
+func TestLocalShellTool_StreamCommandCancel(t *testing.T) {
+	sh, _ := shellTool(t, state.Permissions{})
+	sh.timeout = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// sh prints its own pid and a background child's, then both sleep
+	lines, err := sh.StreamCommand(ctx, "sleep 30 & echo $$ $!; wait")
+	if err != nil {
+		t.Fatalf("StreamCommand() error = %v", err)
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(<-lines) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			t.Fatalf("Expected pids, got %q", field)
+		}
+		pids = append(pids, pid)
+	}
+
+	cancel()
+	start := time.Now()
+	got := drain(lines)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the command to be killed on cancellation, took %s", elapsed)
+	}
+	if len(got) != 1 || got[0] != "[cancelled]" {
+		t.Errorf("StreamCommand() lines after cancelling = %q, want the cancelled status", got)
+	}
+
+	for _, pid := range pids {
+		if !processGone(pid, 2*time.Second) {
+			t.Errorf("Expected process %d to be killed and reaped", pid)
+		}
+	}
+}
+
+// processGone reports whether the process pid exits and is reaped within timeout
+func processGone(pid int, timeout time.Duration) bool {
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+			return true
+		}
+		// an orphan left for init to reap still answers signals, /proc shows it's dead
+		if stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat"); err == nil && strings.Contains(string(stat), ") Z ") {
+			return true
+		}
+	}
+	return false
+}
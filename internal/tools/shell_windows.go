@@ -0,0 +1,7 @@
+package tools
+
+import "os/exec"
+
+// killProcessGroup leaves cmd as it is, Windows has no process groups to signal so only
+// the command itself is killed when its context is done
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,295 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// DefaultFetchTimeout is how long fetching a single URL may take, redirects included
+const DefaultFetchTimeout = 30 * time.Second
+
+// DefaultMaxFetchBytes is how much of a response body is read, the rest is cut off
+const DefaultMaxFetchBytes = 512 << 10
+
+// maxRedirects is how many redirects are followed before giving up
+const maxRedirects = 5
+
+// ErrURLNotAllowed is returned for URLs that aren't http(s) or that point at a
+// loopback, private or link-local address
+var ErrURLNotAllowed = errors.New("url not allowed")
+
+// ErrUnsupportedContent is returned for responses that aren't text, like images
+var ErrUnsupportedContent = errors.New("unsupported content type")
+
+// webTool implements WebTool over HTTP. Every connection is checked against the address
+// it's actually made to, so neither redirects nor DNS can point it at the local network.
+type webTool struct {
+	client   *http.Client
+	timeout  time.Duration
+	maxBytes int64
+
+	// blocked reports whether connecting to ip isn't allowed, replaced in tests so they
+	// can fetch from httptest servers on the loopback address
+	blocked func(ip net.IP) bool
+}
+
+// NewWebTool creates a WebTool. Non-positive timeout and maxBytes fall back to
+// DefaultFetchTimeout and DefaultMaxFetchBytes.
+func NewWebTool(timeout time.Duration, maxBytes int64) WebTool {
+	return newWebTool(timeout, maxBytes)
+}
+
+func newWebTool(timeout time.Duration, maxBytes int64) *webTool {
+	if timeout <= 0 {
+		timeout = DefaultFetchTimeout
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxFetchBytes
+	}
+
+	w := &webTool{timeout: timeout, maxBytes: maxBytes, blocked: isInternalAddress}
+
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || w.blocked(ip) {
+				return fmt.Errorf("%w: %s is a local address", ErrURLNotAllowed, host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// a proxy would be the address checked instead of the page's
+	transport.Proxy = nil
+
+	w.client = &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return checkURL(req.URL)
+		},
+	}
+	return w
+}
+
+// FetchURL fetches rawURL and returns its body as text. HTML is reduced to its readable
+// text, other text is returned as it is. Bodies over the size limit are cut off with a note.
+func (w *webTool) FetchURL(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+	if err := checkURL(u); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+	req.Header.Set("User-Agent", "tai")
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9, */*;q=0.8")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("fetching %s timed out after %s", u, w.timeout)
+		}
+		return "", fmt.Errorf("failed to fetch %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("fetching %s returned %s", u, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, w.maxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", u, err)
+	}
+	truncated := int64(len(body)) > w.maxBytes
+	if truncated {
+		body = body[:w.maxBytes]
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	if mediaType == "" {
+		mediaType = http.DetectContentType(body)
+	}
+	mediaType, _, _ = mime.ParseMediaType(mediaType)
+
+	var text string
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		text = htmlText(string(body))
+	case isTextMediaType(mediaType):
+		text = string(body)
+	default:
+		return "", fmt.Errorf("%w: %s is %s", ErrUnsupportedContent, u, mediaType)
+	}
+
+	if truncated {
+		text += fmt.Sprintf("\n\n[truncated, only the first %d bytes were read]", w.maxBytes)
+	}
+	return text, nil
+}
+
+// checkURL allows only absolute http and https URLs
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: only http and https can be fetched, not %q", ErrURLNotAllowed, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("%w: %q has no host", ErrURLNotAllowed, u.String())
+	}
+	return nil
+}
+
+// isInternalAddress reports whether ip is on the local machine or network, or otherwise
+// not a public address, e.g. the cloud metadata service at 169.254.169.254
+func isInternalAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// isTextMediaType reports whether content of mediaType can be returned to the model as is
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-yaml", "application/yaml":
+		return true
+	}
+	return false
+}
+
+// skippedElements hold no readable text
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Svg: true, atom.Iframe: true, atom.Canvas: true,
+}
+
+// blockElements start on a new line
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Br: true, atom.Dd: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Figcaption: true, atom.Figure: true, atom.Footer: true, atom.Form: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Main: true, atom.Nav: true,
+	atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true, atom.Table: true,
+	atom.Tr: true, atom.Ul: true,
+}
+
+// paragraphElements are followed by a blank line
+var paragraphElements = map[atom.Atom]bool{
+	atom.P: true, atom.Pre: true, atom.Blockquote: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+var (
+	// whitespace is collapsed to a single space outside of <pre>
+	whitespace = regexp.MustCompile(`\s+`)
+	// blankLines matches runs of blank lines, which are collapsed to one
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlText returns the readable text of an HTML document, one block per line. Scripts,
+// styles and the head are dropped, and whitespace is collapsed outside of <pre>.
+func htmlText(doc string) string {
+	root, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		return doc
+	}
+
+	var b strings.Builder
+	var pre int
+	newline := func() {
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			if pre > 0 {
+				b.WriteString(n.Data)
+				return
+			}
+
+			text := whitespace.ReplaceAllString(n.Data, " ")
+			if out := b.String(); out == "" || strings.HasSuffix(out, "\n") || strings.HasSuffix(out, " ") {
+				text = strings.TrimLeft(text, " ")
+			}
+			b.WriteString(text)
+			return
+		case html.ElementNode:
+			if skippedElements[n.DataAtom] {
+				return
+			}
+		}
+
+		block := n.Type == html.ElementNode && blockElements[n.DataAtom]
+		if block {
+			newline()
+			if n.DataAtom == atom.Li {
+				b.WriteString("- ")
+			}
+			if n.DataAtom == atom.Pre {
+				pre++
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+
+		if block {
+			if n.DataAtom == atom.Pre {
+				pre--
+			}
+			newline()
+			if paragraphElements[n.DataAtom] {
+				b.WriteString("\n")
+			}
+		}
+	}
+	walk(root)
+
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loopbackWebTool returns a webTool that may fetch from httptest servers
+func loopbackWebTool(maxBytes int64) *webTool {
+	w := newWebTool(time.Second, maxBytes)
+	w.blocked = func(ip net.IP) bool { return !ip.IsLoopback() && isInternalAddress(ip) }
+	return w
+}
+
+func TestWebTool_FetchURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<!doctype html><html><head><title>Docs</title><style>body{color:red}</style></head>
+<body><script>alert("hi")</script>
+<h1>Getting   started</h1>
+<p>Install the <b>tool</b> and
+run it.</p>
+<ul><li>one</li><li>two</li></ul>
+<pre>func main() {
+    run()
+}</pre>
+</body></html>`))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("<b>not html</b>\n"))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/plain", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	web := loopbackWebTool(0)
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "html is reduced to text",
+			path: "/docs",
+			want: "Getting started\n\nInstall the tool and run it.\n\n- one\n- two\nfunc main() {\n    run()\n}",
+		},
+		{name: "other text is returned as is", path: "/plain", want: "<b>not html</b>\n"},
+		{name: "redirects are followed", path: "/moved", want: "<b>not html</b>\n"},
+		{name: "redirects are bounded", path: "/loop", wantErr: "stopped after 5 redirects"},
+		{name: "binary content is refused", path: "/image", wantErr: "unsupported content type"},
+		{name: "errors are reported", path: "/missing", wantErr: "404 Not Found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := web.FetchURL(context.Background(), server.URL+tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("FetchURL() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchURL() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FetchURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebTool_TruncatesLargeBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("a", 100)))
+	}))
+	defer server.Close()
+
+	got, err := loopbackWebTool(10).FetchURL(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("FetchURL() error = %v", err)
+	}
+	if !strings.HasPrefix(got, strings.Repeat("a", 10)+"\n") || strings.Contains(got, strings.Repeat("a", 11)) {
+		t.Errorf("FetchURL() = %q, want the first 10 bytes", got)
+	}
+	if !strings.Contains(got, "truncated") {
+		t.Errorf("FetchURL() = %q, want a note that it was truncated", got)
+	}
+}
+
+func TestWebTool_BlocksInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request should never reach a loopback server")
+	}))
+	defer server.Close()
+
+	// a public page redirecting to the local network is caught on the redirect's connection
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	web := newWebTool(time.Second, 0)
+	for _, url := range []string{
+		server.URL,
+		strings.Replace(server.URL, "127.0.0.1", "localhost", 1),
+		"http://10.0.0.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]:1/",
+	} {
+		if _, err := web.FetchURL(context.Background(), url); !errors.Is(err, ErrURLNotAllowed) {
+			t.Errorf("FetchURL(%s) error = %v, want %v", url, err, ErrURLNotAllowed)
+		}
+	}
+
+	// only the first hop is allowed onto the loopback address
+	hops := 0
+	web.blocked = func(ip net.IP) bool {
+		hops++
+		return hops > 1
+	}
+	web.client.Transport.(*http.Transport).DisableKeepAlives = true
+	if _, err := web.FetchURL(context.Background(), redirect.URL); !errors.Is(err, ErrURLNotAllowed) {
+		t.Errorf("FetchURL(redirect) error = %v, want %v", err, ErrURLNotAllowed)
+	}
+}
+
+func TestWebTool_RejectsOtherSchemes(t *testing.T) {
+	web := NewWebTool(time.Second, 0)
+	for _, url := range []string{"file:///etc/passwd", "ftp://example.com/file", "gopher://example.com", "example.com/docs", "http://"} {
+		if _, err := web.FetchURL(context.Background(), url); !errors.Is(err, ErrURLNotAllowed) {
+			t.Errorf("FetchURL(%s) error = %v, want %v", url, err, ErrURLNotAllowed)
+		}
+	}
+}
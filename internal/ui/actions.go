@@ -2,15 +2,156 @@ package ui
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/adamveld12/tai/internal/llm"
 	"github.com/adamveld12/tai/internal/state"
 )
 
-func NewMessage(d state.Dispatcher, provider llm.Provider, role state.Role, content string) error {
+// DefaultMaxToolIterations bounds how many rounds of tool calls a single turn may make
+const DefaultMaxToolIterations = 10
+
+// AgentOption configures how NewMessage runs a turn
+type AgentOption func(*agentConfig)
+
+type agentConfig struct {
+	tools             ToolExecutor
+	maxToolIterations int
+	approve           ToolApprover
+	planReview        bool
+	contextBudget     int
+	ctx               context.Context
+	wg                *sync.WaitGroup
+}
+
+// ToolApprover asks the user whether to run a tool call, blocking until they answer
+type ToolApprover func(ctx context.Context, call state.ToolCall) bool
+
+// WithToolApprover asks approve before running tool calls the current mode doesn't allow
+// outright. Without one those calls are declined.
+func WithToolApprover(approve ToolApprover) AgentOption {
+	return func(c *agentConfig) {
+		c.approve = approve
+	}
+}
+
+// WithPlanReview proposes every round of tool calls with a call that needs approval as
+// one plan, see PlanProposedAction, instead of asking about each call. None of the calls
+// run until the plan is approved, and none run at all when it's rejected.
+func WithPlanReview(enabled bool) AgentOption {
+	return func(c *agentConfig) {
+		c.planReview = enabled
+	}
+}
+
+// WithContextBudget drops the oldest messages from each request until its estimated
+// prompt fits in tokens, see llm.TruncateMessages. Zero sends the whole conversation.
+func WithContextBudget(tokens int) AgentOption {
+	return func(c *agentConfig) {
+		c.contextBudget = tokens
+	}
+}
+
+// WithContext runs the turn under ctx. Cancelling it stops the reply being streamed, what
+// was streamed so far is kept and the turn completes as cancelled.
+func WithContext(ctx context.Context) AgentOption {
+	return func(c *agentConfig) {
+		c.ctx = ctx
+	}
+}
+
+// WithWaitGroup adds the turn's goroutine to wg, so a caller shutting down can wait for
+// it to dispatch its last action before saving the conversation
+func WithWaitGroup(wg *sync.WaitGroup) AgentOption {
+	return func(c *agentConfig) {
+		c.wg = wg
+	}
+}
+
+// toolGate is what the agent does with a tool call
+type toolGate int
+
+const (
+	// toolRun runs the call
+	toolRun toolGate = iota
+	// toolAsk runs the call only if the user approves it
+	toolAsk
+	// toolPropose shows the call to the user without running it
+	toolPropose
+)
+
+// gateToolCall decides how a tool call is handled in mode: plan mode only proposes calls,
+// except to tools that preview their changes, execute mode runs read-only tools and asks
+// before the rest, and yolo mode runs everything
+func gateToolCall(mode state.Mode, readOnly, previews bool) toolGate {
+	switch mode {
+	case state.YoloMode:
+		return toolRun
+	case state.ExecuteMode:
+		if readOnly {
+			return toolRun
+		}
+		return toolAsk
+	case state.PlanMode:
+		if previews {
+			return toolRun
+		}
+		return toolPropose
+	default:
+		return toolPropose
+	}
+}
+
+// planReview is the user's answer to a round of tool calls proposed as a plan
+type planReview int
+
+const (
+	// planNotReviewed asks about each call on its own, if it has to
+	planNotReviewed planReview = iota
+	// planApproved runs every call the mode allows, without asking again
+	planApproved
+	// planRejected runs none of the calls
+	planRejected
+)
+
+// Tool results the model gets back for calls that weren't run
+const (
+	toolProposedResult = "not run: tai is in plan mode, so the call was shown to the user for approval instead. Describe the plan and wait for the user to switch to execute mode."
+	toolDeclinedResult = "not run: the user declined this tool call"
+)
+
+// WithToolExecutor runs the tool calls the model makes with tools and sends the
+// results back to the model until it stops calling tools
+func WithToolExecutor(tools ToolExecutor) AgentOption {
+	return func(c *agentConfig) {
+		c.tools = tools
+	}
+}
+
+// WithMaxToolIterations caps the follow-up completions a turn makes to run tool calls.
+// A non-positive n falls back to DefaultMaxToolIterations.
+func WithMaxToolIterations(n int) AgentOption {
+	return func(c *agentConfig) {
+		if n > 0 {
+			c.maxToolIterations = n
+		}
+	}
+}
+
+// NewMessage adds content to the conversation and streams the model's reply. When a
+// tool executor is configured, tool calls in the reply are run and their results sent
+// back in follow-up completions until the model answers without calling tools.
+func NewMessage(d state.Dispatcher, provider llm.Provider, role state.Role, content string, opts ...AgentOption) error {
+	cfg := agentConfig{maxToolIterations: DefaultMaxToolIterations, ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	d.Dispatch(ChatCompletionStartedAction{})
 
 	d.Dispatch(MessageAction{
@@ -19,73 +160,440 @@ func NewMessage(d state.Dispatcher, provider llm.Provider, role state.Role, cont
 		Timestamp: time.Now(),
 	})
 
+	if cfg.wg != nil {
+		cfg.wg.Add(1)
+	}
 	go func() {
-		s := d.GetState()
-		req := llm.ChatRequest{
-			Messages:     s.Context.Messages,
-			Model:        s.Model.Name,
-			SystemPrompt: state.SystemPrompt(s),
+		if cfg.wg != nil {
+			defer cfg.wg.Done()
 		}
-
-		startedAt := time.Now()
-		d.Dispatch(MessageAction{
-			Role:      state.RoleAssistant,
-			Timestamp: startedAt,
+		ctx := llm.WithRetryFunc(cfg.ctx, func(attempt, maxAttempts int, _ error) {
+			d.Dispatch(AgentStatusAction{Activity: fmt.Sprintf("retrying (%d/%d)", attempt, maxAttempts)})
 		})
 
-		// res, err := provider.ChatCompletion(context.Background(), req)
-		res, err := provider.StreamChatCompletion(context.Background(), req)
+		for iteration := 1; ; iteration++ {
+			toolCalls, usage, err := streamCompletion(ctx, d, provider, cfg)
+			if ctx.Err() != nil {
+				d.Dispatch(ChatCompletionCompletedAction{Cancelled: true, Usage: usage})
+				return
+			}
+			if err != nil || cfg.tools == nil || len(toolCalls) == 0 {
+				d.Dispatch(ChatCompletionCompletedAction{Error: err, Usage: usage})
+				return
+			}
 
-		if err != nil {
-			log.Fatalf("Failed to get chat completion: %v", err)
-		}
+			if iteration >= cfg.maxToolIterations {
+				d.Dispatch(ChatCompletionCompletedAction{Error: fmt.Errorf("stopped after %d rounds of tool calls", iteration), Usage: usage})
+				return
+			}
 
-		for chunk := range res {
-			if chunk.Error != nil {
-				break
-			} else {
-				d.Dispatch(MessageChunkAction{
-					Message: state.Message{
-						Role:      state.RoleAssistant,
-						Content:   chunk.Delta,
-						Timestamp: startedAt,
-						Usage: state.TokenUsage{
-							Prompt:     chunk.Usage.PromptTokens,
-							Completion: chunk.Usage.CompletionTokens,
-							Total:      chunk.Usage.TotalTokens,
-						},
-					},
+			review := reviewPlan(ctx, d, cfg, toolCalls)
+			for _, tc := range toolCalls {
+				output := runToolCall(ctx, d, cfg, tc, review)
+				d.Dispatch(MessageAction{
+					Role:      state.RoleTool,
+					Content:   output,
+					ToolCalls: []state.ToolCall{tc},
+					Timestamp: time.Now(),
 				})
 			}
 		}
-
-		d.Dispatch(ChatCompletionCompletedAction{})
 	}()
 
 	return nil
 }
 
+// reviewPlan proposes toolCalls as a plan when plan review is on and one of them needs
+// approval, then waits for the user to approve or reject it
+func reviewPlan(ctx context.Context, d state.Dispatcher, cfg agentConfig, toolCalls []state.ToolCall) planReview {
+	if !cfg.planReview {
+		return planNotReviewed
+	}
+
+	mode := d.GetState().Context.Mode
+	needsApproval := slices.ContainsFunc(toolCalls, func(tc state.ToolCall) bool {
+		name := tc.Function.Name
+		return gateToolCall(mode, cfg.tools.ReadOnly(name), cfg.tools.Previews(name)) == toolAsk
+	})
+	if !needsApproval {
+		return planNotReviewed
+	}
+
+	// listen before proposing so an answer can't arrive unseen
+	answers := make(chan planReview, 1)
+	unsubscribe := d.OnStateChange(func(action state.Action, _, _ state.AppState) {
+		var answer planReview
+		switch action.(type) {
+		case ApprovePlanAction:
+			answer = planApproved
+		case RejectPlanAction:
+			answer = planRejected
+		default:
+			return
+		}
+
+		select {
+		case answers <- answer:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	d.Dispatch(PlanProposedAction{ToolCalls: toolCalls})
+	select {
+	case answer := <-answers:
+		return answer
+	case <-ctx.Done():
+		d.Dispatch(RejectPlanAction{})
+		return planRejected
+	}
+}
+
+// runToolCall runs tc if the current mode allows it, asking the user first when it has to
+// unless review already answered for the whole round, and returns the output the model
+// gets back
+func runToolCall(ctx context.Context, d state.Dispatcher, cfg agentConfig, tc state.ToolCall, review planReview) string {
+	name := tc.Function.Name
+	gate := gateToolCall(d.GetState().Context.Mode, cfg.tools.ReadOnly(name), cfg.tools.Previews(name))
+	if gate == toolPropose {
+		return toolProposedResult
+	}
+	if review == planRejected {
+		return toolDeclinedResult
+	}
+
+	if gate == toolAsk && review != planApproved {
+		if cfg.approve == nil {
+			return toolDeclinedResult
+		}
+
+		d.Dispatch(ToolApprovalRequestedAction{ToolCall: tc})
+		approved := cfg.approve(ctx, tc)
+		d.Dispatch(ToolApprovalResolvedAction{})
+		if !approved {
+			return toolDeclinedResult
+		}
+	}
+
+	d.Dispatch(AgentStatusAction{Activity: "running " + name})
+	output, err := cfg.tools.Call(ctx, name, tc.Function.Arguments)
+	if err != nil {
+		// the model sees the failure and can correct itself
+		output = fmt.Sprintf("error: %v", err)
+	}
+	return output
+}
+
+// streamCompletion streams the model's reply to the conversation into a new assistant
+// message and returns the tool calls it made along with the last usage the provider
+// reported for it. The model is offered the tools, if any, and the conversation is
+// truncated to the context budget.
+func streamCompletion(ctx context.Context, d state.Dispatcher, provider llm.Provider, cfg agentConfig) ([]state.ToolCall, state.TokenUsage, error) {
+	var usage state.TokenUsage
+
+	// cancelled while tools were running, there's nothing to start
+	if err := ctx.Err(); err != nil {
+		return nil, usage, err
+	}
+
+	req := chatRequest(d.GetState())
+	if cfg.tools != nil {
+		req.Tools = cfg.tools.Tools()
+	}
+
+	messages := llm.TruncateMessages(req.SystemPrompt, req.Messages, cfg.contextBudget, nil)
+	truncated := len(messages) != len(req.Messages)
+	req.Messages = messages
+
+	startedAt := time.Now()
+	messageID := state.NewMessageID()
+	d.Dispatch(MessageAction{
+		ID:        messageID,
+		Role:      state.RoleAssistant,
+		Timestamp: startedAt,
+	})
+
+	d.Dispatch(AgentStatusAction{Activity: "thinking"})
+	res, trimmed, err := streamWithTrimFallback(ctx, provider, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			d.Dispatch(MessageFinishedAction{ID: messageID, FinishReason: FinishReasonCancelled})
+		}
+		return nil, usage, err
+	}
+	d.Dispatch(AgentStatusAction{Activity: "responding"})
+
+	if trimmed || truncated {
+		d.Dispatch(ContextTrimmedAction{ID: messageID})
+	}
+
+	var finishReason string
+	var toolCalls []state.ToolCall
+	var streamErr error
+	for chunk := range res {
+		if chunk.FinishReason != "" {
+			finishReason = chunk.FinishReason
+		}
+
+		if chunk.Error != nil {
+			streamErr = chunk.Error
+			break
+		}
+
+		// usage usually only arrives with the last chunk, zero on the others
+		chunkUsage := tokenUsage(chunk.Usage)
+		if chunkUsage != (state.TokenUsage{}) {
+			usage = chunkUsage
+		}
+
+		toolCalls = append(toolCalls, chunk.ToolCalls...)
+		d.Dispatch(MessageChunkAction{
+			Message: state.Message{
+				ID:        messageID,
+				Role:      state.RoleAssistant,
+				Content:   chunk.Delta,
+				Timestamp: startedAt,
+				Usage:     chunkUsage,
+			},
+		})
+	}
+
+	// stopped by the user, the partial reply is kept but its tool calls aren't run
+	if err := ctx.Err(); err != nil {
+		d.Dispatch(MessageFinishedAction{ID: messageID, FinishReason: FinishReasonCancelled})
+		return nil, usage, err
+	}
+
+	if len(toolCalls) > 0 {
+		d.Dispatch(MessageToolCallsAction{ID: messageID, ToolCalls: toolCalls})
+	}
+
+	if finishReason != "" {
+		d.Dispatch(MessageFinishedAction{ID: messageID, FinishReason: finishReason})
+	}
+
+	return toolCalls, usage, streamErr
+}
+
+// tokenUsage converts usage reported by a provider, filling in the total when only the
+// prompt and completion counts were given
+func tokenUsage(u llm.TokenUsage) state.TokenUsage {
+	usage := state.TokenUsage{Prompt: u.PromptTokens, Completion: u.CompletionTokens, Total: u.TotalTokens}
+	if usage.Total == 0 {
+		usage.Total = usage.Prompt + usage.Completion
+	}
+	return usage
+}
+
+// streamWithTrimFallback starts streaming req. If the provider rejects it for not
+// fitting in the context window, it retries once without the oldest messages and
+// reports that the context was trimmed.
+func streamWithTrimFallback(ctx context.Context, provider llm.Provider, req llm.ChatRequest) (<-chan llm.ChatStreamChunk, bool, error) {
+	res, err := openStream(ctx, provider, req)
+	if !llm.IsContextLengthError(err) {
+		return res, false, err
+	}
+
+	messages := llm.TrimOldestMessages(req.Messages)
+	if len(messages) == len(req.Messages) {
+		return nil, false, err
+	}
+
+	req.Messages = messages
+	res, err = openStream(ctx, provider, req)
+	return res, true, err
+}
+
+// openStream starts streaming req and waits for the first chunk, so errors the
+// provider only reports on the stream are returned like errors starting it
+func openStream(ctx context.Context, provider llm.Provider, req llm.ChatRequest) (<-chan llm.ChatStreamChunk, error) {
+	res, err := provider.StreamChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	first, ok := <-res
+	if ok && first.Error != nil {
+		// let the provider finish sending so its goroutine can exit
+		go func() {
+			for range res {
+			}
+		}()
+		return nil, first.Error
+	}
+
+	out := make(chan llm.ChatStreamChunk)
+	go func() {
+		defer close(out)
+		if !ok {
+			return
+		}
+		out <- first
+		for chunk := range res {
+			out <- chunk
+		}
+	}()
+
+	return out, nil
+}
+
+// chatRequest builds the request for the conversation in s using the active model parameters
+func chatRequest(s state.AppState) llm.ChatRequest {
+	params := s.Model.Effective()
+	return llm.ChatRequest{
+		Messages:     s.Context.Messages,
+		Model:        s.Model.Name,
+		SystemPrompt: state.SystemPrompt(s),
+		Temperature:  params.Temperature,
+		TopP:         params.TopP,
+		MaxTokens:    params.MaxTokens,
+
+		PresencePenalty:  params.PresencePenalty,
+		FrequencyPenalty: params.FrequencyPenalty,
+	}
+}
+
 type MessageChunkAction struct {
 	state.Message
 }
 
 func (a MessageChunkAction) Execute(s state.AppState) (state.AppState, error) {
-	// find last assistant message with same ID and append to it
-	for idx, msg := range s.Context.Messages {
-		if msg.Role == a.Role && msg.Timestamp.Equal(a.Timestamp) {
-			a.Content = fmt.Sprintf("%s%s", msg.Content, a.Content)
-			s.Context.Messages = append(s.Context.Messages[:idx], a.Message)
-			s.Context.Updated = time.Now()
-			break
+	if a.ID == "" {
+		return s, nil
+	}
+
+	// find the last message with the same ID and append to it
+	for idx := len(s.Context.Messages) - 1; idx >= 0; idx-- {
+		msg := s.Context.Messages[idx]
+		if msg.ID != a.ID || msg.Role != a.Role {
+			continue
+		}
+
+		// keep what was recorded on the message, e.g. ContextTrimmed, and append the delta
+		msg.Content = fmt.Sprintf("%s%s", msg.Content, a.Content)
+
+		// usage is reported as the running count for the reply, so only the change since
+		// the last report is added to the session totals. Chunks without usage keep it.
+		if a.Usage != (state.TokenUsage{}) {
+			usage := a.Usage
+			if usage.Total == 0 {
+				usage.Total = usage.Prompt + usage.Completion
+			}
+			s.Context.PromptTokens += usage.Prompt - msg.Usage.Prompt
+			s.Context.CompletionTokens += usage.Completion - msg.Usage.Completion
+			msg.Usage = usage
+		}
+
+		// copy so earlier snapshots of the state keep their own history
+		messages := make([]state.Message, len(s.Context.Messages))
+		copy(messages, s.Context.Messages)
+		messages[idx] = msg
+
+		s.Context.Messages = messages
+		s.Context.Updated = time.Now()
+		break
+	}
+
+	return s, nil
+}
+
+// MessageToolCallsAction records the tool calls the model made in the message with ID
+type MessageToolCallsAction struct {
+	ID        string
+	ToolCalls []state.ToolCall
+}
+
+func (a MessageToolCallsAction) Execute(s state.AppState) (state.AppState, error) {
+	for idx := len(s.Context.Messages) - 1; idx >= 0; idx-- {
+		if s.Context.Messages[idx].ID != a.ID {
+			continue
 		}
+
+		messages := make([]state.Message, len(s.Context.Messages))
+		copy(messages, s.Context.Messages)
+		messages[idx].ToolCalls = append(append([]state.ToolCall{}, messages[idx].ToolCalls...), a.ToolCalls...)
+
+		s.Context.Messages = messages
+		s.Context.Updated = time.Now()
+		break
 	}
 
 	return s, nil
 }
 
+// MessageFinishedAction records why the model stopped generating the message with ID
+type MessageFinishedAction struct {
+	ID           string
+	FinishReason string
+}
+
+func (a MessageFinishedAction) Execute(s state.AppState) (state.AppState, error) {
+	for idx := len(s.Context.Messages) - 1; idx >= 0; idx-- {
+		if s.Context.Messages[idx].ID != a.ID {
+			continue
+		}
+
+		messages := make([]state.Message, len(s.Context.Messages))
+		copy(messages, s.Context.Messages)
+		messages[idx].FinishReason = a.FinishReason
+
+		s.Context.Messages = messages
+		s.Context.Updated = time.Now()
+		break
+	}
+
+	return s, nil
+}
+
+// ContextTrimmedAction marks the message with ID as answering a request that was sent
+// without the oldest messages, to fit the context budget or the context window
+type ContextTrimmedAction struct {
+	ID string
+}
+
+func (a ContextTrimmedAction) Execute(s state.AppState) (state.AppState, error) {
+	for idx := len(s.Context.Messages) - 1; idx >= 0; idx-- {
+		if s.Context.Messages[idx].ID != a.ID {
+			continue
+		}
+
+		messages := make([]state.Message, len(s.Context.Messages))
+		copy(messages, s.Context.Messages)
+		messages[idx].ContextTrimmed = true
+
+		s.Context.Messages = messages
+		break
+	}
+
+	return s, nil
+}
+
+// FinishReasonCancelled is recorded on a reply the user stopped before it finished
+const FinishReasonCancelled = "cancelled"
+
+// ContextTrimmedNotice is shown on replies to a request that had to be trimmed to fit
+const ContextTrimmedNotice = "(trimmed context to fit)"
+
+// FinishNotice explains a finish reason that the user should know about, such as
+// output blocked by a content filter. It's empty for reasons that need no explanation.
+func FinishNotice(finishReason string) string {
+	switch finishReason {
+	case llm.FinishReasonContentFilter:
+		return "response blocked by content filter"
+	case FinishReasonCancelled:
+		return "stopped, the reply was cancelled"
+	default:
+		return ""
+	}
+}
+
 type MessageAction state.Message
 
 func (a MessageAction) Execute(s state.AppState) (state.AppState, error) {
+	if a.ID == "" {
+		a.ID = state.NewMessageID()
+	}
+
 	s.Context.Messages = append(s.Context.Messages, state.Message(a))
 	s.Context.Updated = time.Now()
 	return s, nil
@@ -97,39 +605,283 @@ func ClearMessages(d state.Dispatcher) {
 
 type ClearMessagesAction struct{}
 
+// SwitchThemeAction changes the UI theme. Screens repaint with the new styles when they receive it.
 type SwitchThemeAction struct {
 	Name string
 }
 
+func (a SwitchThemeAction) Execute(s state.AppState) (state.AppState, error) {
+	if err := ThemeManagerInstance.SetTheme(a.Name); err != nil {
+		return s, err
+	}
+
+	refreshElementStyles()
+	return s, nil
+}
+
 func (a ClearMessagesAction) Execute(s state.AppState) (state.AppState, error) {
 	s.Context.Messages = []state.Message{}
 	s.Context.Updated = time.Now()
 	return s, nil
 }
 
+// RecordInputAction adds Input to the input history, keeping the newest DefaultInputHistorySize
+type RecordInputAction struct {
+	Input string
+}
+
+func (a RecordInputAction) Execute(s state.AppState) (state.AppState, error) {
+	history := s.Context.InputHistory
+	if a.Input == "" || (len(history) > 0 && history[len(history)-1] == a.Input) {
+		return s, nil
+	}
+
+	history = append(slices.Clone(history), a.Input)
+	if len(history) > DefaultInputHistorySize {
+		history = history[len(history)-DefaultInputHistorySize:]
+	}
+	s.Context.InputHistory = history
+	return s, nil
+}
+
+// ErrNothingToRetry is returned when the conversation doesn't end in a reply that can be regenerated
+var ErrNothingToRetry = errors.New("the last message isn't from the assistant")
+
+// retryPoint returns the index of the user message the last assistant reply answers.
+// The reply and any tool calls it made are everything after it.
+func retryPoint(messages []state.Message) (int, error) {
+	if len(messages) == 0 || messages[len(messages)-1].Role != state.RoleAssistant {
+		return 0, ErrNothingToRetry
+	}
+
+	for idx := len(messages) - 1; idx >= 0; idx-- {
+		if messages[idx].Role == state.RoleUser {
+			return idx, nil
+		}
+	}
+	return 0, ErrNothingToRetry
+}
+
+// RetryAction removes the last assistant reply, with the tool calls it made and the user
+// message it answered, so that message can be sent again for a new reply
+type RetryAction struct{}
+
+func (a RetryAction) Execute(s state.AppState) (state.AppState, error) {
+	idx, err := retryPoint(s.Context.Messages)
+	if err != nil {
+		return s, err
+	}
+
+	s.Context.Messages = slices.Clone(s.Context.Messages[:idx])
+	s.Context.Updated = time.Now()
+	return s, nil
+}
+
+// SetPersonaAction swaps the agent's persona name and its optional prompt layer.
+// The conversation history is left untouched.
+type SetPersonaAction struct {
+	Name   string
+	Prompt string
+}
+
+func (a SetPersonaAction) Execute(s state.AppState) (state.AppState, error) {
+	if strings.TrimSpace(a.Name) == "" {
+		return s, fmt.Errorf("persona name cannot be empty")
+	}
+
+	s.Context.AgentName = a.Name
+	s.Context.PersonaPrompt = a.Prompt
+	return s, nil
+}
+
+// SetSystemPromptAction replaces the user's system prompt, the part of the effective
+// prompt that state.SystemPrompt wraps in its template
+type SetSystemPromptAction struct {
+	Prompt string
+}
+
+func (a SetSystemPromptAction) Execute(s state.AppState) (state.AppState, error) {
+	s.Context.SystemPrompt = a.Prompt
+	return s, nil
+}
+
+// ToolApprovalRequestedAction marks a tool call as waiting on the user's approval
+type ToolApprovalRequestedAction struct {
+	state.ToolCall
+}
+
+func (a ToolApprovalRequestedAction) Execute(s state.AppState) (state.AppState, error) {
+	tc := a.ToolCall
+	s.Status.PendingToolCall = &tc
+	return s, nil
+}
+
+// ToolApprovalResolvedAction clears the tool call waiting on approval once the user answers
+type ToolApprovalResolvedAction struct{}
+
+func (a ToolApprovalResolvedAction) Execute(s state.AppState) (state.AppState, error) {
+	s.Status.PendingToolCall = nil
+	return s, nil
+}
+
+// PlanProposedAction shows the round of tool calls the agent wants to make, in order.
+// None of them run until ApprovePlanAction or RejectPlanAction answers it.
+type PlanProposedAction struct {
+	ToolCalls []state.ToolCall
+}
+
+func (a PlanProposedAction) Execute(s state.AppState) (state.AppState, error) {
+	s.Status.PendingPlan = slices.Clone(a.ToolCalls)
+	return s, nil
+}
+
+// ApprovePlanAction lets the agent run the proposed plan
+type ApprovePlanAction struct{}
+
+func (a ApprovePlanAction) Execute(s state.AppState) (state.AppState, error) {
+	s.Status.PendingPlan = nil
+	return s, nil
+}
+
+// RejectPlanAction stops the agent from running any of the proposed plan
+type RejectPlanAction struct{}
+
+func (a RejectPlanAction) Execute(s state.AppState) (state.AppState, error) {
+	s.Status.PendingPlan = nil
+	return s, nil
+}
+
+// AllowAction adds Pattern to the commands tools are allowed to run
+type AllowAction struct {
+	Pattern string
+}
+
+func (a AllowAction) Execute(s state.AppState) (state.AppState, error) {
+	allow, err := addPermissionRule(s.Permissions.Allow, a.Pattern)
+	if err != nil {
+		return s, err
+	}
+
+	s.Permissions.Allow = allow
+	return s, nil
+}
+
+// DenyAction adds Pattern to the commands tools are never allowed to run
+type DenyAction struct {
+	Pattern string
+}
+
+func (a DenyAction) Execute(s state.AppState) (state.AppState, error) {
+	deny, err := addPermissionRule(s.Permissions.Deny, a.Pattern)
+	if err != nil {
+		return s, err
+	}
+
+	s.Permissions.Deny = deny
+	return s, nil
+}
+
+// addPermissionRule returns rules with pattern appended, unless it's already there
+func addPermissionRule(rules []string, pattern string) ([]string, error) {
+	pattern = strings.Join(strings.Fields(pattern), " ")
+	if pattern == "" {
+		return rules, errors.New("permission pattern is empty")
+	}
+
+	if slices.Contains(rules, pattern) {
+		return rules, nil
+	}
+
+	// copy so earlier states don't share the backing array
+	return append(slices.Clone(rules), pattern), nil
+}
+
+// ChatCompletionStartedAction marks a completion as in flight, clearing the error the
+// last one ended with
 type ChatCompletionStartedAction struct{}
 
 func (a ChatCompletionStartedAction) Execute(s state.AppState) (state.AppState, error) {
 	s.Model.Busy = true
+	s.Status.Error = nil
 	return s, nil
 }
 
-type ChatCompletionCompletedAction struct{}
+// ChatCompletionCompletedAction marks the completion as finished. Error is the stream
+// error that ended it early, if any, and is recorded on the state so the UI can show it,
+// a completion that finishes cleanly clears the last one.
+// Cancelled is set when the user stopped it, the reply streamed until then is kept.
+// Usage is the last usage the provider reported for the final reply, zero if it didn't.
+type ChatCompletionCompletedAction struct {
+	Error     error
+	Cancelled bool
+	Usage     state.TokenUsage
+}
 
 func (a ChatCompletionCompletedAction) Execute(s state.AppState) (state.AppState, error) {
 	s.Model.Busy = false
+	s.Status.Activity = ""
+	s.Status.Error = nil
+	if a.Error != nil {
+		s.Status.Error = fmt.Errorf("chat completion failed: %w", a.Error)
+	}
+	return s, nil
+}
+
+// AgentStatusAction records what the agent is doing while a completion is in flight,
+// shown beside the spinner. ChatCompletionCompletedAction clears it.
+type AgentStatusAction struct {
+	Activity string
+}
+
+func (a AgentStatusAction) Execute(s state.AppState) (state.AppState, error) {
+	s.Status.Activity = a.Activity
 	return s, nil
 }
 
+// ChangeProviderAction switches the active provider and model, along with the
+// provider's default parameters. Parameter overrides set by the user are kept.
 type ChangeProviderAction struct {
 	Provider string
 	Name     string
+	Params   state.ModelParams
 }
 
 func (a ChangeProviderAction) Execute(s state.AppState) (state.AppState, error) {
 	s.Model.Provider = a.Provider
 	s.Model.Name = a.Name
-	s.Model.Busy = true
+	s.Model.Params = a.Params
 	return s, nil
+}
+
+// SetModelOverridesAction replaces the user's parameter overrides
+type SetModelOverridesAction struct {
+	Overrides state.ModelParams
+}
 
+func (a SetModelOverridesAction) Execute(s state.AppState) (state.AppState, error) {
+	if err := a.Overrides.Validate(); err != nil {
+		return s, err
+	}
+
+	s.Model.Overrides = a.Overrides
+	return s, nil
 }
+
+// these actions stream a reply in or change settings that undo keeps, so they aren't
+// undo steps of their own, see state.TransientAction
+func (a MessageChunkAction) Transient()            {}
+func (a MessageToolCallsAction) Transient()        {}
+func (a MessageFinishedAction) Transient()         {}
+func (a ContextTrimmedAction) Transient()          {}
+func (a ChatCompletionStartedAction) Transient()   {}
+func (a ChatCompletionCompletedAction) Transient() {}
+func (a AgentStatusAction) Transient()             {}
+func (a ToolApprovalRequestedAction) Transient()   {}
+func (a ToolApprovalResolvedAction) Transient()    {}
+func (a PlanProposedAction) Transient()            {}
+func (a ApprovePlanAction) Transient()             {}
+func (a RejectPlanAction) Transient()              {}
+func (a RecordInputAction) Transient()             {}
+func (a SwitchThemeAction) Transient()             {}
+func (a ChangeProviderAction) Transient()          {}
+func (a SetModelOverridesAction) Transient()       {}
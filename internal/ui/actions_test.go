@@ -0,0 +1,897 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adamveld12/tai/internal/llm"
+	"github.com/adamveld12/tai/internal/state"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestMessageChunkAction_KeepsTrailingMessages(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	startedAt := time.Now()
+
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "first question"})
+	s.Dispatch(MessageAction{ID: "msg_streaming", Role: state.RoleAssistant, Timestamp: startedAt})
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "follow up"})
+	s.Dispatch(MessageAction{Role: state.RoleAssistant, Content: "another answer", Timestamp: startedAt})
+
+	before := s.GetState()
+	for _, delta := range []string{"Hello", ", ", "world"} {
+		s.Dispatch(MessageChunkAction{Message: state.Message{ID: "msg_streaming", Role: state.RoleAssistant, Content: delta, Timestamp: startedAt}})
+	}
+
+	messages := s.GetState().Context.Messages
+	if len(messages) != 4 {
+		t.Fatalf("Expected 4 messages after streaming, got %d", len(messages))
+	}
+	if messages[1].Content != "Hello, world" {
+		t.Errorf("streamed message = %q, want %q", messages[1].Content, "Hello, world")
+	}
+	if messages[2].Content != "follow up" || messages[3].Content != "another answer" {
+		t.Errorf("trailing messages were changed: %q, %q", messages[2].Content, messages[3].Content)
+	}
+	if before.Context.Messages[1].Content != "" {
+		t.Error("Expected earlier state snapshots to be left untouched")
+	}
+}
+
+// streamProvider replays chunks from StreamChatCompletion
+type streamProvider struct {
+	chunks []llm.ChatStreamChunk
+}
+
+func (p *streamProvider) Name() llm.SupportedProvider { return "stream" }
+
+func (p *streamProvider) ChatCompletion(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *streamProvider) StreamChatCompletion(ctx context.Context, req llm.ChatRequest) (<-chan llm.ChatStreamChunk, error) {
+	ch := make(chan llm.ChatStreamChunk, len(p.chunks))
+	for _, c := range p.chunks {
+		ch <- c
+	}
+	close(ch)
+	return ch, nil
+}
+
+func (p *streamProvider) Models(ctx context.Context) ([]string, error) { return nil, nil }
+
+func TestNewMessage_ContentFilter(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	provider := &streamProvider{chunks: []llm.ChatStreamChunk{
+		{Delta: "Here is how to"},
+		{FinishReason: llm.FinishReasonContentFilter},
+		{Done: true},
+	}}
+
+	done := make(chan struct{})
+	s.OnStateChange(func(a state.Action, _, _ state.AppState) {
+		if _, ok := a.(ChatCompletionCompletedAction); ok {
+			close(done)
+		}
+	})
+
+	if err := NewMessage(s, provider, state.RoleUser, "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the completion to finish")
+	}
+
+	messages := s.GetState().Context.Messages
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+	reply := messages[1]
+	if reply.FinishReason != llm.FinishReasonContentFilter {
+		t.Errorf("FinishReason = %q, want %q", reply.FinishReason, llm.FinishReasonContentFilter)
+	}
+
+	repl := NewREPL(s, provider)
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+	repl.setViewport()
+	if !strings.Contains(repl.viewport.View(), "response blocked by content filter") {
+		t.Error("Expected the content filter notice in the transcript")
+	}
+}
+
+func TestMessageChunkAction_MatchesByID(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	sameInstant := time.Now()
+
+	// two assistant messages created in the same instant used to be indistinguishable
+	s.Dispatch(MessageAction{ID: "first", Role: state.RoleAssistant, Timestamp: sameInstant})
+	s.Dispatch(MessageAction{ID: "second", Role: state.RoleAssistant, Timestamp: sameInstant})
+	s.Dispatch(MessageChunkAction{Message: state.Message{ID: "first", Role: state.RoleAssistant, Content: "one", Timestamp: sameInstant}})
+	s.Dispatch(MessageChunkAction{Message: state.Message{ID: "second", Role: state.RoleAssistant, Content: "two", Timestamp: sameInstant}})
+
+	messages := s.GetState().Context.Messages
+	if messages[0].Content != "one" || messages[1].Content != "two" {
+		t.Errorf("contents = (%q, %q), want (%q, %q)", messages[0].Content, messages[1].Content, "one", "two")
+	}
+
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "no id given"})
+	if id := s.GetState().Context.Messages[2].ID; id == "" {
+		t.Error("Expected MessageAction to assign an ID when none is given")
+	}
+}
+
+func TestNewMessage_StreamErrorSurvives(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	streamErr := errors.New("connection reset by peer")
+	provider := &streamProvider{chunks: []llm.ChatStreamChunk{
+		{Delta: "partial"},
+		{Error: streamErr},
+	}}
+
+	completed := make(chan ChatCompletionCompletedAction, 1)
+	s.OnStateChange(func(a state.Action, _, _ state.AppState) {
+		if c, ok := a.(ChatCompletionCompletedAction); ok {
+			completed <- c
+		}
+	})
+
+	if err := NewMessage(s, provider, state.RoleUser, "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case c := <-completed:
+		if !errors.Is(c.Error, streamErr) {
+			t.Errorf("completed action Error = %v, want %v", c.Error, streamErr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the completion to finish")
+	}
+
+	if err := s.GetState().Status.Error; !errors.Is(err, streamErr) {
+		t.Errorf("Status.Error = %v, want it to wrap %v", err, streamErr)
+	}
+}
+
+func TestChatCompletionActions_ClearError(t *testing.T) {
+	var s state.AppState
+	s, _ = ChatCompletionCompletedAction{Error: errors.New("connection reset")}.Execute(s)
+	if s.Status.Error == nil {
+		t.Fatal("Expected a failed completion to record its error")
+	}
+
+	started, _ := ChatCompletionStartedAction{}.Execute(s)
+	if started.Status.Error != nil {
+		t.Errorf("Status.Error after starting = %v, want it cleared", started.Status.Error)
+	}
+
+	completed, _ := ChatCompletionCompletedAction{}.Execute(s)
+	if completed.Status.Error != nil {
+		t.Errorf("Status.Error after a clean completion = %v, want it cleared", completed.Status.Error)
+	}
+}
+
+// contextLimitProvider rejects requests with more than limit messages for exceeding the context window
+type contextLimitProvider struct {
+	streamProvider
+	limit    int
+	requests []llm.ChatRequest
+}
+
+func (p *contextLimitProvider) StreamChatCompletion(ctx context.Context, req llm.ChatRequest) (<-chan llm.ChatStreamChunk, error) {
+	p.requests = append(p.requests, req)
+	if len(req.Messages) > p.limit {
+		ch := make(chan llm.ChatStreamChunk, 1)
+		ch <- llm.ChatStreamChunk{Error: errors.New("This model's maximum context length is 8192 tokens")}
+		close(ch)
+		return ch, nil
+	}
+	return p.streamProvider.StreamChatCompletion(ctx, req)
+}
+
+func TestNewMessage_RetriesWithTrimmedContext(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	for i := 0; i < 3; i++ {
+		s.Dispatch(MessageAction{Role: state.RoleUser, Content: "earlier question"})
+		s.Dispatch(MessageAction{Role: state.RoleAssistant, Content: "earlier answer"})
+	}
+
+	provider := &contextLimitProvider{
+		streamProvider: streamProvider{chunks: []llm.ChatStreamChunk{{Delta: "fits now"}, {Done: true}}},
+		limit:          4,
+	}
+
+	completed := make(chan ChatCompletionCompletedAction, 1)
+	s.OnStateChange(func(a state.Action, _, _ state.AppState) {
+		if c, ok := a.(ChatCompletionCompletedAction); ok {
+			completed <- c
+		}
+	})
+
+	if err := NewMessage(s, provider, state.RoleUser, "latest question"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case c := <-completed:
+		if c.Error != nil {
+			t.Fatalf("Expected the trimmed retry to succeed, got %v", c.Error)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the completion to finish")
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("Expected 1 retry, got %d requests", len(provider.requests))
+	}
+	retried := provider.requests[1].Messages
+	if len(retried) > provider.limit || retried[len(retried)-1].Content != "latest question" {
+		t.Errorf("Expected the retry to drop the oldest messages and keep the latest, got %d messages", len(retried))
+	}
+
+	messages := s.GetState().Context.Messages
+	reply := messages[len(messages)-1]
+	if reply.Content != "fits now" || !reply.ContextTrimmed {
+		t.Errorf("reply = %q (trimmed %v), want %q marked as trimmed", reply.Content, reply.ContextTrimmed, "fits now")
+	}
+	if len(messages) != 8 {
+		t.Errorf("Expected the conversation history to be kept, got %d messages", len(messages))
+	}
+}
+
+func TestNewMessage_ContextBudget(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	for i := 0; i < 3; i++ {
+		s.Dispatch(MessageAction{Role: state.RoleUser, Content: strings.Repeat("earlier question ", 50)})
+		s.Dispatch(MessageAction{Role: state.RoleAssistant, Content: strings.Repeat("earlier answer ", 50)})
+	}
+
+	provider := &contextLimitProvider{
+		streamProvider: streamProvider{chunks: []llm.ChatStreamChunk{{Delta: "fits"}, {Done: true}}},
+		limit:          100,
+	}
+
+	completed := make(chan ChatCompletionCompletedAction, 1)
+	s.OnStateChange(func(a state.Action, _, _ state.AppState) {
+		if c, ok := a.(ChatCompletionCompletedAction); ok {
+			completed <- c
+		}
+	})
+
+	budget := llm.EstimatePromptTokens(state.SystemPrompt(s.GetState()), nil) + 500
+	if err := NewMessage(s, provider, state.RoleUser, "latest question", WithContextBudget(budget)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case c := <-completed:
+		if c.Error != nil {
+			t.Fatalf("Expected the completion to succeed, got %v", c.Error)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the completion to finish")
+	}
+
+	if len(provider.requests) != 1 {
+		t.Fatalf("Expected a single request, got %d", len(provider.requests))
+	}
+	req := provider.requests[0]
+	if got := llm.EstimatePromptTokens(req.SystemPrompt, req.Messages); got > budget {
+		t.Errorf("request estimated at %d tokens, want at most %d", got, budget)
+	}
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Content != "latest question" {
+		t.Errorf("Expected the latest question to be sent, got %d messages", len(req.Messages))
+	}
+
+	messages := s.GetState().Context.Messages
+	if reply := messages[len(messages)-1]; !reply.ContextTrimmed {
+		t.Error("Expected the reply to be marked as trimmed")
+	}
+	if len(messages) != 8 {
+		t.Errorf("Expected the conversation history to be kept, got %d messages", len(messages))
+	}
+}
+
+// scriptedProvider replies to each request with the next script entry
+type scriptedProvider struct {
+	streamProvider
+	mu       sync.Mutex
+	script   [][]llm.ChatStreamChunk
+	requests []llm.ChatRequest
+}
+
+func (p *scriptedProvider) StreamChatCompletion(ctx context.Context, req llm.ChatRequest) (<-chan llm.ChatStreamChunk, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, req)
+	chunks := p.script[0]
+	if len(p.script) > 1 {
+		p.script = p.script[1:]
+	}
+	return (&streamProvider{chunks: chunks}).StreamChatCompletion(ctx, req)
+}
+
+// recordingExecutor answers every tool call with a fixed output
+type recordingExecutor struct {
+	calls    []string
+	readOnly bool
+	previews bool
+}
+
+func (e *recordingExecutor) Tools() []llm.Tool {
+	return []llm.Tool{{Type: "function", Function: llm.ToolFunction{Name: "weather"}}}
+}
+
+func (e *recordingExecutor) Call(ctx context.Context, name, args string) (string, error) {
+	e.calls = append(e.calls, name+" "+args)
+	return "72°F and sunny", nil
+}
+
+func (e *recordingExecutor) ReadOnly(name string) bool {
+	return e.readOnly
+}
+
+func (e *recordingExecutor) Previews(name string) bool {
+	return e.previews
+}
+
+func waitForCompletion(t *testing.T, s state.Dispatcher, send func()) ChatCompletionCompletedAction {
+	t.Helper()
+
+	completed := make(chan ChatCompletionCompletedAction, 1)
+	s.OnStateChange(func(a state.Action, _, _ state.AppState) {
+		if c, ok := a.(ChatCompletionCompletedAction); ok {
+			completed <- c
+		}
+	})
+
+	send()
+
+	select {
+	case c := <-completed:
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the completion to finish")
+		return ChatCompletionCompletedAction{}
+	}
+}
+
+func TestNewMessage_ToolLoop(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	s.Dispatch(state.SetModeAction{Mode: state.YoloMode})
+	weatherCall := state.ToolCall{ID: "call_1", Type: "function", Function: state.ToolCallFunction{Name: "weather", Arguments: `{"city":"Austin"}`}}
+	provider := &scriptedProvider{script: [][]llm.ChatStreamChunk{
+		{{ToolCalls: []state.ToolCall{weatherCall}}, {FinishReason: llm.FinishReasonToolCalls, Done: true}},
+		{{Delta: "It's 72°F and sunny in Austin."}, {FinishReason: "stop", Done: true}},
+	}}
+	tools := &recordingExecutor{}
+
+	c := waitForCompletion(t, s, func() {
+		if err := NewMessage(s, provider, state.RoleUser, "weather in Austin?", WithToolExecutor(tools)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if c.Error != nil {
+		t.Fatalf("completion error = %v", c.Error)
+	}
+
+	if len(tools.calls) != 1 || tools.calls[0] != `weather {"city":"Austin"}` {
+		t.Errorf("tool calls = %q, want the weather call", tools.calls)
+	}
+
+	messages := s.GetState().Context.Messages
+	if len(messages) != 4 {
+		t.Fatalf("Expected user, tool call, tool result and answer messages, got %d", len(messages))
+	}
+	if len(messages[1].ToolCalls) != 1 || messages[1].ToolCalls[0].ID != "call_1" {
+		t.Errorf("Expected the assistant message to record the tool call, got %+v", messages[1].ToolCalls)
+	}
+	result := messages[2]
+	if result.Role != state.RoleTool || result.Content != "72°F and sunny" || result.ToolCalls[0].ID != "call_1" {
+		t.Errorf("tool result = %+v, want the output for call_1", result)
+	}
+	if messages[3].Content != "It's 72°F and sunny in Austin." {
+		t.Errorf("final answer = %q", messages[3].Content)
+	}
+
+	if len(provider.requests) != 2 || len(provider.requests[1].Messages) != 3 {
+		t.Errorf("Expected the follow-up request to include the tool result")
+	}
+	for _, req := range provider.requests {
+		if len(req.Tools) != 1 || req.Tools[0].Function.Name != "weather" {
+			t.Errorf("Expected every request to offer the tools, got %+v", req.Tools)
+		}
+	}
+}
+
+func TestNewMessage_Activity(t *testing.T) {
+	s := state.NewMemoryStateWithOptions("Test prompt", "/test", "test", state.WithSyncListeners())
+	s.Dispatch(state.SetModeAction{Mode: state.YoloMode})
+	weatherCall := state.ToolCall{ID: "call_1", Type: "function", Function: state.ToolCallFunction{Name: "weather", Arguments: `{"city":"Austin"}`}}
+	provider := &scriptedProvider{script: [][]llm.ChatStreamChunk{
+		{{ToolCalls: []state.ToolCall{weatherCall}}, {FinishReason: llm.FinishReasonToolCalls, Done: true}},
+		{{Delta: "It's sunny."}, {FinishReason: "stop", Done: true}},
+	}}
+
+	var activities []string
+	s.OnStateChange(func(a state.Action, newState, _ state.AppState) {
+		if _, ok := a.(AgentStatusAction); ok {
+			activities = append(activities, newState.Status.Activity)
+		}
+	})
+
+	c := waitForCompletion(t, s, func() {
+		if err := NewMessage(s, provider, state.RoleUser, "weather in Austin?", WithToolExecutor(&recordingExecutor{})); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if c.Error != nil {
+		t.Fatalf("completion error = %v", c.Error)
+	}
+
+	want := []string{"thinking", "responding", "running weather", "thinking", "responding"}
+	if !slices.Equal(activities, want) {
+		t.Errorf("activities = %q, want %q", activities, want)
+	}
+	if activity := s.GetState().Status.Activity; activity != "" {
+		t.Errorf("Expected the activity to be cleared once the completion finished, got %q", activity)
+	}
+}
+
+func TestNewMessage_ToolLoopIsBounded(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	loopCall := state.ToolCall{ID: "call_again", Type: "function", Function: state.ToolCallFunction{Name: "weather", Arguments: `{}`}}
+	provider := &scriptedProvider{script: [][]llm.ChatStreamChunk{
+		{{ToolCalls: []state.ToolCall{loopCall}}, {FinishReason: llm.FinishReasonToolCalls, Done: true}},
+	}}
+	tools := &recordingExecutor{}
+
+	c := waitForCompletion(t, s, func() {
+		if err := NewMessage(s, provider, state.RoleUser, "loop forever", WithToolExecutor(tools), WithMaxToolIterations(3)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if c.Error == nil {
+		t.Error("Expected an error once the iteration cap is hit")
+	}
+	if len(provider.requests) != 3 {
+		t.Errorf("Expected 3 completions, got %d", len(provider.requests))
+	}
+}
+
+func TestGateToolCall(t *testing.T) {
+	tests := []struct {
+		mode     state.Mode
+		readOnly bool
+		previews bool
+		want     toolGate
+	}{
+		{state.PlanMode, true, false, toolPropose},
+		{state.PlanMode, false, false, toolPropose},
+		{state.PlanMode, false, true, toolRun},
+		{state.ExecuteMode, true, false, toolRun},
+		{state.ExecuteMode, false, false, toolAsk},
+		{state.ExecuteMode, false, true, toolAsk},
+		{state.YoloMode, true, false, toolRun},
+		{state.YoloMode, false, false, toolRun},
+		{state.Mode("unknown"), true, false, toolPropose},
+		{state.Mode("unknown"), false, true, toolPropose},
+	}
+
+	for _, tt := range tests {
+		if got := gateToolCall(tt.mode, tt.readOnly, tt.previews); got != tt.want {
+			t.Errorf("gateToolCall(%q, readOnly=%v, previews=%v) = %v, want %v", tt.mode, tt.readOnly, tt.previews, got, tt.want)
+		}
+	}
+}
+
+func TestNewMessage_ToolCallsFollowMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        state.Mode
+		readOnly    bool
+		approver    bool
+		approve     bool
+		wantRun     bool
+		wantAsked   bool
+		wantContent string
+	}{
+		{name: "plan mode proposes", mode: state.PlanMode, approver: true, approve: true, wantContent: toolProposedResult},
+		{name: "execute mode runs read-only tools", mode: state.ExecuteMode, readOnly: true, approver: true, wantRun: true, wantContent: "72°F and sunny"},
+		{name: "execute mode runs approved mutations", mode: state.ExecuteMode, approver: true, approve: true, wantRun: true, wantAsked: true, wantContent: "72°F and sunny"},
+		{name: "execute mode skips declined mutations", mode: state.ExecuteMode, approver: true, wantAsked: true, wantContent: toolDeclinedResult},
+		{name: "execute mode declines without an approver", mode: state.ExecuteMode, wantContent: toolDeclinedResult},
+		{name: "yolo mode runs everything", mode: state.YoloMode, approver: true, wantRun: true, wantContent: "72°F and sunny"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := state.NewMemoryState("Test prompt", "/test", "test")
+			s.Dispatch(state.SetModeAction{Mode: tt.mode})
+
+			call := state.ToolCall{ID: "call_1", Type: "function", Function: state.ToolCallFunction{Name: "weather", Arguments: `{}`}}
+			provider := &scriptedProvider{script: [][]llm.ChatStreamChunk{
+				{{ToolCalls: []state.ToolCall{call}}, {FinishReason: llm.FinishReasonToolCalls, Done: true}},
+				{{Delta: "done"}, {FinishReason: "stop", Done: true}},
+			}}
+			tools := &recordingExecutor{readOnly: tt.readOnly}
+
+			opts := []AgentOption{WithToolExecutor(tools)}
+			var asked *state.ToolCall
+			if tt.approver {
+				opts = append(opts, WithToolApprover(func(ctx context.Context, tc state.ToolCall) bool {
+					asked = s.GetState().Status.PendingToolCall
+					return tt.approve
+				}))
+			}
+
+			waitForCompletion(t, s, func() {
+				if err := NewMessage(s, provider, state.RoleUser, "weather?", opts...); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			if ran := len(tools.calls) > 0; ran != tt.wantRun {
+				t.Errorf("tool ran = %v, want %v", ran, tt.wantRun)
+			}
+			if (asked != nil) != tt.wantAsked {
+				t.Errorf("asked for approval = %v, want %v", asked != nil, tt.wantAsked)
+			}
+			if asked != nil && asked.ID != "call_1" {
+				t.Errorf("pending tool call = %+v, want call_1", asked)
+			}
+			if s.GetState().Status.PendingToolCall != nil {
+				t.Error("Expected the pending tool call to be cleared once answered")
+			}
+
+			result := s.GetState().Context.Messages[2]
+			if result.Role != state.RoleTool || result.Content != tt.wantContent {
+				t.Errorf("tool result = %q, want %q", result.Content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestNewMessage_PlanReview(t *testing.T) {
+	tests := []struct {
+		name        string
+		answer      state.Action
+		wantRun     int
+		wantContent string
+	}{
+		{name: "approved plan runs every call", answer: ApprovePlanAction{}, wantRun: 2, wantContent: "72°F and sunny"},
+		{name: "rejected plan runs nothing", answer: RejectPlanAction{}, wantContent: toolDeclinedResult},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := state.NewMemoryState("Test prompt", "/test", "test")
+			s.Dispatch(state.SetModeAction{Mode: state.ExecuteMode})
+
+			calls := []state.ToolCall{
+				{ID: "call_1", Type: "function", Function: state.ToolCallFunction{Name: "weather", Arguments: `{"city":"Austin"}`}},
+				{ID: "call_2", Type: "function", Function: state.ToolCallFunction{Name: "weather", Arguments: `{"city":"Boston"}`}},
+			}
+			provider := &scriptedProvider{script: [][]llm.ChatStreamChunk{
+				{{ToolCalls: calls}, {FinishReason: llm.FinishReasonToolCalls, Done: true}},
+				{{Delta: "done"}, {FinishReason: "stop", Done: true}},
+			}}
+			tools := &recordingExecutor{}
+
+			// the plan is answered as soon as it's proposed, the way the REPL answers y or n
+			proposed := make(chan []state.ToolCall, 1)
+			s.OnStateChange(func(a state.Action, newState, _ state.AppState) {
+				if _, ok := a.(PlanProposedAction); ok {
+					proposed <- newState.Status.PendingPlan
+					s.Dispatch(tt.answer)
+				}
+			})
+
+			var asked bool
+			waitForCompletion(t, s, func() {
+				err := NewMessage(s, provider, state.RoleUser, "weather?",
+					WithToolExecutor(tools),
+					WithPlanReview(true),
+					WithToolApprover(func(context.Context, state.ToolCall) bool {
+						asked = true
+						return true
+					}),
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			select {
+			case plan := <-proposed:
+				if len(plan) != 2 || plan[0].ID != "call_1" || plan[1].ID != "call_2" {
+					t.Errorf("proposed plan = %+v, want both calls in order", plan)
+				}
+			default:
+				t.Fatal("Expected the tool calls to be proposed as a plan")
+			}
+
+			if asked {
+				t.Error("Expected the plan to be answered once instead of asking about each call")
+			}
+			if len(tools.calls) != tt.wantRun {
+				t.Errorf("tools ran %d times, want %d", len(tools.calls), tt.wantRun)
+			}
+			if s.GetState().Status.PendingPlan != nil {
+				t.Error("Expected the pending plan to be cleared once answered")
+			}
+
+			messages := s.GetState().Context.Messages
+			for _, result := range messages[2:4] {
+				if result.Role != state.RoleTool || result.Content != tt.wantContent {
+					t.Errorf("tool result = %q, want %q", result.Content, tt.wantContent)
+				}
+			}
+		})
+	}
+}
+
+func TestSetSystemPromptAction(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "hello"})
+	s.Dispatch(SetSystemPromptAction{Prompt: "Be terse"})
+
+	got := s.GetState()
+	if got.Context.SystemPrompt != "Be terse" {
+		t.Errorf("SystemPrompt = %q, want %q", got.Context.SystemPrompt, "Be terse")
+	}
+	if len(got.Context.Messages) != 1 {
+		t.Errorf("Expected the conversation to be kept, got %d messages", len(got.Context.Messages))
+	}
+
+	// it's an ordinary change to the conversation, so :undo brings the old prompt back
+	s.Dispatch(state.UndoAction{})
+	if got := s.GetState().Context.SystemPrompt; got != "Test prompt" {
+		t.Errorf("SystemPrompt after undo = %q, want %q", got, "Test prompt")
+	}
+}
+
+func TestAllowDenyActions(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	s.Dispatch(AllowAction{Pattern: "git *"})
+	s.Dispatch(AllowAction{Pattern: "  git   * "})
+	s.Dispatch(DenyAction{Pattern: "git push"})
+
+	p := s.GetState().Permissions
+	if len(p.Allow) != 1 || p.Allow[0] != "git *" {
+		t.Errorf("Allow = %q, want [git *] without the duplicate", p.Allow)
+	}
+	if len(p.Deny) != 1 || p.Deny[0] != "git push" {
+		t.Errorf("Deny = %q, want [git push]", p.Deny)
+	}
+	if !p.IsAllowed("git status") || p.IsAllowed("git push") {
+		t.Errorf("Expected git status allowed and git push denied with %+v", p)
+	}
+
+	if _, err := (AllowAction{Pattern: "  "}).Execute(s.GetState()); err == nil {
+		t.Error("Expected an empty pattern to be rejected")
+	}
+}
+
+func TestMessageChunkAction_AccumulatesUsage(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+
+	reply := func(id string, usages ...state.TokenUsage) {
+		s.Dispatch(MessageAction{ID: id, Role: state.RoleAssistant})
+		for _, usage := range usages {
+			s.Dispatch(MessageChunkAction{Message: state.Message{ID: id, Role: state.RoleAssistant, Content: "x", Usage: usage}})
+		}
+	}
+
+	// running counts reported on every chunk, then a chunk without usage
+	reply("first",
+		state.TokenUsage{Prompt: 10, Completion: 1, Total: 11},
+		state.TokenUsage{Prompt: 10, Completion: 2, Total: 12},
+		state.TokenUsage{},
+	)
+	// only the final chunk reports usage, without a total
+	reply("second", state.TokenUsage{}, state.TokenUsage{Prompt: 30, Completion: 5})
+
+	ctx := s.GetState().Context
+	if ctx.PromptTokens != 40 || ctx.CompletionTokens != 7 {
+		t.Errorf("totals = prompt %d / completion %d, want 40 / 7", ctx.PromptTokens, ctx.CompletionTokens)
+	}
+
+	first, second := ctx.Messages[0], ctx.Messages[1]
+	if first.Usage != (state.TokenUsage{Prompt: 10, Completion: 2, Total: 12}) {
+		t.Errorf("first reply usage = %+v, want the last reported", first.Usage)
+	}
+	if second.Usage.Total != 35 {
+		t.Errorf("second reply total = %d, want it filled in as 35", second.Usage.Total)
+	}
+}
+
+func TestNewMessage_StreamUsage(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []llm.ChatStreamChunk
+		want   state.TokenUsage
+	}{
+		{
+			name: "usage in a final chunk without content",
+			chunks: []llm.ChatStreamChunk{
+				{Delta: "Hello"},
+				{Delta: " there", FinishReason: "stop"},
+				{Usage: llm.TokenUsage{PromptTokens: 20, CompletionTokens: 2, TotalTokens: 22}},
+				{Done: true},
+			},
+			want: state.TokenUsage{Prompt: 20, Completion: 2, Total: 22},
+		},
+		{
+			name: "running counts keep the last",
+			chunks: []llm.ChatStreamChunk{
+				{Delta: "Hello", Usage: llm.TokenUsage{PromptTokens: 20, CompletionTokens: 1, TotalTokens: 21}},
+				{Delta: " there", Usage: llm.TokenUsage{PromptTokens: 20, CompletionTokens: 2, TotalTokens: 22}},
+				{Done: true},
+			},
+			want: state.TokenUsage{Prompt: 20, Completion: 2, Total: 22},
+		},
+		{
+			name: "total filled in",
+			chunks: []llm.ChatStreamChunk{
+				{Delta: "Hello", Usage: llm.TokenUsage{PromptTokens: 20, CompletionTokens: 1}},
+				{Done: true},
+			},
+			want: state.TokenUsage{Prompt: 20, Completion: 1, Total: 21},
+		},
+		{
+			name:   "no usage reported",
+			chunks: []llm.ChatStreamChunk{{Delta: "Hello"}, {Done: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := state.NewMemoryState("Test prompt", "/test", "test")
+			provider := &streamProvider{chunks: tt.chunks}
+
+			c := waitForCompletion(t, s, func() {
+				if err := NewMessage(s, provider, state.RoleUser, "hi"); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if c.Usage != tt.want {
+				t.Errorf("completed usage = %+v, want %+v", c.Usage, tt.want)
+			}
+
+			messages := s.GetState().Context.Messages
+			if reply := messages[len(messages)-1]; reply.Usage != tt.want {
+				t.Errorf("reply usage = %+v, want %+v", reply.Usage, tt.want)
+			}
+			if got := s.GetState().Context.PromptTokens + s.GetState().Context.CompletionTokens; got != tt.want.Total {
+				t.Errorf("session totals = %d, want %d", got, tt.want.Total)
+			}
+		})
+	}
+}
+
+func TestRetryAction(t *testing.T) {
+	user := func(c string) state.Message { return state.Message{Role: state.RoleUser, Content: c} }
+	assistant := func(c string) state.Message { return state.Message{Role: state.RoleAssistant, Content: c} }
+	tool := state.Message{Role: state.RoleTool, Content: "result"}
+
+	tests := []struct {
+		name     string
+		messages []state.Message
+		want     []string
+		wantErr  bool
+	}{
+		{"drops the reply and its prompt", []state.Message{user("a"), assistant("b"), user("c"), assistant("d")}, []string{"a", "b"}, false},
+		{"drops the tool calls the reply made", []state.Message{user("a"), assistant(""), tool, assistant("d")}, nil, false},
+		{"nothing after a user message", []state.Message{user("a"), assistant("b"), user("c")}, nil, true},
+		{"nothing after a tool result", []state.Message{user("a"), assistant(""), tool}, nil, true},
+		{"no user message to resend", []state.Message{assistant("hello")}, nil, true},
+		{"empty conversation", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := state.NewMemoryState("Test prompt", "/test", "test").GetState()
+			s.Context.Messages = tt.messages
+
+			got, err := RetryAction{}.Execute(s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrNothingToRetry) || len(got.Context.Messages) != len(tt.messages) {
+					t.Errorf("Expected ErrNothingToRetry with the conversation untouched, got %v", err)
+				}
+				return
+			}
+
+			var contents []string
+			for _, m := range got.Context.Messages {
+				contents = append(contents, m.Content)
+			}
+			if !slices.Equal(contents, tt.want) {
+				t.Errorf("messages = %q, want %q", contents, tt.want)
+			}
+		})
+	}
+}
+
+// stallingProvider streams its chunks and then holds the stream open until the request is cancelled
+type stallingProvider struct {
+	streamProvider
+}
+
+func (p *stallingProvider) StreamChatCompletion(ctx context.Context, req llm.ChatRequest) (<-chan llm.ChatStreamChunk, error) {
+	ch := make(chan llm.ChatStreamChunk)
+	go func() {
+		defer close(ch)
+		for _, c := range p.chunks {
+			select {
+			case ch <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+	return ch, nil
+}
+
+func TestNewMessage_Cancel(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	provider := &stallingProvider{streamProvider{chunks: []llm.ChatStreamChunk{{Delta: "partial "}, {Delta: "answer"}}}}
+
+	streamed := make(chan struct{}, 2)
+	completed := make(chan ChatCompletionCompletedAction, 1)
+	s.OnStateChange(func(a state.Action, _, _ state.AppState) {
+		switch a := a.(type) {
+		case MessageChunkAction:
+			streamed <- struct{}{}
+		case ChatCompletionCompletedAction:
+			completed <- a
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := NewMessage(s, provider, state.RoleUser, "tell me a story", WithContext(ctx)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-streamed:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for the reply to stream")
+		}
+	}
+	cancel()
+
+	select {
+	case c := <-completed:
+		if !c.Cancelled || c.Error != nil {
+			t.Errorf("completed action = %+v, want it cancelled without an error", c)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the cancelled completion")
+	}
+
+	got := s.GetState()
+	reply := got.Context.Messages[len(got.Context.Messages)-1]
+	if reply.Content != "partial answer" || reply.FinishReason != FinishReasonCancelled {
+		t.Errorf("reply = %q (%s), want the partial answer marked as cancelled", reply.Content, reply.FinishReason)
+	}
+	if got.Model.Busy || got.Status.Error != nil {
+		t.Errorf("Busy = %v, Error = %v, want the completion finished cleanly", got.Model.Busy, got.Status.Error)
+	}
+}
@@ -0,0 +1,46 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/atotto/clipboard"
+)
+
+// ErrNoClipboard is returned by CopyToClipboard when there is no system clipboard to
+// write to, as on a headless machine or over SSH without a clipboard tool installed
+var ErrNoClipboard = errors.New("no clipboard available")
+
+// ErrNothingToCopy is returned by lastReply when the assistant hasn't replied yet
+var ErrNothingToCopy = errors.New("the assistant hasn't replied yet")
+
+// CopyToClipboard writes text to the system clipboard using pbcopy, clip.exe or
+// xclip/xsel/wl-copy depending on the platform
+func CopyToClipboard(text string) error {
+	return writeClipboard(text)
+}
+
+// writeClipboard is replaced in tests so they don't touch the real clipboard
+var writeClipboard = func(text string) error {
+	if clipboard.Unsupported {
+		return ErrNoClipboard
+	}
+	if err := clipboard.WriteAll(text); err != nil {
+		return fmt.Errorf("%w: %v", ErrNoClipboard, err)
+	}
+	return nil
+}
+
+// lastReply returns the raw content of the last assistant message that has any,
+// skipping replies that only made tool calls
+func lastReply(messages []state.Message) (string, error) {
+	for idx := len(messages) - 1; idx >= 0; idx-- {
+		msg := messages[idx]
+		if msg.Role == state.RoleAssistant && strings.TrimSpace(msg.Content) != "" {
+			return msg.Content, nil
+		}
+	}
+	return "", ErrNothingToCopy
+}
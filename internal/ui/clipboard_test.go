@@ -0,0 +1,108 @@
+package ui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/state"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestLastReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []state.Message
+		want     string
+		wantErr  error
+	}{
+		{name: "empty conversation", wantErr: ErrNothingToCopy},
+		{
+			name:     "only the user has spoken",
+			messages: []state.Message{{Role: state.RoleUser, Content: "hi"}},
+			wantErr:  ErrNothingToCopy,
+		},
+		{
+			name: "last assistant message",
+			messages: []state.Message{
+				{Role: state.RoleUser, Content: "first"},
+				{Role: state.RoleAssistant, Content: "old answer"},
+				{Role: state.RoleUser, Content: "second"},
+				{Role: state.RoleAssistant, Content: "```go\nfmt.Println(\"hi\")\n```"},
+			},
+			want: "```go\nfmt.Println(\"hi\")\n```",
+		},
+		{
+			name: "skips tool calls and results",
+			messages: []state.Message{
+				{Role: state.RoleUser, Content: "list files"},
+				{Role: state.RoleAssistant, Content: "Here they are"},
+				{Role: state.RoleUser, Content: "again"},
+				{Role: state.RoleAssistant, ToolCalls: []state.ToolCall{{ID: "1"}}},
+				{Role: state.RoleTool, Content: "a.go\nb.go", ToolCalls: []state.ToolCall{{ID: "1"}}},
+			},
+			want: "Here they are",
+		},
+		{
+			name: "last reply is still empty",
+			messages: []state.Message{
+				{Role: state.RoleUser, Content: "hi"},
+				{Role: state.RoleAssistant, Content: "hello"},
+				{Role: state.RoleUser, Content: "more"},
+				{Role: state.RoleAssistant, Content: " \n"},
+			},
+			want: "hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lastReply(tt.messages)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("lastReply() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("lastReply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestREPLScreen_CopyCommand(t *testing.T) {
+	var copied string
+	var clipboardErr error
+	write := writeClipboard
+	writeClipboard = func(text string) error {
+		if clipboardErr != nil {
+			return clipboardErr
+		}
+		copied = text
+		return nil
+	}
+	defer func() { writeClipboard = write }()
+
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	repl.handleCommand(":copy")
+	if !strings.Contains(repl.viewport.View(), "Could not copy") || copied != "" {
+		t.Error("Expected :copy to refuse before the assistant has replied")
+	}
+
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "hi"})
+	s.Dispatch(MessageAction{Role: state.RoleAssistant, Content: "**bold** answer"})
+	repl.handleCommand(":copy")
+	if copied != "**bold** answer" {
+		t.Errorf("copied %q, want the raw Markdown of the reply", copied)
+	}
+	if !strings.Contains(repl.viewport.View(), "Copied the last reply") {
+		t.Error("Expected :copy to confirm the copy")
+	}
+
+	clipboardErr = ErrNoClipboard
+	repl.handleCommand(":copy")
+	if !strings.Contains(repl.viewport.View(), ErrNoClipboard.Error()) {
+		t.Error("Expected :copy to explain that no clipboard is available")
+	}
+}
@@ -0,0 +1,200 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/wordwrap"
+	"github.com/muesli/reflow/wrap"
+)
+
+// hunkHeader matches a unified diff hunk header, e.g. "@@ -3,5 +3,6 @@"
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// diffLine is a line of a unified diff and the old and new line numbers it's at,
+// 0 when it isn't in that side of the file
+type diffLine struct {
+	kind     byte
+	text     string
+	old, new int
+}
+
+// renderDiff colors a unified diff with the theme, added lines in its success color and
+// removed lines in its error color, and numbers each line in the old and new file. Lines
+// are hard wrapped to width, the numbers aren't repeated on the wrapped part.
+func renderDiff(diff string, width int) string {
+	lines, maxNumber := parseDiff(diff)
+
+	// a diff without hunk headers has nothing to number
+	digits := len(strconv.Itoa(maxNumber))
+	gutterWidth := 2*digits + 3
+	if maxNumber == 0 {
+		gutterWidth = 0
+	}
+	textWidth := max(width-gutterWidth, 10)
+
+	number := func(n int) string {
+		if n == 0 {
+			return strings.Repeat(" ", digits)
+		}
+		return fmt.Sprintf("%*d", digits, n)
+	}
+
+	theme := CurrentTheme()
+	added := lipgloss.NewStyle().Foreground(theme.Success())
+	removed := lipgloss.NewStyle().Foreground(theme.Error())
+	gutter := CurrentStyles().Subtle
+
+	var b strings.Builder
+	for _, line := range lines {
+		var style lipgloss.Style
+		switch line.kind {
+		case 'h':
+			b.WriteString(CurrentStyles().Accent.Render(line.text))
+			b.WriteString("\n")
+			continue
+		case '+':
+			style = added
+		case '-':
+			style = removed
+		case '\\':
+			style = gutter
+		default:
+			style = lipgloss.NewStyle()
+		}
+
+		prefix, blank := "", ""
+		if gutterWidth > 0 {
+			prefix = gutter.Render(fmt.Sprintf("%s %s │", number(line.old), number(line.new)))
+			blank = gutter.Render(strings.Repeat(" ", gutterWidth-1) + "│")
+		}
+		text := strings.ReplaceAll(line.text, "\t", "    ")
+		for i, part := range strings.Split(wrap.String(text, textWidth), "\n") {
+			if i > 0 {
+				prefix = blank
+			}
+			b.WriteString(prefix)
+			b.WriteString(style.Render(part))
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// parseDiff splits diff into its lines, numbering the ones in hunks, and returns them
+// with the largest line number. File and hunk headers are kind 'h', the rest are kind
+// '+', '-', ' ' or '\\' with the marker kept in their text.
+func parseDiff(diff string) ([]diffLine, int) {
+	var lines []diffLine
+	var oldLine, newLine, maxNumber int
+	inHunk := false
+
+	texts := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	for i := 0; i < len(texts); i++ {
+		text := texts[i]
+		if m := hunkHeader.FindStringSubmatch(text); m != nil {
+			oldLine, _ = strconv.Atoi(m[1])
+			newLine, _ = strconv.Atoi(m[2])
+			inHunk = true
+			lines = append(lines, diffLine{kind: 'h', text: text})
+			continue
+		}
+
+		// file headers come in pairs, so a removed line that happens to start with "-- " isn't one
+		if !inHunk && strings.HasPrefix(text, "--- ") && i+1 < len(texts) && strings.HasPrefix(texts[i+1], "+++ ") {
+			lines = append(lines, diffLine{kind: 'h', text: text}, diffLine{kind: 'h', text: texts[i+1]})
+			i++
+			continue
+		}
+
+		line := diffLine{kind: ' ', text: text}
+		if text != "" {
+			line.kind = text[0]
+		}
+		switch line.kind {
+		case '+':
+			if inHunk {
+				line.new = newLine
+				newLine++
+			}
+		case '-':
+			if inHunk {
+				line.old = oldLine
+				oldLine++
+			}
+		case '\\':
+		default:
+			line.kind = ' '
+			if inHunk {
+				line.old, line.new = oldLine, newLine
+				oldLine++
+				newLine++
+			}
+		}
+		maxNumber = max(maxNumber, line.old, line.new)
+		lines = append(lines, line)
+	}
+	return lines, maxNumber
+}
+
+// diffStart returns where the unified diff in text starts, the "--- " line followed by
+// a "+++ " line, or -1 when there isn't one
+func diffStart(text string) int {
+	offset := 0
+	for {
+		if strings.HasPrefix(text[offset:], "--- ") {
+			if end := strings.IndexByte(text[offset:], '\n'); end >= 0 && strings.HasPrefix(text[offset+end+1:], "+++ ") {
+				return offset
+			}
+		}
+
+		next := strings.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			return -1
+		}
+		offset += next + 1
+	}
+}
+
+// renderToolOutput wraps a tool's output to width, rendering a diff it ends with, like
+// edit_file's, with renderDiff
+func renderToolOutput(content string, width int) string {
+	start := diffStart(content)
+	if start < 0 {
+		return wordwrap.String(content, width)
+	}
+	return wordwrap.String(content[:start], width) + renderDiff(content[start:], width)
+}
+
+// editCallDiff is the change an edit_file call asks for as a diff of its old and new
+// text. Where the text is in the file isn't known until the call runs, so it has no
+// hunk header and isn't numbered.
+func editCallDiff(tc state.ToolCall) (string, bool) {
+	if tc.Function.Name != "edit_file" {
+		return "", false
+	}
+
+	var p struct {
+		Path      string `json:"path"`
+		OldString string `json:"old_string"`
+		NewString string `json:"new_string"`
+	}
+	if err := json.Unmarshal([]byte(tc.Function.Arguments), &p); err != nil || p.Path == "" {
+		return "", false
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", p.Path, p.Path)
+	for _, line := range strings.Split(strings.TrimSuffix(p.OldString, "\n"), "\n") {
+		b.WriteString("-" + line + "\n")
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(p.NewString, "\n"), "\n") {
+		b.WriteString("+" + line + "\n")
+	}
+	return b.String(), true
+}
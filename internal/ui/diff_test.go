@@ -0,0 +1,108 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+const editDiff = "--- a/main.go\n+++ b/main.go\n@@ -3,5 +3,5 @@\n" +
+	" import \"fmt\"\n" +
+	" \n" +
+	" func main() {\n" +
+	"-\tfmt.Println(\"hello\")\n" +
+	"+\tfmt.Println(\"hello, world\")\n" +
+	" }\n"
+
+// withColor renders styles in true color for the rest of the test, tests otherwise
+// render without any so the styles couldn't be told apart
+func withColor(t *testing.T) {
+	t.Helper()
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.TrueColor)
+	t.Cleanup(func() { lipgloss.SetColorProfile(profile) })
+}
+
+func TestRenderDiff(t *testing.T) {
+	withColor(t)
+
+	theme := CurrentTheme()
+	added := lipgloss.NewStyle().Foreground(theme.Success())
+	removed := lipgloss.NewStyle().Foreground(theme.Error())
+	gutter := CurrentStyles().Subtle
+
+	out := renderDiff(editDiff, 80)
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 9 {
+		t.Fatalf("renderDiff() rendered %d lines, want 9:\n%s", len(lines), out)
+	}
+
+	want := map[int]string{
+		0: CurrentStyles().Accent.Render("--- a/main.go"),
+		2: CurrentStyles().Accent.Render("@@ -3,5 +3,5 @@"),
+		3: gutter.Render("3 3 │") + ` import "fmt"`,
+		6: gutter.Render("6   │") + removed.Render(`-    fmt.Println("hello")`),
+		7: gutter.Render("  6 │") + added.Render(`+    fmt.Println("hello, world")`),
+		8: gutter.Render("7 7 │") + " }",
+	}
+	for i, line := range want {
+		if lines[i] != line {
+			t.Errorf("line %d = %q, want %q", i, lines[i], line)
+		}
+	}
+}
+
+func TestRenderDiff_Wraps(t *testing.T) {
+	diff := "@@ -1,1 +1,1 @@\n-" + strings.Repeat("a", 50) + "\n+" + strings.Repeat("b", 50) + "\n"
+
+	out := renderDiff(diff, 30)
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if w := lipgloss.Width(line); w > 30 {
+			t.Errorf("line %q is %d wide, want at most 30", line, w)
+		}
+	}
+	if !strings.Contains(out, "    │"+strings.Repeat("a", 20)) {
+		t.Errorf("Expected the wrapped part of a line to have an empty gutter, got:\n%s", out)
+	}
+}
+
+func TestRenderToolOutput(t *testing.T) {
+	withColor(t)
+	removed := lipgloss.NewStyle().Foreground(CurrentTheme().Error())
+
+	out := renderToolOutput("not applied, tai is in plan mode:\n"+editDiff, 80)
+	if !strings.HasPrefix(out, "not applied, tai is in plan mode:\n") {
+		t.Errorf("Expected the text before the diff to be kept, got:\n%s", out)
+	}
+	if !strings.Contains(out, removed.Render(`-    fmt.Println("hello")`)) {
+		t.Errorf("Expected the diff to be rendered, got:\n%s", out)
+	}
+
+	if out := renderToolOutput("wrote main.go", 80); out != "wrote main.go" {
+		t.Errorf("renderToolOutput() = %q, want output without a diff as it is", out)
+	}
+}
+
+func TestPlanText_EditDiff(t *testing.T) {
+	withColor(t)
+	added := lipgloss.NewStyle().Foreground(CurrentTheme().Success())
+	removed := lipgloss.NewStyle().Foreground(CurrentTheme().Error())
+
+	out := planText([]state.ToolCall{
+		{Function: state.ToolCallFunction{Name: "edit_file", Arguments: `{"path":"main.go","old_string":"-- old\n","new_string":"new"}`}},
+		{Function: state.ToolCallFunction{Name: "run_command", Arguments: `{"command":"go test"}`}},
+	}, 80)
+
+	for _, want := range []string{
+		"1. edit_file\n",
+		"\n" + removed.Render("--- old") + "\n" + added.Render("+new") + "\n",
+		`2. run_command {"command":"go test"}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("planText() = %q, want it to contain %q", out, want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	"github.com/charmbracelet/lipgloss"
@@ -22,11 +23,31 @@ const (
 type ChatInput textinput.Model
 
 func (i ChatInput) View() string {
-	input := textinput.Model(i).View()
-	trueWidth := lipgloss.Width(input)
-	borderTop := strings.Repeat(string(borderTP), trueWidth)
-	borderBottom := strings.Repeat(string(borderBM), trueWidth)
-	return fmt.Sprintf(" %c%s%c\n |%s|\n %c%s%c", borderTL, borderTop, borderTR, input, borderBL, borderBottom, borderBR)
+	return bordered(textinput.Model(i).View())
+}
+
+// ChatTextArea is the multi-line input, its border grows with the lines typed
+type ChatTextArea textarea.Model
+
+func (t ChatTextArea) View() string {
+	return bordered(textarea.Model(t).View())
+}
+
+// bordered draws the input border around each line of content, as wide as the widest line
+func bordered(content string) string {
+	lines := strings.Split(content, "\n")
+	width := 0
+	for _, line := range lines {
+		width = max(width, lipgloss.Width(line))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, " %c%s%c\n", borderTL, strings.Repeat(string(borderTP), width), borderTR)
+	for _, line := range lines {
+		fmt.Fprintf(&b, " |%s%s|\n", line, strings.Repeat(" ", width-lipgloss.Width(line)))
+	}
+	fmt.Fprintf(&b, " %c%s%c", borderBL, strings.Repeat(string(borderBM), width), borderBR)
+	return b.String()
 }
 
 func ElementViewport(width, height int) viewport.Model {
@@ -55,12 +76,54 @@ func ElementInput(prompt, placeholder string) ChatInput {
 	if prompt == "" {
 		prompt = ">"
 	}
-	ti.Prompt = CurrentTheme().Styles().Primary.Bold(true).Render(fmt.Sprintf("%s ", prompt))
+	ti.Prompt = renderPrompt(prompt)
 
 	return ti
 }
 
+// ElementTextArea returns the multi-line input. Enter is left to the REPL, which decides
+// between submitting and starting a new line.
+func ElementTextArea(prompt string) ChatTextArea {
+	ta := textarea.New()
+	ta.ShowLineNumbers = false
+	ta.CharLimit = 0
+	ta.KeyMap.InsertNewline.SetEnabled(false)
+	ta.FocusedStyle.CursorLine = lipgloss.NewStyle()
+	ta.FocusedStyle.Base = lipgloss.NewStyle()
+	ta.BlurredStyle.Base = lipgloss.NewStyle()
+	setTextAreaPrompt(&ta, prompt)
+	ta.SetHeight(1)
+
+	return ChatTextArea(ta)
+}
+
+// setTextAreaPrompt shows prompt on the first line of ta and indents the rest to match
+func setTextAreaPrompt(ta *textarea.Model, prompt string) {
+	if prompt == "" {
+		prompt = ">"
+	}
+	rendered := renderPrompt(prompt)
+	width := lipgloss.Width(rendered)
+	ta.SetPromptFunc(width, func(line int) string {
+		if line == 0 {
+			return rendered
+		}
+		return strings.Repeat(" ", width)
+	})
+}
+
+// renderPrompt styles an input prompt with the current theme
+func renderPrompt(prompt string) string {
+	return CurrentTheme().Styles().Primary.Bold(true).Render(fmt.Sprintf("%s ", prompt))
+}
+
 var (
 	RoleStyle = lipgloss.NewStyle().Bold(true).Foreground(CurrentTheme().Text())
 	DimStyle  = CurrentTheme().Styles().Subtle
 )
+
+// refreshElementStyles rebuilds the package level styles after the theme changes
+func refreshElementStyles() {
+	RoleStyle = lipgloss.NewStyle().Bold(true).Foreground(CurrentTheme().Text())
+	DimStyle = CurrentTheme().Styles().Subtle
+}
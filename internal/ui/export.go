@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adamveld12/tai/internal/state"
+)
+
+// conversationPath resolves where :save and :export write. An empty path defaults to
+// session-<SessionID><ext>, and relative paths are taken from the working directory.
+func conversationPath(s state.AppState, path, ext string) string {
+	if path == "" {
+		path = fmt.Sprintf("session-%s%s", s.Context.SessionID, ext)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.Context.WorkingDirectory, path)
+	}
+	return path
+}
+
+// SaveConversation writes messages to path as JSON
+func SaveConversation(path string, messages []state.Message) error {
+	data, err := json.MarshalIndent(messages, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode conversation: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// ExportConversation writes messages to path as Markdown
+func ExportConversation(path string, messages []state.Message) error {
+	if err := os.WriteFile(path, []byte(MarkdownTranscript(messages)), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// MarkdownTranscript renders messages as Markdown, one section per message headed by
+// its role and timestamp
+func MarkdownTranscript(messages []state.Message) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&b, "## %s", msg.Role)
+		if !msg.Timestamp.IsZero() {
+			fmt.Fprintf(&b, " · %s", msg.Timestamp.Format(time.RFC3339))
+		}
+		b.WriteString("\n\n")
+
+		if content := strings.TrimSpace(msg.Content); content != "" {
+			b.WriteString(content)
+			b.WriteString("\n\n")
+		}
+
+		for _, tc := range msg.ToolCalls {
+			if msg.Role == state.RoleTool {
+				continue
+			}
+			fmt.Fprintf(&b, "```json\n%s(%s)\n```\n\n", tc.Function.Name, tc.Function.Arguments)
+		}
+
+		if notice := FinishNotice(msg.FinishReason); notice != "" {
+			fmt.Fprintf(&b, "> %s\n\n", notice)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,99 @@
+package ui
+
+// DefaultInputHistorySize is how many submitted inputs the REPL remembers
+const DefaultInputHistorySize = 100
+
+// inputHistory is a ring buffer of the inputs submitted to the REPL with a cursor for
+// browsing them. Browsing starts past the newest entry, where the unsent draft is kept.
+type inputHistory struct {
+	entries []string
+	// start is the index of the oldest entry once the buffer is full
+	start  int
+	size   int
+	cursor int
+	draft  string
+}
+
+// newInputHistory returns a history holding up to size inputs, seeded with entries oldest first
+func newInputHistory(size int, entries []string) *inputHistory {
+	if size <= 0 {
+		size = DefaultInputHistorySize
+	}
+
+	h := &inputHistory{size: size}
+	for _, entry := range entries {
+		h.push(entry)
+	}
+	return h
+}
+
+// len returns the number of inputs remembered
+func (h *inputHistory) len() int {
+	return len(h.entries)
+}
+
+// at returns the i-th oldest input
+func (h *inputHistory) at(i int) string {
+	return h.entries[(h.start+i)%len(h.entries)]
+}
+
+// push remembers input as the newest entry, overwriting the oldest once full, and stops
+// browsing. Empty inputs and repeats of the newest entry aren't remembered.
+func (h *inputHistory) push(input string) {
+	h.reset()
+	if input == "" || (h.len() > 0 && h.at(h.len()-1) == input) {
+		return
+	}
+
+	if h.len() < h.size {
+		h.entries = append(h.entries, input)
+	} else {
+		h.entries[h.start] = input
+		h.start = (h.start + 1) % h.size
+	}
+	h.cursor = h.len()
+}
+
+// browsing reports whether an entry is currently recalled
+func (h *inputHistory) browsing() bool {
+	return h.cursor < h.len()
+}
+
+// current returns the recalled entry, or the draft when not browsing
+func (h *inputHistory) current() string {
+	if !h.browsing() {
+		return h.draft
+	}
+	return h.at(h.cursor)
+}
+
+// prev recalls the entry before the current one, saving draft when browsing starts.
+// It reports false when there's nothing older.
+func (h *inputHistory) prev(draft string) (string, bool) {
+	if h.cursor == 0 {
+		return "", false
+	}
+
+	if !h.browsing() {
+		h.draft = draft
+	}
+	h.cursor--
+	return h.current(), true
+}
+
+// next recalls the entry after the current one, returning to the draft past the newest.
+// It reports false when not browsing.
+func (h *inputHistory) next() (string, bool) {
+	if !h.browsing() {
+		return "", false
+	}
+
+	h.cursor++
+	return h.current(), true
+}
+
+// reset stops browsing and forgets the draft
+func (h *inputHistory) reset() {
+	h.cursor = h.len()
+	h.draft = ""
+}
@@ -0,0 +1,55 @@
+package ui
+
+import "testing"
+
+func TestInputHistory_Cursor(t *testing.T) {
+	h := newInputHistory(3, nil)
+	if _, ok := h.prev(""); ok {
+		t.Fatal("Expected nothing to recall from an empty history")
+	}
+
+	for _, input := range []string{"one", "two", "two", "", "three", "four"} {
+		h.push(input)
+	}
+	// "one" fell out of the ring, the repeated "two" and the empty input weren't kept
+	if h.len() != 3 {
+		t.Fatalf("len() = %d, want 3", h.len())
+	}
+
+	steps := []struct {
+		older bool
+		want  string
+		ok    bool
+	}{
+		{true, "four", true},
+		{true, "three", true},
+		{true, "two", true},
+		{true, "", false},
+		{false, "three", true},
+		{false, "four", true},
+		{false, "draft", true},
+		{false, "", false},
+	}
+
+	for i, step := range steps {
+		var got string
+		var ok bool
+		if step.older {
+			got, ok = h.prev("draft")
+		} else {
+			got, ok = h.next()
+		}
+		if ok != step.ok || (ok && got != step.want) {
+			t.Fatalf("step %d: got %q, %v, want %q, %v", i, got, ok, step.want, step.ok)
+		}
+	}
+
+	h.prev("draft")
+	h.push("five")
+	if h.browsing() {
+		t.Error("Expected submitting an input to stop browsing")
+	}
+	if got, _ := h.prev(""); got != "five" {
+		t.Errorf("prev() = %q after push, want the newest input", got)
+	}
+}
@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxInputLines is the most lines the multi-line input grows to before it scrolls
+const maxInputLines = 10
+
+// newlineKey inserts a newline instead of submitting
+const newlineKey = "alt+enter"
+
+// inputAction is what pressing enter does with the input
+type inputAction int
+
+const (
+	// inputSubmit sends the input
+	inputSubmit inputAction = iota
+	// inputNewline continues the input on a new line
+	inputNewline
+)
+
+// enterAction decides whether pressing key with value in the input submits it or starts a
+// new line. alt+enter always starts a new line, as does enter after a trailing backslash,
+// which is dropped. The value to continue editing or submit is returned.
+func enterAction(key, value string) (inputAction, string) {
+	if key == newlineKey {
+		return inputNewline, value
+	}
+	if trimmed, ok := strings.CutSuffix(value, `\`); ok {
+		return inputNewline, trimmed
+	}
+	return inputSubmit, value
+}
+
+// inputValue returns what's been typed into whichever input is active
+func (r *REPLScreen) inputValue() string {
+	if r.multiline {
+		return r.textarea.Value()
+	}
+	return r.input.Value()
+}
+
+// setInputValue replaces the input, switching to the multi-line input when value has several lines
+func (r *REPLScreen) setInputValue(value string) {
+	if strings.Contains(value, "\n") {
+		r.startMultiline(value)
+		return
+	}
+
+	r.input.SetValue(value)
+	r.input.CursorEnd()
+}
+
+// resetInput empties the input and goes back to the single line input
+func (r *REPLScreen) resetInput() {
+	r.input.Reset()
+	r.textarea.Reset()
+	if r.multiline {
+		r.multiline = false
+		r.textarea.Blur()
+		r.input.Focus()
+		r.layout()
+	}
+}
+
+// startMultiline moves value into the multi-line input with the cursor at its end
+func (r *REPLScreen) startMultiline(value string) {
+	r.textarea.SetValue(value)
+	r.textarea.Focus()
+	r.multiline = true
+	r.input.Reset()
+	r.input.Blur()
+	r.layout()
+}
+
+// newline continues the input on a new line. alt+enter splits the line at the cursor,
+// a trailing backslash continues after value, which had the backslash dropped.
+func (r *REPLScreen) newline(key, value string) {
+	switch {
+	case key == newlineKey && r.multiline:
+		r.textarea.InsertString("\n")
+	case key == newlineKey:
+		runes := []rune(value)
+		pos := min(r.input.Position(), len(runes))
+		r.startMultiline(string(runes[:pos]) + "\n" + string(runes[pos:]))
+		// the single line had no newlines, so the cursor belongs at the start of the second
+		r.textarea.CursorStart()
+	default:
+		r.startMultiline(value + "\n")
+	}
+	r.layout()
+}
+
+// updateTextarea passes msg to the multi-line input and resizes it to fit what's typed
+func (r *REPLScreen) updateTextarea(msg tea.Msg) tea.Cmd {
+	var cmd tea.Cmd
+	r.textarea, cmd = r.textarea.Update(msg)
+	r.layout()
+	return cmd
+}
+
+// layout sizes the multi-line input to its lines, up to maxInputLines, and gives the
+// viewport the rest of the height
+func (r *REPLScreen) layout() {
+	inputLines := 1
+	if r.multiline {
+		inputLines = min(max(r.textarea.LineCount(), 1), maxInputLines)
+	}
+	r.textarea.SetHeight(inputLines)
+
+	if r.height == 0 {
+		return
+	}
+
+	headerHeight := 2 // Header and separator
+	footerHeight := 5 // Input area and footer
+	r.viewport.Height = max(r.height-headerHeight-footerHeight-(inputLines-1), 1)
+	if r.autoscroll {
+		r.viewport.GotoBottom()
+	}
+}
@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/llm"
+	"github.com/adamveld12/tai/internal/state"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestEnterAction(t *testing.T) {
+	tests := []struct {
+		key, value string
+		want       inputAction
+		wantValue  string
+	}{
+		{"enter", "hello", inputSubmit, "hello"},
+		{"enter", "", inputSubmit, ""},
+		{"enter", ":help", inputSubmit, ":help"},
+		{"enter", "first line\nsecond", inputSubmit, "first line\nsecond"},
+		{"enter", `continue \`, inputNewline, "continue "},
+		{"enter", "line one\nline two\\", inputNewline, "line one\nline two"},
+		{"enter", `C:\path\ in the middle`, inputSubmit, `C:\path\ in the middle`},
+		{"alt+enter", "hello", inputNewline, "hello"},
+		{"alt+enter", `keeps the backslash \`, inputNewline, `keeps the backslash \`},
+	}
+
+	for _, tt := range tests {
+		got, value := enterAction(tt.key, tt.value)
+		if got != tt.want || value != tt.wantValue {
+			t.Errorf("enterAction(%q, %q) = %v, %q, want %v, %q", tt.key, tt.value, got, value, tt.want, tt.wantValue)
+		}
+	}
+}
+
+func TestREPLScreen_MultilineInput(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	provider := &streamProvider{chunks: []llm.ChatStreamChunk{{Done: true}}}
+	repl := NewREPL(s, provider)
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+	height := repl.viewport.Height
+
+	typeText := func(text string) {
+		repl.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text)})
+	}
+
+	typeText(`func main() {\`)
+	repl.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if !repl.multiline {
+		t.Fatal("Expected a trailing backslash to start a multi-line input")
+	}
+	typeText("  println()")
+	repl.Update(tea.KeyMsg{Type: tea.KeyEnter, Alt: true})
+	typeText("}")
+
+	if got, want := repl.inputValue(), "func main() {\n  println()\n}"; got != want {
+		t.Fatalf("input = %q, want %q", got, want)
+	}
+	if repl.viewport.Height != height-2 {
+		t.Errorf("viewport height = %d, want it to shrink by 2 as the input grows to 3 lines", repl.viewport.Height)
+	}
+	if view := repl.View(); !strings.Contains(view, "println()") || strings.Count(view, "|") < 6 {
+		t.Error("Expected the input border to wrap every line")
+	}
+
+	repl.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	messages := s.GetState().Context.Messages
+	if len(messages) == 0 || messages[0].Content != "func main() {\n  println()\n}" {
+		t.Fatalf("Expected the whole buffer to be sent, got %+v", messages)
+	}
+	if repl.multiline || repl.inputValue() != "" || repl.viewport.Height != height {
+		t.Error("Expected sending to go back to an empty single line input")
+	}
+
+	// a multi-line prompt starting with a colon isn't a command
+	repl.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(":theme\nis this a command?"), Paste: true})
+	if !repl.multiline {
+		t.Fatal("Expected pasting several lines to switch to the multi-line input")
+	}
+	repl.Update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	sent := false
+	for _, msg := range s.GetState().Context.Messages {
+		sent = sent || (msg.Role == state.RoleUser && msg.Content == ":theme\nis this a command?")
+	}
+	if !sent {
+		t.Error("Expected a multi-line prompt starting with a colon to be sent to the model")
+	}
+}
@@ -1,6 +1,9 @@
 package ui
 
 import (
+	"context"
+
+	"github.com/adamveld12/tai/internal/llm"
 	"github.com/adamveld12/tai/internal/state"
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -10,6 +13,11 @@ type Screen interface {
 	tea.Model
 }
 
+// MessageSink receives messages for a running Bubble Tea program. *tea.Program satisfies it.
+type MessageSink interface {
+	Send(msg tea.Msg)
+}
+
 // Stack defines the interface for a screen stack
 type Stack interface {
 	tea.Model
@@ -18,3 +26,17 @@ type Stack interface {
 	Pop() Screen
 	Clear()
 }
+
+// ToolExecutor describes the tools the model may call and runs them with the JSON
+// encoded arguments it gives. *tools.Registry satisfies it.
+type ToolExecutor interface {
+	Tools() []llm.Tool
+	Call(ctx context.Context, name, args string) (string, error)
+
+	// ReadOnly reports whether the tool called name only reads, so execute mode can run it without asking
+	ReadOnly(name string) bool
+
+	// Previews reports whether the tool called name checks the mode itself and only shows
+	// what it would do in plan mode, so plan mode can run it
+	Previews(name string) bool
+}
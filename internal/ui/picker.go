@@ -0,0 +1,243 @@
+package ui
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/adamveld12/tai/internal/state"
+	"github.com/adamveld12/tai/internal/tools"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxPickerFiles bounds how many files are indexed so huge repositories stay responsive
+const maxPickerFiles = 20000
+
+// FileSelectedMsg is delivered to the screen below the picker when a file is chosen
+type FileSelectedMsg struct {
+	Path string
+}
+
+// pickerFilesMsg carries the files indexed for the picker once the walk finishes
+type pickerFilesMsg struct {
+	files []string
+}
+
+// FilePickerScreen is a fuzzy finder over the files in the working directory
+type FilePickerScreen struct {
+	root    string
+	input   textinput.Model
+	files   []string
+	loading bool
+	matches []string
+	cursor  int
+	offset  int
+	width   int
+	height  int
+}
+
+// NewFilePicker creates a picker listing the files under root, honoring .gitignore.
+// The files are indexed in the background once the picker is initialized.
+func NewFilePicker(root string) *FilePickerScreen {
+	input := textinput.Model(ElementInput("@", "Find a file..."))
+	input.Focus()
+
+	return &FilePickerScreen{
+		root:    root,
+		input:   input,
+		loading: true,
+		height:  20,
+	}
+}
+
+// Init implements tea.Model
+func (p *FilePickerScreen) Init() tea.Cmd {
+	return tea.Batch(textinput.Blink, loadPickerFiles(p.root))
+}
+
+// loadPickerFiles returns a command that walks root off of the UI loop
+func loadPickerFiles(root string) tea.Cmd {
+	return func() tea.Msg {
+		files := make([]string, 0)
+		_ = tools.WalkFiles(root, func(relPath string) error {
+			files = append(files, relPath)
+			if len(files) >= maxPickerFiles {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		return pickerFilesMsg{files: files}
+	}
+}
+
+// OnStateChange implements Screen. The picker doesn't render application state.
+func (p *FilePickerScreen) OnStateChange(action state.Action, newState, oldState state.AppState) tea.Msg {
+	return nil
+}
+
+// Update implements tea.Model
+func (p *FilePickerScreen) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case pickerFilesMsg:
+		p.files = msg.files
+		p.loading = false
+		p.matches = rankFiles(p.input.Value(), p.files)
+		p.cursor, p.offset = 0, 0
+		return p, nil
+	case tea.WindowSizeMsg:
+		p.width = msg.Width
+		p.height = msg.Height
+		p.input.Width = msg.Width - 7
+		p.scrollToCursor()
+		return p, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc", "ctrl+c":
+			return p, popScreen(nil)
+		case "enter":
+			if len(p.matches) == 0 {
+				return p, popScreen(nil)
+			}
+			return p, popScreen(FileSelectedMsg{Path: p.matches[p.cursor]})
+		case "up", "ctrl+p":
+			if p.cursor > 0 {
+				p.cursor--
+			}
+			p.scrollToCursor()
+			return p, nil
+		case "down", "ctrl+n":
+			if p.cursor < len(p.matches)-1 {
+				p.cursor++
+			}
+			p.scrollToCursor()
+			return p, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	query := p.input.Value()
+	p.input, cmd = p.input.Update(msg)
+	if p.input.Value() != query {
+		p.matches = rankFiles(p.input.Value(), p.files)
+		p.cursor, p.offset = 0, 0
+	}
+
+	return p, cmd
+}
+
+// View implements tea.Model
+func (p *FilePickerScreen) View() string {
+	var b strings.Builder
+
+	b.WriteString(CurrentStyles().Header.Render("Find File"))
+	b.WriteString("\n")
+	b.WriteString(ChatInput(p.input).View())
+	b.WriteString("\n")
+
+	if p.loading {
+		b.WriteString(CurrentStyles().Subtle.Render("Indexing files..."))
+		return b.String()
+	}
+
+	end := min(p.offset+p.visibleRows(), len(p.matches))
+	for i := p.offset; i < end; i++ {
+		if i == p.cursor {
+			b.WriteString(CurrentStyles().Highlight.Render(p.matches[i]))
+		} else {
+			b.WriteString(CurrentStyles().Primary.Render(p.matches[i]))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString(CurrentStyles().Subtle.Render(fmt.Sprintf("%d/%d files | enter to insert, esc to cancel", len(p.matches), len(p.files))))
+
+	return b.String()
+}
+
+// visibleRows is how many matches fit under the header, input and footer
+func (p *FilePickerScreen) visibleRows() int {
+	return max(p.height-6, 1)
+}
+
+// scrollToCursor moves the window of visible matches so the cursor is inside it
+func (p *FilePickerScreen) scrollToCursor() {
+	visible := p.visibleRows()
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+visible {
+		p.offset = p.cursor - visible + 1
+	}
+}
+
+// rankFiles returns the files matching query, best match first
+func rankFiles(query string, files []string) []string {
+	type scored struct {
+		path  string
+		score int
+	}
+
+	results := make([]scored, 0, len(files))
+	for _, f := range files {
+		if score, ok := fuzzyScore(query, f); ok {
+			results = append(results, scored{path: f, score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return len(results[i].path) < len(results[j].path)
+	})
+
+	ranked := make([]string, len(results))
+	for i, r := range results {
+		ranked[i] = r.path
+	}
+	return ranked
+}
+
+// fuzzyScore reports whether every rune of query appears in candidate in order,
+// and scores the match. Consecutive runs, matches at the start of a path segment
+// or word, and matches inside the file name all score higher.
+func fuzzyScore(query, candidate string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+
+	q := []rune(strings.ToLower(query))
+	c := []rune(strings.ToLower(candidate))
+	base := strings.LastIndex(candidate, "/") + 1
+
+	score := 0
+	qi := 0
+	prev := -2
+	for ci := 0; ci < len(c) && qi < len(q); ci++ {
+		if c[ci] != q[qi] {
+			continue
+		}
+
+		score++
+		if prev == ci-1 {
+			score += 5
+		}
+		if ci == 0 || strings.ContainsRune("/_-. ", c[ci-1]) {
+			score += 3
+		}
+		if ci >= base {
+			score += 2
+		}
+
+		prev = ci
+		qi++
+	}
+
+	if qi < len(q) {
+		return 0, false
+	}
+
+	return score, true
+}
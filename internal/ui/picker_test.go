@@ -0,0 +1,132 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamveld12/tai/internal/state"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestRankFiles(t *testing.T) {
+	files := []string{
+		"internal/ui/themes.go",
+		"internal/state/state.go",
+		"internal/state/state_test.go",
+		"cmd/tai/main.go",
+		"README.md",
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		first string
+		count int
+	}{
+		{name: "empty query keeps everything, shortest first", query: "", first: "README.md", count: 5},
+		{name: "file name beats scattered match", query: "state", first: "internal/state/state.go", count: 2},
+		{name: "subsequence across segments", query: "cmdmain", first: "cmd/tai/main.go", count: 1},
+		{name: "case insensitive", query: "readme", first: "README.md", count: 1},
+		{name: "no match", query: "zzz", count: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked := rankFiles(tt.query, files)
+			if len(ranked) != tt.count {
+				t.Fatalf("rankFiles(%q) returned %d results %v, want %d", tt.query, len(ranked), ranked, tt.count)
+			}
+			if tt.count > 0 && ranked[0] != tt.first {
+				t.Errorf("rankFiles(%q)[0] = %q, want %q", tt.query, ranked[0], tt.first)
+			}
+		})
+	}
+}
+
+func TestFilePicker_PushPopInsertsPath(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"main.go", "ignored.log", "pkg/util.go"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("package x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.log\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := state.NewMemoryState("Test", dir, "test")
+	repl := NewREPL(s, nil)
+	stack := NewScreenStack(s, repl)
+
+	// :file pushes the picker
+	_, cmd := repl.handleCommand(":file")
+	if cmd == nil {
+		t.Fatal("Expected :file to return a command")
+	}
+	stack.Update(cmd())
+
+	picker, ok := stack.Active().(*FilePickerScreen)
+	if !ok {
+		t.Fatalf("Expected the picker to be active, got %T", stack.Active())
+	}
+	if !strings.Contains(picker.View(), "Indexing files") {
+		t.Errorf("Expected the picker to show it's indexing before the walk finishes:\n%s", picker.View())
+	}
+	stack.Update(loadPickerFiles(dir)())
+
+	for _, f := range picker.files {
+		if strings.HasSuffix(f, ".log") {
+			t.Errorf("Expected .gitignore'd file %q to be excluded", f)
+		}
+	}
+
+	// type a query and select the top match
+	for _, r := range "util" {
+		stack.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	_, cmd = stack.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd == nil {
+		t.Fatal("Expected enter to return a command")
+	}
+	stack.Update(cmd())
+
+	if stack.Active() != repl {
+		t.Fatalf("Expected the REPL to be active after selecting a file, got %T", stack.Active())
+	}
+	if got := repl.input.Value(); got != "pkg/util.go " {
+		t.Errorf("input = %q, want %q", got, "pkg/util.go ")
+	}
+}
+
+func TestFilePicker_Scrolls(t *testing.T) {
+	picker := NewFilePicker("/test")
+	files := make([]string, 30)
+	for i := range files {
+		files[i] = fmt.Sprintf("file%02d.go", i)
+	}
+	picker.Update(pickerFilesMsg{files: files})
+	picker.Update(tea.WindowSizeMsg{Width: 80, Height: 11})
+
+	for range 7 {
+		picker.Update(tea.KeyMsg{Type: tea.KeyDown})
+	}
+	view := picker.View()
+	if !strings.Contains(view, "file07.go") || strings.Contains(view, "file02.go") {
+		t.Errorf("Expected the window to follow the cursor down to file07.go:\n%s", view)
+	}
+
+	for range 7 {
+		picker.Update(tea.KeyMsg{Type: tea.KeyUp})
+	}
+	view = picker.View()
+	if !strings.Contains(view, "file00.go") || strings.Contains(view, "file05.go") {
+		t.Errorf("Expected the window to follow the cursor back up to file00.go:\n%s", view)
+	}
+}
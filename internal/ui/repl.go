@@ -1,16 +1,27 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/adamveld12/tai/internal/llm"
 	"github.com/adamveld12/tai/internal/state"
+	"github.com/adamveld12/tai/internal/tools"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/stopwatch"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
@@ -18,11 +29,16 @@ import (
 	"github.com/muesli/reflow/wordwrap"
 )
 
-// REPLScreen represents the REPLScreen UI model
+// REPLScreen represents the REPLScreen UI model. Its fields are only touched on Bubble
+// Tea's loop: state changes from other goroutines reach it as messages sent by the
+// ScreenStack, and the agent's goroutine only talks to it over the approvals channel.
 type REPLScreen struct {
 	state.Dispatcher
 	llm.Provider
-	input      textinput.Model
+	input textinput.Model
+	// textarea replaces input while a multi-line prompt is being written
+	textarea   textarea.Model
+	multiline  bool
 	viewport   viewport.Model
 	swatch     stopwatch.Model
 	spinner    spinner.Model
@@ -30,38 +46,281 @@ type REPLScreen struct {
 	height     int
 	ready      bool
 	autoscroll bool
+
+	// stall watchdog: warns when the model hasn't streamed anything for stallTimeout
+	stallTimeout time.Duration
+	lastChunk    time.Time
+	stalled      bool
+	now          func() time.Time
+
+	altScreen bool
+	quitting  bool
+
+	// actionErr is the last failed action, shown until the next input is sent
+	actionErr error
+
+	// prompts estimated above confirmTokens need a second enter before they're sent
+	confirmTokens int
+	confirmInput  string
+
+	// history is the inputs submitted so far, recalled with up and down
+	history *inputHistory
+
+	// historyTokens is the estimated prompt size of the system prompt and conversation,
+	// shown in the footer with the input's estimate added
+	historyTokens int
+
+	// glamourStyle is the standard glamour style messages and help are rendered with
+	glamourStyle string
+
+	// userMarkdown renders the user's messages as markdown too, not only replies
+	userMarkdown bool
+
+	// renderer is reused while the wrap width and glamour style stay the same, and
+	// renderCache holds each message's rendered body keyed by role and message ID
+	renderer      *glamour.TermRenderer
+	rendererWidth int
+	rendererStyle string
+	renderCache   map[string]renderedMessage
+
+	// agentOpts configure how each message sent from the REPL is answered
+	agentOpts []AgentOption
+
+	// cancel stops the completion in flight, nil when there isn't one
+	cancel context.CancelFunc
+
+	// agents tracks the goroutines answering sent messages so Shutdown can wait for them
+	agents sync.WaitGroup
+
+	// approvals carries the user's answer to the tool call waiting on approval
+	approvals chan bool
+
+	// configSummary is the effective configuration shown by :config
+	configSummary string
+
+	// pruneSessions removes saved sessions beyond the configured limit, nil when sessions aren't saved
+	pruneSessions func() ([]string, error)
+}
+
+// modeCycleKey cycles plan → execute → yolo
+const modeCycleKey = "shift+tab"
+
+// cancelKey stops the reply being streamed, like esc
+const cancelKey = "ctrl+x"
+
+// DefaultStallWarning is how long the REPL waits for a chunk before hinting the model may be stuck
+const DefaultStallWarning = 20 * time.Second
+
+// stallCheckInterval is how often the stall watchdog runs while a completion is in flight
+const stallCheckInterval = time.Second
+
+// stallCheckMsg triggers a stall watchdog check
+type stallCheckMsg struct{}
+
+// modelsMsg carries the models listed by the provider for :model
+type modelsMsg struct {
+	models []string
+	err    error
+}
+
+// actionErrorMsg reports an error recorded on the state by action. The action is still
+// handled, e.g. a completion that ended with an error must still stop the spinner.
+type actionErrorMsg struct {
+	err    error
+	action state.Action
+}
+
+// REPLOption configures optional REPLScreen behavior
+type REPLOption func(*REPLScreen)
+
+// WithStallWarning sets how long to wait without a streamed chunk before showing a
+// "still waiting" hint. A non-positive duration disables the hint.
+func WithStallWarning(d time.Duration) REPLOption {
+	return func(r *REPLScreen) {
+		r.stallTimeout = d
+	}
+}
+
+// WithAltScreen controls whether the REPL takes over the terminal's alternate screen.
+// When disabled the REPL renders inline so the conversation stays in the scrollback.
+func WithAltScreen(enabled bool) REPLOption {
+	return func(r *REPLScreen) {
+		r.altScreen = enabled
+	}
+}
+
+// WithConfirmThreshold asks for confirmation before sending a prompt whose estimated
+// token count, including the history and system prompt, exceeds tokens. Zero disables it.
+func WithConfirmThreshold(tokens int) REPLOption {
+	return func(r *REPLScreen) {
+		r.confirmTokens = tokens
+	}
+}
+
+// WithSessionPruner enables the :sessions prune command, which calls prune to remove
+// the oldest saved sessions and reports the ones it removed
+func WithSessionPruner(prune func() ([]string, error)) REPLOption {
+	return func(r *REPLScreen) {
+		r.pruneSessions = prune
+	}
+}
+
+// WithAgentOptions configures how the agent answers messages sent from the REPL,
+// e.g. which tools it can call
+func WithAgentOptions(opts ...AgentOption) REPLOption {
+	return func(r *REPLScreen) {
+		r.agentOpts = append(r.agentOpts, opts...)
+	}
+}
+
+// WithUserMarkdown renders the user's messages as markdown like the model's replies, so
+// code fences they paste are highlighted the same way. Off, they're shown as typed.
+func WithUserMarkdown(enabled bool) REPLOption {
+	return func(r *REPLScreen) {
+		r.userMarkdown = enabled
+	}
+}
+
+// WithConfigSummary sets the effective configuration the :config command shows
+func WithConfigSummary(summary string) REPLOption {
+	return func(r *REPLScreen) {
+		r.configSummary = summary
+	}
 }
 
 // NewREPL creates a new REPL instance
-func NewREPL(d state.Dispatcher, p llm.Provider) *REPLScreen {
+func NewREPL(d state.Dispatcher, p llm.Provider, opts ...REPLOption) *REPLScreen {
 	repl := &REPLScreen{
-		Dispatcher: d,
-		Provider:   p,
-		swatch:     stopwatch.New(),
-		input:      textinput.Model(ElementInput(">", "Type your message...")),
-		spinner:    spinner.New(spinner.WithSpinner(spinner.Points), spinner.WithStyle(CurrentStyles().Accent)),
-		viewport:   ElementViewport(80, 20),
-		autoscroll: true,
+		Dispatcher:   d,
+		Provider:     p,
+		swatch:       stopwatch.New(),
+		input:        textinput.Model(ElementInput(">", "Type your message...")),
+		textarea:     textarea.Model(ElementTextArea(">")),
+		spinner:      spinner.New(spinner.WithSpinner(spinner.Points), spinner.WithStyle(CurrentStyles().Accent)),
+		viewport:     ElementViewport(80, 20),
+		autoscroll:   true,
+		stallTimeout: DefaultStallWarning,
+		now:          time.Now,
+		altScreen:    true,
+		approvals:    make(chan bool, 1),
 	}
 
 	repl.swatch.Interval = time.Millisecond * 16
 
+	style, err := ResolveGlamourStyle(CurrentTheme(), os.Getenv(GlamourStyleEnv))
+	if err != nil {
+		log.Printf("warning: %s: %v", GlamourStyleEnv, err)
+	}
+	repl.glamourStyle = style
+
+	for _, opt := range opts {
+		opt(repl)
+	}
+
+	repl.historyTokens = estimatePrompt(d.GetState(), "")
+	repl.history = newInputHistory(DefaultInputHistorySize, d.GetState().Context.InputHistory)
+
+	// the REPL asks for approval itself unless the options brought their own approver
+	repl.agentOpts = append([]AgentOption{WithToolApprover(repl.approveToolCall)}, repl.agentOpts...)
+
 	return repl
 }
 
+// send sends input to the model as the user, the reply can be stopped with esc
+func (r *REPLScreen) send(input string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := append([]AgentOption{WithContext(ctx), WithWaitGroup(&r.agents)}, r.agentOpts...)
+	if err := NewMessage(r.Dispatcher, r.Provider, state.RoleUser, input, opts...); err != nil {
+		cancel()
+		return err
+	}
+
+	r.cancel = cancel
+	return nil
+}
+
+// approveToolCall waits for the user to answer y or n to the pending tool call. It runs
+// on the agent's goroutine, the answer comes from Update.
+func (r *REPLScreen) approveToolCall(ctx context.Context, _ state.ToolCall) bool {
+	select {
+	case approved := <-r.approvals:
+		return approved
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// answerApproval hands the user's answer to the agent waiting in approveToolCall
+func (r *REPLScreen) answerApproval(approved bool) {
+	select {
+	case r.approvals <- approved:
+	default:
+	}
+}
+
+// checkStall schedules the next stall watchdog check
+func (r *REPLScreen) checkStall() tea.Cmd {
+	if r.stallTimeout <= 0 {
+		return nil
+	}
+	return tea.Tick(stallCheckInterval, func(time.Time) tea.Msg { return stallCheckMsg{} })
+}
+
 // Init initializes the REPL
 func (r *REPLScreen) Init() tea.Cmd {
+	if !r.altScreen {
+		return r.viewport.Init()
+	}
 	return tea.Batch(tea.EnterAltScreen, r.viewport.Init())
 }
 
-func (r *REPLScreen) OnStateChange(action state.Action, newState, oldState state.AppState) (msg tea.Msg) {
-	msg = action
-	switch action.(type) {
-	case MessageAction, MessageChunkAction, ClearMessagesAction:
-		r.setViewport()
+// quit stops the program. Inline REPLs clear their last frame so the transcript
+// printed on exit isn't preceded by a stale copy of the screen.
+func (r *REPLScreen) quit() tea.Cmd {
+	r.quitting = true
+	// the reply in flight is stopped, Shutdown waits for it to wind down
+	if r.cancel != nil {
+		r.cancel()
+	}
+	return tea.Quit
+}
+
+// DefaultShutdownTimeout is how long tai waits for the agent to stop on exit
+const DefaultShutdownTimeout = 5 * time.Second
+
+// Shutdown stops the reply in flight, along with any tool call or approval it's waiting
+// on, and waits for the agent to dispatch its last action so the conversation saved on
+// exit is complete. Call it once the program has stopped. It returns false when the
+// agent didn't finish within timeout.
+func (r *REPLScreen) Shutdown(timeout time.Duration) bool {
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
 	}
 
-	return
+	done := make(chan struct{})
+	go func() {
+		r.agents.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// OnStateChange implements Screen. It runs on the dispatcher's listener goroutine, so it
+// only picks the message to send; rendering happens in Update on the program's loop.
+func (r *REPLScreen) OnStateChange(action state.Action, newState, oldState state.AppState) tea.Msg {
+	// a cleared error takes its banner down with it
+	if newState.Status.Error != oldState.Status.Error {
+		return actionErrorMsg{err: newState.Status.Error, action: action}
+	}
+
+	return action
 }
 
 // Update handles messages and updates the model
@@ -69,81 +328,226 @@ func (r *REPLScreen) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	var cmds []tea.Cmd
 
+	if msg, ok := msg.(modelsMsg); ok {
+		r.viewport.SetContent(wordwrap.String(r.modelsText(msg), int(math.Max(40, float64(r.viewport.Width)-10))))
+		return r, nil
+	}
+
+	if msg, ok := msg.(actionErrorMsg); ok {
+		r.actionErr = msg.err
+		if msg.action == nil {
+			return r, nil
+		}
+		return r.Update(msg.action)
+	}
+
+	if _, ok := msg.(SwitchThemeAction); ok {
+		r.applyTheme()
+	}
+
+	// the plan takes over the viewport until it's answered
+	switch msg := msg.(type) {
+	case PlanProposedAction:
+		r.viewport.SetContent(planText(msg.ToolCalls, int(math.Max(40, float64(r.viewport.Width)-10))))
+		r.viewport.GotoTop()
+	case ApprovePlanAction, RejectPlanAction:
+		r.setViewport()
+	}
+
+	switch msg.(type) {
+	case MessageAction, MessageChunkAction, MessageFinishedAction, MessageToolCallsAction, ContextTrimmedAction, ChangeProviderAction, ClearMessagesAction, RetryAction, SetPersonaAction, SetModelOverridesAction, state.UndoAction, state.RedoAction:
+		r.setViewport()
+	}
+
+	// chunks only grow the reply being streamed, it's estimated once the completion ends
+	switch msg.(type) {
+	case MessageAction, MessageToolCallsAction, ChatCompletionCompletedAction, ChangeProviderAction, ClearMessagesAction, RetryAction, SetPersonaAction, state.UndoAction, state.RedoAction:
+		r.historyTokens = estimatePrompt(r.GetState(), "")
+	}
+
 	switch msg := msg.(type) {
 	case ChatCompletionStartedAction:
-		cmds = append(cmds, r.swatch.Reset(), r.swatch.Start(), r.spinner.Tick)
+		r.lastChunk = r.now()
+		r.stalled = false
+		cmds = append(cmds, r.swatch.Reset(), r.swatch.Start(), r.spinner.Tick, r.checkStall())
 	case ChatCompletionCompletedAction:
+		// a prompt sent since has its own completion in flight
+		if r.cancel != nil && !r.GetState().Model.Busy {
+			r.cancel()
+			r.cancel = nil
+		}
+		r.stalled = false
 		r.spinner = spinner.New(spinner.WithSpinner(spinner.Points), spinner.WithStyle(CurrentStyles().Accent))
 		cmds = append(cmds, r.swatch.Stop())
+	case MessageChunkAction:
+		r.lastChunk = r.now()
+		r.stalled = false
+	case stallCheckMsg:
+		if r.GetState().Model.Busy {
+			r.stalled = r.now().Sub(r.lastChunk) >= r.stallTimeout
+			cmds = append(cmds, r.checkStall())
+		} else {
+			r.stalled = false
+		}
 	case ClearMessagesAction:
 		r.viewport.GotoTop()
+	case FileSelectedMsg:
+		if r.multiline {
+			r.textarea.InsertString(msg.Path + " ")
+			r.textarea.Focus()
+			break
+		}
+
+		value := r.input.Value()
+		if value != "" && !strings.HasSuffix(value, " ") {
+			value += " "
+		}
+		r.input.SetValue(value + msg.Path + " ")
+		r.input.CursorEnd()
+		r.input.Focus()
 	case tea.WindowSizeMsg:
 		r.width = msg.Width
 		r.height = msg.Height
 
 		// Update text input width
 		r.input.Width = msg.Width - 7 // Account for prompt and padding
+		r.textarea.SetWidth(msg.Width - 4)
+
+		// the transcript rewraps to the new width, so the reader's place is kept as how far
+		// through it they'd scrolled rather than as a line offset
+		percent := r.viewport.ScrollPercent()
 
 		// Update viewport size
-		headerHeight := 2 // Header and separator
-		footerHeight := 5 // Input area and footer
-		viewportHeight := msg.Height - headerHeight - footerHeight
 		r.viewport.Width = msg.Width
-		r.viewport.Height = viewportHeight
+		r.layout()
 		r.setViewport()
-		r.input.Focus()
+		if r.ready && !r.autoscroll {
+			r.viewport.SetYOffset(int(math.Round(percent * float64(max(r.viewport.TotalLineCount()-r.viewport.Height, 0)))))
+		}
+		if !r.multiline {
+			r.input.Focus()
+		}
 		r.ready = true
 
-	case tea.MouseButton:
-		switch msg {
-		case tea.MouseButtonWheelUp:
-			r.autoscroll = false
-			r.viewport.ScrollUp(3)
-		case tea.MouseButtonWheelDown:
-			r.viewport.ScrollDown(3)
-		}
-		// Handle mouse actions if needed in future
 	case tea.KeyMsg:
+		if r.GetState().Status.PendingPlan != nil {
+			switch msg.String() {
+			case "y", "Y":
+				r.Dispatcher.Dispatch(ApprovePlanAction{})
+				return r, nil
+			case "n", "N", "esc":
+				r.Dispatcher.Dispatch(RejectPlanAction{})
+				return r, nil
+			}
+		}
+
+		if r.GetState().Status.PendingToolCall != nil {
+			switch msg.String() {
+			case "y", "Y":
+				r.answerApproval(true)
+				return r, nil
+			case "n", "N", "esc":
+				r.answerApproval(false)
+				return r, nil
+			}
+		}
+
 		switch msg.String() {
 		case "ctrl+c", "ctrl+d":
-			return r, tea.Quit
-		case "esc":
-			r.input.Reset()
+			return r, r.quit()
+		case modeCycleKey:
+			// shift+tab isn't bound by the text input, unlike ctrl+p which picks suggestions
+			r.Dispatcher.Dispatch(state.SetModeAction{Mode: r.GetState().Context.Mode.Next()})
+		case "esc", cancelKey:
+			// while the model is replying, esc stops it and leaves the input alone
+			if r.cancel != nil {
+				r.cancel()
+				return r, nil
+			}
+			if msg.String() == cancelKey {
+				break
+			}
+
+			r.resetInput()
+			r.confirmInput = ""
+			r.history.reset()
 			r.setViewport()
-		case "enter":
-			if input, ok := r.handleTextInput(r.input.Value()); ok {
-				if strings.HasPrefix(input, ":") {
-					r.handleCommand(input)
-				} else if err := NewMessage(r.Dispatcher, r.Provider, state.RoleUser, input); err != nil {
-					log.Fatalf("💩 failed to create user message: %v", err)
-				}
+		case "up", "down":
+			// the cursor moves between lines of a multi-line input
+			if r.multiline {
+				return r, r.updateTextarea(msg)
+			}
+			// a recalled input uses up the key, otherwise it scrolls the viewport as usual
+			if r.recallHistory(msg.String() == "up") {
+				return r, nil
 			}
-		default:
-			// Let the text input handle other keys
 			r.input, cmd = r.input.Update(msg)
 			cmds = append(cmds, cmd)
+		case "enter", newlineKey:
+			action, value := enterAction(msg.String(), r.inputValue())
+			if action == inputNewline {
+				r.newline(msg.String(), value)
+				return r, nil
+			}
+
+			r.actionErr = nil
+			if input, ok := r.handleTextInput(value); ok {
+				r.history.push(input)
+				r.Dispatcher.Dispatch(RecordInputAction{Input: input})
+				// a colon on the first line of a multi-line prompt doesn't make it a command
+				if strings.HasPrefix(input, ":") && !strings.Contains(input, "\n") {
+					_, cmd = r.handleCommand(input)
+					cmds = append(cmds, cmd)
+				} else if estimate, confirm := r.needsConfirmation(input); confirm {
+					r.confirmInput = input
+					r.setInputValue(input)
+					r.viewport.SetContent(wordwrap.String(fmt.Sprintf(
+						"This prompt is estimated at ~%d tokens, over the %d token threshold.\nPress enter again to send it or esc to cancel.\n",
+						estimate, r.confirmTokens), int(math.Max(40, float64(r.viewport.Width)-10))))
+				} else {
+					r.confirmInput = ""
+					if err := r.send(input); err != nil {
+						log.Fatalf("💩 failed to create user message: %v", err)
+					}
+				}
+			}
+		default:
+			switch {
+			case r.multiline:
+				cmds = append(cmds, r.updateTextarea(msg))
+			case msg.Paste && strings.ContainsRune(string(msg.Runes), '\n'):
+				// pasting several lines switches to the multi-line input
+				runes := []rune(r.input.Value())
+				pos := min(r.input.Position(), len(runes))
+				r.startMultiline(string(runes[:pos]) + string(msg.Runes) + string(runes[pos:]))
+			default:
+				// Let the text input handle other keys
+				r.input, cmd = r.input.Update(msg)
+				cmds = append(cmds, cmd)
+			}
 		}
 	}
 
 	r.swatch, cmd = r.swatch.Update(msg)
 	cmds = append(cmds, cmd)
+
+	offset := r.viewport.YOffset
 	r.viewport, cmd = r.viewport.Update(msg)
 	cmds = append(cmds, cmd)
+	r.followScroll(msg, offset)
 
 	r.spinner, cmd = r.spinner.Update(msg)
 	cmds = append(cmds, cmd)
 
-	if r.viewport.ScrollPercent() <= .95 && r.autoscroll {
-		r.autoscroll = false
-	} else if r.viewport.ScrollPercent() > .95 {
-		r.autoscroll = true
-	}
-
 	return r, tea.Batch(cmds...)
 }
 
 // View renders the REPL interface
 func (r *REPLScreen) View() string {
+	if r.quitting && !r.altScreen {
+		return ""
+	}
+
 	if !r.ready {
 		return "Initializing..."
 	}
@@ -151,7 +555,7 @@ func (r *REPLScreen) View() string {
 	var b strings.Builder
 
 	// Header
-	header := CurrentStyles().Header.Render("TAI - Terminal AI Assistant")
+	header := CurrentStyles().Header.Render(fmt.Sprintf("TAI - Terminal AI Assistant · %s", modelLabel(r.GetState())))
 
 	b.WriteString(header)
 	b.WriteString("\n")
@@ -164,11 +568,46 @@ func (r *REPLScreen) View() string {
 	b.WriteString(strings.Repeat("─", r.width))
 	b.WriteString("\n")
 
-	b.WriteString(CurrentStyles().Subtle.Render(fmt.Sprintf("%s %s", r.spinner.View(), r.swatch.View())))
+	b.WriteString(CurrentStyles().Subtle.Render(r.spinner.View()))
+	if activity := r.GetState().Status.Activity; activity != "" {
+		b.WriteString(" ")
+		b.WriteString(CurrentStyles().Accent.Render(activity))
+	}
+	b.WriteString(CurrentStyles().Subtle.Render(" " + r.swatch.View()))
+	b.WriteString(" ")
+	b.WriteString(r.tokenIndicator())
+	if r.cancel != nil {
+		b.WriteString(CurrentStyles().Subtle.Render(" esc to stop"))
+	}
+	if r.stalled {
+		b.WriteString(" ")
+		b.WriteString(CurrentStyles().Warning.Render("still waiting on the model…"))
+	}
+	if r.actionErr != nil {
+		b.WriteString(" ")
+		b.WriteString(CurrentStyles().Warning.Render(r.actionErr.Error()))
+	}
+	if plan := r.GetState().Status.PendingPlan; plan != nil {
+		b.WriteString(" ")
+		b.WriteString(CurrentStyles().Warning.Render(fmt.Sprintf("run the %d tool call(s) in this plan? [y/n]", len(plan))))
+	}
+	if tc := r.GetState().Status.PendingToolCall; tc != nil {
+		b.WriteString(" ")
+		b.WriteString(CurrentStyles().Warning.Render(fmt.Sprintf("run %s %s? [y/n]", tc.Function.Name, tc.Function.Arguments)))
+	}
 	b.WriteString("\n")
-	b.WriteString(ChatInput(r.input).View())
+	if r.multiline {
+		b.WriteString(ChatTextArea(r.textarea).View())
+	} else {
+		b.WriteString(ChatInput(r.input).View())
+	}
 
-	footer := CurrentStyles().Subtle.Render("\n:help, :clear, :quit, :theme | Ctrl+C to exit")
+	b.WriteString("\n")
+	b.WriteString(modeIndicator(r.GetState().Context.Mode))
+	if usage := usageTotals(r.GetState().Context); usage != "" {
+		b.WriteString(CurrentStyles().Subtle.Render(" | " + usage))
+	}
+	footer := CurrentStyles().Subtle.Render(" | :help, :clear, :quit, :theme | Ctrl+C to exit")
 	b.WriteString(footer)
 
 	return b.String()
@@ -178,12 +617,218 @@ func (r *REPLScreen) View() string {
 func (r *REPLScreen) handleCommand(cmd string) (tea.Model, tea.Cmd) {
 	wrapWidth := int(math.Max(40, float64(r.viewport.Width)-10))
 
-	switch strings.ToLower(strings.TrimSpace(cmd)) {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return r, nil
+	}
+
+	switch strings.ToLower(fields[0]) {
 	case ":quit", ":q", ":exit":
-		return r, tea.Quit
+		return r, r.quit()
 	case ":clear", ":c":
 		r.Dispatcher.Dispatch(ClearMessagesAction{})
 		return r, nil
+	case ":file", ":f":
+		return r, pushScreen(NewFilePicker(r.GetState().Context.WorkingDirectory))
+	case ":persona", ":p":
+		if len(fields) < 2 {
+			s := r.GetState()
+			r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Current persona: %s\nUsage: :persona <name> [prompt]\n", s.Context.AgentName), wrapWidth))
+			return r, nil
+		}
+
+		r.Dispatcher.Dispatch(SetPersonaAction{Name: fields[1], Prompt: commandRest(cmd, 2)})
+		return r, nil
+	case ":system":
+		if len(fields) < 2 {
+			// what's actually sent, the system prompt wrapped in tai's own instructions
+			r.viewport.SetContent(wordwrap.String(strings.TrimSpace(state.SystemPrompt(r.GetState()))+"\n\nUsage: :system [prompt]\n", wrapWidth))
+			r.viewport.GotoTop()
+			return r, nil
+		}
+
+		r.Dispatcher.Dispatch(SetSystemPromptAction{Prompt: commandRest(cmd, 1)})
+		return r, nil
+	case ":set":
+		s := r.GetState()
+		if len(fields) < 3 {
+			p := s.Model.Effective()
+			r.viewport.SetContent(wordwrap.String(fmt.Sprintf(
+				"temperature: %s\ntop_p: %s\nmax_tokens: %d\nUsage: :set <temperature|top_p|max_tokens> <value|default>\n",
+				paramText(p.Temperature), paramText(p.TopP), p.MaxTokens), wrapWidth))
+			return r, nil
+		}
+
+		action, err := setOverride(s.Model.Overrides, fields[1], fields[2])
+		if err == nil {
+			_, err = action.Execute(s)
+		}
+		if err != nil {
+			r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Could not set %s: %v\n", fields[1], err), wrapWidth))
+			return r, nil
+		}
+
+		r.Dispatcher.Dispatch(action)
+		return r, nil
+	case ":mode", ":m":
+		if len(fields) < 2 {
+			r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Current mode: %s\nUsage: :mode <plan|execute|yolo> (or press %s to cycle)\n", r.GetState().Context.Mode, modeCycleKey), wrapWidth))
+			return r, nil
+		}
+
+		mode := state.Mode(strings.ToLower(fields[1]))
+		if !mode.Valid() {
+			r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Unknown mode: %s (expected plan, execute or yolo)\n", fields[1]), wrapWidth))
+			return r, nil
+		}
+
+		r.Dispatcher.Dispatch(state.SetModeAction{Mode: mode})
+		r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Switched to %s mode\n", mode), wrapWidth))
+		return r, nil
+	case ":allow", ":deny":
+		if len(fields) < 2 {
+			r.viewport.SetContent(wordwrap.String(permissionsText(r.GetState().Permissions), wrapWidth))
+			return r, nil
+		}
+
+		var action state.Action = AllowAction{Pattern: commandRest(cmd, 1)}
+		if strings.ToLower(fields[0]) == ":deny" {
+			action = DenyAction{Pattern: commandRest(cmd, 1)}
+		}
+
+		r.Dispatcher.Dispatch(action)
+		r.viewport.SetContent(wordwrap.String(permissionsText(r.GetState().Permissions), wrapWidth))
+		return r, nil
+	case ":retry":
+		s := r.GetState()
+		if s.Model.Busy {
+			r.viewport.SetContent(wordwrap.String("Wait for the reply to finish before retrying\n", wrapWidth))
+			return r, nil
+		}
+
+		idx, err := retryPoint(s.Context.Messages)
+		if err != nil {
+			r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Nothing to retry, %v\n", err), wrapWidth))
+			return r, nil
+		}
+
+		// resent like a normal prompt so the spinner and stopwatch start over
+		r.Dispatcher.Dispatch(RetryAction{})
+		if err := r.send(s.Context.Messages[idx].Content); err != nil {
+			r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Could not retry: %v\n", err), wrapWidth))
+		}
+		return r, nil
+	case ":undo", ":redo":
+		if r.GetState().Model.Busy {
+			r.viewport.SetContent(wordwrap.String("Wait for the reply to finish before undoing\n", wrapWidth))
+			return r, nil
+		}
+
+		var action state.Action = state.UndoAction{}
+		if strings.ToLower(fields[0]) == ":redo" {
+			action = state.RedoAction{}
+		}
+		r.Dispatcher.Dispatch(action)
+		return r, nil
+	case ":copy":
+		reply, err := lastReply(r.GetState().Context.Messages)
+		if err == nil {
+			err = CopyToClipboard(reply)
+		}
+		if err != nil {
+			r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Could not copy the last reply: %v\n", err), wrapWidth))
+			return r, nil
+		}
+
+		r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Copied the last reply to the clipboard (%d characters)\n", utf8.RuneCountInString(reply)), wrapWidth))
+		return r, nil
+	case ":tokens":
+		r.viewport.SetContent(tokensText(r.GetState().Context))
+		return r, nil
+	case ":history":
+		messages := r.GetState().Context.Messages
+		if len(fields) < 2 {
+			// the transcript is aligned into columns, wrapping would break them
+			r.viewport.SetContent(historyText(messages))
+			r.viewport.GotoTop()
+			return r, nil
+		}
+
+		text, err := historyMessageText(messages, fields[1])
+		if err != nil {
+			text = fmt.Sprintf("%v\nUsage: :history [n]\n", err)
+		}
+		r.viewport.SetContent(wordwrap.String(text, wrapWidth))
+		r.viewport.GotoTop()
+		return r, nil
+	case ":scratchpad", ":s":
+		r.viewport.SetContent(wordwrap.String(scratchpadText(r.GetState().Context.Scratchpad), wrapWidth))
+		return r, nil
+	case ":theme":
+		if len(fields) < 2 {
+			r.viewport.SetContent(wordwrap.String(themesText(), wrapWidth))
+			return r, nil
+		}
+
+		action := SwitchThemeAction{Name: strings.ToLower(fields[1])}
+		if !slices.Contains(ThemeManagerInstance.ListThemes(), action.Name) {
+			r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Unknown theme: %s\n%s", fields[1], themesText()), wrapWidth))
+			return r, nil
+		}
+
+		r.Dispatcher.Dispatch(action)
+		return r, nil
+	case ":model":
+		if len(fields) < 2 {
+			return r, r.listModels()
+		}
+
+		s := r.GetState()
+		r.Dispatcher.Dispatch(ChangeProviderAction{Provider: s.Model.Provider, Name: fields[1], Params: s.Model.Params})
+		return r, nil
+	case ":save", ":export":
+		s := r.GetState()
+		write, ext := SaveConversation, ".json"
+		if strings.ToLower(fields[0]) == ":export" {
+			write, ext = ExportConversation, ".md"
+		}
+
+		path := conversationPath(s, commandRest(cmd, 1), ext)
+		if err := write(path, s.Context.Messages); err != nil {
+			r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Could not save the conversation: %v\n", err), wrapWidth))
+			return r, nil
+		}
+
+		r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Saved %d message(s) to %s\n", len(s.Context.Messages), path), wrapWidth))
+		return r, nil
+	case ":config":
+		if r.configSummary == "" {
+			r.viewport.SetContent("No configuration available\n")
+			return r, nil
+		}
+
+		// the summary is already aligned into columns, wrapping would break them
+		r.viewport.SetContent(r.configSummary)
+		return r, nil
+	case ":sessions":
+		if len(fields) < 2 || strings.ToLower(fields[1]) != "prune" {
+			r.viewport.SetContent(wordwrap.String("Usage: :sessions prune\n", wrapWidth))
+			return r, nil
+		}
+
+		if r.pruneSessions == nil {
+			r.viewport.SetContent(wordwrap.String("Sessions are not being saved\n", wrapWidth))
+			return r, nil
+		}
+
+		removed, err := r.pruneSessions()
+		if err != nil {
+			r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Could not prune sessions: %v\n", err), wrapWidth))
+			return r, nil
+		}
+
+		r.viewport.SetContent(wordwrap.String(fmt.Sprintf("Pruned %d session(s)\n", len(removed)), wrapWidth))
+		return r, nil
 	case ":help", ":h":
 		helpText := `# TAI Commands
 
@@ -193,16 +838,41 @@ func (r *REPLScreen) handleCommand(cmd string) (tea.Model, tea.Cmd) {
 |---------|----------|-------------|
 | **:help** | **:h** | Show this help |
 | **:clear** | **:c** | Clear conversation |
+| **:file** | **:f** | Fuzzy find a file and insert its path |
+| **:persona** *name* [*prompt*] | **:p** | Switch the agent persona |
+| **:system** [*prompt*] | | Show the full system prompt that's sent, or replace your part of it |
+| **:mode** *plan\|execute\|yolo* | **:m** | Switch mode, or press **shift+tab** to cycle |
+| **:allow** [*pattern*] | | Allow tools to run commands matching *pattern* (e.g. *git \**), or list the rules |
+| **:deny** [*pattern*] | | Never let tools run commands matching *pattern*, deny wins over allow |
+| **:retry** | | Regenerate the last reply to your last message |
+| **:undo** | | Undo the last change to the conversation, files tools changed stay as they are |
+| **:redo** | | Redo the last change **:undo** rolled back |
+| **:copy** | | Copy the last reply's raw Markdown to the clipboard |
+| **:tokens** | | Show the tokens each reply used and the session totals |
+| **:history** [*n*] | | List the conversation's messages, or show message *n* in full |
+| **:scratchpad** | **:s** | Show the model's scratchpad notes |
+| **:set** *param* *value* | | Override temperature, top_p or max_tokens (*default* resets) |
+| **:theme** [*name*] | | Switch the color theme, or list the themes |
+| **:model** [*name*] | | Switch to another model, or list the provider's models |
+| **:save** [*path*] | | Save the conversation as JSON (default: session-*id*.json) |
+| **:export** [*path*] | | Export the conversation as Markdown (default: session-*id*.md) |
+| **:config** | | Show the effective configuration and where each value came from |
+| **:sessions prune** | | Remove the oldest saved sessions beyond -max-sessions |
 | **:quit** | **:q** | Exit application |
 
 ## Usage Tips
 
 - Type your message and press **Enter** to send
-- Use **mouse wheel** or **arrow keys** to scroll through history
+- End a line with **\\** or press **alt+enter** to keep typing on a new line, **enter** sends the whole prompt
+- Press **esc** or **ctrl+x** while the model is replying to stop it, the reply so far is kept
+- Press **up** and **down** on an empty input to recall what you typed before
+- Use **mouse wheel** or **arrow keys** to scroll through the conversation
 - Messages support **markdown formatting**
+- In **plan** mode tools are only proposed, in **execute** mode press **y** or **n** when a tool wants to change something, **yolo** runs everything
+- With **-review-plan** the tool calls of a reply are shown together as a plan, **y** runs them all and **n** runs none
 `
 		wrappedHelp := wordwrap.String(helpText, wrapWidth)
-		if renderer, err := glamour.NewTermRenderer(glamour.WithWordWrap(wrapWidth)); err == nil {
+		if renderer, err := glamour.NewTermRenderer(glamour.WithStandardStyle(r.glamourStyle), glamour.WithWordWrap(wrapWidth)); err == nil {
 			if renderedHelp, err := renderer.Render(helpText); err == nil {
 				wrappedHelp = strings.TrimSpace(renderedHelp)
 			}
@@ -221,12 +891,165 @@ func (r *REPLScreen) handleCommand(cmd string) (tea.Model, tea.Cmd) {
 	}
 }
 
+// needsConfirmation estimates the prompt tokens sending input would use and reports
+// whether it's over the threshold and hasn't already been confirmed
+func (r *REPLScreen) needsConfirmation(input string) (int, bool) {
+	if r.confirmTokens <= 0 || input == r.confirmInput {
+		return 0, false
+	}
+
+	estimate := estimatePrompt(r.GetState(), input)
+	return estimate, llm.ExceedsTokenThreshold(estimate, r.confirmTokens)
+}
+
+// estimatePrompt estimates the prompt tokens the next request would use with the current
+// model if input were sent, an empty input estimates just the system prompt and history
+func estimatePrompt(s state.AppState, input string) int {
+	model := tokenizerModel(s)
+	messages := s.Context.Messages
+	if input != "" {
+		messages = append(slices.Clone(messages), state.Message{Role: state.RoleUser, Content: input})
+	}
+	return llm.TokenCounterFor(model)(state.SystemPrompt(s)) + llm.EstimateMessageTokens(messages, model)
+}
+
+// tokenCount formats an estimated token count, in thousands once it's large
+func tokenCount(n int) string {
+	if n >= 1000 {
+		return fmt.Sprintf("~%.1fk tokens", float64(n)/1000)
+	}
+	return fmt.Sprintf("~%d tokens", n)
+}
+
+// tokenizerModel names the model tokens are estimated for, the provider stands in for its default model
+func tokenizerModel(s state.AppState) string {
+	if s.Model.Name == "" {
+		return s.Model.Provider
+	}
+	return s.Model.Name
+}
+
+// tokenIndicator renders the estimated size of the next request for the footer, as a
+// warning once it's over the confirmation threshold
+func (r *REPLScreen) tokenIndicator() string {
+	estimate := r.historyTokens
+	if input := strings.TrimSpace(r.inputValue()); input != "" && !strings.HasPrefix(input, ":") {
+		estimate += llm.EstimateMessageTokens([]state.Message{{Role: state.RoleUser, Content: input}}, tokenizerModel(r.GetState()))
+	}
+
+	label := tokenCount(estimate)
+	if llm.ExceedsTokenThreshold(estimate, r.confirmTokens) {
+		return CurrentStyles().Warning.Render(label)
+	}
+	return CurrentStyles().Subtle.Render(label)
+}
+
+// setOverride returns the action that sets the named parameter override to value, or clears it when value is "default"
+func setOverride(overrides state.ModelParams, name, value string) (SetModelOverridesAction, error) {
+	reset := strings.EqualFold(value, "default")
+
+	switch strings.ToLower(name) {
+	case "temperature":
+		overrides.Temperature = nil
+		if !reset {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return SetModelOverridesAction{}, fmt.Errorf("%q is not a number", value)
+			}
+			overrides.Temperature = &v
+		}
+	case "top_p":
+		overrides.TopP = nil
+		if !reset {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return SetModelOverridesAction{}, fmt.Errorf("%q is not a number", value)
+			}
+			overrides.TopP = &v
+		}
+	case "max_tokens":
+		overrides.MaxTokens = 0
+		if !reset {
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return SetModelOverridesAction{}, fmt.Errorf("%q is not a whole number", value)
+			}
+			overrides.MaxTokens = v
+		}
+	default:
+		return SetModelOverridesAction{}, fmt.Errorf("unknown parameter, expected temperature, top_p or max_tokens")
+	}
+
+	return SetModelOverridesAction{Overrides: overrides}, nil
+}
+
+// paramText renders a sampling parameter for :set, "default" when it is unset
+func paramText(v *float64) string {
+	if v == nil {
+		return "default"
+	}
+	return strconv.FormatFloat(*v, 'g', -1, 64)
+}
+
+// modeIndicator renders the current mode for the footer, yolo stands out as a warning
+func modeIndicator(mode state.Mode) string {
+	label := fmt.Sprintf("mode: %s (%s)", mode, modeCycleKey)
+	if mode == state.YoloMode {
+		return CurrentStyles().Warning.Render(label)
+	}
+	return CurrentStyles().Accent.Render(label)
+}
+
+// scratchpadText renders the scratchpad as "key: value" lines sorted by key
+func scratchpadText(pad map[string]string) string {
+	if len(pad) == 0 {
+		return "Scratchpad is empty\n"
+	}
+
+	keys := make([]string, 0, len(pad))
+	for k := range pad {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Scratchpad (%d/%d bytes)\n\n", tools.ScratchpadSize(pad), tools.MaxScratchpadSize)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s: %s\n", k, pad[k])
+	}
+	return b.String()
+}
+
+// recallHistory replaces the input with the previous or next submitted input. Inputs are
+// only recalled when the input is empty, the cursor is at its start, or it still holds
+// the recalled input, otherwise the key is left for the input and viewport.
+func (r *REPLScreen) recallHistory(older bool) bool {
+	value := r.input.Value()
+	if value != "" && r.input.Position() != 0 && !(r.history.browsing() && value == r.history.current()) {
+		return false
+	}
+
+	recall := r.history.next
+	if older {
+		recall = func() (string, bool) { return r.history.prev(value) }
+	}
+
+	input, ok := recall()
+	if !ok {
+		return false
+	}
+
+	r.input.SetValue(input)
+	r.input.CursorEnd()
+	return true
+}
+
 func (r *REPLScreen) handleTextInput(content string) (input string, ok bool) {
 	if input = strings.TrimSpace(content); input != "" {
 		ok = true
 	}
 
-	defer r.input.SetValue("")
+	defer r.resetInput()
 	return
 }
 
@@ -234,23 +1057,13 @@ func (r *REPLScreen) handleTextInput(content string) (input string, ok bool) {
 func (r *REPLScreen) setViewport() {
 	newState := r.GetState()
 	var builder strings.Builder
-	var renderer *glamour.TermRenderer
-	var err error
 
 	// Apply additional wordwrap if needed (glamour should handle most of it)
 	wrapWidth := 40 // Minimum wrap width
 	if ww := r.viewport.Width - 10; ww > wrapWidth {
 		wrapWidth = ww
 	}
-
-	// Create glamour renderer with dark theme
-	if renderer, err = glamour.NewTermRenderer(
-		glamour.WithStandardStyle("dracula"),
-		glamour.WithWordWrap(wrapWidth),
-	); err != nil {
-		// Fallback to plain rendering if glamour fails
-		renderer = nil
-	}
+	renderer := r.markdownRenderer(wrapWidth)
 
 	msgs := append([]state.Message{{
 		Timestamp: newState.Context.Created,
@@ -261,37 +1074,359 @@ func (r *REPLScreen) setViewport() {
 
 	for _, msg := range msgs {
 		role := string(msg.Role)
-		renderedContent := wordwrap.String(msg.Content, wrapWidth)
-
 		switch msg.Role {
 		case state.RoleUser:
 			role = CurrentStyles().Subtle.Render(role)
-			renderedContent = CurrentStyles().Subtle.Render(renderedContent)
 		case state.RoleSystem:
 			role = CurrentStyles().Accent.Render("System >")
-			renderedContent = CurrentStyles().Primary.Render(renderedContent)
-		case state.RoleTool:
-			role = CurrentStyles().Primary.Render(role)
 		case state.RoleAssistant:
-			role = CurrentStyles().Primary.Bold(true).Render(fmt.Sprintf("%s ~> %s", newState.Model.Provider, newState.Model.Name))
+			role = CurrentStyles().Primary.Bold(true).Render(assistantLabel(newState))
 			fallthrough
 		default:
 			role = CurrentStyles().Primary.Render(role)
-			if rendered, err := renderer.Render(msg.Content); err == nil {
-				renderedContent = rendered
-			}
 		}
 
 		fmt.Fprintf(
 			&builder,
 			"%s\n\t%s\n\n",
 			role,
-			renderedContent,
+			r.renderMessage(msg, renderer, wrapWidth),
 		)
 	}
 
 	r.viewport.SetContent(builder.String())
-	if r.autoscroll && r.viewport.ScrollPercent() < .9 {
+	if r.autoscroll {
 		r.viewport.GotoBottom()
 	}
 }
+
+// followScroll decides whether the viewport keeps following new output after the user
+// scrolled it with msg from offset. Scrolling up stops following so streamed text doesn't
+// pull the view back down, scrolling back to the bottom follows again. Only the user's
+// scrolling changes it, content growing under a scrolled up view doesn't.
+func (r *REPLScreen) followScroll(msg tea.Msg, offset int) {
+	switch msg.(type) {
+	case tea.KeyMsg, tea.MouseMsg:
+	default:
+		return
+	}
+
+	if r.viewport.YOffset < offset {
+		r.autoscroll = false
+	} else if r.viewport.AtBottom() {
+		r.autoscroll = true
+	}
+}
+
+// renderedMessage is a message body as last rendered, reused until the message changes
+type renderedMessage struct {
+	content      string
+	trimmed      bool
+	finishReason string
+	body         string
+}
+
+// markdownRenderer returns the glamour renderer for wrapWidth, building a new one and
+// dropping the rendered messages when the width or style changed. nil when glamour fails.
+func (r *REPLScreen) markdownRenderer(wrapWidth int) *glamour.TermRenderer {
+	if r.renderer != nil && r.rendererWidth == wrapWidth && r.rendererStyle == r.glamourStyle {
+		return r.renderer
+	}
+
+	r.renderCache = make(map[string]renderedMessage)
+	r.rendererWidth = wrapWidth
+	r.rendererStyle = r.glamourStyle
+
+	// Create glamour renderer with the theme's style, or the one picked through TAI_GLAMOUR_STYLE
+	renderer, err := glamour.NewTermRenderer(
+		glamour.WithStandardStyle(r.glamourStyle),
+		glamour.WithWordWrap(wrapWidth),
+	)
+	if err != nil {
+		// Fallback to plain rendering if glamour fails
+		renderer = nil
+	}
+	r.renderer = renderer
+	return renderer
+}
+
+// renderMessage renders a message body, reusing the cached render while its content is unchanged
+// so only the message being streamed is rendered again
+func (r *REPLScreen) renderMessage(msg state.Message, renderer *glamour.TermRenderer, wrapWidth int) string {
+	key := string(msg.Role) + ":" + msg.ID
+	if cached, ok := r.renderCache[key]; ok &&
+		cached.content == msg.Content &&
+		cached.trimmed == msg.ContextTrimmed &&
+		cached.finishReason == msg.FinishReason {
+		return cached.body
+	}
+
+	body := wordwrap.String(msg.Content, wrapWidth)
+	switch msg.Role {
+	case state.RoleUser:
+		body = CurrentStyles().Subtle.Render(body)
+		if r.userMarkdown && renderer != nil {
+			if rendered, err := renderer.Render(msg.Content); err == nil {
+				body = rendered
+			}
+		}
+	case state.RoleSystem:
+		body = CurrentStyles().Primary.Render(body)
+	case state.RoleTool:
+		body = renderToolOutput(msg.Content, wrapWidth)
+	default:
+		if renderer != nil {
+			if rendered, err := renderer.Render(msg.Content); err == nil {
+				body = rendered
+			}
+		}
+	}
+
+	if msg.ContextTrimmed {
+		body = strings.TrimRight(body, "\n") + "\n\t" + CurrentStyles().Subtle.Render(ContextTrimmedNotice)
+	}
+
+	if notice := FinishNotice(msg.FinishReason); notice != "" {
+		body = strings.TrimRight(body, "\n") + "\n\t" + CurrentStyles().Warning.Render("⚠ "+notice)
+	}
+
+	r.renderCache[key] = renderedMessage{
+		content:      msg.Content,
+		trimmed:      msg.ContextTrimmed,
+		finishReason: msg.FinishReason,
+		body:         body,
+	}
+	return body
+}
+
+// commandRest returns the raw text of a command after its first n words
+func commandRest(cmd string, n int) string {
+	rest := strings.TrimSpace(cmd)
+	for i := 0; i < n && rest != ""; i++ {
+		if idx := strings.IndexFunc(rest, unicode.IsSpace); idx >= 0 {
+			rest = strings.TrimSpace(rest[idx:])
+		} else {
+			rest = ""
+		}
+	}
+	return rest
+}
+
+// applyTheme repaints the parts of the REPL that captured the previous theme's styles
+func (r *REPLScreen) applyTheme() {
+	r.input.Prompt = renderPrompt(">")
+	setTextAreaPrompt(&r.textarea, ">")
+	r.spinner.Style = CurrentStyles().Accent
+
+	// TAI_GLAMOUR_STYLE still wins, otherwise markdown follows the new theme
+	style, _ := ResolveGlamourStyle(CurrentTheme(), os.Getenv(GlamourStyleEnv))
+	r.glamourStyle = style
+
+	// cached messages were rendered with the old theme's styles
+	r.renderer = nil
+	r.setViewport()
+}
+
+// themesText lists the available themes with the current one marked
+func themesText() string {
+	names := ThemeManagerInstance.ListThemes()
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Themes:\n")
+	for _, name := range names {
+		marker := "  "
+		if name == ThemeManagerInstance.CurrentName() {
+			marker = "* "
+		}
+		fmt.Fprintf(&b, "%s%s\n", marker, name)
+	}
+	b.WriteString("Usage: :theme <name>\n")
+	return b.String()
+}
+
+// listModels asks the provider for its models without blocking the update loop
+func (r *REPLScreen) listModels() tea.Cmd {
+	provider := r.Provider
+	return func() tea.Msg {
+		if provider == nil {
+			return modelsMsg{err: fmt.Errorf("no provider configured")}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		models, err := provider.Models(ctx)
+		return modelsMsg{models: models, err: err}
+	}
+}
+
+// usageTotals summarises the tokens the session has used for the footer, empty until a provider reports usage
+func usageTotals(c state.Context) string {
+	if c.PromptTokens == 0 && c.CompletionTokens == 0 {
+		return ""
+	}
+	return fmt.Sprintf("prompt %d / completion %d / total %d", c.PromptTokens, c.CompletionTokens, c.PromptTokens+c.CompletionTokens)
+}
+
+// tokensText breaks the session's token usage down by reply for :tokens
+func tokensText(c state.Context) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "#\trole\tprompt\tcompletion\ttotal\t")
+	for i, msg := range c.Messages {
+		if msg.Usage == (state.TokenUsage{}) {
+			continue
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t\n", i+1, msg.Role, msg.Usage.Prompt, msg.Usage.Completion, msg.Usage.Total)
+	}
+	fmt.Fprintf(w, "\tsession\t%d\t%d\t%d\t\n", c.PromptTokens, c.CompletionTokens, c.PromptTokens+c.CompletionTokens)
+	w.Flush()
+
+	if c.PromptTokens == 0 && c.CompletionTokens == 0 {
+		b.WriteString("\nNo usage reported yet, not every provider reports it\n")
+	}
+	return b.String()
+}
+
+// historyPreviewLength is how many characters of each message :history shows
+const historyPreviewLength = 60
+
+// historyText numbers the conversation's messages for :history, one line each with
+// the start of the message's content and the tools it called
+func historyText(messages []state.Message) string {
+	if len(messages) == 0 {
+		return "No messages yet\n"
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\ttime\trole\tmessage")
+	for i, msg := range messages {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, historyTime(msg.Timestamp), msg.Role, historyPreview(msg))
+	}
+	w.Flush()
+
+	b.WriteString("\nUsage: :history <n> to show a message in full\n")
+	return b.String()
+}
+
+// historyMessageText shows the message numbered n by historyText in full
+func historyMessageText(messages []state.Message, n string) (string, error) {
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 1 || i > len(messages) {
+		return "", fmt.Errorf("no message %s, the conversation has %d", n, len(messages))
+	}
+	msg := messages[i-1]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#%d %s at %s\n\n", i, msg.Role, historyTime(msg.Timestamp))
+	if msg.Content != "" {
+		b.WriteString(strings.TrimRight(msg.Content, "\n"))
+		b.WriteString("\n")
+	}
+	if msg.Role == state.RoleAssistant {
+		for _, tc := range msg.ToolCalls {
+			fmt.Fprintf(&b, "\ncalled %s %s\n", tc.Function.Name, tc.Function.Arguments)
+		}
+	}
+	return b.String(), nil
+}
+
+// historyTime formats when a message was sent, messages from before timestamps were kept have none
+func historyTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("15:04:05")
+}
+
+// historyPreview squashes msg onto one line and cuts it to historyPreviewLength
+// characters, naming the tools an assistant message called
+func historyPreview(msg state.Message) string {
+	preview := strings.Join(strings.Fields(msg.Content), " ")
+	if runes := []rune(preview); len(runes) > historyPreviewLength {
+		preview = strings.TrimRight(string(runes[:historyPreviewLength]), " ") + "..."
+	}
+
+	if msg.Role == state.RoleAssistant && len(msg.ToolCalls) > 0 {
+		names := make([]string, len(msg.ToolCalls))
+		for i, tc := range msg.ToolCalls {
+			names[i] = tc.Function.Name
+		}
+		preview = strings.TrimSpace(fmt.Sprintf("%s [called %s]", preview, strings.Join(names, ", ")))
+	}
+	return preview
+}
+
+// planText lists the tool calls of a proposed plan in the order they'll run, wrapped to
+// width, showing the change each edit asks for as a diff
+func planText(calls []state.ToolCall, width int) string {
+	var b strings.Builder
+	b.WriteString("Proposed plan, nothing runs until you answer y or n\n\n")
+	for i, tc := range calls {
+		if diff, ok := editCallDiff(tc); ok {
+			fmt.Fprintf(&b, "%d. %s\n%s", i+1, tc.Function.Name, renderDiff(diff, width))
+			continue
+		}
+		b.WriteString(wordwrap.String(fmt.Sprintf("%d. %s %s", i+1, tc.Function.Name, tc.Function.Arguments), width))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// permissionsText lists the allow and deny rules for :allow and :deny
+func permissionsText(p state.Permissions) string {
+	var b strings.Builder
+	rules := func(title string, patterns []string, none string) {
+		fmt.Fprintf(&b, "%s:\n", title)
+		if len(patterns) == 0 {
+			fmt.Fprintf(&b, "  (%s)\n", none)
+		}
+		for _, pattern := range patterns {
+			fmt.Fprintf(&b, "  %s\n", pattern)
+		}
+	}
+
+	rules("Allowed", p.Allow, "everything not denied")
+	rules("Denied", p.Deny, "nothing")
+	b.WriteString("Usage: :allow <pattern> | :deny <pattern>, e.g. :allow git *\n")
+	return b.String()
+}
+
+// modelsText describes the models the provider listed for :model
+func (r *REPLScreen) modelsText(msg modelsMsg) string {
+	s := r.GetState()
+	if msg.err != nil {
+		return fmt.Sprintf("Could not list models: %v\nUsage: :model <name>\n", msg.err)
+	}
+	if len(msg.models) == 0 {
+		return fmt.Sprintf("%s didn't report any models, specify one with :model <name>\n", s.Model.Provider)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Models available from %s:\n", s.Model.Provider)
+	for _, m := range msg.models {
+		marker := "  "
+		if m == s.Model.Name {
+			marker = "* "
+		}
+		fmt.Fprintf(&b, "%s%s\n", marker, m)
+	}
+	b.WriteString("Usage: :model <name>\n")
+	return b.String()
+}
+
+// modelLabel names the active provider and model, e.g. "ollama ~> llama3.2"
+func modelLabel(s state.AppState) string {
+	name := s.Model.Name
+	if name == "" {
+		name = "default model"
+	}
+	return fmt.Sprintf("%s ~> %s", s.Model.Provider, name)
+}
+
+// assistantLabel is the transcript label shown above assistant messages
+func assistantLabel(s state.AppState) string {
+	return fmt.Sprintf("%s (%s ~> %s)", s.Context.AgentName, s.Model.Provider, s.Model.Name)
+}
@@ -0,0 +1,1132 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adamveld12/tai/internal/llm"
+	"github.com/adamveld12/tai/internal/state"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour/styles"
+)
+
+func TestREPLScreen_PersonaCommand(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "hello"})
+
+	repl := NewREPL(s, nil)
+	repl.handleCommand(":persona reviewer Focus on finding bugs")
+
+	got := s.GetState()
+	if got.Context.AgentName != "reviewer" {
+		t.Errorf("AgentName = %q, want %q", got.Context.AgentName, "reviewer")
+	}
+	if got.Context.PersonaPrompt != "Focus on finding bugs" {
+		t.Errorf("PersonaPrompt = %q, want %q", got.Context.PersonaPrompt, "Focus on finding bugs")
+	}
+	if len(got.Context.Messages) != 1 {
+		t.Errorf("Expected history to be kept across persona switch, got %d messages", len(got.Context.Messages))
+	}
+
+	if label := assistantLabel(got); !strings.HasPrefix(label, "reviewer ") {
+		t.Errorf("assistantLabel() = %q, want it to start with the persona name", label)
+	}
+
+	prompt := state.SystemPrompt(got)
+	if !strings.Contains(prompt, `"reviewer" persona`) {
+		t.Error("SystemPrompt() should mention the active persona")
+	}
+	if !strings.Contains(prompt, "Focus on finding bugs") {
+		t.Error("SystemPrompt() should include the persona prompt")
+	}
+
+	// switching again without a prompt clears the previous prompt layer
+	repl.handleCommand(":persona coder")
+	got = s.GetState()
+	if got.Context.AgentName != "coder" || got.Context.PersonaPrompt != "" {
+		t.Errorf("persona = (%q, %q), want (%q, %q)", got.Context.AgentName, got.Context.PersonaPrompt, "coder", "")
+	}
+}
+
+func TestREPLScreen_SystemCommand(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 100, Height: 400})
+
+	repl.handleCommand(":system")
+	out := repl.viewport.View()
+	for _, want := range []string{"You are Tai", "<user prompt>", "Test prompt"} {
+		if !strings.Contains(out, want) {
+			t.Errorf(":system should show the effective prompt, missing %q:\n%s", want, out)
+		}
+	}
+
+	repl.handleCommand(":system  Answer in French ")
+	if got := s.GetState().Context.SystemPrompt; got != "Answer in French" {
+		t.Errorf("SystemPrompt = %q, want %q", got, "Answer in French")
+	}
+	if prompt := state.SystemPrompt(s.GetState()); !strings.Contains(prompt, "Answer in French") || strings.Contains(prompt, "Test prompt") {
+		t.Errorf("SystemPrompt() should only include the new prompt:\n%s", prompt)
+	}
+}
+
+func TestCommandRest(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		n    int
+		want string
+	}{
+		{":persona reviewer be  terse", 2, "be  terse"},
+		{":persona reviewer", 2, ""},
+		{":persona", 2, ""},
+		{"  :system   new prompt ", 1, "new prompt"},
+	}
+
+	for _, tt := range tests {
+		if got := commandRest(tt.cmd, tt.n); got != tt.want {
+			t.Errorf("commandRest(%q, %d) = %q, want %q", tt.cmd, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestREPLScreen_StallWarning(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil, WithStallWarning(20*time.Second))
+
+	clock := time.Now()
+	repl.now = func() time.Time { return clock }
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+
+	s.Dispatch(ChatCompletionStartedAction{})
+	repl.Update(ChatCompletionStartedAction{})
+
+	clock = clock.Add(10 * time.Second)
+	repl.Update(stallCheckMsg{})
+	if repl.stalled {
+		t.Fatal("Expected no stall warning before the threshold")
+	}
+
+	clock = clock.Add(11 * time.Second)
+	repl.Update(stallCheckMsg{})
+	if !repl.stalled {
+		t.Fatal("Expected a stall warning after the threshold")
+	}
+	if !strings.Contains(repl.View(), "still waiting on the model") {
+		t.Error("Expected the stall hint to be rendered")
+	}
+
+	repl.Update(MessageChunkAction{})
+	if repl.stalled {
+		t.Error("Expected a new chunk to clear the stall warning")
+	}
+	if strings.Contains(repl.View(), "still waiting on the model") {
+		t.Error("Expected the stall hint to be cleared after a chunk")
+	}
+}
+
+func TestREPLScreen_InlineQuitClearsView(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+
+	inline := NewREPL(s, nil, WithAltScreen(false))
+	inline.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+	if inline.View() == "" {
+		t.Fatal("Expected the inline REPL to render before quitting")
+	}
+
+	inline.handleCommand(":quit")
+	if inline.View() != "" {
+		t.Error("Expected the inline REPL to clear its frame on quit")
+	}
+
+	fullscreen := NewREPL(s, nil)
+	fullscreen.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+	fullscreen.handleCommand(":quit")
+	if fullscreen.View() == "" {
+		t.Error("Expected the alt screen REPL to keep rendering on quit")
+	}
+}
+
+func TestREPLScreen_TokenEstimateInFooter(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil, WithConfirmThreshold(2000))
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	empty := estimatePrompt(s.GetState(), "")
+	if empty == 0 || !strings.Contains(repl.View(), tokenCount(empty)) {
+		t.Errorf("Expected the footer to show the system prompt's ~%d tokens", empty)
+	}
+
+	repl.input.SetValue(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 20))
+	typed := estimatePrompt(s.GetState(), repl.input.Value())
+	if typed <= empty || !strings.Contains(repl.View(), tokenCount(typed)) {
+		t.Errorf("Expected the footer to include the input, want ~%d tokens", typed)
+	}
+
+	repl.input.Reset()
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: strings.Repeat("lorem ipsum ", 1000)})
+	repl.Update(MessageAction{})
+	if repl.historyTokens <= empty {
+		t.Errorf("historyTokens = %d, want it to grow with the conversation", repl.historyTokens)
+	}
+	if got := tokenCount(2500); got != "~2.5k tokens" {
+		t.Errorf("tokenCount(2500) = %q, want it in thousands", got)
+	}
+	if got := tokenCount(999); got != "~999 tokens" {
+		t.Errorf("tokenCount(999) = %q", got)
+	}
+}
+
+func TestREPLScreen_TokensCommand(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	if strings.Contains(repl.View(), "completion") {
+		t.Error("Expected no usage in the footer before any is reported")
+	}
+	repl.handleCommand(":tokens")
+	if !strings.Contains(repl.viewport.View(), "No usage reported yet") {
+		t.Error("Expected :tokens to say no usage has been reported")
+	}
+
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "hi"})
+	s.Dispatch(MessageAction{ID: "reply", Role: state.RoleAssistant})
+	s.Dispatch(MessageChunkAction{Message: state.Message{ID: "reply", Role: state.RoleAssistant, Content: "hello", Usage: state.TokenUsage{Prompt: 12, Completion: 3, Total: 15}}})
+
+	if !strings.Contains(repl.View(), "prompt 12 / completion 3 / total 15") {
+		t.Error("Expected the footer to show the session totals")
+	}
+
+	repl.handleCommand(":tokens")
+	out := repl.viewport.View()
+	if !strings.Contains(out, "assistant") || !strings.Contains(out, "session") || strings.Contains(out, "No usage") {
+		t.Errorf("Expected :tokens to break usage down by reply, got:\n%s", out)
+	}
+}
+
+func TestREPLScreen_RetryCommand(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	provider := &streamProvider{chunks: []llm.ChatStreamChunk{{Delta: "second answer"}, {Done: true}}}
+	repl := NewREPL(s, provider)
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+
+	repl.handleCommand(":retry")
+	if !strings.Contains(repl.viewport.View(), "Nothing to retry") {
+		t.Error("Expected :retry with no reply to say there's nothing to retry")
+	}
+
+	completed := make(chan struct{}, 1)
+	s.OnStateChange(func(a state.Action, _, _ state.AppState) {
+		if _, ok := a.(ChatCompletionCompletedAction); ok {
+			completed <- struct{}{}
+		}
+	})
+
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "question"})
+	s.Dispatch(MessageAction{Role: state.RoleAssistant, Content: "first answer"})
+	repl.handleCommand(":retry")
+
+	if !s.GetState().Model.Busy {
+		t.Error("Expected the retry to start a completion like a normal prompt")
+	}
+	select {
+	case <-completed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the retry to finish")
+	}
+
+	messages := s.GetState().Context.Messages
+	if len(messages) != 2 || messages[0].Content != "question" || messages[1].Content != "second answer" {
+		t.Errorf("messages = %+v, want the question answered again", messages)
+	}
+}
+
+func TestREPLScreen_UndoCommand(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "question"})
+	s.Dispatch(ChatCompletionStartedAction{})
+	s.Dispatch(MessageAction{ID: "reply", Role: state.RoleAssistant})
+	s.Dispatch(MessageChunkAction{Message: state.Message{ID: "reply", Role: state.RoleAssistant, Content: "answer"}})
+
+	repl.handleCommand(":undo")
+	if !strings.Contains(repl.viewport.View(), "Wait for the reply") {
+		t.Error("Expected :undo to wait for the reply to finish")
+	}
+
+	s.Dispatch(ChatCompletionCompletedAction{})
+	s.Dispatch(state.SetModeAction{Mode: state.YoloMode})
+
+	// the reply's chunks are undone along with it, the mode set afterwards stays
+	repl.handleCommand(":undo")
+	if messages := s.GetState().Context.Messages; len(messages) != 1 || messages[0].Content != "question" {
+		t.Errorf("messages after :undo = %+v, want only the question", messages)
+	}
+	if mode := s.GetState().Context.Mode; mode != state.YoloMode {
+		t.Errorf("Expected :undo to keep the mode, got %s", mode)
+	}
+
+	repl.handleCommand(":redo")
+	if messages := s.GetState().Context.Messages; len(messages) != 2 || messages[1].Content != "answer" {
+		t.Errorf("messages after :redo = %+v, want the reply back", messages)
+	}
+}
+
+func TestREPLScreen_InputHistory(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	s.Dispatch(RecordInputAction{Input: "from the saved session"})
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+
+	for _, input := range []string{":mode plan", ":scratchpad"} {
+		repl.input.SetValue(input)
+		repl.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	}
+
+	up := tea.KeyMsg{Type: tea.KeyUp}
+	down := tea.KeyMsg{Type: tea.KeyDown}
+	for _, want := range []string{":scratchpad", ":mode plan", "from the saved session"} {
+		repl.Update(up)
+		if got := repl.input.Value(); got != want {
+			t.Fatalf("input = %q after up, want %q", got, want)
+		}
+	}
+
+	repl.Update(down)
+	repl.Update(down)
+	repl.Update(down)
+	if got := repl.input.Value(); got != "" {
+		t.Errorf("input = %q after browsing past the newest input, want the empty draft back", got)
+	}
+
+	// with the cursor inside typed text, up belongs to the input
+	repl.input.SetValue("half typed")
+	repl.Update(up)
+	if got := repl.input.Value(); got != "half typed" {
+		t.Errorf("input = %q, want the typed text left alone", got)
+	}
+
+	want := []string{"from the saved session", ":mode plan", ":scratchpad"}
+	if got := s.GetState().Context.InputHistory; !slices.Equal(got, want) {
+		t.Errorf("InputHistory = %q, want %q so it's saved with the session", got, want)
+	}
+}
+
+func TestREPLScreen_EscCancelsReply(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	provider := &stallingProvider{streamProvider{chunks: []llm.ChatStreamChunk{{Delta: "so far"}}}}
+	repl := NewREPL(s, provider)
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+
+	completed := make(chan ChatCompletionCompletedAction, 1)
+	s.OnStateChange(func(a state.Action, _, _ state.AppState) {
+		if c, ok := a.(ChatCompletionCompletedAction); ok {
+			completed <- c
+		}
+	})
+
+	repl.input.SetValue("hello")
+	repl.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	repl.input.SetValue("next question")
+	if !strings.Contains(repl.View(), "esc to stop") {
+		t.Error("Expected the footer to say how to stop the reply")
+	}
+
+	repl.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	select {
+	case c := <-completed:
+		if !c.Cancelled {
+			t.Error("Expected esc to cancel the reply")
+		}
+		repl.Update(c)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the reply to be cancelled")
+	}
+
+	if repl.input.Value() != "next question" {
+		t.Errorf("input = %q, want esc to leave what's typed while cancelling", repl.input.Value())
+	}
+	if repl.cancel != nil || strings.Contains(repl.View(), "esc to stop") {
+		t.Error("Expected nothing left to cancel once the reply stopped")
+	}
+}
+
+func TestREPLScreen_ResizeKeepsScrollPosition(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	for i := 0; i < 40; i++ {
+		s.Dispatch(MessageAction{Role: state.RoleUser, Content: fmt.Sprintf("question %d is long enough to wrap once the terminal gets narrower than it is now", i)})
+	}
+
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	if !repl.viewport.AtBottom() {
+		t.Fatal("Expected the transcript to start at the bottom")
+	}
+
+	for i := 0; i < 100 && repl.viewport.ScrollPercent() > 0.5; i++ {
+		repl.Update(tea.MouseMsg{Action: tea.MouseActionPress, Button: tea.MouseButtonWheelUp})
+	}
+	percent := repl.viewport.ScrollPercent()
+	lines := repl.viewport.TotalLineCount()
+
+	repl.Update(tea.WindowSizeMsg{Width: 70, Height: 20})
+	if repl.viewport.TotalLineCount() == lines {
+		t.Fatal("Expected the narrower window to rewrap the transcript")
+	}
+	if got := repl.viewport.ScrollPercent(); math.Abs(got-percent) > 0.05 {
+		t.Errorf("ScrollPercent() after resize = %.2f, want about %.2f", got, percent)
+	}
+	if repl.autoscroll {
+		t.Error("Expected a resize not to start following the output again")
+	}
+
+	for i := 0; i < 200 && !repl.viewport.AtBottom(); i++ {
+		repl.Update(tea.MouseMsg{Action: tea.MouseActionPress, Button: tea.MouseButtonWheelDown})
+	}
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	if !repl.viewport.AtBottom() {
+		t.Error("Expected a resize to keep a view following the output at the bottom")
+	}
+}
+
+func TestREPLScreen_AutoscrollFollowsStream(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	for i := 0; i < 20; i++ {
+		s.Dispatch(MessageAction{Role: state.RoleUser, Content: fmt.Sprintf("question %d", i)})
+	}
+	s.Dispatch(MessageAction{ID: "reply", Role: state.RoleAssistant})
+
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	chunk := func() {
+		s.Dispatch(MessageChunkAction{Message: state.Message{ID: "reply", Role: state.RoleAssistant, Content: "more\n\n"}})
+		repl.Update(MessageChunkAction{})
+	}
+	wheel := func(button tea.MouseButton) {
+		repl.Update(tea.MouseMsg{Action: tea.MouseActionPress, Button: button})
+	}
+
+	chunk()
+	if !repl.autoscroll || !repl.viewport.AtBottom() {
+		t.Fatal("Expected the viewport to follow streamed output")
+	}
+
+	wheel(tea.MouseButtonWheelUp)
+	if repl.autoscroll {
+		t.Fatal("Expected scrolling up to stop following the output")
+	}
+	offset := repl.viewport.YOffset
+	chunk()
+	if repl.autoscroll || repl.viewport.YOffset != offset {
+		t.Errorf("YOffset = %d, want the scrolled up view kept at %d while streaming", repl.viewport.YOffset, offset)
+	}
+
+	for i := 0; i < 10 && !repl.viewport.AtBottom(); i++ {
+		wheel(tea.MouseButtonWheelDown)
+	}
+	if !repl.autoscroll {
+		t.Fatal("Expected scrolling back to the bottom to follow the output again")
+	}
+	chunk()
+	if !repl.viewport.AtBottom() {
+		t.Error("Expected new output to keep the viewport at the bottom")
+	}
+}
+
+func TestREPLScreen_ConfirmLargePrompt(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil, WithConfirmThreshold(2000))
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+
+	large := strings.TrimSpace(strings.Repeat("lorem ipsum ", 1000))
+	if _, confirm := repl.needsConfirmation("hi"); confirm {
+		t.Error("Expected a short prompt not to need confirmation")
+	}
+
+	repl.input.SetValue(large)
+	repl.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if len(s.GetState().Context.Messages) != 0 {
+		t.Fatal("Expected a large prompt not to be sent on the first enter")
+	}
+	if !strings.Contains(repl.viewport.View(), "Press enter again") {
+		t.Error("Expected the confirmation hint to be shown")
+	}
+	if repl.input.Value() != large {
+		t.Error("Expected the prompt to stay in the input while confirming")
+	}
+	if _, confirm := repl.needsConfirmation(large); confirm {
+		t.Error("Expected the pending prompt to be confirmed by a second enter")
+	}
+
+	repl.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if _, confirm := repl.needsConfirmation(large); !confirm {
+		t.Error("Expected esc to cancel the pending confirmation")
+	}
+}
+
+func TestREPLScreen_ProviderParams(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+
+	s.Dispatch(ChangeProviderAction{Provider: "lmstudio", Params: state.ModelParams{Temperature: state.Float(0.8)}})
+	if req := chatRequest(s.GetState()); paramText(req.Temperature) != "0.8" || req.MaxTokens != 0 {
+		t.Errorf("lmstudio request params = (%s, %v), want (0.8, 0)", paramText(req.Temperature), req.MaxTokens)
+	}
+
+	s.Dispatch(ChangeProviderAction{Provider: "claude", Params: state.ModelParams{Temperature: state.Float(0.2), MaxTokens: 1024}})
+	if req := chatRequest(s.GetState()); paramText(req.Temperature) != "0.2" || req.MaxTokens != 1024 {
+		t.Errorf("claude request params = (%s, %v), want (0.2, 1024)", paramText(req.Temperature), req.MaxTokens)
+	}
+
+	// explicit overrides win, and survive switching providers
+	repl.handleCommand(":set temperature 0.5")
+	repl.handleCommand(":set top_p 0.9")
+	s.Dispatch(ChangeProviderAction{Provider: "lmstudio", Params: state.ModelParams{Temperature: state.Float(0.8)}})
+	req := chatRequest(s.GetState())
+	if paramText(req.Temperature) != "0.5" || paramText(req.TopP) != "0.9" {
+		t.Errorf("overridden request params = (%s, %s), want (0.5, 0.9)", paramText(req.Temperature), paramText(req.TopP))
+	}
+
+	repl.handleCommand(":set temperature 3")
+	if got := paramText(s.GetState().Model.Overrides.Temperature); got != "0.5" {
+		t.Errorf("out of range temperature was applied, override = %s", got)
+	}
+
+	// 0 is a temperature of its own, not the same as going back to the default
+	repl.handleCommand(":set temperature 0")
+	if req := chatRequest(s.GetState()); paramText(req.Temperature) != "0" {
+		t.Errorf("zero temperature = %s, want 0", paramText(req.Temperature))
+	}
+
+	repl.handleCommand(":set temperature default")
+	if req := chatRequest(s.GetState()); paramText(req.Temperature) != "0.8" {
+		t.Errorf("reset temperature = %s, want provider default 0.8", paramText(req.Temperature))
+	}
+}
+
+func TestREPLScreen_ModeCycleKey(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+	repl.input.SetValue("half typed")
+
+	want := []state.Mode{state.ExecuteMode, state.YoloMode, state.PlanMode, state.ExecuteMode}
+	for _, mode := range want {
+		repl.Update(tea.KeyMsg{Type: tea.KeyShiftTab})
+		if got := s.GetState().Context.Mode; got != mode {
+			t.Fatalf("Mode = %q, want %q", got, mode)
+		}
+	}
+
+	if repl.input.Value() != "half typed" {
+		t.Errorf("input = %q, the cycle key should not touch the text input", repl.input.Value())
+	}
+	if !strings.Contains(repl.View(), "mode: execute") {
+		t.Error("Expected the footer to show the current mode")
+	}
+
+	repl.handleCommand(":mode yolo")
+	if got := s.GetState().Context.Mode; got != state.YoloMode {
+		t.Errorf("Mode = %q after :mode yolo, want %q", got, state.YoloMode)
+	}
+	if !strings.Contains(repl.viewport.View(), "Switched to yolo mode") {
+		t.Error("Expected :mode to echo the new mode")
+	}
+	repl.handleCommand(":mode reckless")
+	if got := s.GetState().Context.Mode; got != state.YoloMode {
+		t.Errorf("Mode = %q after an unknown mode, want it unchanged", got)
+	}
+	if !strings.Contains(repl.viewport.View(), "Unknown mode: reckless") {
+		t.Error("Expected an unknown mode to be reported")
+	}
+}
+
+func TestREPLScreen_PermissionCommands(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+
+	repl.handleCommand(":allow")
+	if !strings.Contains(repl.viewport.View(), "everything not denied") {
+		t.Error("Expected :allow without a pattern to list the rules")
+	}
+
+	repl.handleCommand(":allow git *")
+	repl.handleCommand(":deny git push")
+
+	p := s.GetState().Permissions
+	if len(p.Allow) != 1 || p.Allow[0] != "git *" {
+		t.Errorf("Allow = %q, want [git *]", p.Allow)
+	}
+	if len(p.Deny) != 1 || p.Deny[0] != "git push" {
+		t.Errorf("Deny = %q, want [git push]", p.Deny)
+	}
+	if !strings.Contains(repl.viewport.View(), "git push") {
+		t.Error("Expected :deny to list the updated rules")
+	}
+}
+
+func TestREPLScreen_ShowsActionErrors(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	oldState := s.GetState()
+	s.Dispatch(SetPersonaAction{Name: ""})
+	newState := s.GetState()
+
+	msg := repl.OnStateChange(SetPersonaAction{}, newState, oldState)
+	repl.Update(msg)
+	if !strings.Contains(repl.View(), "persona name cannot be empty") {
+		t.Error("Expected the failed action to be shown in the status line")
+	}
+
+	repl.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if strings.Contains(repl.View(), "persona name cannot be empty") {
+		t.Error("Expected the error to clear once the user sends new input")
+	}
+}
+
+func TestREPLScreen_ClearsActionErrorsWithTheState(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	oldState := s.GetState()
+	s.Dispatch(ChatCompletionCompletedAction{Error: errors.New("connection reset")})
+	repl.Update(repl.OnStateChange(ChatCompletionCompletedAction{}, s.GetState(), oldState))
+	if !strings.Contains(repl.View(), "connection reset") {
+		t.Fatal("Expected the failed completion to be shown in the status line")
+	}
+
+	oldState = s.GetState()
+	s.Dispatch(ChatCompletionStartedAction{})
+	repl.Update(repl.OnStateChange(ChatCompletionStartedAction{}, s.GetState(), oldState))
+	if strings.Contains(repl.View(), "connection reset") {
+		t.Error("Expected the error to clear once the next completion starts")
+	}
+}
+
+func TestREPLScreen_GlamourStyleEnvOverridesTheme(t *testing.T) {
+	if CurrentTheme().GlamourStyle() == "light" {
+		t.Fatal("test expects the default theme to use a style other than light")
+	}
+
+	t.Setenv(GlamourStyleEnv, "light")
+	repl := NewREPL(state.NewMemoryState("Test prompt", "/test", "test"), nil)
+	if repl.glamourStyle != "light" {
+		t.Errorf("glamourStyle = %q, want the %s override %q", repl.glamourStyle, GlamourStyleEnv, "light")
+	}
+
+	t.Setenv(GlamourStyleEnv, "")
+	repl = NewREPL(state.NewMemoryState("Test prompt", "/test", "test"), nil)
+	if want := CurrentTheme().GlamourStyle(); repl.glamourStyle != want {
+		t.Errorf("glamourStyle = %q, want the theme's style %q", repl.glamourStyle, want)
+	}
+}
+
+func TestResolveGlamourStyle_InvalidFallsBack(t *testing.T) {
+	theme := NewLightTheme()
+	style, err := ResolveGlamourStyle(theme, "not-a-style")
+	if err == nil {
+		t.Error("Expected an error for an unknown style")
+	}
+	if style != theme.GlamourStyle() {
+		t.Errorf("style = %q, want the theme's style %q", style, theme.GlamourStyle())
+	}
+}
+
+func TestREPLScreen_StreamErrorStillCompletes(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	oldState := s.GetState()
+	action := ChatCompletionCompletedAction{Error: errors.New("connection reset")}
+	s.Dispatch(action)
+
+	msg := repl.OnStateChange(action, s.GetState(), oldState)
+	_, cmd := repl.Update(msg)
+	if cmd == nil {
+		t.Error("Expected the completion to be handled and stop the stopwatch")
+	}
+	if !strings.Contains(repl.View(), "connection reset") {
+		t.Error("Expected the stream error to be shown in the status line")
+	}
+}
+
+func TestREPLScreen_SaveAndExport(t *testing.T) {
+	dir := t.TempDir()
+	s := state.NewMemoryState("Test prompt", dir, "abc123")
+	asked := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "hello", Timestamp: asked})
+	s.Dispatch(MessageAction{Role: state.RoleAssistant, Content: "hi there", Timestamp: asked})
+
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	// defaults to session-<id> in the working directory
+	repl.handleCommand(":save")
+	data, err := os.ReadFile(filepath.Join(dir, "session-abc123.json"))
+	if err != nil {
+		t.Fatalf(":save did not write the default file: %v", err)
+	}
+	var saved []state.Message
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved) != 2 || saved[1].Content != "hi there" {
+		t.Errorf("saved conversation = %+v, %v", saved, err)
+	}
+	if !strings.Contains(repl.viewport.View(), "Saved 2 message(s)") {
+		t.Error("Expected a confirmation in the viewport")
+	}
+
+	repl.handleCommand(":export notes/chat.md")
+	if !strings.Contains(repl.viewport.View(), "Could not save") {
+		t.Error("Expected an error when the directory doesn't exist")
+	}
+
+	repl.handleCommand(":export chat.md")
+	data, err = os.ReadFile(filepath.Join(dir, "chat.md"))
+	if err != nil {
+		t.Fatalf(":export did not write the file: %v", err)
+	}
+	md := string(data)
+	for _, want := range []string{"## user · 2025-01-02T03:04:05Z", "hello", "## assistant", "hi there"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("exported Markdown is missing %q:\n%s", want, md)
+		}
+	}
+}
+
+// modelsProvider lists a fixed set of models
+type modelsProvider struct {
+	streamProvider
+	models []string
+}
+
+func (p *modelsProvider) Models(ctx context.Context) ([]string, error) {
+	return p.models, nil
+}
+
+func TestREPLScreen_ModelCommand(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	s.Dispatch(ChangeProviderAction{Provider: "ollama", Name: "llama3.2", Params: state.ModelParams{Temperature: state.Float(0.8)}})
+
+	repl := NewREPL(s, &modelsProvider{models: []string{"llama3.2", "qwen2.5-coder"}})
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	_, cmd := repl.handleCommand(":model")
+	if cmd == nil {
+		t.Fatal("Expected :model to list models asynchronously")
+	}
+	repl.Update(cmd())
+	view := repl.viewport.View()
+	if !strings.Contains(view, "* llama3.2") || !strings.Contains(view, "qwen2.5-coder") {
+		t.Errorf("Expected the models with the active one marked, got:\n%s", view)
+	}
+
+	repl.handleCommand(":model qwen2.5-coder")
+	got := s.GetState().Model
+	if got.Name != "qwen2.5-coder" || got.Provider != "ollama" || paramText(got.Params.Temperature) != "0.8" {
+		t.Errorf("Model = %+v, want qwen2.5-coder on ollama with its params kept", got)
+	}
+	if !strings.Contains(repl.View(), "ollama ~> qwen2.5-coder") {
+		t.Error("Expected the header to show the new model")
+	}
+
+	empty := NewREPL(s, &modelsProvider{})
+	empty.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	_, cmd = empty.handleCommand(":model")
+	empty.Update(cmd())
+	if !strings.Contains(empty.viewport.View(), "specify one with :model <name>") {
+		t.Error("Expected a hint to name the model when the provider lists none")
+	}
+}
+
+func TestREPLScreen_ThemeCommand(t *testing.T) {
+	t.Cleanup(func() {
+		_ = ThemeManagerInstance.SetTheme("retro")
+		refreshElementStyles()
+	})
+
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	repl.handleCommand(":theme")
+	if view := repl.viewport.View(); !strings.Contains(view, "* retro") || !strings.Contains(view, "light") {
+		t.Errorf("Expected the themes with the current one marked, got:\n%s", view)
+	}
+
+	before := CurrentTheme()
+	repl.handleCommand(":theme light")
+	if CurrentTheme() == before || ThemeManagerInstance.CurrentName() != "light" {
+		t.Fatalf("Expected :theme light to switch the theme, still on %q", ThemeManagerInstance.CurrentName())
+	}
+
+	// the dispatched action reaches the screen through the stack, so hand it over directly
+	repl.Update(SwitchThemeAction{Name: "light"})
+	if want := renderPrompt(">"); repl.input.Prompt != want {
+		t.Errorf("input prompt = %q, want it restyled to %q", repl.input.Prompt, want)
+	}
+
+	repl.handleCommand(":theme nope")
+	if ThemeManagerInstance.CurrentName() != "light" {
+		t.Error("Expected an unknown theme to leave the current theme alone")
+	}
+	if !strings.Contains(repl.viewport.View(), "Unknown theme: nope") {
+		t.Error("Expected an unknown theme to be reported")
+	}
+}
+
+func TestREPLScreen_GlamourStyleFollowsTheme(t *testing.T) {
+	t.Setenv(GlamourStyleEnv, "")
+	t.Cleanup(func() {
+		_ = ThemeManagerInstance.SetTheme("retro")
+		refreshElementStyles()
+	})
+
+	repl := NewREPL(state.NewMemoryState("Test prompt", "/test", "test"), nil)
+	if repl.glamourStyle != styles.DraculaStyle {
+		t.Errorf("glamourStyle = %q, want %q for the retro theme", repl.glamourStyle, styles.DraculaStyle)
+	}
+
+	repl.handleCommand(":theme light")
+	repl.Update(SwitchThemeAction{Name: "light"})
+	if repl.glamourStyle != styles.LightStyle {
+		t.Errorf("glamourStyle = %q, want %q after switching to the light theme", repl.glamourStyle, styles.LightStyle)
+	}
+}
+
+// BenchmarkREPLScreen_SetViewport renders a 50 message conversation while the last
+// message streams in. Compare the allocations of the cached and uncached runs.
+func BenchmarkREPLScreen_SetViewport(b *testing.B) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	for i := 0; i < 25; i++ {
+		s.Dispatch(MessageAction{Role: state.RoleUser, Content: fmt.Sprintf("question %d", i)})
+		s.Dispatch(MessageAction{Role: state.RoleAssistant, Content: fmt.Sprintf("## Answer %d\n\nSome `code` and a list:\n\n- one\n- two\n", i)})
+	}
+	streaming := s.GetState().Context.Messages[49].ID
+
+	for _, tc := range []struct {
+		name   string
+		cached bool
+	}{
+		{"cached", true},
+		{"uncached", false},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			repl := NewREPL(s, nil)
+			repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Dispatch(MessageChunkAction{Message: state.Message{ID: streaming, Role: state.RoleAssistant, Content: " more"}})
+				if !tc.cached {
+					repl.renderer = nil
+				}
+				repl.setViewport()
+			}
+		})
+	}
+}
+
+func TestREPLScreen_RenderCache(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "hello"})
+	s.Dispatch(MessageAction{Role: state.RoleAssistant, Content: "hi"})
+	assistant := s.GetState().Context.Messages[1].ID
+
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	renderer := repl.renderer
+	if renderer == nil {
+		t.Fatal("Expected the renderer to be built on the first render")
+	}
+
+	s.Dispatch(MessageChunkAction{Message: state.Message{ID: assistant, Role: state.RoleAssistant, Content: " there"}})
+	repl.setViewport()
+	if repl.renderer != renderer {
+		t.Error("Expected the renderer to be reused while the width is unchanged")
+	}
+	cached := repl.renderCache[string(state.RoleAssistant)+":"+assistant]
+	if cached.content != "hi there" || !strings.Contains(cached.body, "there") {
+		t.Errorf("cached = %+v, want the streamed message re-rendered", cached)
+	}
+
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+	if repl.renderer == renderer {
+		t.Error("Expected a width change to rebuild the renderer")
+	}
+}
+
+func TestREPLScreen_ToolApprovalKeys(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	// keys only answer while a call is waiting
+	repl.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	if repl.input.Value() != "y" {
+		t.Errorf("input = %q, want y typed normally with nothing pending", repl.input.Value())
+	}
+	repl.input.Reset()
+
+	call := state.ToolCall{ID: "call_1", Function: state.ToolCallFunction{Name: "write_file", Arguments: `{"path":"a.txt"}`}}
+	s.Dispatch(ToolApprovalRequestedAction{ToolCall: call})
+	if !strings.Contains(repl.View(), "run write_file") {
+		t.Error("Expected the pending tool call to be shown")
+	}
+
+	answered := make(chan bool, 1)
+	go func() { answered <- repl.approveToolCall(context.Background(), call) }()
+
+	repl.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	select {
+	case approved := <-answered:
+		if !approved {
+			t.Error("Expected y to approve the tool call")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the approval")
+	}
+	if repl.input.Value() != "" {
+		t.Errorf("input = %q, want the answer kept out of the input", repl.input.Value())
+	}
+}
+
+func TestREPLScreen_PlanApproval(t *testing.T) {
+	s := state.NewMemoryStateWithOptions("Test prompt", "/test", "test", state.WithSyncListeners())
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	plan := []state.ToolCall{
+		{ID: "call_1", Function: state.ToolCallFunction{Name: "write_file", Arguments: `{"path":"a.txt"}`}},
+		{ID: "call_2", Function: state.ToolCallFunction{Name: "run_command", Arguments: `{"command":"make"}`}},
+	}
+
+	for _, key := range []string{"y", "n"} {
+		var answer state.Action
+		unsubscribe := s.OnStateChange(func(a state.Action, _, _ state.AppState) {
+			switch a.(type) {
+			case ApprovePlanAction, RejectPlanAction:
+				answer = a
+			}
+		})
+
+		s.Dispatch(PlanProposedAction{ToolCalls: plan})
+		repl.Update(PlanProposedAction{ToolCalls: plan})
+		view := repl.View()
+		if !strings.Contains(view, "1. write_file") || !strings.Contains(view, "2. run_command") || !strings.Contains(view, "[y/n]") {
+			t.Errorf("Expected the plan to be shown in order, got:\n%s", view)
+		}
+
+		repl.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)})
+		unsubscribe()
+
+		want := state.Action(ApprovePlanAction{})
+		if key == "n" {
+			want = RejectPlanAction{}
+		}
+		if answer != want {
+			t.Errorf("%s answered the plan with %T, want %T", key, answer, want)
+		}
+		if s.GetState().Status.PendingPlan != nil {
+			t.Errorf("Expected %s to clear the pending plan", key)
+		}
+		if repl.input.Value() != "" {
+			t.Errorf("input = %q, want the answer kept out of the input", repl.input.Value())
+		}
+	}
+}
+
+func TestHistoryText(t *testing.T) {
+	at := func(hour, min int) time.Time { return time.Date(2024, 5, 1, hour, min, 0, 0, time.Local) }
+	messages := []state.Message{
+		{Role: state.RoleUser, Content: "What's the weather\nin   Paris?", Timestamp: at(9, 30)},
+		{Role: state.RoleAssistant, ToolCalls: []state.ToolCall{{ID: "1", Function: state.ToolCallFunction{Name: "get_weather", Arguments: `{"city":"Paris"}`}}}, Timestamp: at(9, 30)},
+		{Role: state.RoleTool, Content: "Sunny, 21C", ToolCalls: []state.ToolCall{{ID: "1"}}, Timestamp: at(9, 31)},
+		{Role: state.RoleAssistant, Content: strings.Repeat("sunny ", 15), Timestamp: at(9, 31)},
+		{Role: state.RoleUser, Content: "thanks"},
+	}
+
+	want := "#  time      role       message\n" +
+		"1  09:30:00  user       What's the weather in Paris?\n" +
+		"2  09:30:00  assistant  [called get_weather]\n" +
+		"3  09:31:00  tool       Sunny, 21C\n" +
+		"4  09:31:00  assistant  sunny sunny sunny sunny sunny sunny sunny sunny sunny sunny...\n" +
+		"5  -         user       thanks\n" +
+		"\nUsage: :history <n> to show a message in full\n"
+	if got := historyText(messages); got != want {
+		t.Errorf("historyText() =\n%s\nwant\n%s", got, want)
+	}
+	if got := historyText(nil); got != "No messages yet\n" {
+		t.Errorf("historyText(nil) = %q", got)
+	}
+
+	got, err := historyMessageText(messages, "2")
+	if want := "#2 assistant at 09:30:00\n\n\ncalled get_weather {\"city\":\"Paris\"}\n"; err != nil || got != want {
+		t.Errorf("historyMessageText(2) = %q, %v, want %q", got, err, want)
+	}
+	got, err = historyMessageText(messages, "1")
+	if want := "#1 user at 09:30:00\n\nWhat's the weather\nin   Paris?\n"; err != nil || got != want {
+		t.Errorf("historyMessageText(1) = %q, %v, want %q", got, err, want)
+	}
+	for _, n := range []string{"0", "6", "two"} {
+		if _, err := historyMessageText(messages, n); err == nil {
+			t.Errorf("historyMessageText(%s) should fail", n)
+		}
+	}
+
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+	s.Dispatch(MessageAction{Role: state.RoleUser, Content: "question"})
+
+	repl.handleCommand(":history 3")
+	if out := repl.viewport.View(); !strings.Contains(out, "no message 3, the conversation has 1") {
+		t.Errorf("Expected :history to reject a message that isn't there, got:\n%s", out)
+	}
+}
+
+func TestREPLScreen_ShowsActivity(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error":{"message":"overloaded"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"1","object":"chat.completion.chunk","model":"m","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	// without jitter the backoff before the second attempt is a full second, long enough to see
+	provider, err := llm.NewLMStudioProvider(llm.ProviderConfig{BaseURL: server.URL, DefaultModel: "m", MaxRetries: 3, DisableRetryJitter: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	repl := NewREPL(s, nil)
+	repl.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	if err := NewMessage(s, provider, state.RoleUser, "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s, view:\n%s", what, repl.View())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor("the retry beside the spinner", func() bool { return strings.Contains(repl.View(), "retrying (2/3)") })
+	waitFor("the completion to finish", func() bool { return !s.GetState().Model.Busy })
+	if strings.Contains(repl.View(), "retrying") {
+		t.Error("Expected the activity to go once the completion finished")
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want the failed stream retried once", got)
+	}
+}
+
+func TestREPLScreen_UserMarkdown(t *testing.T) {
+	pasted := "why does this fail?\n\n```go\nfunc main() { panic(\"boom\") }\n```"
+
+	for _, enabled := range []bool{false, true} {
+		s := state.NewMemoryState("Test prompt", "/test", "test")
+		s.Dispatch(MessageAction{Role: state.RoleUser, Content: pasted})
+		repl := NewREPL(s, nil, WithUserMarkdown(enabled))
+		repl.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+
+		out := repl.viewport.View()
+		if !strings.Contains(out, `"boom"`) {
+			t.Fatalf("user-markdown %v: expected the pasted code in the transcript, got:\n%s", enabled, out)
+		}
+		// glamour turns the fence into a code block, so the backticks are only left as typed
+		if fenced := strings.Contains(out, "```"); fenced == enabled {
+			t.Errorf("user-markdown %v: fence shown = %v, want %v:\n%s", enabled, fenced, !enabled, out)
+		}
+	}
+}
+
+func TestREPLScreen_NoColor(t *testing.T) {
+	withColor(t)
+
+	render := func() string {
+		s := state.NewMemoryState("Test prompt", "/test", "test")
+		s.Dispatch(MessageAction{Role: state.RoleUser, Content: "fix the greeting"})
+		s.Dispatch(MessageAction{Role: state.RoleAssistant, Content: "# Done\n\n**Changed** `main.go`:\n\n```go\nfmt.Println(\"hi\")\n```"})
+		s.Dispatch(MessageAction{Role: state.RoleTool, Content: "edited main.go\n--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,1 @@\n-hello\n+hi\n"})
+		repl := NewREPL(s, nil, WithUserMarkdown(true))
+		repl.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+		return repl.View()
+	}
+
+	if out := render(); !strings.Contains(out, "\x1b[") {
+		t.Fatalf("expected escape sequences with colors on, got:\n%s", out)
+	}
+
+	SetNoColor(true)
+	t.Cleanup(func() { SetNoColor(false) })
+
+	out := render()
+	if strings.Contains(out, "\x1b") {
+		t.Errorf("expected no escape sequences with colors off, got:\n%q", out)
+	}
+	for _, want := range []string{"fix the greeting", "Changed", "+hi"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the plain output, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestREPLScreen_ShutdownStopsTheAgent(t *testing.T) {
+	s := state.NewMemoryState("Test prompt", "/test", "test")
+	provider := &stallingProvider{streamProvider{chunks: []llm.ChatStreamChunk{{Delta: "partial"}}}}
+	repl := NewREPL(s, provider)
+
+	if err := repl.send("tell me a story"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.GetState().Model.Busy {
+		t.Fatal("expected the reply to be in flight")
+	}
+
+	repl.handleCommand(":quit")
+	if !repl.Shutdown(2 * time.Second) {
+		t.Fatal("Shutdown() timed out waiting for the agent to return")
+	}
+
+	if s.GetState().Model.Busy {
+		t.Error("expected the cancelled reply to have completed before Shutdown returned")
+	}
+
+	// with nothing in flight there's nothing to wait for
+	if !repl.Shutdown(time.Second) {
+		t.Error("Shutdown() with no agent running = false, want true")
+	}
+}
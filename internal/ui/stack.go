@@ -1,22 +1,73 @@
 package ui
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	"sync"
+
+	"github.com/adamveld12/tai/internal/state"
+	tea "github.com/charmbracelet/bubbletea"
+)
 
 // ScreenStack implements a stack of screens. It follows LIFO order.
 type ScreenStack struct {
 	root        Screen
 	screenStack []Screen
+	size        *tea.WindowSizeMsg
+
+	// dispatcher notifies each screen of state changes while it's on the stack,
+	// unsubscribe holds the funcs that stop it, one per entry in screenStack
+	dispatcher  state.Dispatcher
+	unsubscribe []func()
+
+	// mu guards screenStack, unsubscribe and program, state changes arrive on the
+	// dispatcher's goroutines
+	mu      sync.RWMutex
+	program MessageSink
+
+	// outbox holds the messages state changes mapped to until they're sent to the program,
+	// in order, by the one goroutine sending is set for. The listener only appends to it,
+	// so it never waits on the program, which may be in Update dispatching an action.
+	outboxMu sync.Mutex
+	outbox   []tea.Msg
+	sending  bool
+}
+
+// PushScreenMsg asks the stack to push a new screen on top of the active one
+type PushScreenMsg struct {
+	Screen Screen
+}
+
+// PopScreenMsg asks the stack to pop the active screen. Msg, when set, is
+// delivered to the screen that becomes active.
+type PopScreenMsg struct {
+	Msg tea.Msg
+}
+
+// pushScreen returns a command that pushes screen onto the stack
+func pushScreen(screen Screen) tea.Cmd {
+	return func() tea.Msg { return PushScreenMsg{Screen: screen} }
+}
+
+// popScreen returns a command that pops the active screen, handing result to the one below
+func popScreen(result tea.Msg) tea.Cmd {
+	return func() tea.Msg { return PopScreenMsg{Msg: result} }
 }
 
 // Push adds a screen to the top of the stack and returns the new stack size
 func (s *ScreenStack) Push(screen Screen) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.screenStack = append(s.screenStack, screen)
+	s.unsubscribe = append(s.unsubscribe, s.subscribe(len(s.screenStack)))
 	return len(s.screenStack)
 }
 
 // Pop removes and returns the top screen from the stack
 // Returns nil if the stack is empty
 func (s *ScreenStack) Pop() Screen {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if len(s.screenStack) == 0 {
 		return nil
 	}
@@ -24,22 +75,53 @@ func (s *ScreenStack) Pop() Screen {
 	// Get the last element
 	screen := s.screenStack[len(s.screenStack)-1]
 
-	// Remove it from the stack
+	// Remove it from the stack and stop its state change notifications
 	s.screenStack = s.screenStack[:len(s.screenStack)-1]
+	s.unsubscribe[len(s.unsubscribe)-1]()
+	s.unsubscribe = s.unsubscribe[:len(s.unsubscribe)-1]
 
 	return screen
 }
 
 // Clear removes all screens from the stack
 func (s *ScreenStack) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if len(s.screenStack) > 0 {
 		s.screenStack = make([]Screen, 0)
 	}
+	for _, unsubscribe := range s.unsubscribe {
+		unsubscribe()
+	}
+	s.unsubscribe = nil
+}
+
+// subscribe registers a listener for the screen at depth, 0 being the root, that
+// forwards state changes only while that screen is the active one. Notifications
+// already queued when a screen is popped are dropped by the same check.
+func (s *ScreenStack) subscribe(depth int) func() {
+	if s.dispatcher == nil {
+		return func() {}
+	}
+
+	return s.dispatcher.OnStateChange(func(action state.Action, newState, oldState state.AppState) {
+		s.mu.RLock()
+		active := len(s.screenStack) == depth
+		s.mu.RUnlock()
+
+		if active {
+			s.OnStateChange(action, newState, oldState)
+		}
+	})
 }
 
 // Active returns the top screen from the stack without removing it
 // Returns the root screen if the stack is empty
 func (s *ScreenStack) Active() Screen {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if len(s.screenStack) == 0 {
 		return s.root
 	}
@@ -57,9 +139,34 @@ func (s *ScreenStack) Init() tea.Cmd {
 
 // Update implements tea.Model interface
 func (s *ScreenStack) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case PushScreenMsg:
+		s.Push(msg.Screen)
+		cmds := []tea.Cmd{msg.Screen.Init()}
+		// the new screen hasn't seen a resize yet, so hand it the last known size
+		if s.size != nil {
+			_, cmd := msg.Screen.Update(*s.size)
+			cmds = append(cmds, cmd)
+		}
+		return s, tea.Batch(cmds...)
+	case PopScreenMsg:
+		s.Pop()
+		if msg.Msg == nil {
+			return s, nil
+		}
+		if active := s.Active(); active != nil {
+			_, cmd := active.Update(msg.Msg)
+			return s, cmd
+		}
+		return s, nil
+	case tea.WindowSizeMsg:
+		s.size = &msg
+	}
+
 	// Delegate to the active screen if it exists
 	if active := s.Active(); active != nil {
-		return active.Update(msg)
+		_, cmd := active.Update(msg)
+		return s, cmd
 	}
 
 	return s, nil
@@ -75,7 +182,67 @@ func (s *ScreenStack) View() string {
 	return "💩NOTHIN TO SEE HERE 💩"
 }
 
-// NewScreenStack creates a new screen stack
-func NewScreenStack(root Screen) *ScreenStack {
-	return &ScreenStack{root: root}
+// SetProgram sets where state change messages are sent. It's separate from
+// NewScreenStack because the program is built from the stack.
+func (s *ScreenStack) SetProgram(program MessageSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.program = program
+}
+
+// OnStateChange implements state.OnStateChangeHandler. It asks the active screen which
+// message the change maps to and queues it for the program, so screens only update on
+// Bubble Tea's loop and get the changes in the order they were made.
+func (s *ScreenStack) OnStateChange(action state.Action, newState, oldState state.AppState) {
+	active := s.Active()
+	if active == nil {
+		return
+	}
+
+	msg := active.OnStateChange(action, newState, oldState)
+	if msg == nil {
+		return
+	}
+
+	s.outboxMu.Lock()
+	s.outbox = append(s.outbox, msg)
+	start := !s.sending
+	s.sending = true
+	s.outboxMu.Unlock()
+
+	if start {
+		go s.sendOutbox()
+	}
+}
+
+// sendOutbox sends the queued messages to the program one at a time until none are left
+func (s *ScreenStack) sendOutbox() {
+	for {
+		s.outboxMu.Lock()
+		if len(s.outbox) == 0 {
+			s.sending = false
+			s.outboxMu.Unlock()
+			return
+		}
+		msg := s.outbox[0]
+		s.outbox = s.outbox[1:]
+		s.outboxMu.Unlock()
+
+		s.mu.RLock()
+		program := s.program
+		s.mu.RUnlock()
+
+		if program != nil {
+			program.Send(msg)
+		}
+	}
+}
+
+// NewScreenStack creates a new screen stack and registers it for d's state changes.
+// Each pushed screen gets its own listener, which is removed again when it's popped.
+func NewScreenStack(d state.Dispatcher, root Screen) *ScreenStack {
+	stack := &ScreenStack{root: root, dispatcher: d}
+	stack.subscribe(0)
+	return stack
 }
@@ -0,0 +1,249 @@
+package ui
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adamveld12/tai/internal/state"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// fakeProgram records the messages sent to it in place of a running tea.Program
+type fakeProgram struct {
+	mu   sync.Mutex
+	msgs []tea.Msg
+}
+
+func (p *fakeProgram) Send(msg tea.Msg) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.msgs = append(p.msgs, msg)
+}
+
+func (p *fakeProgram) received() []tea.Msg {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]tea.Msg(nil), p.msgs...)
+}
+
+func TestScreenStack_ForwardsStateChanges(t *testing.T) {
+	s := state.NewMemoryState("Test", "/test", "test")
+	stack := NewScreenStack(s, NewREPL(s, nil))
+
+	program := &fakeProgram{}
+	stack.SetProgram(program)
+
+	s.Dispatch(state.SetModeAction{Mode: state.ExecuteMode})
+
+	deadline := time.Now().Add(time.Second)
+	for len(program.received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	msgs := program.received()
+	if len(msgs) != 1 {
+		t.Fatalf("Expected 1 forwarded message, got %d", len(msgs))
+	}
+	if _, ok := msgs[0].(state.SetModeAction); !ok {
+		t.Errorf("Expected the dispatched action to be forwarded, got %T", msgs[0])
+	}
+}
+
+func TestScreenStack_DropsNilMessages(t *testing.T) {
+	s := state.NewMemoryState("Test", "/test", "test")
+	stack := NewScreenStack(nil, NewFilePicker("/test"))
+
+	program := &fakeProgram{}
+	stack.SetProgram(program)
+
+	// the picker maps every state change to nil, which must not reach the program
+	stack.OnStateChange(state.SetModeAction{Mode: state.ExecuteMode}, s.GetState(), s.GetState())
+
+	if msgs := program.received(); len(msgs) != 0 {
+		t.Errorf("Expected nil messages to be dropped, got %v", msgs)
+	}
+}
+
+// countingDispatcher tracks how many listeners are registered on the wrapped dispatcher
+type countingDispatcher struct {
+	state.Dispatcher
+	mu     sync.Mutex
+	active int
+}
+
+func (d *countingDispatcher) OnStateChange(listener state.OnStateChangeHandler) func() {
+	d.mu.Lock()
+	d.active++
+	d.mu.Unlock()
+
+	unsubscribe := d.Dispatcher.OnStateChange(listener)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.mu.Lock()
+			d.active--
+			d.mu.Unlock()
+			unsubscribe()
+		})
+	}
+}
+
+func (d *countingDispatcher) listeners() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.active
+}
+
+func TestScreenStack_PopUnsubscribes(t *testing.T) {
+	s := state.NewMemoryState("Test", "/test", "test")
+	d := &countingDispatcher{Dispatcher: s}
+	stack := NewScreenStack(d, NewREPL(s, nil))
+
+	program := &fakeProgram{}
+	stack.SetProgram(program)
+
+	stack.Push(NewFilePicker("/test"))
+	stack.Push(NewFilePicker("/test"))
+	if got := d.listeners(); got != 3 {
+		t.Fatalf("Expected a listener for the root and each pushed screen, got %d", got)
+	}
+
+	stack.Pop()
+	if got := d.listeners(); got != 2 {
+		t.Errorf("Expected Pop to unsubscribe the popped screen, got %d listeners", got)
+	}
+	stack.Clear()
+	if got := d.listeners(); got != 1 {
+		t.Errorf("Expected Clear to leave only the root listener, got %d", got)
+	}
+
+	// the root is active again and is the only screen still forwarding changes
+	s.Dispatch(state.SetModeAction{Mode: state.ExecuteMode})
+
+	deadline := time.Now().Add(time.Second)
+	for len(program.received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if msgs := program.received(); len(msgs) != 1 {
+		t.Errorf("Expected 1 forwarded message, got %d", len(msgs))
+	}
+}
+
+// loopProgram hands sent messages to a goroutine standing in for Bubble Tea's loop
+type loopProgram chan tea.Msg
+
+func (p loopProgram) Send(msg tea.Msg) {
+	p <- msg
+}
+
+func TestScreenStack_ConcurrentStateChanges(t *testing.T) {
+	s := state.NewMemoryState("Test", "/test", "test")
+	stack := NewScreenStack(s, NewREPL(s, nil))
+
+	program := make(loopProgram)
+	stack.SetProgram(program)
+	stack.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+
+	const dispatchers, perDispatcher = 8, 25
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// only the loop updates and renders the screens, like a running program
+		for i := 0; i < dispatchers*perDispatcher; i++ {
+			stack.Update(<-program)
+			stack.View()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for d := 0; d < dispatchers; d++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perDispatcher; i++ {
+				switch i % 3 {
+				case 0:
+					s.Dispatch(MessageAction{Role: state.RoleUser, Content: "status"})
+				case 1:
+					s.Dispatch(state.SetModeAction{Mode: state.Modes[i%len(state.Modes)]})
+				default:
+					s.Dispatch(ChatCompletionCompletedAction{})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for every state change to reach the loop")
+	}
+
+	if got := len(s.GetState().Context.Messages); got != dispatchers*((perDispatcher+2)/3) {
+		t.Errorf("Expected every message to be recorded, got %d", got)
+	}
+}
+
+func TestScreenStack_ForwardsInOrder(t *testing.T) {
+	s := state.NewMemoryState("Test", "/test", "test")
+	stack := NewScreenStack(s, NewREPL(s, nil))
+
+	program := &fakeProgram{}
+	stack.SetProgram(program)
+
+	const chunks = 100
+	s.Dispatch(ChatCompletionStartedAction{})
+	for i := 0; i < chunks; i++ {
+		s.Dispatch(AgentStatusAction{Activity: fmt.Sprintf("step %d", i)})
+	}
+	s.Dispatch(ChatCompletionCompletedAction{})
+
+	deadline := time.Now().Add(time.Second)
+	for len(program.received()) < chunks+2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	msgs := program.received()
+	if len(msgs) != chunks+2 {
+		t.Fatalf("Expected %d forwarded messages, got %d", chunks+2, len(msgs))
+	}
+	if _, ok := msgs[0].(ChatCompletionStartedAction); !ok {
+		t.Errorf("Expected the completion to start first, got %T", msgs[0])
+	}
+	for i, msg := range msgs[1 : chunks+1] {
+		if a, ok := msg.(AgentStatusAction); !ok || a.Activity != fmt.Sprintf("step %d", i) {
+			t.Fatalf("message %d = %#v, want step %d", i+1, msg, i)
+		}
+	}
+	if _, ok := msgs[chunks+1].(ChatCompletionCompletedAction); !ok {
+		t.Errorf("Expected the completion to finish last, got %T", msgs[chunks+1])
+	}
+}
+
+func TestScreenStack_DispatchWhileProgramBusy(t *testing.T) {
+	s := state.NewMemoryState("Test", "/test", "test")
+	stack := NewScreenStack(s, NewREPL(s, nil))
+
+	// nothing reads from the program, like Bubble Tea's loop while it's in Update
+	program := make(loopProgram)
+	stack.SetProgram(program)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			s.Dispatch(AgentStatusAction{Activity: "busy"})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Dispatch blocked on a program that wasn't reading its messages")
+	}
+}
@@ -3,9 +3,18 @@ package ui
 import (
 	"fmt"
 
+	"github.com/charmbracelet/glamour/styles"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
+// GlamourStyleEnv overrides the glamour style used to render markdown, so tai can
+// follow the same dotfile-driven theming as other terminal tools
+const GlamourStyleEnv = "TAI_GLAMOUR_STYLE"
+
+// NoColorEnv turns off colors and text styling when it's set to anything, see https://no-color.org
+const NoColorEnv = "NO_COLOR"
+
 // Theme defines the interface for color themes
 type Theme interface {
 	// Core colors
@@ -28,6 +37,9 @@ type Theme interface {
 	Highlight() lipgloss.Color
 	Selection() lipgloss.Color
 
+	// GlamourStyle is the standard glamour style markdown is rendered with
+	GlamourStyle() string
+
 	// Get pre-configured styles
 	Styles() *ThemeStyles
 }
@@ -58,6 +70,11 @@ func (t *BaseTheme) Styles() *ThemeStyles {
 	return t.styles
 }
 
+// GlamourStyle defaults to glamour's dark style, themes override it to match their palette
+func (t *BaseTheme) GlamourStyle() string {
+	return styles.DarkStyle
+}
+
 // buildStyles creates all the pre-configured styles for a theme
 func buildStyles(theme Theme) *ThemeStyles {
 	return &ThemeStyles{
@@ -143,6 +160,7 @@ func (t *RetroTheme) Info() lipgloss.Color       { return lipgloss.Color("#02839
 func (t *RetroTheme) Border() lipgloss.Color     { return lipgloss.Color("#028391") } // Teal
 func (t *RetroTheme) Highlight() lipgloss.Color  { return lipgloss.Color("#FAA698") } // Peach
 func (t *RetroTheme) Selection() lipgloss.Color  { return lipgloss.Color("#02356B") } // Slightly lighter navy
+func (t *RetroTheme) GlamourStyle() string       { return styles.DraculaStyle }
 
 // DarkTheme implements a dark purple theme
 type DarkTheme struct {
@@ -169,6 +187,7 @@ func (t *DarkTheme) Info() lipgloss.Color       { return lipgloss.Color("#63B3ED
 func (t *DarkTheme) Border() lipgloss.Color     { return lipgloss.Color("#553C9A") } // Purple
 func (t *DarkTheme) Highlight() lipgloss.Color  { return lipgloss.Color("#9F7AEA") } // Medium light purple
 func (t *DarkTheme) Selection() lipgloss.Color  { return lipgloss.Color("#44337A") } // Dark purple
+func (t *DarkTheme) GlamourStyle() string       { return styles.DraculaStyle }
 
 // LightTheme implements Solarized Light color scheme
 type LightTheme struct {
@@ -195,13 +214,36 @@ func (t *LightTheme) Info() lipgloss.Color       { return lipgloss.Color("#2aa19
 func (t *LightTheme) Border() lipgloss.Color     { return lipgloss.Color("#93a1a1") } // Base1
 func (t *LightTheme) Highlight() lipgloss.Color  { return lipgloss.Color("#586e75") } // Base01
 func (t *LightTheme) Selection() lipgloss.Color  { return lipgloss.Color("#eee8d5") } // Base2
+func (t *LightTheme) GlamourStyle() string       { return styles.LightStyle }
+
+// ResolveGlamourStyle picks the glamour style for markdown: override when it names a
+// standard glamour style, otherwise the theme's own. An unknown override returns an
+// error alongside the theme's style so the caller can warn and carry on.
+func ResolveGlamourStyle(theme Theme, override string) (string, error) {
+	if noColor {
+		return styles.NoTTYStyle, nil
+	}
+	if override == "" {
+		return theme.GlamourStyle(), nil
+	}
+
+	if _, ok := styles.DefaultStyles[override]; !ok {
+		return theme.GlamourStyle(), fmt.Errorf("unknown glamour style %q, using %q", override, theme.GlamourStyle())
+	}
+
+	return override, nil
+}
 
 // ThemeManager manages the current theme
 type ThemeManager struct {
-	current Theme
-	themes  map[string]Theme
+	current     Theme
+	currentName string
+	themes      map[string]Theme
 }
 
+// DefaultTheme is the theme tai starts with
+const DefaultTheme = "retro"
+
 // NewThemeManager creates a new theme manager with all available themes
 func NewThemeManager() *ThemeManager {
 	tm := &ThemeManager{
@@ -214,7 +256,8 @@ func NewThemeManager() *ThemeManager {
 	tm.themes["light"] = NewLightTheme()
 
 	// Set default theme
-	tm.current = tm.themes["retro"]
+	tm.current = tm.themes[DefaultTheme]
+	tm.currentName = DefaultTheme
 
 	return tm
 }
@@ -232,9 +275,15 @@ func (tm *ThemeManager) SetTheme(name string) error {
 	}
 
 	tm.current = theme
+	tm.currentName = name
 	return nil
 }
 
+// CurrentName returns the name of the current theme
+func (tm *ThemeManager) CurrentName() string {
+	return tm.currentName
+}
+
 // ListThemes returns all available theme names
 func (tm *ThemeManager) ListThemes() []string {
 	names := make([]string, 0, len(tm.themes))
@@ -254,5 +303,45 @@ func CurrentTheme() Theme {
 
 // Convenience function to get current theme styles
 func CurrentStyles() *ThemeStyles {
+	if noColor {
+		return plainStyles
+	}
 	return ThemeManagerInstance.Current().Styles()
 }
+
+// noColor is set by SetNoColor, colorProfile is the profile it replaced
+var (
+	noColor      bool
+	colorProfile termenv.Profile
+)
+
+// plainStyles are what CurrentStyles returns with colors off, they keep the padding and
+// borders that lay the REPL out but draw nothing else
+var plainStyles = &ThemeStyles{
+	Header:    lipgloss.NewStyle().Padding(0, 1),
+	Highlight: lipgloss.NewStyle().Padding(0, 1),
+	Border:    lipgloss.NewStyle().BorderStyle(lipgloss.RoundedBorder()),
+	CodeBlock: lipgloss.NewStyle().Padding(1).MarginTop(1).MarginBottom(1),
+	Input:     lipgloss.NewStyle().Padding(0, 1),
+}
+
+// SetNoColor turns colors and text styling off everywhere, the theme's styles are swapped
+// for plain ones, lipgloss renders no escape sequences and markdown uses glamour's notty
+// style. Turning it back on restores the terminal's color profile.
+func SetNoColor(enabled bool) {
+	if enabled == noColor {
+		return
+	}
+	if enabled {
+		colorProfile = lipgloss.ColorProfile()
+		lipgloss.SetColorProfile(termenv.Ascii)
+	} else {
+		lipgloss.SetColorProfile(colorProfile)
+	}
+	noColor = enabled
+}
+
+// NoColor reports whether colors were turned off with SetNoColor
+func NoColor() bool {
+	return noColor
+}